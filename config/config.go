@@ -3,17 +3,21 @@ package config
 import (
 	"io/ioutil"
 	"runtime"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
 
 // ConfYaml is config structure.
 type ConfYaml struct {
-	Core    SectionCore    			`yaml:"core"`
-	API     SectionAPI     			`yaml:"api"`
-	Apps 	map[string]SectionApp   `yaml:"apps"`
-	Log     SectionLog     			`yaml:"log"`
-	Stat    SectionStat    			`yaml:"stat"`
+	Core  SectionCore           `yaml:"core"`
+	API   SectionAPI            `yaml:"api"`
+	Auth  SectionAuth           `yaml:"auth"`
+	GRPC  SectionGRPC           `yaml:"grpc"`
+	Apps  map[string]SectionApp `yaml:"apps"`
+	Log   SectionLog            `yaml:"log"`
+	Stat  SectionStat           `yaml:"stat"`
+	Trace SectionTrace          `yaml:"trace"`
 }
 
 // SectionCore is sub section of config.
@@ -29,8 +33,22 @@ type SectionCore struct {
 	CertDir         string         `yaml:"cert_dir"`
 	KeyPath         string         `yaml:"key_path"`
 	HTTPProxy       string         `yaml:"http_proxy"`
+	ShutdownTimeout int64          `yaml:"shutdown_timeout"`
+	StatusTTL       int64          `yaml:"status_ttl"`
+	IdempotencyTTL  int64          `yaml:"idempotency_ttl"`
 	PID             SectionPID     `yaml:"pid"`
 	AutoTLS         SectionAutoTLS `yaml:"auto_tls"`
+	Queue           SectionQueue   `yaml:"queue"`
+}
+
+// SectionQueue is sub section of config.
+type SectionQueue struct {
+	Engine   string         `yaml:"engine"`
+	Instance string         `yaml:"instance"`
+	Redis    SectionRedis   `yaml:"redis"`
+	BoltDB   SectionBoltDB  `yaml:"boltdb"`
+	BuntDB   SectionBuntDB  `yaml:"buntdb"`
+	LevelDB  SectionLevelDB `yaml:"leveldb"`
 }
 
 // SectionAutoTLS support Let's Encrypt setting.
@@ -42,25 +60,97 @@ type SectionAutoTLS struct {
 
 // SectionAPI is sub section of config.
 type SectionAPI struct {
-	PushURI    string `yaml:"push_uri"`
-	StatGoURI  string `yaml:"stat_go_uri"`
-	StatAppURI string `yaml:"stat_app_uri"`
-	ConfigURI  string `yaml:"config_uri"`
-	SysStatURI string `yaml:"sys_stat_uri"`
-	MetricURI  string `yaml:"metric_uri"`
+	PushURI        string `yaml:"push_uri"`
+	StatGoURI      string `yaml:"stat_go_uri"`
+	StatAppURI     string `yaml:"stat_app_uri"`
+	ConfigURI      string `yaml:"config_uri"`
+	SysStatURI     string `yaml:"sys_stat_uri"`
+	MetricURI      string `yaml:"metric_uri"`
+	CertReloadURI  string `yaml:"cert_reload_uri"`
+	FeedbackURI    string `yaml:"feedback_uri"`
+	FeedbackAckURI string `yaml:"feedback_ack_uri"`
+	KeyURI         string `yaml:"key_uri"`
+	ScheduleURI    string `yaml:"schedule_uri"`
+	TemplateURI    string `yaml:"template_uri"`
+	DeviceURI      string `yaml:"device_uri"`
+}
+
+// SectionGRPC is sub section of config.
+type SectionGRPC struct {
+	Enabled bool   `yaml:"enabled"`
+	Port    string `yaml:"port"`
+}
+
+// SectionAuth is sub section of config.
+type SectionAuth struct {
+	Enabled bool            `yaml:"enabled"`
+	Storage bool            `yaml:"storage"`
+	Keys    []SectionAPIKey `yaml:"keys"`
+}
+
+// SectionAPIKey is api key of auth section.
+type SectionAPIKey struct {
+	ID     string   `yaml:"id"`
+	Key    string   `yaml:"key" secret:"true"`
+	Apps   []string `yaml:"apps"`
+	Scopes []string `yaml:"scopes"`
 }
 
 // SectionApp is sub section of config
 type SectionApp struct {
-	Android    SectionAndroid `yaml:"android"`
-	AndroidFcm SectionAndroid `yaml:"android_fcm"`
-	Ios        SectionIos     `yaml:"ios"`
+	Android    SectionAndroid             `yaml:"android"`
+	AndroidFcm SectionAndroid             `yaml:"android_fcm"`
+	Ios        SectionIos                 `yaml:"ios"`
+	Retry      SectionRetry               `yaml:"retry"`
+	Callback   SectionCallback            `yaml:"callback"`
+	Templates  map[string]SectionTemplate `yaml:"templates"`
+}
+
+// SectionTemplate is named notification template with per-locale variants.
+type SectionTemplate struct {
+	DefaultLocale string                           `yaml:"default_locale" json:"default_locale,omitempty"`
+	Locales       map[string]SectionTemplateLocale `yaml:"locales" json:"locales"`
+}
+
+// SectionTemplateLocale is template content of one locale in Go
+// text/template syntax.
+type SectionTemplateLocale struct {
+	Title   string               `yaml:"title" json:"title,omitempty"`
+	Message string               `yaml:"message" json:"message,omitempty"`
+	Sound   string               `yaml:"sound" json:"sound,omitempty"`
+	Alert   SectionTemplateAlert `yaml:"alert" json:"alert,omitempty"`
+	Data    map[string]string    `yaml:"data" json:"data,omitempty"`
+}
+
+// SectionTemplateAlert is template content of iOS alert payload.
+type SectionTemplateAlert struct {
+	Title       string `yaml:"title" json:"title,omitempty"`
+	Subtitle    string `yaml:"subtitle" json:"subtitle,omitempty"`
+	Body        string `yaml:"body" json:"body,omitempty"`
+	Action      string `yaml:"action" json:"action,omitempty"`
+	LaunchImage string `yaml:"launch_image" json:"launch_image,omitempty"`
+}
+
+// SectionCallback is sub section of config.
+type SectionCallback struct {
+	URL       string `yaml:"url"`
+	Secret    string `yaml:"secret" secret:"true"`
+	BatchSize int    `yaml:"batch_size"`
+	MaxRetry  int    `yaml:"max_retry"`
+}
+
+// SectionRetry is sub section of config.
+type SectionRetry struct {
+	MaxRetry  int           `yaml:"max_retry"`
+	BaseDelay time.Duration `yaml:"base_delay"`
+	MaxDelay  time.Duration `yaml:"max_delay"`
+	Jitter    bool          `yaml:"jitter"`
 }
 
 // SectionAndroid is sub section of config.
 type SectionAndroid struct {
 	Enabled  bool   `yaml:"enabled"`
-	APIKey   string `yaml:"apikey"`
+	APIKey   string `yaml:"apikey" secret:"true"`
 	MaxRetry int    `yaml:"max_retry"`
 }
 
@@ -68,7 +158,10 @@ type SectionAndroid struct {
 type SectionIos struct {
 	Enabled    bool   `yaml:"enabled"`
 	KeyPath    string `yaml:"key_path"`
-	Password   string `yaml:"password"`
+	Password   string `yaml:"password" secret:"true"`
+	KeyID      string `yaml:"key_id"`
+	TeamID     string `yaml:"team_id"`
+	Topic      string `yaml:"topic"`
 	Production bool   `yaml:"production"`
 	MaxRetry   int    `yaml:"max_retry"`
 }
@@ -90,12 +183,28 @@ type SectionStat struct {
 	BoltDB  SectionBoltDB  `yaml:"boltdb"`
 	BuntDB  SectionBuntDB  `yaml:"buntdb"`
 	LevelDB SectionLevelDB `yaml:"leveldb"`
+	History SectionHistory `yaml:"history"`
+}
+
+// SectionHistory is sub section of config.
+type SectionHistory struct {
+	MinuteRetention int64 `yaml:"minute_retention"`
+	HourRetention   int64 `yaml:"hour_retention"`
+	DayRetention    int64 `yaml:"day_retention"`
+}
+
+// SectionTrace is sub section of config.
+type SectionTrace struct {
+	Enabled     bool   `yaml:"enabled"`
+	Exporter    string `yaml:"exporter"`
+	Endpoint    string `yaml:"endpoint"`
+	ServiceName string `yaml:"service_name"`
 }
 
 // SectionRedis is sub section of config.
 type SectionRedis struct {
 	Addr     string `yaml:"addr"`
-	Password string `yaml:"password"`
+	Password string `yaml:"password" secret:"true"`
 	DB       int    `yaml:"db"`
 }
 
@@ -138,6 +247,9 @@ func BuildDefaultPushConf() ConfYaml {
 	conf.Core.KeyPath = "key.pem"
 	conf.Core.MaxNotification = int64(100)
 	conf.Core.HTTPProxy = ""
+	conf.Core.ShutdownTimeout = int64(30)
+	conf.Core.StatusTTL = int64(86400)
+	conf.Core.IdempotencyTTL = int64(86400)
 	conf.Core.PID.Enabled = false
 	conf.Core.PID.Path = "gorush.pid"
 	conf.Core.PID.Override = false
@@ -145,6 +257,22 @@ func BuildDefaultPushConf() ConfYaml {
 	conf.Core.AutoTLS.Folder = ".cache"
 	conf.Core.AutoTLS.Host = ""
 
+	// Queue
+	conf.Core.Queue.Engine = "memory"
+	conf.Core.Queue.Instance = ""
+	conf.Core.Queue.Redis.Addr = "localhost:6379"
+	conf.Core.Queue.Redis.Password = ""
+	conf.Core.Queue.Redis.DB = 0
+	conf.Core.Queue.BoltDB.Path = "queue.bolt.db"
+	conf.Core.Queue.BoltDB.Bucket = "gorush-queue"
+	conf.Core.Queue.BuntDB.Path = "queue.bunt.db"
+	conf.Core.Queue.LevelDB.Path = "queue.level.db"
+
+	// Apps
+	conf.Apps = map[string]SectionApp{
+		"normal": BuildDefaultAppConf(),
+	}
+
 	// Api
 	conf.API.PushURI = "/api/push"
 	conf.API.StatGoURI = "/api/stat/go"
@@ -152,6 +280,22 @@ func BuildDefaultPushConf() ConfYaml {
 	conf.API.ConfigURI = "/api/config"
 	conf.API.SysStatURI = "/sys/stats"
 	conf.API.MetricURI = "/metrics"
+	conf.API.CertReloadURI = "/api/cert/reload"
+	conf.API.FeedbackURI = "/api/feedback"
+	conf.API.FeedbackAckURI = "/api/feedback/ack"
+	conf.API.KeyURI = "/api/keys"
+	conf.API.ScheduleURI = "/api/schedule"
+	conf.API.TemplateURI = "/api/templates"
+	conf.API.DeviceURI = "/api/devices"
+
+	// gRPC
+	conf.GRPC.Enabled = false
+	conf.GRPC.Port = "9000"
+
+	// Auth
+	conf.Auth.Enabled = false
+	conf.Auth.Storage = false
+	conf.Auth.Keys = []SectionAPIKey{}
 
 	// log
 	conf.Log.Format = "string"
@@ -172,9 +316,61 @@ func BuildDefaultPushConf() ConfYaml {
 	conf.Stat.BuntDB.Path = "bunt.db"
 	conf.Stat.LevelDB.Path = "level.db"
 
+	conf.Stat.History.MinuteRetention = int64(86400)
+	conf.Stat.History.HourRetention = int64(2592000)
+	conf.Stat.History.DayRetention = int64(31536000)
+
+	// Trace
+	conf.Trace.Enabled = false
+	conf.Trace.Exporter = "stdout"
+	conf.Trace.Endpoint = "http://localhost:4318/v1/traces"
+	conf.Trace.ServiceName = "gorush"
+
 	return conf
 }
 
+// BuildDefaultAppConf is default app setting.
+func BuildDefaultAppConf() SectionApp {
+	var app SectionApp
+
+	// Android
+	app.Android.Enabled = false
+	app.Android.APIKey = ""
+	app.Android.MaxRetry = 0
+
+	// Android FCM
+	app.AndroidFcm.Enabled = false
+	app.AndroidFcm.APIKey = ""
+	app.AndroidFcm.MaxRetry = 0
+
+	// iOS
+	app.Ios.Enabled = false
+	app.Ios.KeyPath = "key.pem"
+	app.Ios.Password = ""
+	app.Ios.KeyID = ""
+	app.Ios.TeamID = ""
+	app.Ios.Topic = ""
+	app.Ios.Production = false
+	app.Ios.MaxRetry = 0
+
+	// Retry
+	app.Retry.MaxRetry = 0
+	app.Retry.BaseDelay = 1 * time.Second
+	app.Retry.MaxDelay = 60 * time.Second
+	app.Retry.Jitter = true
+
+	// Callback
+	app.Callback.URL = ""
+	app.Callback.Secret = ""
+	app.Callback.BatchSize = 100
+	app.Callback.MaxRetry = 5
+
+	// Templates
+	app.Templates = map[string]SectionTemplate{}
+
+	return app
+}
+
 // LoadConfYaml provide load yml config.
 func LoadConfYaml(confPath string) (ConfYaml, error) {
 	var config ConfYaml
@@ -199,5 +395,35 @@ func LoadConfYaml(confPath string) (ConfYaml, error) {
 		config.Core.QueueNum = int64(8192)
 	}
 
+	if config.Core.ShutdownTimeout == int64(0) {
+		config.Core.ShutdownTimeout = int64(30)
+	}
+
+	if config.Apps == nil {
+		config.Apps = make(map[string]SectionApp)
+	}
+
+	// config of older version doesn't have uri of newer endpoints.
+	api := BuildDefaultPushConf().API
+	for uri, value := range map[*string]string{
+		&config.API.PushURI:        api.PushURI,
+		&config.API.StatGoURI:      api.StatGoURI,
+		&config.API.StatAppURI:     api.StatAppURI,
+		&config.API.ConfigURI:      api.ConfigURI,
+		&config.API.SysStatURI:     api.SysStatURI,
+		&config.API.MetricURI:      api.MetricURI,
+		&config.API.CertReloadURI:  api.CertReloadURI,
+		&config.API.FeedbackURI:    api.FeedbackURI,
+		&config.API.FeedbackAckURI: api.FeedbackAckURI,
+		&config.API.KeyURI:         api.KeyURI,
+		&config.API.ScheduleURI:    api.ScheduleURI,
+		&config.API.TemplateURI:    api.TemplateURI,
+		&config.API.DeviceURI:      api.DeviceURI,
+	} {
+		if *uri == "" {
+			*uri = value
+		}
+	}
+
 	return config, nil
 }
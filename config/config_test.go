@@ -6,6 +6,7 @@ import (
 	"os"
 	"runtime"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
@@ -38,6 +39,58 @@ func TestWrongYAMLormat(t *testing.T) {
 	assert.NotNil(t, err)
 }
 
+// Test config of older version without uri of newer endpoints
+func TestLoadOlderConfig(t *testing.T) {
+	content := []byte(`core:
+  port: "8088"
+  worker_num: 0
+  queue_num: 0
+  max_notification: 100
+  sync: true
+  mode: "release"
+
+api:
+  push_uri: "/api/push"
+  stat_go_uri: "/api/stat/go"
+  stat_app_uri: "/api/stat/app"
+  config_uri: "/api/config"
+  sys_stat_uri: "/sys/stats"
+  metric_uri: "/metrics"
+
+apps:
+  normal:
+    android:
+      enabled: true
+      apikey: "key"
+      max_retry: 3
+`)
+
+	filename := "tempfile"
+
+	if err := ioutil.WriteFile(filename, content, 0644); err != nil {
+		log.Fatalf("WriteFile %s: %v", filename, err)
+	}
+
+	// clean up
+	defer os.Remove(filename)
+
+	conf, err := LoadConfYaml(filename)
+	assert.NoError(t, err)
+
+	// queued notifications are waited for on shutdown.
+	assert.Equal(t, int64(30), conf.Core.ShutdownTimeout)
+
+	api := BuildDefaultPushConf().API
+	assert.Equal(t, "/api/push", conf.API.PushURI)
+	assert.Equal(t, api.CertReloadURI, conf.API.CertReloadURI)
+	assert.Equal(t, api.FeedbackURI, conf.API.FeedbackURI)
+	assert.Equal(t, api.FeedbackAckURI, conf.API.FeedbackAckURI)
+	assert.Equal(t, api.KeyURI, conf.API.KeyURI)
+	assert.Equal(t, api.ScheduleURI, conf.API.ScheduleURI)
+	assert.Equal(t, api.TemplateURI, conf.API.TemplateURI)
+	assert.Equal(t, api.DeviceURI, conf.API.DeviceURI)
+}
+
 type ConfigTestSuite struct {
 	suite.Suite
 	ConfGorushDefault ConfYaml
@@ -65,6 +118,9 @@ func (suite *ConfigTestSuite) TestValidateConfDefault() {
 	assert.Equal(suite.T(), "key.pem", suite.ConfGorushDefault.Core.KeyPath)
 	assert.Equal(suite.T(), int64(100), suite.ConfGorushDefault.Core.MaxNotification)
 	assert.Equal(suite.T(), "", suite.ConfGorushDefault.Core.HTTPProxy)
+	assert.Equal(suite.T(), int64(30), suite.ConfGorushDefault.Core.ShutdownTimeout)
+	assert.Equal(suite.T(), int64(86400), suite.ConfGorushDefault.Core.StatusTTL)
+	assert.Equal(suite.T(), int64(86400), suite.ConfGorushDefault.Core.IdempotencyTTL)
 	// Pid
 	assert.Equal(suite.T(), false, suite.ConfGorushDefault.Core.PID.Enabled)
 	assert.Equal(suite.T(), "gorush.pid", suite.ConfGorushDefault.Core.PID.Path)
@@ -73,6 +129,15 @@ func (suite *ConfigTestSuite) TestValidateConfDefault() {
 	assert.Equal(suite.T(), ".cache", suite.ConfGorushDefault.Core.AutoTLS.Folder)
 	assert.Equal(suite.T(), "", suite.ConfGorushDefault.Core.AutoTLS.Host)
 
+	// Queue
+	assert.Equal(suite.T(), "memory", suite.ConfGorushDefault.Core.Queue.Engine)
+	assert.Equal(suite.T(), "", suite.ConfGorushDefault.Core.Queue.Instance)
+	assert.Equal(suite.T(), "localhost:6379", suite.ConfGorushDefault.Core.Queue.Redis.Addr)
+	assert.Equal(suite.T(), "queue.bolt.db", suite.ConfGorushDefault.Core.Queue.BoltDB.Path)
+	assert.Equal(suite.T(), "gorush-queue", suite.ConfGorushDefault.Core.Queue.BoltDB.Bucket)
+	assert.Equal(suite.T(), "queue.bunt.db", suite.ConfGorushDefault.Core.Queue.BuntDB.Path)
+	assert.Equal(suite.T(), "queue.level.db", suite.ConfGorushDefault.Core.Queue.LevelDB.Path)
+
 	// Api
 	assert.Equal(suite.T(), "/api/push", suite.ConfGorushDefault.API.PushURI)
 	assert.Equal(suite.T(), "/api/stat/go", suite.ConfGorushDefault.API.StatGoURI)
@@ -80,18 +145,58 @@ func (suite *ConfigTestSuite) TestValidateConfDefault() {
 	assert.Equal(suite.T(), "/api/config", suite.ConfGorushDefault.API.ConfigURI)
 	assert.Equal(suite.T(), "/sys/stats", suite.ConfGorushDefault.API.SysStatURI)
 	assert.Equal(suite.T(), "/metrics", suite.ConfGorushDefault.API.MetricURI)
+	assert.Equal(suite.T(), "/api/cert/reload", suite.ConfGorushDefault.API.CertReloadURI)
+	assert.Equal(suite.T(), "/api/feedback", suite.ConfGorushDefault.API.FeedbackURI)
+	assert.Equal(suite.T(), "/api/feedback/ack", suite.ConfGorushDefault.API.FeedbackAckURI)
+	assert.Equal(suite.T(), "/api/keys", suite.ConfGorushDefault.API.KeyURI)
+	assert.Equal(suite.T(), "/api/schedule", suite.ConfGorushDefault.API.ScheduleURI)
+	assert.Equal(suite.T(), "/api/templates", suite.ConfGorushDefault.API.TemplateURI)
+	assert.Equal(suite.T(), "/api/devices", suite.ConfGorushDefault.API.DeviceURI)
+
+	// gRPC
+	assert.Equal(suite.T(), false, suite.ConfGorushDefault.GRPC.Enabled)
+	assert.Equal(suite.T(), "9000", suite.ConfGorushDefault.GRPC.Port)
+
+	// Auth
+	assert.Equal(suite.T(), false, suite.ConfGorushDefault.Auth.Enabled)
+	assert.Equal(suite.T(), false, suite.ConfGorushDefault.Auth.Storage)
+	assert.Equal(suite.T(), 0, len(suite.ConfGorushDefault.Auth.Keys))
+
+	// Apps
+	assert.Equal(suite.T(), 1, len(suite.ConfGorushDefault.Apps))
 
 	// Android
-	assert.Equal(suite.T(), false, suite.ConfGorushDefault.Android.Enabled)
-	assert.Equal(suite.T(), "", suite.ConfGorushDefault.Android.APIKey)
-	assert.Equal(suite.T(), 0, suite.ConfGorushDefault.Android.MaxRetry)
+	assert.Equal(suite.T(), false, suite.ConfGorushDefault.Apps["normal"].Android.Enabled)
+	assert.Equal(suite.T(), "", suite.ConfGorushDefault.Apps["normal"].Android.APIKey)
+	assert.Equal(suite.T(), 0, suite.ConfGorushDefault.Apps["normal"].Android.MaxRetry)
+
+	// Android FCM
+	assert.Equal(suite.T(), false, suite.ConfGorushDefault.Apps["normal"].AndroidFcm.Enabled)
+	assert.Equal(suite.T(), "", suite.ConfGorushDefault.Apps["normal"].AndroidFcm.APIKey)
+	assert.Equal(suite.T(), 0, suite.ConfGorushDefault.Apps["normal"].AndroidFcm.MaxRetry)
 
 	// iOS
-	assert.Equal(suite.T(), false, suite.ConfGorushDefault.Ios.Enabled)
-	assert.Equal(suite.T(), "key.pem", suite.ConfGorushDefault.Ios.KeyPath)
-	assert.Equal(suite.T(), "", suite.ConfGorushDefault.Ios.Password)
-	assert.Equal(suite.T(), false, suite.ConfGorushDefault.Ios.Production)
-	assert.Equal(suite.T(), 0, suite.ConfGorushDefault.Ios.MaxRetry)
+	assert.Equal(suite.T(), false, suite.ConfGorushDefault.Apps["normal"].Ios.Enabled)
+	assert.Equal(suite.T(), "key.pem", suite.ConfGorushDefault.Apps["normal"].Ios.KeyPath)
+	assert.Equal(suite.T(), "", suite.ConfGorushDefault.Apps["normal"].Ios.Password)
+	assert.Equal(suite.T(), false, suite.ConfGorushDefault.Apps["normal"].Ios.Production)
+	assert.Equal(suite.T(), "", suite.ConfGorushDefault.Apps["normal"].Ios.KeyID)
+	assert.Equal(suite.T(), "", suite.ConfGorushDefault.Apps["normal"].Ios.TeamID)
+	assert.Equal(suite.T(), "", suite.ConfGorushDefault.Apps["normal"].Ios.Topic)
+	assert.Equal(suite.T(), 0, suite.ConfGorushDefault.Apps["normal"].Ios.MaxRetry)
+
+	// Retry
+	assert.Equal(suite.T(), 0, suite.ConfGorushDefault.Apps["normal"].Retry.MaxRetry)
+	assert.Equal(suite.T(), time.Second, suite.ConfGorushDefault.Apps["normal"].Retry.BaseDelay)
+	assert.Equal(suite.T(), 60*time.Second, suite.ConfGorushDefault.Apps["normal"].Retry.MaxDelay)
+	assert.Equal(suite.T(), true, suite.ConfGorushDefault.Apps["normal"].Retry.Jitter)
+	assert.Equal(suite.T(), "", suite.ConfGorushDefault.Apps["normal"].Callback.URL)
+	assert.Equal(suite.T(), "", suite.ConfGorushDefault.Apps["normal"].Callback.Secret)
+	assert.Equal(suite.T(), 100, suite.ConfGorushDefault.Apps["normal"].Callback.BatchSize)
+	assert.Equal(suite.T(), 5, suite.ConfGorushDefault.Apps["normal"].Callback.MaxRetry)
+
+	// Templates
+	assert.Empty(suite.T(), suite.ConfGorushDefault.Apps["normal"].Templates)
 
 	// log
 	assert.Equal(suite.T(), "string", suite.ConfGorushDefault.Log.Format)
@@ -111,6 +216,16 @@ func (suite *ConfigTestSuite) TestValidateConfDefault() {
 
 	assert.Equal(suite.T(), "bunt.db", suite.ConfGorushDefault.Stat.BuntDB.Path)
 	assert.Equal(suite.T(), "level.db", suite.ConfGorushDefault.Stat.LevelDB.Path)
+
+	assert.Equal(suite.T(), int64(86400), suite.ConfGorushDefault.Stat.History.MinuteRetention)
+	assert.Equal(suite.T(), int64(2592000), suite.ConfGorushDefault.Stat.History.HourRetention)
+	assert.Equal(suite.T(), int64(31536000), suite.ConfGorushDefault.Stat.History.DayRetention)
+
+	// Trace
+	assert.Equal(suite.T(), false, suite.ConfGorushDefault.Trace.Enabled)
+	assert.Equal(suite.T(), "stdout", suite.ConfGorushDefault.Trace.Exporter)
+	assert.Equal(suite.T(), "http://localhost:4318/v1/traces", suite.ConfGorushDefault.Trace.Endpoint)
+	assert.Equal(suite.T(), "gorush", suite.ConfGorushDefault.Trace.ServiceName)
 }
 
 func (suite *ConfigTestSuite) TestValidateConf() {
@@ -119,12 +234,15 @@ func (suite *ConfigTestSuite) TestValidateConf() {
 	assert.Equal(suite.T(), int64(runtime.NumCPU()), suite.ConfGorush.Core.WorkerNum)
 	assert.Equal(suite.T(), int64(8192), suite.ConfGorush.Core.QueueNum)
 	assert.Equal(suite.T(), "release", suite.ConfGorush.Core.Mode)
-	assert.Equal(suite.T(), false, suite.ConfGorush.Core.Sync)
+	assert.Equal(suite.T(), true, suite.ConfGorush.Core.Sync)
 	assert.Equal(suite.T(), false, suite.ConfGorush.Core.SSL)
 	assert.Equal(suite.T(), "cert.pem", suite.ConfGorush.Core.CertPath)
 	assert.Equal(suite.T(), "key.pem", suite.ConfGorush.Core.KeyPath)
 	assert.Equal(suite.T(), int64(100), suite.ConfGorush.Core.MaxNotification)
 	assert.Equal(suite.T(), "", suite.ConfGorush.Core.HTTPProxy)
+	assert.Equal(suite.T(), int64(30), suite.ConfGorush.Core.ShutdownTimeout)
+	assert.Equal(suite.T(), int64(86400), suite.ConfGorush.Core.StatusTTL)
+	assert.Equal(suite.T(), int64(86400), suite.ConfGorush.Core.IdempotencyTTL)
 	// Pid
 	assert.Equal(suite.T(), false, suite.ConfGorush.Core.PID.Enabled)
 	assert.Equal(suite.T(), "gorush.pid", suite.ConfGorush.Core.PID.Path)
@@ -133,6 +251,15 @@ func (suite *ConfigTestSuite) TestValidateConf() {
 	assert.Equal(suite.T(), ".cache", suite.ConfGorush.Core.AutoTLS.Folder)
 	assert.Equal(suite.T(), "", suite.ConfGorush.Core.AutoTLS.Host)
 
+	// Queue
+	assert.Equal(suite.T(), "memory", suite.ConfGorush.Core.Queue.Engine)
+	assert.Equal(suite.T(), "", suite.ConfGorush.Core.Queue.Instance)
+	assert.Equal(suite.T(), "localhost:6379", suite.ConfGorush.Core.Queue.Redis.Addr)
+	assert.Equal(suite.T(), "queue.bolt.db", suite.ConfGorush.Core.Queue.BoltDB.Path)
+	assert.Equal(suite.T(), "gorush-queue", suite.ConfGorush.Core.Queue.BoltDB.Bucket)
+	assert.Equal(suite.T(), "queue.bunt.db", suite.ConfGorush.Core.Queue.BuntDB.Path)
+	assert.Equal(suite.T(), "queue.level.db", suite.ConfGorush.Core.Queue.LevelDB.Path)
+
 	// Api
 	assert.Equal(suite.T(), "/api/push", suite.ConfGorush.API.PushURI)
 	assert.Equal(suite.T(), "/api/stat/go", suite.ConfGorush.API.StatGoURI)
@@ -140,18 +267,60 @@ func (suite *ConfigTestSuite) TestValidateConf() {
 	assert.Equal(suite.T(), "/api/config", suite.ConfGorush.API.ConfigURI)
 	assert.Equal(suite.T(), "/sys/stats", suite.ConfGorush.API.SysStatURI)
 	assert.Equal(suite.T(), "/metrics", suite.ConfGorush.API.MetricURI)
+	assert.Equal(suite.T(), "/api/cert/reload", suite.ConfGorush.API.CertReloadURI)
+	assert.Equal(suite.T(), "/api/feedback", suite.ConfGorush.API.FeedbackURI)
+	assert.Equal(suite.T(), "/api/feedback/ack", suite.ConfGorush.API.FeedbackAckURI)
+	assert.Equal(suite.T(), "/api/keys", suite.ConfGorush.API.KeyURI)
+	assert.Equal(suite.T(), "/api/schedule", suite.ConfGorush.API.ScheduleURI)
+	assert.Equal(suite.T(), "/api/templates", suite.ConfGorush.API.TemplateURI)
+	assert.Equal(suite.T(), "/api/devices", suite.ConfGorush.API.DeviceURI)
+
+	// gRPC
+	assert.Equal(suite.T(), false, suite.ConfGorush.GRPC.Enabled)
+	assert.Equal(suite.T(), "9000", suite.ConfGorush.GRPC.Port)
+
+	// Auth
+	assert.Equal(suite.T(), false, suite.ConfGorush.Auth.Enabled)
+	assert.Equal(suite.T(), false, suite.ConfGorush.Auth.Storage)
+	assert.Equal(suite.T(), 0, len(suite.ConfGorush.Auth.Keys))
+
+	// Apps
+	assert.Equal(suite.T(), 2, len(suite.ConfGorush.Apps))
 
 	// Android
-	assert.Equal(suite.T(), true, suite.ConfGorush.Android.Enabled)
-	assert.Equal(suite.T(), "YOUR_API_KEY", suite.ConfGorush.Android.APIKey)
-	assert.Equal(suite.T(), 0, suite.ConfGorush.Android.MaxRetry)
+	assert.Equal(suite.T(), true, suite.ConfGorush.Apps["normal"].Android.Enabled)
+	assert.Equal(suite.T(), "key", suite.ConfGorush.Apps["normal"].Android.APIKey)
+	assert.Equal(suite.T(), 3, suite.ConfGorush.Apps["normal"].Android.MaxRetry)
+
+	// Android FCM
+	assert.Equal(suite.T(), true, suite.ConfGorush.Apps["normal"].AndroidFcm.Enabled)
+	assert.Equal(suite.T(), "key", suite.ConfGorush.Apps["normal"].AndroidFcm.APIKey)
+	assert.Equal(suite.T(), 3, suite.ConfGorush.Apps["normal"].AndroidFcm.MaxRetry)
 
 	// iOS
-	assert.Equal(suite.T(), false, suite.ConfGorush.Ios.Enabled)
-	assert.Equal(suite.T(), "key.pem", suite.ConfGorush.Ios.KeyPath)
-	assert.Equal(suite.T(), "", suite.ConfGorush.Ios.Password)
-	assert.Equal(suite.T(), false, suite.ConfGorush.Ios.Production)
-	assert.Equal(suite.T(), 0, suite.ConfGorush.Ios.MaxRetry)
+	assert.Equal(suite.T(), false, suite.ConfGorush.Apps["normal"].Ios.Enabled)
+	assert.Equal(suite.T(), "key.pem", suite.ConfGorush.Apps["normal"].Ios.KeyPath)
+	assert.Equal(suite.T(), "", suite.ConfGorush.Apps["normal"].Ios.Password)
+	assert.Equal(suite.T(), false, suite.ConfGorush.Apps["normal"].Ios.Production)
+	assert.Equal(suite.T(), "", suite.ConfGorush.Apps["normal"].Ios.KeyID)
+	assert.Equal(suite.T(), "", suite.ConfGorush.Apps["normal"].Ios.TeamID)
+	assert.Equal(suite.T(), "", suite.ConfGorush.Apps["normal"].Ios.Topic)
+	assert.Equal(suite.T(), 0, suite.ConfGorush.Apps["normal"].Ios.MaxRetry)
+
+	// Retry
+	assert.Equal(suite.T(), 0, suite.ConfGorush.Apps["normal"].Retry.MaxRetry)
+	assert.Equal(suite.T(), time.Second, suite.ConfGorush.Apps["normal"].Retry.BaseDelay)
+	assert.Equal(suite.T(), 60*time.Second, suite.ConfGorush.Apps["normal"].Retry.MaxDelay)
+	assert.Equal(suite.T(), true, suite.ConfGorush.Apps["normal"].Retry.Jitter)
+	assert.Equal(suite.T(), "", suite.ConfGorush.Apps["normal"].Callback.URL)
+	assert.Equal(suite.T(), "", suite.ConfGorush.Apps["normal"].Callback.Secret)
+	assert.Equal(suite.T(), 100, suite.ConfGorush.Apps["normal"].Callback.BatchSize)
+	assert.Equal(suite.T(), 5, suite.ConfGorush.Apps["normal"].Callback.MaxRetry)
+
+	// Templates
+	assert.Equal(suite.T(), "en", suite.ConfGorush.Apps["normal"].Templates["welcome"].DefaultLocale)
+	assert.Equal(suite.T(), "Hello {{.name}}", suite.ConfGorush.Apps["normal"].Templates["welcome"].Locales["en"].Message)
+	assert.Equal(suite.T(), "{{.name}} 你好", suite.ConfGorush.Apps["normal"].Templates["welcome"].Locales["zh-TW"].Message)
 
 	// log
 	assert.Equal(suite.T(), "string", suite.ConfGorush.Log.Format)
@@ -171,6 +340,16 @@ func (suite *ConfigTestSuite) TestValidateConf() {
 
 	assert.Equal(suite.T(), "bunt.db", suite.ConfGorush.Stat.BuntDB.Path)
 	assert.Equal(suite.T(), "level.db", suite.ConfGorush.Stat.LevelDB.Path)
+
+	assert.Equal(suite.T(), int64(86400), suite.ConfGorush.Stat.History.MinuteRetention)
+	assert.Equal(suite.T(), int64(2592000), suite.ConfGorush.Stat.History.HourRetention)
+	assert.Equal(suite.T(), int64(31536000), suite.ConfGorush.Stat.History.DayRetention)
+
+	// Trace
+	assert.Equal(suite.T(), false, suite.ConfGorush.Trace.Enabled)
+	assert.Equal(suite.T(), "stdout", suite.ConfGorush.Trace.Exporter)
+	assert.Equal(suite.T(), "http://localhost:4318/v1/traces", suite.ConfGorush.Trace.Endpoint)
+	assert.Equal(suite.T(), "gorush", suite.ConfGorush.Trace.ServiceName)
 }
 
 func TestConfigTestSuite(t *testing.T) {
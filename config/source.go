@@ -0,0 +1,330 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Source of config value.
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceFlag    = "flag"
+	SourceEnv     = "env"
+)
+
+// EnvPrefix is the prefix of environment variables which override config,
+// e.g. GORUSH_CORE_PORT or GORUSH_APPS_NORMAL_ANDROID_APIKEY.
+const EnvPrefix = "GORUSH"
+
+// RedactedValue replaces secret value in redacted config.
+const RedactedValue = "******"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Sources records where each config value comes from, keyed by the yaml
+// path like core.port. Path without record comes from default.
+type Sources map[string]string
+
+// Set records the source of path and all values below it.
+func (s Sources) Set(path, source string) {
+	for key := range s {
+		if strings.HasPrefix(key, path+".") {
+			delete(s, key)
+		}
+	}
+	s[path] = source
+}
+
+// Source returns the source of path, the closest parent record is used if
+// path has no record.
+func (s Sources) Source(path string) string {
+	for {
+		if source, ok := s[path]; ok {
+			return source
+		}
+
+		i := strings.LastIndex(path, ".")
+		if i < 0 {
+			return SourceDefault
+		}
+		path = path[:i]
+	}
+}
+
+// ConfValue is a config value with its source.
+type ConfValue struct {
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+}
+
+// LoadSources returns the sources of values which are set in yaml file.
+func LoadSources(confPath string) (Sources, error) {
+	sources := Sources{}
+
+	if confPath == "" {
+		return sources, nil
+	}
+
+	configFile, err := ioutil.ReadFile(confPath)
+	if err != nil {
+		return sources, err
+	}
+
+	var data map[interface{}]interface{}
+	if err := yaml.Unmarshal(configFile, &data); err != nil {
+		return sources, err
+	}
+
+	flattenYaml(data, "", func(path string) {
+		sources[path] = SourceFile
+	})
+
+	return sources, nil
+}
+
+func flattenYaml(data interface{}, path string, fn func(path string)) {
+	switch v := data.(type) {
+	case map[interface{}]interface{}:
+		if len(v) == 0 {
+			fn(path)
+		}
+		for key, value := range v {
+			flattenYaml(value, joinPath(path, fmt.Sprint(key)), fn)
+		}
+	case []interface{}:
+		// lists like auth.keys are set as a whole.
+		fn(path)
+	default:
+		fn(path)
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+// walkConf calls fn for every leaf value of v with its yaml path. Values
+// in maps are copied, so fn can modify them.
+func walkConf(v reflect.Value, path string, secret bool, fn func(path string, secret bool, v reflect.Value)) {
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+
+			walkConf(v.Field(i), joinPath(path, name), field.Tag.Get("secret") == "true", fn)
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Sort(valuesByString(keys))
+		for _, key := range keys {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(key))
+			walkConf(elem, joinPath(path, key.String()), secret, fn)
+			v.SetMapIndex(key, elem)
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Struct {
+			fn(path, secret, v)
+			return
+		}
+
+		for i := 0; i < v.Len(); i++ {
+			walkConf(v.Index(i), joinPath(path, strconv.Itoa(i)), secret, fn)
+		}
+	default:
+		fn(path, secret, v)
+	}
+}
+
+type valuesByString []reflect.Value
+
+func (v valuesByString) Len() int           { return len(v) }
+func (v valuesByString) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v valuesByString) Less(i, j int) bool { return v[i].String() < v[j].String() }
+
+// envName returns the environment variable name of yaml path.
+func envName(path string) string {
+	name := strings.ToUpper(EnvPrefix + "_" + path)
+
+	return strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// LoadEnv overrides config values by GORUSH_* environment variables and
+// records them in sources.
+func LoadEnv(conf *ConfYaml, sources Sources) error {
+	var err error
+
+	walkConf(reflect.ValueOf(conf).Elem(), "", false, func(path string, secret bool, v reflect.Value) {
+		value, ok := os.LookupEnv(envName(path))
+		if !ok || err != nil {
+			return
+		}
+
+		if e := setValue(v, value); e != nil {
+			err = fmt.Errorf("environment %s: %v", envName(path), e)
+			return
+		}
+
+		if sources != nil {
+			sources.Set(path, SourceEnv)
+		}
+	})
+
+	return err
+}
+
+func setValue(v reflect.Value, value string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+// copyConf returns a copy of config which doesn't share any map or slice
+// with the original, so walkConf can write into the copy while workers
+// read the live config.
+func copyConf(conf ConfYaml) ConfYaml {
+	return copyValue(reflect.ValueOf(conf)).Interface().(ConfYaml)
+}
+
+// copyValue returns a deep copy of v.
+func copyValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if c.Field(i).CanSet() {
+				c.Field(i).Set(copyValue(v.Field(i)))
+			}
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMap(v.Type())
+		for _, key := range v.MapKeys() {
+			c.SetMapIndex(key, copyValue(v.MapIndex(key)))
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(copyValue(v.Index(i)))
+		}
+		return c
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		if v.Kind() == reflect.Ptr {
+			c.Set(reflect.New(v.Type().Elem()))
+			c.Elem().Set(copyValue(v.Elem()))
+		} else {
+			c.Set(copyValue(v.Elem()))
+		}
+		return c
+	default:
+		return v
+	}
+}
+
+// Redact returns a copy of config with secret values replaced.
+func Redact(conf ConfYaml) ConfYaml {
+	conf = copyConf(conf)
+
+	walkConf(reflect.ValueOf(&conf).Elem(), "", false, func(path string, secret bool, v reflect.Value) {
+		if secret && v.Kind() == reflect.String && v.String() != "" {
+			v.SetString(RedactedValue)
+		}
+	})
+
+	return conf
+}
+
+// Effective returns every config value with its source, secret values are
+// replaced unless full is true.
+func Effective(conf ConfYaml, sources Sources, full bool) map[string]ConfValue {
+	values := make(map[string]ConfValue)
+	conf = copyConf(conf)
+
+	walkConf(reflect.ValueOf(&conf).Elem(), "", false, func(path string, secret bool, v reflect.Value) {
+		var value interface{}
+		switch {
+		case secret && !full && v.Kind() == reflect.String && v.String() != "":
+			value = RedactedValue
+		case v.Type() == durationType:
+			value = time.Duration(v.Int()).String()
+		default:
+			value = v.Interface()
+		}
+
+		values[path] = ConfValue{
+			Value:  value,
+			Source: sources.Source(path),
+		}
+	})
+
+	return values
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadSources(t *testing.T) {
+	sources, err := LoadSources("config.yml")
+	assert.NoError(t, err)
+
+	assert.Equal(t, SourceFile, sources.Source("core.port"))
+	assert.Equal(t, SourceFile, sources.Source("apps.normal.android.apikey"))
+	assert.Equal(t, SourceFile, sources.Source("auth.keys"))
+	assert.Equal(t, SourceDefault, sources.Source("apps.normal.unknown"))
+	assert.Equal(t, SourceDefault, sources.Source("unknown"))
+
+	sources.Set("apps.normal", SourceFlag)
+	assert.Equal(t, SourceFlag, sources.Source("apps.normal.android.apikey"))
+	assert.Equal(t, SourceFile, sources.Source("core.port"))
+
+	sources, err = LoadSources("")
+	assert.NoError(t, err)
+	assert.Equal(t, SourceDefault, sources.Source("core.port"))
+
+	_, err = LoadSources("missing.yml")
+	assert.Error(t, err)
+}
+
+func TestLoadEnv(t *testing.T) {
+	conf := BuildDefaultPushConf()
+	sources := Sources{}
+
+	os.Setenv("GORUSH_CORE_PORT", "9000")
+	os.Setenv("GORUSH_CORE_SYNC", "true")
+	os.Setenv("GORUSH_APPS_NORMAL_ANDROID_APIKEY", "env-key")
+	os.Setenv("GORUSH_APPS_NORMAL_RETRY_MAX_DELAY", "5s")
+	defer os.Unsetenv("GORUSH_CORE_PORT")
+	defer os.Unsetenv("GORUSH_CORE_SYNC")
+	defer os.Unsetenv("GORUSH_APPS_NORMAL_ANDROID_APIKEY")
+	defer os.Unsetenv("GORUSH_APPS_NORMAL_RETRY_MAX_DELAY")
+
+	assert.NoError(t, LoadEnv(&conf, sources))
+	assert.Equal(t, "9000", conf.Core.Port)
+	assert.True(t, conf.Core.Sync)
+	assert.Equal(t, "env-key", conf.Apps["normal"].Android.APIKey)
+	assert.Equal(t, 5*time.Second, conf.Apps["normal"].Retry.MaxDelay)
+	assert.Equal(t, SourceEnv, sources.Source("core.port"))
+	assert.Equal(t, SourceEnv, sources.Source("apps.normal.android.apikey"))
+	assert.Equal(t, SourceDefault, sources.Source("core.mode"))
+
+	os.Setenv("GORUSH_CORE_WORKER_NUM", "many")
+	defer os.Unsetenv("GORUSH_CORE_WORKER_NUM")
+	assert.Error(t, LoadEnv(&conf, sources))
+}
+
+func TestRedact(t *testing.T) {
+	conf := BuildDefaultPushConf()
+	app := conf.Apps["normal"]
+	app.Android.APIKey = "android-key"
+	app.Ios.Password = "ios-password"
+	conf.Apps["normal"] = app
+	conf.Stat.Redis.Password = "redis-password"
+	conf.Auth.Keys = []SectionAPIKey{{ID: "admin", Key: "admin-key"}}
+	app.Templates = map[string]SectionTemplate{
+		"welcome": {Locales: map[string]SectionTemplateLocale{"en": {Title: "Welcome"}}},
+	}
+	conf.Apps["normal"] = app
+
+	redacted := Redact(conf)
+
+	assert.Equal(t, RedactedValue, redacted.Apps["normal"].Android.APIKey)
+	assert.Equal(t, RedactedValue, redacted.Apps["normal"].Ios.Password)
+	assert.Equal(t, "", redacted.Apps["normal"].AndroidFcm.APIKey)
+	assert.Equal(t, RedactedValue, redacted.Stat.Redis.Password)
+	assert.Equal(t, RedactedValue, redacted.Auth.Keys[0].Key)
+	assert.Equal(t, "admin", redacted.Auth.Keys[0].ID)
+	assert.Equal(t, "key.pem", redacted.Apps["normal"].Ios.KeyPath)
+
+	// original config is untouched
+	assert.Equal(t, "android-key", conf.Apps["normal"].Android.APIKey)
+	assert.Equal(t, "admin-key", conf.Auth.Keys[0].Key)
+
+	// nested maps are not shared with original config.
+	redacted.Apps["normal"].Templates["welcome"].Locales["en"] = SectionTemplateLocale{Title: "Changed"}
+	assert.Equal(t, "Welcome", conf.Apps["normal"].Templates["welcome"].Locales["en"].Title)
+}
+
+func TestEffective(t *testing.T) {
+	conf := BuildDefaultPushConf()
+	conf.Stat.Redis.Password = "redis-password"
+	sources := Sources{"core.port": SourceFlag}
+
+	values := Effective(conf, sources, false)
+	assert.Equal(t, ConfValue{Value: "8088", Source: SourceFlag}, values["core.port"])
+	assert.Equal(t, ConfValue{Value: RedactedValue, Source: SourceDefault}, values["stat.redis.password"])
+	assert.Equal(t, "1m0s", values["apps.normal.retry.max_delay"].Value)
+
+	values = Effective(conf, sources, true)
+	assert.Equal(t, "redis-password", values["stat.redis.password"].Value)
+}
@@ -0,0 +1,317 @@
+package gorush
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	apns "github.com/sideshow/apns2"
+	"github.com/sideshow/apns2/certificate"
+)
+
+// certCheckInterval is how often the certificate file of app is checked for change.
+var certCheckInterval = 30 * time.Second
+
+// ApnsApp is the APNs client and certificate owned by one app.
+type ApnsApp struct {
+	client    *apns.Client
+	keyPath   string
+	modTime   time.Time
+	checkedAt time.Time
+	expiresAt time.Time
+
+	// inflight counts pushes using the client, connections of replaced
+	// client are closed after the last one is finished.
+	lock     sync.Mutex
+	inflight int
+	retired  bool
+}
+
+// ApnsClients is collection of apns client connections
+type ApnsClients struct {
+	lock    sync.RWMutex
+	clients map[string]*ApnsApp
+}
+
+var apnsClients = &ApnsClients{clients: make(map[string]*ApnsApp)}
+
+// CertificateStatus is expiry information of iOS certificate.
+type CertificateStatus struct {
+	AppID     string    `json:"app_id"`
+	KeyPath   string    `json:"key_path"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// newApnsApp load the certificate or auth key of app and create its client.
+func newApnsApp(AppID string) (*ApnsApp, error) {
+	var err error
+	var token *ApnsToken
+	var cert tls.Certificate
+
+	conf := PushConf.Apps[AppID].Ios
+
+	if !conf.Enabled {
+		return nil, errors.New("iOS not enabled")
+	}
+
+	// Append the certificates dir for the path
+	keyPath := certificatePath(conf.KeyPath)
+
+	app := &ApnsApp{
+		keyPath:   keyPath,
+		checkedAt: time.Now(),
+	}
+
+	if info, err := os.Stat(keyPath); err == nil {
+		app.modTime = info.ModTime()
+	}
+
+	switch filepath.Ext(conf.KeyPath) {
+	case ".p12":
+		cert, err = certificate.FromP12File(keyPath, conf.Password)
+	case ".pem":
+		cert, err = certificate.FromPemFile(keyPath, conf.Password)
+	case ".p8":
+		token, err = getApnsToken(keyPath, conf.KeyID, conf.TeamID)
+	default:
+		err = errors.New("wrong certificate key extension")
+	}
+
+	if err != nil {
+		LogError.Error("Cert Error:", err.Error())
+
+		return nil, err
+	}
+
+	app.client = apns.NewClient(cert)
+
+	// token-based authentication, sign every request with provider token.
+	if token != nil {
+		app.client.HTTPClient.Transport = &apnsTokenTransport{
+			token:     token,
+			transport: app.client.HTTPClient.Transport,
+		}
+	} else if len(cert.Certificate) > 0 {
+		if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil {
+			app.expiresAt = leaf.NotAfter
+		}
+	}
+
+	if conf.Production {
+		app.client.Production()
+	} else {
+		app.client.Development()
+	}
+
+	return app, nil
+}
+
+// initAPNSClient initializes an APNs Client for the given AppID.
+func initAPNSClient(AppID string) (*apns.Client, error) {
+	app, err := newApnsApp(AppID)
+	if err != nil {
+		return nil, err
+	}
+
+	return app.client, nil
+}
+
+func (a *ApnsApp) acquire() {
+	a.lock.Lock()
+	a.inflight++
+	a.lock.Unlock()
+}
+
+func (a *ApnsApp) release() {
+	a.lock.Lock()
+	a.inflight--
+	idle := a.retired && a.inflight == 0
+	a.lock.Unlock()
+
+	if idle {
+		a.closeConnections()
+	}
+}
+
+// retire marks the client replaced, its connections are closed now or after
+// in-flight pushes are finished.
+func (a *ApnsApp) retire() {
+	a.lock.Lock()
+	a.retired = true
+	idle := a.inflight == 0
+	a.lock.Unlock()
+
+	if idle {
+		a.closeConnections()
+	}
+}
+
+func (a *ApnsApp) closeConnections() {
+	if t, ok := a.client.HTTPClient.Transport.(interface {
+		CloseIdleConnections()
+	}); ok {
+		t.CloseIdleConnections()
+	}
+}
+
+// changed reports whether the certificate file is modified since loaded.
+func (a *ApnsApp) changed() bool {
+	info, err := os.Stat(a.keyPath)
+	if err != nil {
+		return false
+	}
+
+	return !info.ModTime().Equal(a.modTime)
+}
+
+// GetAPNSClient returns an existing APNs client connection if available else
+// creates a new connection and returns. The client is reloaded when its
+// certificate file has changed.
+func GetAPNSClient(AppID string) (*apns.Client, error) {
+	app, err := acquireApnsApp(AppID)
+	if err != nil {
+		return nil, err
+	}
+	app.release()
+
+	return app.client, nil
+}
+
+// acquireApnsApp works like GetAPNSClient, and keeps connections of the
+// client open until release is called, even if the client is reloaded.
+//
+// For faster concurrency with locks, double checks have been used
+// (https://www.misfra.me/optimizing-concurrent-map-access-in-go/)
+func acquireApnsApp(AppID string) (*ApnsApp, error) {
+	apnsClients.lock.RLock()
+	app, present := apnsClients.clients[AppID]
+	fresh := present && time.Since(app.checkedAt) < certCheckInterval
+	if fresh {
+		app.acquire()
+	}
+	apnsClients.lock.RUnlock()
+
+	if fresh {
+		return app, nil
+	}
+
+	apnsClients.lock.Lock()
+	defer apnsClients.lock.Unlock()
+
+	app, present = apnsClients.clients[AppID]
+	if present {
+		if time.Since(app.checkedAt) < certCheckInterval {
+			app.acquire()
+			return app, nil
+		}
+
+		app.checkedAt = time.Now()
+		if !app.changed() {
+			app.acquire()
+			return app, nil
+		}
+
+		LogAccess.Info("Reload iOS certificate of app: " + AppID)
+		dropAppApnsToken(AppID)
+	}
+
+	newApp, err := newApnsApp(AppID)
+	if err != nil {
+		// keep using the old certificate if new one is broken.
+		if present {
+			app.acquire()
+			return app, nil
+		}
+
+		return nil, err
+	}
+
+	apnsClients.clients[AppID] = newApp
+	if present {
+		app.retire()
+	}
+
+	newApp.acquire()
+	return newApp, nil
+}
+
+// dropAppApnsToken removes the cached provider token of app, so a replaced
+// auth key is loaded on reload.
+func dropAppApnsToken(AppID string) {
+	conf := PushConf.Apps[AppID].Ios
+	if filepath.Ext(conf.KeyPath) == ".p8" {
+		dropApnsToken(certificatePath(conf.KeyPath), conf.KeyID, conf.TeamID)
+	}
+}
+
+// ReloadAPNSClient reload certificate and client of app.
+func ReloadAPNSClient(AppID string) error {
+	dropAppApnsToken(AppID)
+
+	app, err := newApnsApp(AppID)
+	if err != nil {
+		return err
+	}
+
+	apnsClients.lock.Lock()
+	old, present := apnsClients.clients[AppID]
+	apnsClients.clients[AppID] = app
+	apnsClients.lock.Unlock()
+
+	if present {
+		old.retire()
+	}
+
+	return nil
+}
+
+// InitAPNSClients load certificates of all iOS enabled apps, so expiry of
+// every certificate is known at startup.
+func InitAPNSClients() error {
+	for AppID, app := range PushConf.Apps {
+		if !app.Ios.Enabled {
+			continue
+		}
+
+		if err := ReloadAPNSClient(AppID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// certificateStatus returns expiry of loaded certificates ordered by app.
+// Apps with token-based authentication have no expiry.
+func certificateStatus() []CertificateStatus {
+	var result []CertificateStatus
+
+	apnsClients.lock.RLock()
+	for AppID, app := range apnsClients.clients {
+		if app.expiresAt.IsZero() {
+			continue
+		}
+
+		result = append(result, CertificateStatus{
+			AppID:     AppID,
+			KeyPath:   app.keyPath,
+			ExpiresAt: app.expiresAt,
+		})
+	}
+	apnsClients.lock.RUnlock()
+
+	sort.Sort(certificateStatusByApp(result))
+
+	return result
+}
+
+type certificateStatusByApp []CertificateStatus
+
+func (c certificateStatusByApp) Len() int           { return len(c) }
+func (c certificateStatusByApp) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c certificateStatusByApp) Less(i, j int) bool { return c[i].AppID < c[j].AppID }
@@ -0,0 +1,165 @@
+package gorush
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/buger/jsonparser"
+	"github.com/lalit-verma/gorush/config"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/appleboy/gofight.v2"
+)
+
+func resetAPNSClients() {
+	apnsClients.lock.Lock()
+	apnsClients.clients = make(map[string]*ApnsApp)
+	apnsClients.lock.Unlock()
+}
+
+func TestAPNSCertificateExpiry(t *testing.T) {
+	PushConf = config.BuildDefaultPushConf()
+	InitLog()
+	resetAPNSClients()
+
+	app := PushConf.Apps[AppNameDefault]
+	app.Ios.Enabled = true
+	app.Ios.KeyPath = "../certificate/certificate-valid.pem"
+	PushConf.Apps[AppNameDefault] = app
+
+	// token-based app has no certificate expiry
+	token := config.BuildDefaultAppConf()
+	token.Ios.Enabled = true
+	token.Ios.KeyPath = authKeyPath
+	token.Ios.KeyID = "KEY1234567"
+	token.Ios.TeamID = "TEAM123456"
+	PushConf.Apps["token"] = token
+
+	assert.NoError(t, InitAPNSClients())
+
+	certs := certificateStatus()
+	assert.Len(t, certs, 1)
+	assert.Equal(t, AppNameDefault, certs[0].AppID)
+	assert.False(t, certs[0].ExpiresAt.IsZero())
+
+	// every app owns its client
+	normalClient, _ := GetAPNSClient(AppNameDefault)
+	tokenClient, _ := GetAPNSClient("token")
+	assert.True(t, normalClient != tokenClient)
+
+	resetAPNSClients()
+}
+
+func TestGetAPNSClientReloadOnChange(t *testing.T) {
+	PushConf = config.BuildDefaultPushConf()
+	InitLog()
+	resetAPNSClients()
+
+	dir, _ := ioutil.TempDir("", "gorush")
+	defer os.RemoveAll(dir)
+
+	data, _ := ioutil.ReadFile("../certificate/certificate-valid.pem")
+	keyPath := filepath.Join(dir, "cert.pem")
+	ioutil.WriteFile(keyPath, data, 0600)
+
+	PushConf.Core.CertDir = dir + "/"
+	app := PushConf.Apps[AppNameDefault]
+	app.Ios.Enabled = true
+	app.Ios.KeyPath = "cert.pem"
+	PushConf.Apps[AppNameDefault] = app
+
+	interval := certCheckInterval
+	certCheckInterval = 0
+	defer func() { certCheckInterval = interval }()
+
+	first, err := GetAPNSClient(AppNameDefault)
+	assert.NoError(t, err)
+
+	// unchanged file keeps the client
+	same, _ := GetAPNSClient(AppNameDefault)
+	assert.True(t, first == same)
+
+	modTime := time.Now().Add(time.Minute)
+	os.Chtimes(keyPath, modTime, modTime)
+
+	reloaded, err := GetAPNSClient(AppNameDefault)
+	assert.NoError(t, err)
+	assert.True(t, first != reloaded)
+
+	// broken certificate keeps the last good client
+	ioutil.WriteFile(keyPath, []byte("broken"), 0600)
+	modTime = modTime.Add(time.Minute)
+	os.Chtimes(keyPath, modTime, modTime)
+
+	kept, err := GetAPNSClient(AppNameDefault)
+	assert.NoError(t, err)
+	assert.True(t, reloaded == kept)
+
+	resetAPNSClients()
+}
+
+type idleTransport struct {
+	http.RoundTripper
+	closed int
+}
+
+func (t *idleTransport) CloseIdleConnections() {
+	t.closed++
+}
+
+func TestReloadAPNSClientClosesOldClient(t *testing.T) {
+	PushConf = config.BuildDefaultPushConf()
+	InitLog()
+	resetAPNSClients()
+
+	app := PushConf.Apps[AppNameDefault]
+	app.Ios.Enabled = true
+	app.Ios.KeyPath = "../certificate/certificate-valid.pem"
+	PushConf.Apps[AppNameDefault] = app
+
+	old, err := acquireApnsApp(AppNameDefault)
+	assert.NoError(t, err)
+	transport := &idleTransport{RoundTripper: old.client.HTTPClient.Transport}
+	old.client.HTTPClient.Transport = transport
+
+	// in-flight push keeps connections of old client.
+	assert.NoError(t, ReloadAPNSClient(AppNameDefault))
+	assert.Equal(t, 0, transport.closed)
+
+	old.release()
+	assert.Equal(t, 1, transport.closed)
+
+	resetAPNSClients()
+}
+
+func TestCertReloadHandler(t *testing.T) {
+	initTest()
+	InitLog()
+	resetAPNSClients()
+
+	app := PushConf.Apps[AppNameDefault]
+	app.Ios.Enabled = true
+	app.Ios.KeyPath = "../certificate/certificate-valid.pem"
+	PushConf.Apps[AppNameDefault] = app
+
+	r := gofight.New()
+
+	r.POST("/api/cert/reload?app_id=unknown").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusBadRequest, r.Code)
+		})
+
+	r.POST("/api/cert/reload?app_id="+AppNameDefault).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			data := []byte(r.Body.String())
+			appID, _ := jsonparser.GetString(data, "certificates", "[0]", "app_id")
+
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Equal(t, AppNameDefault, appID)
+		})
+
+	resetAPNSClients()
+}
@@ -0,0 +1,197 @@
+package gorush
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// APNs provider token is valid for one hour, refresh it before it expires.
+// ref: https://developer.apple.com/library/content/documentation/NetworkingInternet/Conceptual/RemoteNotificationsPG/CommunicatingwithAPNs.html
+const apnsTokenRefreshInterval = 50 * time.Minute
+
+// ApnsToken sign and cache the JWT of APNs token-based authentication.
+type ApnsToken struct {
+	sync.Mutex
+	key      *ecdsa.PrivateKey
+	keyID    string
+	teamID   string
+	bearer   string
+	issuedAt time.Time
+}
+
+// apnsTokens shares one token between apps which use the same key,
+// the provider token is not bound to any bundle topic.
+var apnsTokens = struct {
+	sync.Mutex
+	tokens map[string]*ApnsToken
+}{tokens: make(map[string]*ApnsToken)}
+
+// loadAuthKey parse the .p8 private key downloaded from Apple.
+func loadAuthKey(path string) (*ecdsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("auth key must be a valid .p8 PEM file")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("auth key must be of type ecdsa.PrivateKey")
+	}
+
+	return ecKey, nil
+}
+
+func apnsTokenName(path, keyID, teamID string) string {
+	return path + "|" + keyID + "|" + teamID
+}
+
+// dropApnsToken removes the cached token of key, so the key file is loaded
+// again on next getApnsToken. Clients created before keep the old token.
+func dropApnsToken(path, keyID, teamID string) {
+	apnsTokens.Lock()
+	delete(apnsTokens.tokens, apnsTokenName(path, keyID, teamID))
+	apnsTokens.Unlock()
+}
+
+// getApnsToken returns the cached token of key or loads the key.
+func getApnsToken(path, keyID, teamID string) (*ApnsToken, error) {
+	if keyID == "" || teamID == "" {
+		return nil, errors.New("Missing iOS key_id or team_id")
+	}
+
+	name := apnsTokenName(path, keyID, teamID)
+
+	apnsTokens.Lock()
+	defer apnsTokens.Unlock()
+
+	if token, ok := apnsTokens.tokens[name]; ok {
+		return token, nil
+	}
+
+	key, err := loadAuthKey(path)
+	if err != nil {
+		return nil, err
+	}
+
+	token := &ApnsToken{
+		key:    key,
+		keyID:  keyID,
+		teamID: teamID,
+	}
+	apnsTokens.tokens[name] = token
+
+	return token, nil
+}
+
+// Bearer returns a signed JWT, a new one is generated when the cached token
+// is close to expire.
+func (t *ApnsToken) Bearer() (string, error) {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.bearer != "" && time.Since(t.issuedAt) < apnsTokenRefreshInterval {
+		return t.bearer, nil
+	}
+
+	now := time.Now()
+	bearer, err := t.sign(now)
+	if err != nil {
+		return "", err
+	}
+
+	t.bearer = bearer
+	t.issuedAt = now
+
+	return bearer, nil
+}
+
+// sign generate ES256 JWT with key id header and team id issuer claim.
+func (t *ApnsToken) sign(issuedAt time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{
+		"alg": "ES256",
+		"kid": t.keyID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss": t.teamID,
+		"iat": issuedAt.Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	encoding := base64.RawURLEncoding
+	unsigned := encoding.EncodeToString(header) + "." + encoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, t.key, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	// JWS signature is r and s as fixed size big-endian integers.
+	size := (t.key.Curve.Params().BitSize + 7) / 8
+	signature := make([]byte, 2*size)
+	rBytes, sBytes := r.Bytes(), s.Bytes()
+	copy(signature[size-len(rBytes):size], rBytes)
+	copy(signature[2*size-len(sBytes):], sBytes)
+
+	return unsigned + "." + encoding.EncodeToString(signature), nil
+}
+
+// apnsTokenTransport adds provider token to every APNs request.
+type apnsTokenTransport struct {
+	token     *ApnsToken
+	transport http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *apnsTokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	bearer, err := t.token.Bearer()
+	if err != nil {
+		return nil, err
+	}
+
+	// RoundTripper must not modify the original request.
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		r.Header[k] = append([]string(nil), v...)
+	}
+	r.Header.Set("Authorization", "bearer "+bearer)
+
+	return t.transport.RoundTrip(r)
+}
+
+// CloseIdleConnections closes idle connections of the wrapped transport.
+func (t *apnsTokenTransport) CloseIdleConnections() {
+	if c, ok := t.transport.(interface {
+		CloseIdleConnections()
+	}); ok {
+		c.CloseIdleConnections()
+	}
+}
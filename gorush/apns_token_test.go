@@ -0,0 +1,181 @@
+package gorush
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lalit-verma/gorush/config"
+	"github.com/stretchr/testify/assert"
+)
+
+const authKeyPath = "../certificate/authkey-valid.p8"
+
+func TestLoadAuthKey(t *testing.T) {
+	key, err := loadAuthKey(authKeyPath)
+	assert.NoError(t, err)
+	assert.NotNil(t, key)
+
+	_, err = loadAuthKey("../certificate/certificate-valid.pem")
+	assert.Error(t, err)
+
+	_, err = loadAuthKey("../certificate/not-found.p8")
+	assert.Error(t, err)
+}
+
+func TestGetApnsToken(t *testing.T) {
+	_, err := getApnsToken(authKeyPath, "", "TEAM123456")
+	assert.Error(t, err)
+	assert.Equal(t, "Missing iOS key_id or team_id", err.Error())
+
+	first, err := getApnsToken(authKeyPath, "KEY1234567", "TEAM123456")
+	assert.NoError(t, err)
+
+	// apps with the same key share one token
+	second, err := getApnsToken(authKeyPath, "KEY1234567", "TEAM123456")
+	assert.NoError(t, err)
+	assert.True(t, first == second)
+}
+
+func TestApnsTokenBearer(t *testing.T) {
+	token, err := getApnsToken(authKeyPath, "KEY1234567", "TEAM123456")
+	assert.NoError(t, err)
+
+	bearer, err := token.Bearer()
+	assert.NoError(t, err)
+
+	parts := strings.Split(bearer, ".")
+	assert.Len(t, parts, 3)
+
+	var header, claims map[string]interface{}
+	data, _ := base64.RawURLEncoding.DecodeString(parts[0])
+	json.Unmarshal(data, &header)
+	data, _ = base64.RawURLEncoding.DecodeString(parts[1])
+	json.Unmarshal(data, &claims)
+
+	assert.Equal(t, "ES256", header["alg"])
+	assert.Equal(t, "KEY1234567", header["kid"])
+	assert.Equal(t, "TEAM123456", claims["iss"])
+
+	// verify ES256 signature
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	assert.Len(t, signature, 64)
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	assert.True(t, ecdsa.Verify(&token.key.PublicKey, digest[:], r, s))
+
+	// cached until refresh interval
+	cached, _ := token.Bearer()
+	assert.Equal(t, bearer, cached)
+
+	token.issuedAt = time.Now().Add(-apnsTokenRefreshInterval - time.Second)
+	refreshed, _ := token.Bearer()
+	assert.NotEqual(t, bearer, refreshed)
+}
+
+func TestApnsTokenTransport(t *testing.T) {
+	var auth string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+	}))
+	defer ts.Close()
+
+	token, _ := getApnsToken(authKeyPath, "KEY1234567", "TEAM123456")
+	client := &http.Client{
+		Transport: &apnsTokenTransport{
+			token:     token,
+			transport: http.DefaultTransport,
+		},
+	}
+
+	req, _ := http.NewRequest("POST", ts.URL, nil)
+	res, err := client.Do(req)
+	assert.NoError(t, err)
+	res.Body.Close()
+
+	bearer, _ := token.Bearer()
+	assert.Equal(t, "bearer "+bearer, auth)
+	assert.Empty(t, req.Header.Get("Authorization"))
+}
+
+func TestAPNSClientWithAuthKey(t *testing.T) {
+	PushConf = config.BuildDefaultPushConf()
+	InitLog()
+
+	app := PushConf.Apps[AppNameDefault]
+
+	app.Ios.Enabled = true
+	app.Ios.KeyPath = authKeyPath
+	PushConf.Apps[AppNameDefault] = app
+
+	_, err := initAPNSClient(AppNameDefault)
+	assert.Error(t, err)
+
+	err = CheckPushConf()
+	assert.Error(t, err)
+	assert.Equal(t, "Missing iOS key_id or team_id", err.Error())
+
+	app.Ios.KeyID = "KEY1234567"
+	app.Ios.TeamID = "TEAM123456"
+	app.Ios.Production = true
+	PushConf.Apps[AppNameDefault] = app
+
+	assert.NoError(t, CheckPushConf())
+
+	client, err := initAPNSClient(AppNameDefault)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://api.push.apple.com", client.Host)
+	assert.IsType(t, &apnsTokenTransport{}, client.HTTPClient.Transport)
+}
+
+func TestReloadAPNSClientAuthKey(t *testing.T) {
+	PushConf = config.BuildDefaultPushConf()
+	InitLog()
+	resetAPNSClients()
+
+	app := PushConf.Apps[AppNameDefault]
+	app.Ios.Enabled = true
+	app.Ios.KeyPath = authKeyPath
+	app.Ios.KeyID = "KEY7654321"
+	app.Ios.TeamID = "TEAM123456"
+	PushConf.Apps[AppNameDefault] = app
+
+	assert.NoError(t, ReloadAPNSClient(AppNameDefault))
+	first, _ := getApnsToken(authKeyPath, "KEY7654321", "TEAM123456")
+
+	// replaced key file is loaded again
+	assert.NoError(t, ReloadAPNSClient(AppNameDefault))
+	second, _ := getApnsToken(authKeyPath, "KEY7654321", "TEAM123456")
+	assert.True(t, first != second)
+
+	resetAPNSClients()
+}
+
+func TestIOSNotificationDefaultTopic(t *testing.T) {
+	PushConf = config.BuildDefaultPushConf()
+	app := PushConf.Apps[AppNameDefault]
+	app.Ios.Topic = "com.example.app"
+	PushConf.Apps[AppNameDefault] = app
+
+	req := PushNotification{
+		AppID:    AppNameDefault,
+		Tokens:   []string{"aaaaaa"},
+		Platform: PlatFormIos,
+	}
+
+	notification := GetIOSNotification(req)
+	assert.Equal(t, "com.example.app", notification.Topic)
+
+	req.Topic = "com.example.other"
+	notification = GetIOSNotification(req)
+	assert.Equal(t, "com.example.other", notification.Topic)
+}
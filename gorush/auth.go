@@ -0,0 +1,311 @@
+package gorush
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// API key scopes.
+const (
+	ScopePush  = "push"
+	ScopeStats = "stats"
+	ScopeAdmin = "admin"
+)
+
+// apiKeyBucket is the storage bucket of api keys created by key api.
+const apiKeyBucket = "api-key"
+
+// context keys of AuthMiddleware.
+const (
+	apiKeyContextKey      = "api_key"
+	apiKeyErrorContextKey = "api_key_error"
+)
+
+var validScopes = map[string]bool{
+	ScopePush:  true,
+	ScopeStats: true,
+	ScopeAdmin: true,
+}
+
+// APIKey is an api key limited to apps and scopes.
+type APIKey struct {
+	ID     string   `json:"id"`
+	Apps   []string `json:"apps"`
+	Scopes []string `json:"scopes"`
+}
+
+// RequestAPIKey is the body of create api key request.
+type RequestAPIKey struct {
+	ID     string   `json:"id" binding:"required"`
+	Apps   []string `json:"apps"`
+	Scopes []string `json:"scopes" binding:"required"`
+}
+
+// HasScope check whether the key is granted scope.
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllowApp check whether the key can access app, key without apps can
+// access all apps.
+func (k *APIKey) AllowApp(appID string) bool {
+	if len(k.Apps) == 0 {
+		return true
+	}
+
+	for _, app := range k.Apps {
+		if app == appID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// findAPIKey looks up the key in config and then in stat storage if
+// auth.storage is enabled. It returns nil if the key is unknown.
+func findAPIKey(key string) (*APIKey, error) {
+	for _, k := range PushConf.Auth.Keys {
+		if k.Key != "" && subtle.ConstantTimeCompare([]byte(k.Key), []byte(key)) == 1 {
+			return &APIKey{
+				ID:     k.ID,
+				Apps:   k.Apps,
+				Scopes: k.Scopes,
+			}, nil
+		}
+	}
+
+	if !PushConf.Auth.Storage {
+		return nil, nil
+	}
+
+	data, err := StatStorage.GetRecord(context.Background(), apiKeyBucket, hashAPIKey(key))
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var apiKey APIKey
+	if err := json.Unmarshal(data, &apiKey); err != nil {
+		return nil, err
+	}
+
+	return &apiKey, nil
+}
+
+// bearerToken returns the token of Authorization header.
+func bearerToken(c *gin.Context) string {
+	auth := c.Request.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+
+	return ""
+}
+
+// AuthMiddleware identifies the caller by api key, so the key id can be
+// logged. Access is checked by RequireScope of each route.
+func AuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !PushConf.Auth.Enabled {
+			c.Next()
+			return
+		}
+
+		if token := bearerToken(c); token != "" {
+			apiKey, err := findAPIKey(token)
+			if err != nil {
+				LogError.Error("api key error: " + err.Error())
+				c.Set(apiKeyErrorContextKey, "Can't verify API key.")
+			} else if apiKey == nil {
+				c.Set(apiKeyErrorContextKey, "Invalid API key.")
+			} else {
+				c.Set(apiKeyContextKey, apiKey)
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// RequireScope rejects request without api key of scope.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !PushConf.Auth.Enabled {
+			c.Next()
+			return
+		}
+
+		if msg, exists := c.Get(apiKeyErrorContextKey); exists {
+			c.Header("WWW-Authenticate", `Bearer realm="gorush"`)
+			abortWithError(c, http.StatusUnauthorized, msg.(string))
+			return
+		}
+
+		apiKey := requestAPIKey(c)
+		if apiKey == nil {
+			c.Header("WWW-Authenticate", `Bearer realm="gorush"`)
+			abortWithError(c, http.StatusUnauthorized, "Missing API key.")
+			return
+		}
+
+		if !apiKey.HasScope(scope) {
+			abortWithError(c, http.StatusForbidden, "API key is not allowed scope: "+scope)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// AuthenticateKey checks api key of request which doesn't come through gin,
+// like gRPC, with the same rules as RequireScope. The key is nil if auth is
+// disabled.
+func AuthenticateKey(key, scope string) (*APIKey, *RequestError) {
+	if !PushConf.Auth.Enabled {
+		return nil, nil
+	}
+
+	if key == "" {
+		return nil, &RequestError{http.StatusUnauthorized, "Missing API key."}
+	}
+
+	apiKey, err := findAPIKey(key)
+	if err != nil {
+		LogError.Error("api key error: " + err.Error())
+		return nil, &RequestError{http.StatusUnauthorized, "Can't verify API key."}
+	}
+
+	if apiKey == nil {
+		return nil, &RequestError{http.StatusUnauthorized, "Invalid API key."}
+	}
+
+	if !apiKey.HasScope(scope) {
+		return nil, &RequestError{http.StatusForbidden, "API key is not allowed scope: " + scope}
+	}
+
+	return apiKey, nil
+}
+
+// requestAPIKey returns the api key of request, nil if auth is disabled.
+func requestAPIKey(c *gin.Context) *APIKey {
+	if value, exists := c.Get(apiKeyContextKey); exists {
+		return value.(*APIKey)
+	}
+
+	return nil
+}
+
+// authorizeApp aborts the request with 403 if api key can't access app.
+func authorizeApp(c *gin.Context, appID string) bool {
+	apiKey := requestAPIKey(c)
+	if apiKey == nil || apiKey.AllowApp(appID) {
+		return true
+	}
+
+	msg := "API key is not allowed app: " + appID
+	if appID == "" {
+		msg = "API key is limited to apps, app_id is required."
+	}
+	abortWithError(c, http.StatusForbidden, msg)
+
+	return false
+}
+
+// authorizeApps aborts the request with 403 if api key limited to apps can't
+// access all of apps, empty apps means all apps.
+func authorizeApps(c *gin.Context, apps []string) bool {
+	apiKey := requestAPIKey(c)
+	if apiKey == nil || len(apiKey.Apps) == 0 {
+		return true
+	}
+
+	if len(apps) == 0 {
+		return authorizeApp(c, "")
+	}
+
+	for _, app := range apps {
+		if !authorizeApp(c, app) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// findStoredAPIKey returns the storage key and the stored api key of id.
+func findStoredAPIKey(id string) (string, *APIKey, error) {
+	var hash string
+	var stored *APIKey
+	err := StatStorage.RangeRecords(context.Background(), apiKeyBucket, "", "", func(key string, value []byte) bool {
+		var apiKey APIKey
+		if json.Unmarshal(value, &apiKey) == nil && apiKey.ID == id {
+			hash = key
+			stored = &apiKey
+			return false
+		}
+
+		return true
+	})
+
+	return hash, stored, err
+}
+
+// createAPIKey saves a new random api key in stat storage and returns it.
+func createAPIKey(req RequestAPIKey) (string, error) {
+	for _, scope := range req.Scopes {
+		if !validScopes[scope] {
+			return "", errors.New("Unknown scope: " + scope)
+		}
+	}
+
+	for _, app := range req.Apps {
+		if _, exists := PushConf.Apps[app]; !exists {
+			return "", errors.New("Unknown app: " + app)
+		}
+	}
+
+	hash, _, err := findStoredAPIKey(req.ID)
+	if err != nil {
+		return "", err
+	}
+	if hash != "" {
+		return "", errors.New("API key already exists: " + req.ID)
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	key := hex.EncodeToString(b)
+
+	data, err := json.Marshal(APIKey{
+		ID:     req.ID,
+		Apps:   req.Apps,
+		Scopes: req.Scopes,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return key, StatStorage.SetRecord(context.Background(), apiKeyBucket, hashAPIKey(key), data)
+}
@@ -0,0 +1,363 @@
+package gorush
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/buger/jsonparser"
+	"github.com/lalit-verma/gorush/config"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/appleboy/gofight.v2"
+)
+
+func initAuthTest() {
+	initTest()
+	InitLog()
+	InitAppStatus()
+
+	PushConf.Auth.Enabled = true
+	PushConf.Auth.Keys = []config.SectionAPIKey{
+		{
+			ID:     "admin",
+			Key:    "admin-key",
+			Scopes: []string{ScopePush, ScopeStats, ScopeAdmin},
+		},
+		{
+			ID:     "backend",
+			Key:    "backend-key",
+			Apps:   []string{AppNameDefault},
+			Scopes: []string{ScopePush},
+		},
+	}
+	PushConf.Apps["other"] = config.BuildDefaultAppConf()
+}
+
+func TestAuthDisabled(t *testing.T) {
+	initTest()
+	InitLog()
+	InitAppStatus()
+
+	r := gofight.New()
+
+	r.GET("/api/stat/app").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+}
+
+func TestAuthMissingOrInvalidKey(t *testing.T) {
+	initAuthTest()
+
+	r := gofight.New()
+
+	r.GET("/api/stat/app").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			msg, _ := jsonparser.GetString([]byte(r.Body.String()), "message")
+
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+			assert.Equal(t, "Missing API key.", msg)
+			assert.Equal(t, `Bearer realm="gorush"`, r.HeaderMap.Get("WWW-Authenticate"))
+		})
+
+	r.GET("/api/stat/app").
+		SetHeader(gofight.H{
+			"Authorization": "Bearer wrong-key",
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			msg, _ := jsonparser.GetString([]byte(r.Body.String()), "message")
+
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+			assert.Equal(t, "Invalid API key.", msg)
+		})
+
+	// root handler is public
+	r.GET("/").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+}
+
+func TestAuthenticateKey(t *testing.T) {
+	initTest()
+
+	apiKey, err := AuthenticateKey("", ScopePush)
+	assert.Nil(t, apiKey)
+	assert.Nil(t, err)
+
+	initAuthTest()
+
+	_, err = AuthenticateKey("", ScopePush)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, http.StatusUnauthorized, err.Code)
+		assert.Equal(t, "Missing API key.", err.Message)
+	}
+
+	_, err = AuthenticateKey("wrong-key", ScopePush)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, http.StatusUnauthorized, err.Code)
+	}
+
+	_, err = AuthenticateKey("backend-key", ScopeAdmin)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, http.StatusForbidden, err.Code)
+	}
+
+	apiKey, err = AuthenticateKey("backend-key", ScopePush)
+	assert.Nil(t, err)
+	if assert.NotNil(t, apiKey) {
+		assert.Equal(t, "backend", apiKey.ID)
+	}
+}
+
+func TestAuthScope(t *testing.T) {
+	initAuthTest()
+
+	r := gofight.New()
+
+	r.GET("/api/config").
+		SetHeader(gofight.H{
+			"Authorization": "Bearer backend-key",
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			msg, _ := jsonparser.GetString([]byte(r.Body.String()), "message")
+
+			assert.Equal(t, http.StatusForbidden, r.Code)
+			assert.Equal(t, "API key is not allowed scope: stats", msg)
+		})
+
+	r.GET("/api/stat/app").
+		SetHeader(gofight.H{
+			"Authorization": "Bearer admin-key",
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+}
+
+func TestAuthApp(t *testing.T) {
+	initAuthTest()
+
+	r := gofight.New()
+
+	r.POST("/api/push").
+		SetHeader(gofight.H{
+			"Authorization": "Bearer backend-key",
+		}).
+		SetJSON(gofight.D{
+			"notifications": []gofight.D{
+				{
+					"app_id":   "other",
+					"tokens":   []string{"aaaaa"},
+					"platform": 2,
+					"message":  "Welcome",
+				},
+			},
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			msg, _ := jsonparser.GetString([]byte(r.Body.String()), "message")
+
+			assert.Equal(t, http.StatusForbidden, r.Code)
+			assert.Equal(t, "API key is not allowed app: other", msg)
+		})
+
+	r.GET("/api/feedback").
+		SetHeader(gofight.H{
+			"Authorization": "Bearer backend-key",
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusForbidden, r.Code)
+		})
+
+	r.GET("/api/feedback?app_id="+AppNameDefault).
+		SetHeader(gofight.H{
+			"Authorization": "Bearer backend-key",
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+}
+
+func TestAuthKeyOfOtherApp(t *testing.T) {
+	initAuthTest()
+	PushConf.Auth.Storage = true
+	PushConf.Auth.Keys = append(PushConf.Auth.Keys, config.SectionAPIKey{
+		ID:     "other",
+		Key:    "other-key",
+		Apps:   []string{"other"},
+		Scopes: []string{ScopePush, ScopeStats, ScopeAdmin},
+	})
+	header := gofight.H{
+		"Authorization": "Bearer other-key",
+	}
+
+	_, err := createAPIKey(RequestAPIKey{ID: "stored", Apps: []string{AppNameDefault}, Scopes: []string{ScopePush}})
+	assert.NoError(t, err)
+
+	r := gofight.New()
+
+	r.POST("/api/feedback/ack").
+		SetHeader(header).
+		SetJSON(gofight.D{
+			"ids": []string{"other/2/aaaaa", AppNameDefault + "/2/aaaaa"},
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			msg, _ := jsonparser.GetString([]byte(r.Body.String()), "message")
+
+			assert.Equal(t, http.StatusForbidden, r.Code)
+			assert.Equal(t, "API key is not allowed app: "+AppNameDefault, msg)
+		})
+
+	r.DELETE("/api/keys?id=stored").
+		SetHeader(header).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusForbidden, r.Code)
+		})
+
+	hash, _, _ := findStoredAPIKey("stored")
+	assert.NotEmpty(t, hash)
+
+	addPushSuccess(PlatFormIos, AppNameDefault, 2)
+
+	r.GET("/api/stat/app").
+		SetHeader(header).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			data := []byte(r.Body.String())
+			_, _, _, normalErr := jsonparser.Get(data, "apps", AppNameDefault)
+			_, _, _, otherErr := jsonparser.Get(data, "apps", "other")
+			success, _ := jsonparser.GetInt(data, "ios", "push_success")
+
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Error(t, normalErr)
+			assert.NoError(t, otherErr)
+			assert.Equal(t, int64(0), success)
+		})
+
+	r.GET("/metrics").
+		SetHeader(header).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Contains(t, r.Body.String(), `app="other"`)
+			assert.NotContains(t, r.Body.String(), `app="`+AppNameDefault+`"`)
+			assert.NotContains(t, r.Body.String(), "gorush_total_push_count")
+			assert.NotContains(t, r.Body.String(), "gorush_ios_success")
+			assert.Contains(t, r.Body.String(), "go_goroutines")
+		})
+
+	r.GET("/api/config?format=json").
+		SetHeader(header).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			data := []byte(r.Body.String())
+			_, _, _, normalErr := jsonparser.Get(data, "config", "apps."+AppNameDefault+".ios.enabled")
+			_, _, _, otherErr := jsonparser.Get(data, "config", "apps.other.ios.enabled")
+
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Error(t, normalErr)
+			assert.NoError(t, otherErr)
+			assert.NotContains(t, r.Body.String(), "backend")
+		})
+
+	// key of all apps still sees every app.
+	r.GET("/metrics").
+		SetHeader(gofight.H{
+			"Authorization": "Bearer admin-key",
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Contains(t, r.Body.String(), `app="`+AppNameDefault+`"`)
+			assert.Contains(t, r.Body.String(), "gorush_total_push_count")
+		})
+}
+
+func TestAuthLogKeyID(t *testing.T) {
+	initAuthTest()
+	PushConf.Log.Format = "json"
+
+	var buf bytes.Buffer
+	LogAccess.Out = &buf
+
+	r := gofight.New()
+
+	r.GET("/api/stat/app").
+		SetHeader(gofight.H{
+			"Authorization": "Bearer admin-key",
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+
+	assert.Regexp(t, `key_id\\?":\\?"admin`, buf.String())
+
+	InitLog()
+}
+
+func TestStoredAPIKey(t *testing.T) {
+	initAuthTest()
+
+	r := gofight.New()
+
+	r.POST("/api/keys").
+		SetHeader(gofight.H{
+			"Authorization": "Bearer admin-key",
+		}).
+		SetJSON(gofight.D{
+			"id":     "stored",
+			"scopes": []string{ScopeStats},
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusBadRequest, r.Code)
+		})
+
+	PushConf.Auth.Storage = true
+
+	var key string
+	r.POST("/api/keys").
+		SetHeader(gofight.H{
+			"Authorization": "Bearer admin-key",
+		}).
+		SetJSON(gofight.D{
+			"id":     "stored",
+			"scopes": []string{ScopeStats},
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			key, _ = jsonparser.GetString([]byte(r.Body.String()), "key")
+
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Len(t, key, 64)
+		})
+
+	r.POST("/api/keys").
+		SetHeader(gofight.H{
+			"Authorization": "Bearer admin-key",
+		}).
+		SetJSON(gofight.D{
+			"id":     "stored",
+			"scopes": []string{ScopeStats},
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusBadRequest, r.Code)
+		})
+
+	r.GET("/api/stat/app").
+		SetHeader(gofight.H{
+			"Authorization": "Bearer " + key,
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+
+	r.DELETE("/api/keys?id=stored").
+		SetHeader(gofight.H{
+			"Authorization": "Bearer admin-key",
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+
+	r.GET("/api/stat/app").
+		SetHeader(gofight.H{
+			"Authorization": "Bearer " + key,
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+		})
+}
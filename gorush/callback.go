@@ -0,0 +1,191 @@
+package gorush
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jpillora/backoff"
+)
+
+// Callback headers, the signature covers the timestamp and body, so a
+// captured callback can't be replayed after the receiver's window.
+const (
+	CallbackSignatureHeader = "X-Gorush-Signature"
+	CallbackTimestampHeader = "X-Gorush-Timestamp"
+)
+
+// CallbackPayload is the body of delivery result callback.
+type CallbackPayload struct {
+	ID       string                   `json:"id"`
+	AppID    string                   `json:"app_id"`
+	Platform int                      `json:"platform"`
+	Attempt  int                      `json:"attempt"`
+	Results  map[string]*PushResponse `json:"results"`
+}
+
+var (
+	callbackClient = &http.Client{Timeout: 10 * time.Second}
+	// callbacks tracks in-flight callback deliveries for shutdown.
+	callbacks sync.WaitGroup
+)
+
+// callbackURL returns the callback url of notification, request url
+// overrides the app default.
+func callbackURL(req PushNotification) string {
+	if req.CallbackURL != "" {
+		return req.CallbackURL
+	}
+
+	return PushConf.Apps[req.AppID].Callback.URL
+}
+
+// signCallback returns the hex HMAC-SHA256 signature of "timestamp.body".
+func signCallback(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// sendCallback posts the final per-token results of notification to the
+// callback url in batches. Tokens which are scheduled to resend are posted
+// when their last attempt finishes.
+func sendCallback(req PushNotification, resp map[string]*PushResponse) {
+	url := callbackURL(req)
+	if url == "" {
+		return
+	}
+
+	var tokens []string
+	for _, token := range req.Tokens {
+		if r, ok := resp[token]; ok && r.Status == StatusRetrying {
+			continue
+		}
+		tokens = append(tokens, token)
+	}
+	sort.Strings(tokens)
+
+	conf := PushConf.Apps[req.AppID].Callback
+	size := conf.BatchSize
+	if size <= 0 {
+		size = len(tokens)
+	}
+
+	for start := 0; start < len(tokens); start += size {
+		end := start + size
+		if end > len(tokens) {
+			end = len(tokens)
+		}
+
+		payload := CallbackPayload{
+			ID:       req.id,
+			AppID:    req.AppID,
+			Platform: req.Platform,
+			Attempt:  req.attempt,
+			Results:  make(map[string]*PushResponse, end-start),
+		}
+
+		for _, token := range tokens[start:end] {
+			if r, ok := resp[token]; ok {
+				payload.Results[token] = r
+			} else {
+				// notification is not sent to provider at all.
+				payload.Results[token] = &PushResponse{Status: "failed"}
+			}
+		}
+
+		body, err := json.Marshal(payload)
+		if err != nil {
+			LogError.Error("callback encode error: " + err.Error())
+			continue
+		}
+
+		callbacks.Add(1)
+		go func() {
+			defer callbacks.Done()
+			deliverCallback(req.AppID, url, body)
+		}()
+	}
+}
+
+// deliverCallback posts body to url and retries with backoff until
+// callback.max_retry is reached.
+func deliverCallback(appID, url string, body []byte) {
+	app := PushConf.Apps[appID]
+
+	b := &backoff.Backoff{
+		Min:    app.Retry.BaseDelay,
+		Max:    app.Retry.MaxDelay,
+		Factor: 2,
+		Jitter: app.Retry.Jitter,
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := postCallback(url, app.Callback.Secret, body)
+		if err == nil {
+			return
+		}
+
+		if attempt >= app.Callback.MaxRetry {
+			LogError.Error("callback error: " + err.Error())
+			return
+		}
+
+		delay := b.Duration()
+		LogAccess.Debug("Retry callback ", attempt+1, " of ", app.Callback.MaxRetry, " after ", delay)
+		time.Sleep(delay)
+	}
+}
+
+func postCallback(url, secret string, body []byte) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		// each retry is signed with its own send time.
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(CallbackTimestampHeader, timestamp)
+		req.Header.Set(CallbackSignatureHeader, signCallback(secret, timestamp, body))
+	}
+
+	res, err := callbackClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("callback %s response status: %d", url, res.StatusCode)
+	}
+
+	return nil
+}
+
+// waitCallbacks returns true if all callbacks are delivered before timeout.
+func waitCallbacks(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		callbacks.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
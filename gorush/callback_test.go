@@ -0,0 +1,131 @@
+package gorush
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCallbackURL(t *testing.T) {
+	initTest()
+
+	app := PushConf.Apps[AppNameDefault]
+	app.Callback.URL = "http://localhost/app"
+	PushConf.Apps[AppNameDefault] = app
+
+	req := PushNotification{AppID: AppNameDefault}
+	assert.Equal(t, "http://localhost/app", callbackURL(req))
+
+	req.CallbackURL = "http://localhost/request"
+	assert.Equal(t, "http://localhost/request", callbackURL(req))
+}
+
+func TestSendCallback(t *testing.T) {
+	initTest()
+	InitLog()
+
+	var lock sync.Mutex
+	var payloads []CallbackPayload
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		timestamp := r.Header.Get(CallbackTimestampHeader)
+		assert.Equal(t, signCallback("secret", timestamp, body), r.Header.Get(CallbackSignatureHeader))
+		assert.NotEqual(t, signCallback("secret", "0", body), r.Header.Get(CallbackSignatureHeader))
+
+		sentAt, _ := strconv.ParseInt(timestamp, 10, 64)
+		assert.WithinDuration(t, time.Now(), time.Unix(sentAt, 0), time.Minute)
+
+		var payload CallbackPayload
+		json.Unmarshal(body, &payload)
+
+		lock.Lock()
+		payloads = append(payloads, payload)
+		lock.Unlock()
+	}))
+	defer ts.Close()
+
+	app := PushConf.Apps[AppNameDefault]
+	app.Callback.Secret = "secret"
+	app.Callback.BatchSize = 2
+	PushConf.Apps[AppNameDefault] = app
+
+	req := PushNotification{
+		AppID:       AppNameDefault,
+		Platform:    PlatFormIos,
+		Tokens:      []string{"a", "b", "c", "d"},
+		CallbackURL: ts.URL,
+		id:          "0001",
+	}
+
+	sendCallback(req, map[string]*PushResponse{
+		"a": {Status: "success"},
+		"b": {Status: StatusRetrying},
+		"c": {Status: "failed", Reason: "BadDeviceToken"},
+	})
+	callbacks.Wait()
+
+	results := map[string]*PushResponse{}
+	for _, payload := range payloads {
+		assert.Equal(t, "0001", payload.ID)
+		assert.Equal(t, AppNameDefault, payload.AppID)
+		assert.Equal(t, PlatFormIos, payload.Platform)
+		assert.True(t, len(payload.Results) <= 2)
+		for token, resp := range payload.Results {
+			results[token] = resp
+		}
+	}
+
+	assert.Len(t, payloads, 2)
+	assert.Len(t, results, 3)
+	assert.Equal(t, "success", results["a"].Status)
+	assert.Equal(t, "BadDeviceToken", results["c"].Reason)
+	assert.Equal(t, "failed", results["d"].Status)
+	assert.Nil(t, results["b"])
+}
+
+func TestSendCallbackRetry(t *testing.T) {
+	initTest()
+	InitLog()
+
+	var lock sync.Mutex
+	var count int
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		count++
+		if count == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	app := PushConf.Apps[AppNameDefault]
+	app.Callback.URL = ts.URL
+	app.Callback.MaxRetry = 1
+	app.Retry.BaseDelay = time.Millisecond
+	app.Retry.MaxDelay = time.Millisecond
+	PushConf.Apps[AppNameDefault] = app
+
+	req := PushNotification{
+		AppID:    AppNameDefault,
+		Platform: PlatFormAndroid,
+		Tokens:   []string{"a"},
+	}
+
+	sendCallback(req, map[string]*PushResponse{
+		"a": {Status: "success"},
+	})
+
+	assert.True(t, waitCallbacks(time.Second))
+	assert.Equal(t, 2, count)
+}
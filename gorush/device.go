@@ -0,0 +1,337 @@
+package gorush
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Storage buckets of device registry. Devices are keyed by
+// app_id/platform/token and indexed by app_id/user_id/platform/token.
+const (
+	deviceBucket     = "device"
+	deviceUserBucket = "device-user"
+)
+
+// Device is a registered device token.
+type Device struct {
+	Token     string   `json:"token" binding:"required"`
+	Platform  int      `json:"platform" binding:"required"`
+	AppID     string   `json:"app_id"`
+	UserID    string   `json:"user_id,omitempty"`
+	Locale    string   `json:"locale,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	CreatedAt int64    `json:"created_at"`
+	UpdatedAt int64    `json:"updated_at"`
+}
+
+func deviceKey(appID string, platform int, token string) string {
+	return fmt.Sprintf("%s/%d/%s", appID, platform, token)
+}
+
+func deviceUserKey(appID, userID string, platform int, token string) string {
+	return fmt.Sprintf("%s/%s/%d/%s", appID, userID, platform, token)
+}
+
+// loadDevice returns nil if device is not registered.
+func loadDevice(appID string, platform int, token string) (*Device, error) {
+	data, err := StatStorage.GetRecord(context.Background(), deviceBucket, deviceKey(appID, platform, token))
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var device Device
+	if err := json.Unmarshal(data, &device); err != nil {
+		return nil, err
+	}
+
+	return &device, nil
+}
+
+// registerDevice adds or updates device in registry.
+func registerDevice(device Device) error {
+	if device.Token == "" || strings.Contains(device.Token, "/") {
+		return errors.New("invalid token")
+	}
+
+	if device.Platform != PlatFormIos && device.Platform != PlatFormAndroid && device.Platform != PlatFormAndroidFcm {
+		return fmt.Errorf("invalid platform: %d", device.Platform)
+	}
+
+	if strings.Contains(device.UserID, "/") {
+		return errors.New("user id can't contain /")
+	}
+
+	old, err := loadDevice(device.AppID, device.Platform, device.Token)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	device.CreatedAt = now
+	device.UpdatedAt = now
+
+	if old != nil {
+		device.CreatedAt = old.CreatedAt
+
+		if old.UserID != "" && old.UserID != device.UserID {
+			if err := StatStorage.DeleteRecord(context.Background(), deviceUserBucket, deviceUserKey(old.AppID, old.UserID, old.Platform, old.Token)); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := json.Marshal(device)
+	if err != nil {
+		return err
+	}
+
+	if err := StatStorage.SetRecord(context.Background(), deviceBucket, deviceKey(device.AppID, device.Platform, device.Token), data); err != nil {
+		return err
+	}
+
+	if device.UserID == "" {
+		return nil
+	}
+
+	return StatStorage.SetRecord(context.Background(), deviceUserBucket, deviceUserKey(device.AppID, device.UserID, device.Platform, device.Token), []byte(device.Token))
+}
+
+// unregisterDevice removes device from registry, it returns false if device
+// is not registered.
+func unregisterDevice(appID string, platform int, token string) (bool, error) {
+	device, err := loadDevice(appID, platform, token)
+	if err != nil || device == nil {
+		return false, err
+	}
+
+	if device.UserID != "" {
+		if err := StatStorage.DeleteRecord(context.Background(), deviceUserBucket, deviceUserKey(appID, device.UserID, platform, token)); err != nil {
+			return false, err
+		}
+	}
+
+	return true, StatStorage.DeleteRecord(context.Background(), deviceBucket, deviceKey(appID, platform, token))
+}
+
+// pruneDevice removes token reported invalid by provider from registry, or
+// replaces it with the canonical id.
+func pruneDevice(req PushNotification, token, reason, canonicalID string) {
+	device, err := loadDevice(req.AppID, req.Platform, token)
+	if err != nil || device == nil {
+		return
+	}
+
+	if _, err := unregisterDevice(req.AppID, req.Platform, token); err != nil {
+		LogError.Error("device registry error: " + err.Error())
+		return
+	}
+
+	if canonicalID == "" || invalidTokenReasons[reason] {
+		LogAccess.Debug("Remove invalid token from device registry: " + hideToken(token, 10))
+		return
+	}
+
+	device.Token = canonicalID
+	if err := registerDevice(*device); err != nil {
+		LogError.Error("device registry error: " + err.Error())
+	}
+}
+
+// findDevices returns devices of app which belong to one of users and match
+// the tag expression. Platform zero means all platforms.
+func findDevices(appID string, platform int, userIDs []string, expr tagExpr) ([]Device, error) {
+	var keys []string
+	var devices []Device
+
+	if len(userIDs) > 0 {
+		for _, userID := range userIDs {
+			prefix := appID + "/" + userID + "/"
+			if platform != 0 {
+				prefix = fmt.Sprintf("%s%d/", prefix, platform)
+			}
+
+			err := StatStorage.RangeRecords(context.Background(), deviceUserBucket, prefix, "", func(key string, value []byte) bool {
+				keys = append(keys, appID+"/"+strings.TrimPrefix(key, appID+"/"+userID+"/"))
+				return true
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		prefix := appID + "/"
+		if platform != 0 {
+			prefix = fmt.Sprintf("%s%d/", prefix, platform)
+		}
+
+		err := StatStorage.RangeRecords(context.Background(), deviceBucket, prefix, "", func(key string, value []byte) bool {
+			var device Device
+			if err := json.Unmarshal(value, &device); err != nil {
+				LogError.Error("device decode error: " + err.Error())
+				return true
+			}
+
+			if expr == nil || expr.match(deviceTags(device)) {
+				devices = append(devices, device)
+			}
+			return true
+		})
+
+		return devices, err
+	}
+
+	for _, key := range keys {
+		data, err := StatStorage.GetRecord(context.Background(), deviceBucket, key)
+		if err != nil {
+			return nil, err
+		}
+		if data == nil {
+			continue
+		}
+
+		var device Device
+		if err := json.Unmarshal(data, &device); err != nil {
+			LogError.Error("device decode error: " + err.Error())
+			continue
+		}
+
+		if expr == nil || expr.match(deviceTags(device)) {
+			devices = append(devices, device)
+		}
+	}
+
+	return devices, nil
+}
+
+func deviceTags(device Device) map[string]bool {
+	tags := make(map[string]bool, len(device.Tags))
+	for _, tag := range device.Tags {
+		tags[tag] = true
+	}
+
+	return tags
+}
+
+// listDevices returns at most limit devices of app after cursor. The
+// returned cursor is empty if there is no more device.
+func listDevices(appID string, platform int, cursor string, limit int) ([]Device, string, error) {
+	devices := []Device{}
+	more := false
+	var last string
+
+	prefix := appID + "/"
+	if platform != 0 {
+		prefix = fmt.Sprintf("%s%d/", prefix, platform)
+	}
+
+	err := StatStorage.RangeRecords(context.Background(), deviceBucket, prefix, cursor, func(key string, value []byte) bool {
+		var device Device
+		if err := json.Unmarshal(value, &device); err != nil {
+			LogError.Error("device decode error: " + err.Error())
+			return true
+		}
+
+		if len(devices) == limit {
+			more = true
+			return false
+		}
+
+		devices = append(devices, device)
+		last = key
+		return true
+	})
+
+	if err != nil || !more {
+		return devices, "", err
+	}
+
+	return devices, last, nil
+}
+
+// expandNotifications replaces notifications which target user_ids or tags
+// with one notification per platform of registered devices. If template of
+// notification has no locale, devices are also grouped by their locale.
+func expandNotifications(notifications []PushNotification) ([]PushNotification, error) {
+	var expanded []PushNotification
+
+	for _, notification := range notifications {
+		if len(notification.UserIDs) == 0 && notification.Tags == "" {
+			expanded = append(expanded, notification)
+			continue
+		}
+
+		if notification.AppID == "" {
+			notification.AppID = AppNameDefault
+		}
+
+		var expr tagExpr
+		if notification.Tags != "" {
+			var err error
+			if expr, err = parseTagExpr(notification.Tags); err != nil {
+				return nil, err
+			}
+		}
+
+		devices, err := findDevices(notification.AppID, notification.Platform, notification.UserIDs, expr)
+		if err != nil {
+			return nil, err
+		}
+
+		type group struct {
+			platform int
+			locale   string
+		}
+
+		var groups []group
+		tokens := make(map[group][]string)
+		seen := make(map[string]bool)
+
+		add := func(g group, token string) {
+			key := fmt.Sprintf("%d/%s", g.platform, token)
+			if seen[key] {
+				return
+			}
+			seen[key] = true
+
+			if _, ok := tokens[g]; !ok {
+				groups = append(groups, g)
+			}
+			tokens[g] = append(tokens[g], token)
+		}
+
+		for _, token := range notification.Tokens {
+			add(group{notification.Platform, notification.Locale}, token)
+		}
+
+		for _, device := range devices {
+			g := group{device.Platform, notification.Locale}
+			if notification.Template != "" && notification.Locale == "" {
+				g.locale = device.Locale
+			}
+			add(g, device.Token)
+		}
+
+		if len(groups) == 0 {
+			LogAccess.Debug("No registered device matches notification of app: " + notification.AppID)
+		}
+
+		for _, g := range groups {
+			n := notification
+			n.Platform = g.platform
+			n.Locale = g.locale
+			n.Tokens = tokens[g]
+			n.UserIDs = nil
+			n.Tags = ""
+			if n.IdempotencyKey != "" {
+				n.IdempotencyKey = fmt.Sprintf("%s/%d/%s", n.IdempotencyKey, g.platform, g.locale)
+			}
+			expanded = append(expanded, n)
+		}
+	}
+
+	return expanded, nil
+}
@@ -0,0 +1,213 @@
+package gorush
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/buger/jsonparser"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/appleboy/gofight.v2"
+)
+
+func initDeviceTest() {
+	initTest()
+	InitLog()
+	InitAppStatus()
+
+	devices := []Device{
+		{Token: "ios-a", Platform: PlatFormIos, AppID: AppNameDefault, UserID: "alice", Locale: "en", Tags: []string{"news"}},
+		{Token: "fcm-a", Platform: PlatFormAndroidFcm, AppID: AppNameDefault, UserID: "alice", Locale: "zh-TW", Tags: []string{"news", "beta"}},
+		{Token: "ios-b", Platform: PlatFormIos, AppID: AppNameDefault, UserID: "bob", Locale: "zh-TW"},
+		{Token: "ios-c", Platform: PlatFormIos, AppID: AppNameDefault, Tags: []string{"sport"}},
+	}
+
+	for _, device := range devices {
+		registerDevice(device)
+	}
+}
+
+func deviceTokens(devices []Device) []string {
+	var tokens []string
+	for _, device := range devices {
+		tokens = append(tokens, device.Token)
+	}
+
+	return tokens
+}
+
+func TestRegisterDevice(t *testing.T) {
+	initDeviceTest()
+
+	assert.Error(t, registerDevice(Device{Token: "", Platform: PlatFormIos}))
+	assert.Error(t, registerDevice(Device{Token: "aaaaa", Platform: 9}))
+	assert.Error(t, registerDevice(Device{Token: "aaaaa", Platform: PlatFormIos, UserID: "a/b"}))
+
+	devices, err := findDevices(AppNameDefault, 0, []string{"alice"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ios-a", "fcm-a"}, deviceTokens(devices))
+
+	devices, _ = findDevices(AppNameDefault, PlatFormIos, []string{"alice", "bob"}, nil)
+	assert.Equal(t, []string{"ios-a", "ios-b"}, deviceTokens(devices))
+
+	expr, _ := parseTagExpr("news && !beta")
+	devices, _ = findDevices(AppNameDefault, 0, nil, expr)
+	assert.Equal(t, []string{"ios-a"}, deviceTokens(devices))
+
+	// move device to another user
+	assert.NoError(t, registerDevice(Device{Token: "ios-a", Platform: PlatFormIos, AppID: AppNameDefault, UserID: "bob"}))
+	devices, _ = findDevices(AppNameDefault, 0, []string{"alice"}, nil)
+	assert.Equal(t, []string{"fcm-a"}, deviceTokens(devices))
+	devices, _ = findDevices(AppNameDefault, 0, []string{"bob"}, nil)
+	assert.Equal(t, []string{"ios-a", "ios-b"}, deviceTokens(devices))
+
+	ok, err := unregisterDevice(AppNameDefault, PlatFormIos, "ios-b")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, _ = unregisterDevice(AppNameDefault, PlatFormIos, "ios-b")
+	assert.False(t, ok)
+	devices, _ = findDevices(AppNameDefault, 0, []string{"bob"}, nil)
+	assert.Equal(t, []string{"ios-a"}, deviceTokens(devices))
+
+	devices, cursor, err := listDevices(AppNameDefault, PlatFormIos, "", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ios-a"}, deviceTokens(devices))
+	devices, cursor, _ = listDevices(AppNameDefault, PlatFormIos, cursor, 1)
+	assert.Equal(t, []string{"ios-c"}, deviceTokens(devices))
+	assert.Equal(t, "", cursor)
+}
+
+func TestPruneDevice(t *testing.T) {
+	initDeviceTest()
+
+	req := PushNotification{AppID: AppNameDefault, Platform: PlatFormIos}
+	recordFeedback(req, "ios-c", "BadDeviceToken", "")
+
+	device, _ := loadDevice(AppNameDefault, PlatFormIos, "ios-c")
+	assert.Nil(t, device)
+
+	req.Platform = PlatFormAndroidFcm
+	recordFeedback(req, "fcm-a", "", "fcm-new")
+
+	device, _ = loadDevice(AppNameDefault, PlatFormAndroidFcm, "fcm-a")
+	assert.Nil(t, device)
+	device, _ = loadDevice(AppNameDefault, PlatFormAndroidFcm, "fcm-new")
+	if assert.NotNil(t, device) {
+		assert.Equal(t, "alice", device.UserID)
+		assert.Equal(t, []string{"news", "beta"}, device.Tags)
+	}
+
+	devices, _ := findDevices(AppNameDefault, 0, []string{"alice"}, nil)
+	assert.Equal(t, []string{"ios-a", "fcm-new"}, deviceTokens(devices))
+}
+
+func TestExpandNotifications(t *testing.T) {
+	initDeviceTest()
+
+	notifications, err := expandNotifications([]PushNotification{
+		{Tokens: []string{"raw"}, Platform: PlatFormAndroid, Message: "raw"},
+		{UserIDs: []string{"alice", "bob"}, Tokens: []string{"ios-b"}, Platform: PlatFormIos, Message: "users"},
+		{Tags: "news", Template: "welcome"},
+		{Tags: "unknown"},
+	})
+	assert.NoError(t, err)
+
+	// notification without matched device is dropped
+	if assert.Len(t, notifications, 4) {
+		assert.Equal(t, []string{"raw"}, notifications[0].Tokens)
+
+		// duplicated token is sent once
+		assert.Equal(t, PlatFormIos, notifications[1].Platform)
+		assert.Equal(t, []string{"ios-b", "ios-a"}, notifications[1].Tokens)
+		assert.Nil(t, notifications[1].UserIDs)
+
+		// template without locale is grouped by locale of device
+		assert.Equal(t, PlatFormIos, notifications[2].Platform)
+		assert.Equal(t, "en", notifications[2].Locale)
+		assert.Equal(t, []string{"ios-a"}, notifications[2].Tokens)
+		assert.Equal(t, "", notifications[2].Tags)
+		assert.Equal(t, PlatFormAndroidFcm, notifications[3].Platform)
+		assert.Equal(t, "zh-TW", notifications[3].Locale)
+		assert.Equal(t, []string{"fcm-a"}, notifications[3].Tokens)
+	}
+
+	_, err = expandNotifications([]PushNotification{{Tags: "news &&"}})
+	assert.Error(t, err)
+}
+
+func TestDeviceHandler(t *testing.T) {
+	initTest()
+	InitLog()
+	InitAppStatus()
+
+	r := gofight.New()
+
+	r.POST("/api/devices").
+		SetJSON(gofight.D{
+			"token":    "aaaaa",
+			"platform": PlatFormIos,
+			"user_id":  "alice",
+			"tags":     []string{"news"},
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+
+	r.POST("/api/devices").
+		SetJSON(gofight.D{
+			"token": "aaaaa",
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusBadRequest, r.Code)
+		})
+
+	r.GET("/api/devices?user_id=alice").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			data := []byte(r.Body.String())
+			token, _ := jsonparser.GetString(data, "devices", "[0]", "token")
+
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Equal(t, "aaaaa", token)
+		})
+
+	r.GET("/api/devices?tags=sport").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Equal(t, `{"cursor":"","devices":[]}`, r.Body.String())
+		})
+
+	r.POST("/api/push").
+		SetJSON(gofight.D{
+			"notifications": []gofight.D{
+				{
+					"tags":    "news || sport",
+					"message": "Welcome",
+				},
+			},
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+
+	r.POST("/api/push").
+		SetJSON(gofight.D{
+			"notifications": []gofight.D{
+				{
+					"tags":    "news ||",
+					"message": "Welcome",
+				},
+			},
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusBadRequest, r.Code)
+		})
+
+	r.DELETE("/api/devices?platform=1&token=aaaaa").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+
+	r.DELETE("/api/devices?platform=1&token=aaaaa").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusNotFound, r.Code)
+		})
+}
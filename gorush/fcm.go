@@ -0,0 +1,295 @@
+package gorush
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NaySoftware/go-fcm"
+)
+
+// fcmMaxRegistrationIds is the max number of tokens of one FCM request.
+const fcmMaxRegistrationIds = 1000
+
+// fcmServerURL is a mutable var for testing purposes
+var fcmServerURL = "https://fcm.googleapis.com/fcm/send"
+
+// FcmSender sends FCM messages for one app. Unlike fcm.FcmClient it keeps
+// no message state, so it is safe for concurrent use by all workers.
+type FcmSender struct {
+	apiKey string
+	client *http.Client
+}
+
+// FcmClients is collection of FCM senders
+type FcmClients struct {
+	lock    sync.RWMutex
+	clients map[string]*FcmSender
+}
+
+var fcmClients = &FcmClients{clients: make(map[string]*FcmSender)}
+
+// NewFcmSender returns FCM sender with api key. The http client uses
+// http.DefaultTransport, so proxy setting is applied.
+func NewFcmSender(apiKey string) *FcmSender {
+	return &FcmSender{
+		apiKey: apiKey,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// Send the message to FCM server.
+func (s *FcmSender) Send(msg *fcm.FcmMsg) (*fcm.FcmResponseStatus, error) {
+	status := new(fcm.FcmResponseStatus)
+
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return status, err
+	}
+
+	req, err := http.NewRequest("POST", fcmServerURL, bytes.NewBuffer(body))
+	if err != nil {
+		return status, err
+	}
+	req.Header.Set("Authorization", "key="+s.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return status, err
+	}
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return status, err
+	}
+
+	status.StatusCode = res.StatusCode
+	status.RetryAfter = res.Header.Get("Retry-After")
+
+	if res.StatusCode != http.StatusOK {
+		return status, nil
+	}
+
+	if err := json.Unmarshal(data, status); err != nil {
+		return status, err
+	}
+	status.Ok = true
+
+	return status, nil
+}
+
+// fcmRetryAfter returns the Retry-After of FCM response. FCM sends seconds,
+// other values are parsed by go-fcm in Go duration format.
+func fcmRetryAfter(res *fcm.FcmResponseStatus) time.Duration {
+	if seconds, err := strconv.Atoi(strings.TrimSpace(res.RetryAfter)); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if d, err := res.GetRetryAfterTime(); err == nil {
+		return d
+	}
+
+	return 0
+}
+
+// initFCMClient initializes an FCM sender for the given AppID.
+func initFCMClient(AppID string) (*FcmSender, error) {
+	if !PushConf.Apps[AppID].AndroidFcm.Enabled {
+		return nil, errors.New("FCM not enabled")
+	}
+
+	return NewFcmSender(PushConf.Apps[AppID].AndroidFcm.APIKey), nil
+}
+
+// GetFcmClient returns an existing FCM sender of app if available else
+// creates a new one and returns
+func GetFcmClient(AppID string) (*FcmSender, error) {
+	fcmClients.lock.RLock()
+	client, present := fcmClients.clients[AppID]
+	fcmClients.lock.RUnlock()
+
+	if present {
+		return client, nil
+	}
+
+	fcmClients.lock.Lock()
+	defer fcmClients.lock.Unlock()
+
+	if client, present = fcmClients.clients[AppID]; present {
+		return client, nil
+	}
+
+	client, err := initFCMClient(AppID)
+	if err != nil {
+		return nil, err
+	}
+
+	fcmClients.clients[AppID] = client
+
+	return client, nil
+}
+
+// GetFcmMessage use for define FCM message without target tokens.
+func GetFcmMessage(req PushNotification) fcm.FcmMsg {
+	notification, data := GetFcmNotification(req)
+
+	msg := fcm.FcmMsg{
+		Data:                  data,
+		Notification:          *notification,
+		CollapseKey:           req.CollapseKey,
+		ContentAvailable:      req.ContentAvailable,
+		DelayWhileIdle:        req.DelayWhileIdle,
+		RestrictedPackageName: req.RestrictedPackageName,
+		DryRun:                req.DryRun,
+	}
+
+	if req.Priority == "high" {
+		msg.Priority = fcm.Priority_HIGH
+	}
+
+	if req.TimeToLive != nil {
+		msg.TimeToLive = int(*req.TimeToLive)
+	}
+
+	return msg
+}
+
+// PushToAndroidFcm provide send notification through FCM. Tokens are sent
+// in batches of registration_ids and the results are mapped back by index.
+func PushToAndroidFcm(req PushNotification) map[string]*PushResponse {
+	LogAccess.Debug("Start push notification for FCM")
+
+	var retryTokens []string
+	var retryAfter time.Duration
+	pushResponse := make(map[string]*PushResponse, 0)
+
+	req, failed := pushTemplate(req)
+	if failed != nil {
+		return failed
+	}
+
+	// get fcm client
+	fcmClient, err := GetFcmClient(req.AppID)
+	if err != nil {
+		LogPush(FailedPush, "", req, err)
+		countPushDrop(req, reasonClientError, len(req.Tokens))
+		return pushResponse
+	}
+
+	for start := 0; start < len(req.Tokens); start += fcmMaxRegistrationIds {
+		end := start + fcmMaxRegistrationIds
+		if end > len(req.Tokens) {
+			end = len(req.Tokens)
+		}
+		tokens := req.Tokens[start:end]
+
+		msg := GetFcmMessage(req)
+		msg.RegistrationIds = tokens
+
+		// Send fcm msg
+		span := startPushSpan(req, "fcm.send", tokens)
+		sentAt := time.Now()
+		res, err := fcmClient.Send(&msg)
+
+		// network error is transient
+		retryable := err != nil
+		reason := reasonRequestError
+
+		// FCM may ask to back off on 200 with Unavailable results too.
+		if err == nil {
+			if d := fcmRetryAfter(res); d > retryAfter {
+				retryAfter = d
+			}
+		}
+
+		if err == nil && !res.Ok {
+			err = fmt.Errorf("FCM server error: %d", res.StatusCode)
+			retryable = isRetryableStatus(res.StatusCode)
+			reason = httpStatusReason(res.StatusCode)
+		}
+
+		if err != nil {
+			// whole batch failed
+			for _, token := range tokens {
+				pushResponse[token] = &PushResponse{
+					Status: "failed",
+					Error:  err.Error(),
+				}
+
+				LogPush(FailedPush, token, req, err)
+			}
+
+			addPushError(PlatFormAndroidFcm, req.AppID, reason, int64(len(tokens)))
+			observeProviderRequest(req, outcomeError, sentAt)
+			countPushError(req, reason, len(tokens))
+			finishPushSpan(span, outcomeError, len(tokens), err)
+			if retryable {
+				retryTokens = append(retryTokens, tokens...)
+			}
+			continue
+		}
+
+		if res.Fail > 0 || len(res.Results) < len(tokens) {
+			observeProviderRequest(req, outcomeFailed, sentAt)
+		} else {
+			observeProviderRequest(req, outcomeSuccess, sentAt)
+		}
+
+		for k, token := range tokens {
+			pushResponse[token] = &PushResponse{
+				Status: "success",
+			}
+
+			if k >= len(res.Results) {
+				pushResponse[token].Status = "failed"
+				pushResponse[token].Error = "missing FCM result"
+
+				LogPush(FailedPush, token, req, errors.New(pushResponse[token].Error))
+				addPushError(PlatFormAndroidFcm, req.AppID, reasonMissingResult, 1)
+				countPushError(req, reasonMissingResult, 1)
+				continue
+			}
+
+			result := res.Results[k]
+
+			if canonicalID := result["registration_id"]; canonicalID != "" {
+				pushResponse[token].CanonicalId = canonicalID
+			}
+
+			recordFeedback(req, token, result["error"], result["registration_id"])
+
+			if reason := result["error"]; reason != "" {
+				pushResponse[token].Status = "failed"
+				pushResponse[token].Reason = reason
+
+				LogPush(FailedPush, token, req, errors.New(reason))
+				addPushError(PlatFormAndroidFcm, req.AppID, reason, 1)
+				countPushError(req, reason, 1)
+				if isRetryableReason(req.Platform, reason) {
+					retryTokens = append(retryTokens, token)
+				}
+				continue
+			}
+
+			LogPush(SucceededPush, token, req, nil)
+			addPushSuccess(PlatFormAndroidFcm, req.AppID, 1)
+		}
+		finishTokensSpan(span, tokens, pushResponse)
+	}
+
+	// resend transient failed tokens
+	scheduleRetry(req, retryTokens, retryAfter, pushResponse)
+
+	return pushResponse
+}
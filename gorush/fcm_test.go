@@ -0,0 +1,225 @@
+package gorush
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/NaySoftware/go-fcm"
+	"github.com/lalit-verma/gorush/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func resetFcmClients() {
+	fcmClients.lock.Lock()
+	fcmClients.clients = make(map[string]*FcmSender)
+	fcmClients.lock.Unlock()
+}
+
+func initFcmTest(t *testing.T, handler http.HandlerFunc) func() {
+	PushConf = config.BuildDefaultPushConf()
+	InitLog()
+	InitAppStatus()
+	resetFcmClients()
+
+	app := PushConf.Apps[AppNameDefault]
+	app.AndroidFcm.Enabled = true
+	app.AndroidFcm.APIKey = "test-key"
+	PushConf.Apps[AppNameDefault] = app
+
+	ts := httptest.NewServer(handler)
+	serverURL := fcmServerURL
+	fcmServerURL = ts.URL
+
+	return func() {
+		fcmServerURL = serverURL
+		ts.Close()
+		resetFcmClients()
+	}
+}
+
+func TestGetFcmClient(t *testing.T) {
+	PushConf = config.BuildDefaultPushConf()
+	resetFcmClients()
+
+	_, err := GetFcmClient(AppNameDefault)
+	assert.Error(t, err)
+
+	app := PushConf.Apps[AppNameDefault]
+	app.AndroidFcm.Enabled = true
+	app.AndroidFcm.APIKey = "test-key"
+	PushConf.Apps[AppNameDefault] = app
+
+	first, err := GetFcmClient(AppNameDefault)
+	assert.NoError(t, err)
+	second, _ := GetFcmClient(AppNameDefault)
+	assert.True(t, first == second)
+
+	resetFcmClients()
+}
+
+func TestPushToAndroidFcmBatch(t *testing.T) {
+	var lock sync.Mutex
+	var batches []int
+
+	done := initFcmTest(t, func(w http.ResponseWriter, r *http.Request) {
+		var msg fcm.FcmMsg
+		json.NewDecoder(r.Body).Decode(&msg)
+
+		lock.Lock()
+		batches = append(batches, len(msg.RegistrationIds))
+		lock.Unlock()
+
+		assert.Equal(t, "key=test-key", r.Header.Get("Authorization"))
+		assert.Equal(t, "Welcome", msg.Notification.Body)
+
+		results := make([]map[string]string, len(msg.RegistrationIds))
+		for i, token := range msg.RegistrationIds {
+			switch token {
+			case "bad":
+				results[i] = map[string]string{"error": "NotRegistered"}
+			case "old":
+				results[i] = map[string]string{"message_id": "1", "registration_id": "new"}
+			default:
+				results[i] = map[string]string{"message_id": "1"}
+			}
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"results": results,
+		})
+	})
+	defer done()
+
+	tokens := []string{"bad", "old"}
+	for i := 0; len(tokens) < fcmMaxRegistrationIds+1; i++ {
+		tokens = append(tokens, fmt.Sprintf("token-%d", i))
+	}
+
+	req := PushNotification{
+		AppID:    AppNameDefault,
+		Tokens:   tokens,
+		Platform: PlatFormAndroidFcm,
+		Message:  "Welcome",
+	}
+
+	resp := PushToAndroidFcm(req)
+
+	assert.Equal(t, []int{fcmMaxRegistrationIds, 1}, batches)
+	assert.Len(t, resp, len(tokens))
+	assert.Equal(t, "failed", resp["bad"].Status)
+	assert.Equal(t, "NotRegistered", resp["bad"].Reason)
+	assert.Equal(t, "success", resp["old"].Status)
+	assert.Equal(t, "new", resp["old"].CanonicalId)
+	assert.Equal(t, "success", resp[tokens[len(tokens)-1]].Status)
+	assert.Equal(t, int64(len(tokens)-1), pushStatus().AndroidFcm.PushSuccess)
+	assert.Equal(t, int64(1), pushStatus().AndroidFcm.PushError)
+	assert.Equal(t, int64(1), pushStatus().Apps[AppNameDefault].AndroidFcm.Errors["NotRegistered"])
+
+	feedbacks, _, _ := listFeedback(AppNameDefault, PlatFormAndroidFcm, "", 10)
+	if assert.Len(t, feedbacks, 2) {
+		assert.Equal(t, "bad", feedbacks[0].Token)
+		assert.Equal(t, "NotRegistered", feedbacks[0].Reason)
+		assert.Equal(t, "old", feedbacks[1].Token)
+		assert.Equal(t, "new", feedbacks[1].CanonicalID)
+	}
+}
+
+func TestPushToAndroidFcmServerError(t *testing.T) {
+	done := initFcmTest(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "10")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer done()
+
+	req := PushNotification{
+		AppID:    AppNameDefault,
+		Tokens:   []string{"aaaaaa", "bbbbb"},
+		Platform: PlatFormAndroidFcm,
+		Message:  "Welcome",
+	}
+
+	resp := PushToAndroidFcm(req)
+
+	assert.Equal(t, "failed", resp["aaaaaa"].Status)
+	assert.Equal(t, "FCM server error: 503", resp["bbbbb"].Error)
+	assert.Equal(t, int64(2), pushStatus().AndroidFcm.PushError)
+	assert.Equal(t, int64(2), pushStatus().AndroidFcm.Errors[statReasonOther])
+}
+
+func TestFcmRetryAfter(t *testing.T) {
+	assert.Equal(t, 120*time.Second, fcmRetryAfter(&fcm.FcmResponseStatus{RetryAfter: "120"}))
+	assert.Equal(t, time.Minute, fcmRetryAfter(&fcm.FcmResponseStatus{RetryAfter: "1m"}))
+	assert.Equal(t, time.Duration(0), fcmRetryAfter(&fcm.FcmResponseStatus{}))
+	assert.Equal(t, time.Duration(0), fcmRetryAfter(&fcm.FcmResponseStatus{RetryAfter: "Wed, 21 Oct 2015 07:28:00 GMT"}))
+}
+
+func TestPushToAndroidFcmUnavailableRetryAfter(t *testing.T) {
+	done := initFcmTest(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "1")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"failure": 1,
+			"results": []map[string]string{{"error": "Unavailable"}},
+		})
+	})
+	defer done()
+
+	app := PushConf.Apps[AppNameDefault]
+	app.Retry.MaxRetry = 1
+	app.Retry.BaseDelay = time.Millisecond
+	app.Retry.MaxDelay = time.Millisecond
+	PushConf.Apps[AppNameDefault] = app
+
+	// no worker reads from this channel.
+	QueueNotification = make(chan PushNotification, 1)
+	defer atomic.StoreInt64(&pendingNotifications, 0)
+
+	resp := PushToAndroidFcm(PushNotification{
+		AppID:    AppNameDefault,
+		Tokens:   []string{"aaaaaa"},
+		Platform: PlatFormAndroidFcm,
+		Message:  "Welcome",
+	})
+	assert.Equal(t, StatusRetrying, resp["aaaaaa"].Status)
+
+	// Retry-After of successful response overrides the backoff.
+	select {
+	case <-QueueNotification:
+		assert.Fail(t, "retry is sent before Retry-After")
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	select {
+	case retry := <-QueueNotification:
+		assert.Equal(t, []string{"aaaaaa"}, retry.Tokens)
+	case <-time.After(2 * time.Second):
+		assert.Fail(t, "retry is not sent to workers")
+	}
+}
+
+func TestGetFcmMessage(t *testing.T) {
+	timeToLive := uint(60)
+	req := PushNotification{
+		Tokens:      []string{"aaaaaa"},
+		Platform:    PlatFormAndroidFcm,
+		Message:     "Welcome",
+		Priority:    "high",
+		CollapseKey: "1",
+		TimeToLive:  &timeToLive,
+		DryRun:      true,
+	}
+
+	msg := GetFcmMessage(req)
+
+	assert.Equal(t, "Welcome", msg.Notification.Body)
+	assert.Equal(t, "high", msg.Priority)
+	assert.Equal(t, "1", msg.CollapseKey)
+	assert.Equal(t, 60, msg.TimeToLive)
+	assert.True(t, msg.DryRun)
+	assert.Empty(t, msg.RegistrationIds)
+}
@@ -0,0 +1,134 @@
+package gorush
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// feedbackBucket is the storage bucket of invalid token feedback.
+const feedbackBucket = "feedback"
+
+// Provider reasons which mean the device token is invalid and should be
+// removed from the token database.
+var invalidTokenReasons = map[string]bool{
+	"Unregistered":        true,
+	"BadDeviceToken":      true,
+	"NotRegistered":       true,
+	"InvalidRegistration": true,
+}
+
+// Feedback is an invalid or replaced device token reported by provider.
+type Feedback struct {
+	ID          string `json:"id"`
+	AppID       string `json:"app_id"`
+	Platform    int    `json:"platform"`
+	Token       string `json:"token"`
+	Reason      string `json:"reason,omitempty"`
+	CanonicalID string `json:"canonical_id,omitempty"`
+	CreatedAt   int64  `json:"created_at"`
+}
+
+// RequestFeedbackAck is the body of feedback acknowledge request.
+type RequestFeedbackAck struct {
+	IDs []string `json:"ids" binding:"required"`
+}
+
+// feedbackPrefix returns the key prefix of app and platform, keys are stored
+// as app_id/platform/id so feedback can be listed per app and platform.
+func feedbackPrefix(appID string, platform int) string {
+	if appID == "" {
+		return ""
+	}
+
+	if platform == 0 {
+		return appID + "/"
+	}
+
+	return fmt.Sprintf("%s/%d/", appID, platform)
+}
+
+// recordFeedback save the token into feedback store when provider reports
+// it as invalid or returns a canonical id replacement, and updates device
+// registry accordingly.
+func recordFeedback(req PushNotification, token, reason, canonicalID string) {
+	if !invalidTokenReasons[reason] && canonicalID == "" {
+		return
+	}
+
+	feedback := Feedback{
+		AppID:       req.AppID,
+		Platform:    req.Platform,
+		Token:       token,
+		Reason:      reason,
+		CanonicalID: canonicalID,
+		CreatedAt:   time.Now().Unix(),
+	}
+	feedback.ID = feedbackPrefix(req.AppID, req.Platform) + newSortableID()
+
+	data, err := json.Marshal(feedback)
+	if err != nil {
+		LogError.Error("feedback encode error: " + err.Error())
+		return
+	}
+
+	if err := StatStorage.SetRecord(context.Background(), feedbackBucket, feedback.ID, data); err != nil {
+		LogError.Error("feedback store error: " + err.Error())
+	}
+
+	pruneDevice(req, token, reason, canonicalID)
+}
+
+// listFeedback returns at most limit feedback after cursor. The returned
+// cursor is empty if there is no more feedback.
+func listFeedback(appID string, platform int, cursor string, limit int) ([]Feedback, string, error) {
+	feedbacks := []Feedback{}
+	more := false
+
+	err := StatStorage.RangeRecords(context.Background(), feedbackBucket, feedbackPrefix(appID, platform), cursor, func(key string, value []byte) bool {
+		var feedback Feedback
+		if err := json.Unmarshal(value, &feedback); err != nil {
+			LogError.Error("feedback decode error: " + err.Error())
+			return true
+		}
+
+		// platform filter without app id can't use the key prefix.
+		if platform != 0 && feedback.Platform != platform {
+			return true
+		}
+
+		if len(feedbacks) == limit {
+			more = true
+			return false
+		}
+
+		feedbacks = append(feedbacks, feedback)
+		return true
+	})
+
+	if err != nil || !more {
+		return feedbacks, "", err
+	}
+
+	return feedbacks, feedbacks[len(feedbacks)-1].ID, nil
+}
+
+// ackFeedback remove acknowledged feedback from store.
+func ackFeedback(ids []string) (int, error) {
+	count := 0
+	for _, id := range ids {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+
+		if err := StatStorage.DeleteRecord(context.Background(), feedbackBucket, id); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
@@ -0,0 +1,118 @@
+package gorush
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/buger/jsonparser"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/appleboy/gofight.v2"
+)
+
+func TestRecordFeedback(t *testing.T) {
+	initTest()
+	InitLog()
+	InitAppStatus()
+
+	req := PushNotification{
+		AppID:    AppNameDefault,
+		Platform: PlatFormIos,
+	}
+
+	recordFeedback(req, "token1", "BadDeviceToken", "")
+	recordFeedback(req, "token2", "TooManyRequests", "")
+	recordFeedback(req, "token3", "", "")
+
+	req.Platform = PlatFormAndroid
+	recordFeedback(req, "token4", "", "canonical4")
+	recordFeedback(req, "token5", "NotRegistered", "")
+
+	feedbacks, cursor, err := listFeedback(AppNameDefault, 0, "", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, "", cursor)
+	if assert.Len(t, feedbacks, 3) {
+		assert.Equal(t, "token1", feedbacks[0].Token)
+		assert.Equal(t, "BadDeviceToken", feedbacks[0].Reason)
+		assert.Equal(t, "token4", feedbacks[1].Token)
+		assert.Equal(t, "canonical4", feedbacks[1].CanonicalID)
+		assert.Equal(t, "token5", feedbacks[2].Token)
+	}
+
+	feedbacks, _, err = listFeedback(AppNameDefault, PlatFormAndroid, "", 10)
+	assert.NoError(t, err)
+	assert.Len(t, feedbacks, 2)
+
+	feedbacks, _, err = listFeedback("", PlatFormIos, "", 10)
+	assert.NoError(t, err)
+	assert.Len(t, feedbacks, 1)
+
+	feedbacks, _, err = listFeedback("unknown", 0, "", 10)
+	assert.NoError(t, err)
+	assert.Len(t, feedbacks, 0)
+}
+
+func TestFeedbackHandler(t *testing.T) {
+	initTest()
+	InitLog()
+	InitAppStatus()
+
+	req := PushNotification{
+		AppID:    AppNameDefault,
+		Platform: PlatFormAndroidFcm,
+	}
+	recordFeedback(req, "token1", "InvalidRegistration", "")
+	recordFeedback(req, "token2", "NotRegistered", "")
+	recordFeedback(req, "token3", "NotRegistered", "")
+
+	r := gofight.New()
+
+	var cursor string
+	var ids []string
+	r.GET("/api/feedback?platform=3&limit=2&app_id="+AppNameDefault).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			data := []byte(r.Body.String())
+			cursor, _ = jsonparser.GetString(data, "cursor")
+			jsonparser.ArrayEach(data, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+				id, _ := jsonparser.GetString(value, "id")
+				ids = append(ids, id)
+			}, "feedback")
+
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+
+	assert.Len(t, ids, 2)
+	assert.Equal(t, ids[1], cursor)
+
+	r.GET("/api/feedback?cursor="+cursor).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			data := []byte(r.Body.String())
+			token, _ := jsonparser.GetString(data, "feedback", "[0]", "token")
+			next, _ := jsonparser.GetString(data, "cursor")
+
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Equal(t, "token3", token)
+			assert.Equal(t, "", next)
+		})
+
+	r.GET("/api/feedback?limit=0").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusBadRequest, r.Code)
+		})
+
+	r.POST("/api/feedback/ack").
+		SetJSON(gofight.D{
+			"ids": ids,
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			acked, _ := jsonparser.GetInt([]byte(r.Body.String()), "acked")
+
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Equal(t, int64(2), acked)
+		})
+
+	feedbacks, _, err := listFeedback(AppNameDefault, 0, "", 10)
+	assert.NoError(t, err)
+	if assert.Len(t, feedbacks, 1) {
+		assert.Equal(t, "token3", feedbacks[0].Token)
+	}
+}
@@ -1,8 +1,6 @@
 package gorush
 
 import (
-	"crypto/tls"
-
 	"github.com/Sirupsen/logrus"
 	"github.com/lalit-verma/gorush/config"
 	apns "github.com/sideshow/apns2"
@@ -11,10 +9,12 @@ import (
 var (
 	// PushConf is gorush config
 	PushConf config.ConfYaml
+	// ConfSources records where each config value comes from
+	ConfSources config.Sources
 	// QueueNotification is chan type
 	QueueNotification chan PushNotification
-	// CertificatePemIos is ios certificate file
-	CertificatePemIos tls.Certificate
+	// NotificationQueue implements the queue interface
+	NotificationQueue Queue
 	// ApnsClient is apns client
 	ApnsClient *apns.Client
 	// LogAccess is log server request log
@@ -0,0 +1,242 @@
+package gorush
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Granularity of history counters.
+const (
+	GranularityMinute = "minute"
+	GranularityHour   = "hour"
+	GranularityDay    = "day"
+)
+
+// maxHistoryPoints limits the number of buckets of one history query.
+const maxHistoryPoints = 1440
+
+// historyBucketName is the storage bucket of purge progress.
+const historyBucketName = "history"
+
+var historyPurgeInterval = time.Minute
+
+// StatHistory is push counts of each bucket between from and to.
+type StatHistory struct {
+	Granularity string         `json:"granularity"`
+	From        int64          `json:"from"`
+	To          int64          `json:"to"`
+	Points      []HistoryPoint `json:"points"`
+}
+
+// HistoryPoint is push counts of one bucket, Time is the bucket start in
+// unix time.
+type HistoryPoint struct {
+	Time       int64                `json:"time"`
+	Ios        IosStatus            `json:"ios"`
+	Android    AndroidStatus        `json:"android"`
+	AndroidFcm AndroidStatus        `json:"android_fcm"`
+	Apps       map[string]AppStatus `json:"apps"`
+}
+
+// historySeconds returns bucket size of granularity, 0 if unknown.
+func historySeconds(granularity string) int64 {
+	switch granularity {
+	case GranularityMinute:
+		return 60
+	case GranularityHour:
+		return 3600
+	case GranularityDay:
+		return 86400
+	}
+
+	return 0
+}
+
+// historyRetention returns seconds to keep buckets of granularity, 0 is
+// disabled.
+func historyRetention(granularity string) int64 {
+	switch granularity {
+	case GranularityMinute:
+		return PushConf.Stat.History.MinuteRetention
+	case GranularityHour:
+		return PushConf.Stat.History.HourRetention
+	case GranularityDay:
+		return PushConf.Stat.History.DayRetention
+	}
+
+	return 0
+}
+
+// historyBucket returns start of the bucket of t in unix time, buckets are
+// aligned to UTC.
+func historyBucket(granularity string, t int64) int64 {
+	seconds := historySeconds(granularity)
+
+	return t - t%seconds
+}
+
+func historyCounterKey(granularity string, bucket int64, appID string, platform int, kind string) string {
+	return "history-" + granularity + "-" + strconv.FormatInt(bucket, 10) + "-" + appID + "-" + typeForPlatForm(platform) + "-" + kind
+}
+
+// addHistoryCounts adds counter of each enabled granularity to counts.
+func addHistoryCounts(counts map[string]int64, appID string, platform int, kind string, count int64, now time.Time) {
+	for _, granularity := range []string{GranularityMinute, GranularityHour, GranularityDay} {
+		if historyRetention(granularity) <= 0 {
+			continue
+		}
+
+		counts[historyCounterKey(granularity, historyBucket(granularity, now.Unix()), appID, platform, kind)] = count
+	}
+}
+
+// historyKeys returns counter keys of all apps and platforms in bucket.
+func historyKeys(granularity string, bucket int64) []string {
+	var keys []string
+	for appID := range PushConf.Apps {
+		for _, platform := range []int{PlatFormIos, PlatFormAndroid, PlatFormAndroidFcm} {
+			keys = append(keys,
+				historyCounterKey(granularity, bucket, appID, platform, statSuccess),
+				historyCounterKey(granularity, bucket, appID, platform, statError),
+			)
+		}
+	}
+
+	return keys
+}
+
+// pushHistory returns push counts of each bucket between from and to in
+// unix time, all counters are read in one call.
+func pushHistory(granularity string, from, to int64) (*StatHistory, error) {
+	seconds := historySeconds(granularity)
+	if seconds == 0 {
+		return nil, errors.New("granularity must be minute, hour or day")
+	}
+
+	if historyRetention(granularity) <= 0 {
+		return nil, errors.New("history of " + granularity + " granularity is disabled")
+	}
+
+	if from > to {
+		return nil, errors.New("from must not be after to")
+	}
+
+	from = historyBucket(granularity, from)
+	to = historyBucket(granularity, to)
+	if (to-from)/seconds+1 > maxHistoryPoints {
+		return nil, errors.New("too many points, max is " + strconv.Itoa(maxHistoryPoints))
+	}
+
+	var keys []string
+	for bucket := from; bucket <= to; bucket += seconds {
+		keys = append(keys, historyKeys(granularity, bucket)...)
+	}
+
+	counts := getStat(keys...)
+
+	history := &StatHistory{
+		Granularity: granularity,
+		From:        from,
+		To:          to,
+		Points:      []HistoryPoint{},
+	}
+
+	for bucket := from; bucket <= to; bucket += seconds {
+		point := HistoryPoint{
+			Time: bucket,
+			Apps: make(map[string]AppStatus, len(PushConf.Apps)),
+		}
+
+		for appID := range PushConf.Apps {
+			var status AppStatus
+			status.Ios.PushSuccess = counts[historyCounterKey(granularity, bucket, appID, PlatFormIos, statSuccess)]
+			status.Ios.PushError = counts[historyCounterKey(granularity, bucket, appID, PlatFormIos, statError)]
+			status.Android.PushSuccess = counts[historyCounterKey(granularity, bucket, appID, PlatFormAndroid, statSuccess)]
+			status.Android.PushError = counts[historyCounterKey(granularity, bucket, appID, PlatFormAndroid, statError)]
+			status.AndroidFcm.PushSuccess = counts[historyCounterKey(granularity, bucket, appID, PlatFormAndroidFcm, statSuccess)]
+			status.AndroidFcm.PushError = counts[historyCounterKey(granularity, bucket, appID, PlatFormAndroidFcm, statError)]
+			point.Apps[appID] = status
+
+			point.Ios.PushSuccess += status.Ios.PushSuccess
+			point.Ios.PushError += status.Ios.PushError
+			point.Android.PushSuccess += status.Android.PushSuccess
+			point.Android.PushError += status.Android.PushError
+			point.AndroidFcm.PushSuccess += status.AndroidFcm.PushSuccess
+			point.AndroidFcm.PushError += status.AndroidFcm.PushError
+		}
+
+		history.Points = append(history.Points, point)
+	}
+
+	return history, nil
+}
+
+// purgeHistory removes buckets older than retention of each granularity.
+// The last purged bucket is kept in stat storage, so buckets are removed
+// once even after restart. It returns the number of removed buckets.
+func purgeHistory(now time.Time) int {
+	var purged int
+	ctx := context.Background()
+
+	for _, granularity := range []string{GranularityMinute, GranularityHour, GranularityDay} {
+		retention := historyRetention(granularity)
+		if retention <= 0 {
+			continue
+		}
+
+		seconds := historySeconds(granularity)
+		cutoff := historyBucket(granularity, now.Unix()-retention)
+
+		// start one retention window back if nothing is purged yet.
+		start := cutoff - retention
+		data, err := StatStorage.GetRecord(ctx, historyBucketName, "purged-"+granularity)
+		if err != nil {
+			LogError.Error("history error: " + err.Error())
+			continue
+		}
+		if last, err := strconv.ParseInt(string(data), 10, 64); err == nil {
+			start = last + seconds
+		}
+		if start < cutoff-retention {
+			start = cutoff - retention
+		}
+		start = historyBucket(granularity, start)
+
+		var last int64
+		for bucket := start; bucket < cutoff; bucket += seconds {
+			if err := StatStorage.DeleteCounters(ctx, historyKeys(granularity, bucket)...); err != nil {
+				LogError.Error("history error: " + err.Error())
+				break
+			}
+
+			last = bucket
+			purged++
+		}
+
+		if last == 0 {
+			continue
+		}
+
+		if err := StatStorage.SetRecord(ctx, historyBucketName, "purged-"+granularity, []byte(strconv.FormatInt(last, 10))); err != nil {
+			LogError.Error("history error: " + err.Error())
+		}
+	}
+
+	return purged
+}
+
+// StartHistoryPurge removes expired history buckets periodically.
+func StartHistoryPurge() {
+	history := PushConf.Stat.History
+	if history.MinuteRetention <= 0 && history.HourRetention <= 0 && history.DayRetention <= 0 {
+		return
+	}
+
+	go func() {
+		for now := range time.Tick(historyPurgeInterval) {
+			purgeHistory(now)
+		}
+	}()
+}
@@ -0,0 +1,138 @@
+package gorush
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/buger/jsonparser"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/appleboy/gofight.v2"
+)
+
+func initHistoryTest() {
+	initTest()
+	InitLog()
+	InitAppStatus()
+
+	StatStorage.Reset(context.Background())
+	for _, granularity := range []string{GranularityMinute, GranularityHour, GranularityDay} {
+		StatStorage.DeleteRecord(context.Background(), historyBucketName, "purged-"+granularity)
+	}
+}
+
+func TestPushHistory(t *testing.T) {
+	initHistoryTest()
+
+	now := time.Now().Unix()
+	addPushSuccess(PlatFormIos, "", 3)
+	addPushError(PlatFormAndroidFcm, AppNameDefault, "NotRegistered", 1)
+
+	history, err := pushHistory(GranularityMinute, now-120, time.Now().Unix())
+	assert.NoError(t, err)
+	assert.Equal(t, GranularityMinute, history.Granularity)
+	assert.Equal(t, historyBucket(GranularityMinute, now-120), history.From)
+	assert.True(t, len(history.Points) >= 3)
+
+	var point HistoryPoint
+	for _, p := range history.Points {
+		point.Ios.PushSuccess += p.Ios.PushSuccess
+		point.AndroidFcm.PushError += p.AndroidFcm.PushError
+		point.Android.PushSuccess += p.Android.PushSuccess
+	}
+	assert.Equal(t, int64(3), point.Ios.PushSuccess)
+	assert.Equal(t, int64(1), point.AndroidFcm.PushError)
+	assert.Equal(t, int64(0), point.Android.PushSuccess)
+
+	history, err = pushHistory(GranularityDay, now, now)
+	assert.NoError(t, err)
+	if assert.Len(t, history.Points, 1) {
+		assert.Equal(t, int64(3), history.Points[0].Apps[AppNameDefault].Ios.PushSuccess)
+	}
+}
+
+func TestPushHistoryError(t *testing.T) {
+	initHistoryTest()
+
+	now := time.Now().Unix()
+
+	_, err := pushHistory("week", now, now)
+	assert.Error(t, err)
+
+	_, err = pushHistory(GranularityHour, now, now-3600)
+	assert.Error(t, err)
+
+	_, err = pushHistory(GranularityMinute, now-maxHistoryPoints*60, now)
+	assert.Error(t, err)
+
+	PushConf.Stat.History.MinuteRetention = 0
+	_, err = pushHistory(GranularityMinute, now, now)
+	assert.Error(t, err)
+}
+
+func TestStatHistoryHandler(t *testing.T) {
+	initHistoryTest()
+
+	addPushSuccess(PlatFormAndroid, "", 2)
+
+	now := time.Now().Unix()
+	from := strconv.FormatInt(now-3600, 10)
+	to := strconv.FormatInt(now, 10)
+
+	r := gofight.New()
+
+	r.GET("/api/stat/app?granularity=hour&from="+from+"&to="+to).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			data := []byte(r.Body.String())
+			granularity, _ := jsonparser.GetString(data, "history", "granularity")
+			value, _ := jsonparser.GetInt(data, "history", "points", "[1]", "android", "push_success")
+
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Equal(t, GranularityHour, granularity)
+			assert.Equal(t, int64(2), value)
+		})
+
+	r.GET("/api/stat/app").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			_, _, _, err := jsonparser.Get([]byte(r.Body.String()), "history")
+
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Error(t, err)
+		})
+
+	r.GET("/api/stat/app?granularity=week").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusBadRequest, r.Code)
+		})
+
+	r.GET("/api/stat/app?from=yesterday").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusBadRequest, r.Code)
+		})
+}
+
+func TestPurgeHistory(t *testing.T) {
+	initHistoryTest()
+
+	PushConf.Stat.History.HourRetention = 0
+	PushConf.Stat.History.DayRetention = 0
+
+	now := time.Now()
+	old := now.Add(-time.Duration(PushConf.Stat.History.MinuteRetention+120) * time.Second)
+	oldKey := historyCounterKey(GranularityMinute, historyBucket(GranularityMinute, old.Unix()), AppNameDefault, PlatFormIos, statSuccess)
+	newKey := historyCounterKey(GranularityMinute, historyBucket(GranularityMinute, now.Unix()), AppNameDefault, PlatFormIos, statSuccess)
+
+	counts := map[string]int64{}
+	addHistoryCounts(counts, AppNameDefault, PlatFormIos, statSuccess, 1, old)
+	addHistoryCounts(counts, AppNameDefault, PlatFormIos, statSuccess, 1, now)
+	incrStat(counts)
+
+	assert.True(t, purgeHistory(now) > 0)
+	assert.Equal(t, int64(0), getStat(oldKey)[oldKey])
+	assert.Equal(t, int64(1), getStat(newKey)[newKey])
+
+	// purged buckets are skipped next time.
+	assert.Equal(t, 0, purgeHistory(now))
+}
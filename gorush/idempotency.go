@@ -0,0 +1,197 @@
+package gorush
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IdempotencyHeader is the request header of idempotency key.
+const IdempotencyHeader = "Idempotency-Key"
+
+// idempotencyBucket is the storage bucket of idempotency keys.
+const idempotencyBucket = "idempotency"
+
+// idempotencyPurgeInterval is how often expired idempotency key is removed.
+var idempotencyPurgeInterval = 10 * time.Minute
+
+// idempotencyRecord is the stored result of idempotency key. Record without
+// Done is claimed by a request which is still in progress.
+type idempotencyRecord struct {
+	Done        bool            `json:"done"`
+	Fingerprint string          `json:"fingerprint,omitempty"`
+	Code        int             `json:"code,omitempty"`
+	Response    json.RawMessage `json:"response,omitempty"`
+	ID          string          `json:"id,omitempty"`
+	ExpiresAt   int64           `json:"expires_at"`
+}
+
+func idempotencyEnabled() bool {
+	return PushConf.Core.IdempotencyTTL > 0 && StatStorage != nil
+}
+
+// loadIdempotencyRecord returns nil if key not exist or expired.
+func loadIdempotencyRecord(key string) (*idempotencyRecord, error) {
+	data, err := StatStorage.GetRecord(context.Background(), idempotencyBucket, key)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var record idempotencyRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+
+	if record.ExpiresAt <= time.Now().Unix() {
+		return nil, StatStorage.DeleteRecord(context.Background(), idempotencyBucket, key)
+	}
+
+	return &record, nil
+}
+
+// claimIdempotencyKey stores in progress record of key. It returns the
+// existing record if key is already used.
+func claimIdempotencyKey(key, fingerprint string) (*idempotencyRecord, error) {
+	data, err := json.Marshal(idempotencyRecord{
+		Fingerprint: fingerprint,
+		ExpiresAt:   time.Now().Unix() + PushConf.Core.IdempotencyTTL,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// try again once if existing record is expired.
+	for i := 0; i < 2; i++ {
+		created, err := StatStorage.CreateRecord(context.Background(), idempotencyBucket, key, data)
+		if err != nil || created {
+			return nil, err
+		}
+
+		record, err := loadIdempotencyRecord(key)
+		if err != nil || record != nil {
+			return record, err
+		}
+	}
+
+	return nil, errors.New("can't claim idempotency key")
+}
+
+// finishIdempotencyKey stores result of claimed key.
+func finishIdempotencyKey(key string, record idempotencyRecord) {
+	record.Done = true
+	record.ExpiresAt = time.Now().Unix() + PushConf.Core.IdempotencyTTL
+
+	data, err := json.Marshal(record)
+	if err == nil {
+		err = StatStorage.SetRecord(context.Background(), idempotencyBucket, key, data)
+	}
+
+	if err != nil {
+		LogError.Error("idempotency error: " + err.Error())
+	}
+}
+
+// releaseIdempotencyKey removes claimed key of failed request, so it can be
+// retried with the same key.
+func releaseIdempotencyKey(key string) {
+	if err := StatStorage.DeleteRecord(context.Background(), idempotencyBucket, key); err != nil {
+		LogError.Error("idempotency error: " + err.Error())
+	}
+}
+
+// notificationIdempotencyKey returns storage key of idempotency_key field,
+// it is unique in app.
+func notificationIdempotencyKey(req PushNotification) string {
+	if req.IdempotencyKey == "" || !idempotencyEnabled() {
+		return ""
+	}
+
+	return "notification/" + req.AppID + "/" + req.IdempotencyKey
+}
+
+// requestIdempotencyKey returns storage key of Idempotency-Key header, it
+// is unique per API key.
+func requestIdempotencyKey(c *gin.Context) string {
+	key := c.Request.Header.Get(IdempotencyHeader)
+	if key == "" || !idempotencyEnabled() {
+		return ""
+	}
+
+	var keyID string
+	if apiKey := requestAPIKey(c); apiKey != nil {
+		keyID = apiKey.ID
+	}
+
+	return "request/" + keyID + "/" + key
+}
+
+func requestFingerprint(req interface{}) string {
+	data, _ := json.Marshal(req)
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// replayIdempotentResponse writes response of request which used the same
+// key before, or error if it is in progress or the request is different.
+func replayIdempotentResponse(c *gin.Context, record *idempotencyRecord, fingerprint string) {
+	if record.Fingerprint != fingerprint {
+		abortWithError(c, http.StatusUnprocessableEntity, "Idempotency-Key is already used by another request.")
+		return
+	}
+
+	if !record.Done {
+		abortWithError(c, http.StatusConflict, "Request with the same Idempotency-Key is in progress.")
+		return
+	}
+
+	LogAccess.Debug("Replay response of Idempotency-Key: " + c.Request.Header.Get(IdempotencyHeader))
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(record.Code, "application/json; charset=utf-8", record.Response)
+}
+
+// purgeIdempotencyKeys removes expired idempotency keys.
+func purgeIdempotencyKeys() int {
+	var expired []string
+	now := time.Now().Unix()
+
+	err := StatStorage.RangeRecords(context.Background(), idempotencyBucket, "", "", func(key string, value []byte) bool {
+		var record idempotencyRecord
+		if json.Unmarshal(value, &record) != nil || record.ExpiresAt <= now {
+			expired = append(expired, key)
+		}
+
+		return true
+	})
+
+	if err != nil {
+		LogError.Error("idempotency error: " + err.Error())
+	}
+
+	for _, key := range expired {
+		if err := StatStorage.DeleteRecord(context.Background(), idempotencyBucket, key); err != nil {
+			LogError.Error("idempotency error: " + err.Error())
+		}
+	}
+
+	return len(expired)
+}
+
+// StartIdempotencyPurge removes expired idempotency keys periodically.
+func StartIdempotencyPurge() {
+	if PushConf.Core.IdempotencyTTL <= 0 {
+		return
+	}
+
+	go func() {
+		for range time.Tick(idempotencyPurgeInterval) {
+			purgeIdempotencyKeys()
+		}
+	}()
+}
@@ -0,0 +1,151 @@
+package gorush
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/NaySoftware/go-fcm"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/appleboy/gofight.v2"
+)
+
+func initIdempotencyTest(t *testing.T) func() {
+	done := initFcmTest(t, func(w http.ResponseWriter, r *http.Request) {
+		var msg fcm.FcmMsg
+		json.NewDecoder(r.Body).Decode(&msg)
+
+		results := make([]map[string]string, len(msg.RegistrationIds))
+		for i := range msg.RegistrationIds {
+			results[i] = map[string]string{"message_id": "1"}
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"results": results,
+		})
+	})
+	PushConf.Core.Mode = "test"
+	InitWorkers(int64(2), 2)
+
+	return done
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	initTest()
+	InitLog()
+	InitAppStatus()
+
+	record, err := claimIdempotencyKey("request//a", "one")
+	assert.NoError(t, err)
+	assert.Nil(t, record)
+
+	record, err = claimIdempotencyKey("request//a", "two")
+	assert.NoError(t, err)
+	if assert.NotNil(t, record) {
+		assert.False(t, record.Done)
+		assert.Equal(t, "one", record.Fingerprint)
+	}
+
+	finishIdempotencyKey("request//a", idempotencyRecord{Fingerprint: "one", Code: http.StatusOK, Response: []byte(`{}`)})
+	record, _ = claimIdempotencyKey("request//a", "one")
+	if assert.NotNil(t, record) {
+		assert.True(t, record.Done)
+		assert.Equal(t, http.StatusOK, record.Code)
+	}
+
+	// released key can be claimed again
+	releaseIdempotencyKey("request//a")
+	record, _ = claimIdempotencyKey("request//a", "one")
+	assert.Nil(t, record)
+
+	// expired key can be claimed again
+	StatStorage.SetRecord(context.Background(), idempotencyBucket, "request//b", []byte(`{"done":true,"expires_at":1}`))
+	record, err = claimIdempotencyKey("request//b", "one")
+	assert.NoError(t, err)
+	assert.Nil(t, record)
+
+	StatStorage.SetRecord(context.Background(), idempotencyBucket, "request//c", []byte(`{"done":true,"expires_at":1}`))
+	assert.Equal(t, 1, purgeIdempotencyKeys())
+}
+
+func TestNotificationIdempotencyKey(t *testing.T) {
+	done := initIdempotencyTest(t)
+	defer done()
+
+	req := RequestPush{
+		Notifications: []PushNotification{
+			{
+				Tokens:         []string{"aaaaa", "bbbbb"},
+				Platform:       PlatFormAndroidFcm,
+				Message:        "Welcome",
+				IdempotencyKey: "welcome-1",
+			},
+		},
+	}
+
+	count, ids, _ := queueNotification(req)
+	assert.Equal(t, 2, count)
+	assert.NotEmpty(t, ids[0])
+
+	// duplicate notification returns the original id and is not sent again
+	count, dupIDs, _ := queueNotification(req)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, ids, dupIDs)
+	assert.Equal(t, int64(2), pushStatus().TotalCount)
+
+	// the key is unique in app
+	PushConf.Apps["other"] = PushConf.Apps[AppNameDefault]
+	req.Notifications[0].AppID = "other"
+	_, otherIDs, _ := queueNotification(req)
+	assert.NotEqual(t, ids[0], otherIDs[0])
+
+	// disabled idempotency key
+	PushConf.Core.IdempotencyTTL = 0
+	req.Notifications[0].AppID = ""
+	_, otherIDs, _ = queueNotification(req)
+	assert.NotEqual(t, ids[0], otherIDs[0])
+}
+
+func TestPushIdempotencyHandler(t *testing.T) {
+	done := initIdempotencyTest(t)
+	defer done()
+
+	var body string
+	r := gofight.New()
+
+	push := func(message string) *gofight.RequestConfig {
+		return r.POST("/api/push").
+			SetHeader(gofight.H{IdempotencyHeader: "retry-1"}).
+			SetJSON(gofight.D{
+				"notifications": []gofight.D{
+					{
+						"tokens":   []string{"aaaaa"},
+						"platform": PlatFormAndroidFcm,
+						"message":  message,
+					},
+				},
+			})
+	}
+
+	push("Welcome").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Equal(t, "", r.HeaderMap.Get("Idempotent-Replayed"))
+			body = r.Body.String()
+		})
+
+	push("Welcome").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Equal(t, "true", r.HeaderMap.Get("Idempotent-Replayed"))
+			assert.JSONEq(t, body, r.Body.String())
+		})
+
+	push("Hello").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnprocessableEntity, r.Code)
+		})
+
+	assert.Equal(t, int64(1), pushStatus().TotalCount)
+}
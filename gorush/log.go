@@ -30,6 +30,7 @@ type LogReq struct {
 	IP          string `json:"ip"`
 	ContentType string `json:"content_type"`
 	Agent       string `json:"agent"`
+	KeyID       string `json:"key_id,omitempty"`
 }
 
 // LogPushEntry is push response log
@@ -136,7 +137,7 @@ func SetLogLevel(log *logrus.Logger, levelString string) error {
 }
 
 // LogRequest record http request
-func LogRequest(uri string, method string, ip string, contentType string, agent string) {
+func LogRequest(uri string, method string, ip string, contentType string, agent string, keyID string) {
 	var output string
 	log := &LogReq{
 		URI:         uri,
@@ -144,6 +145,7 @@ func LogRequest(uri string, method string, ip string, contentType string, agent
 		IP:          ip,
 		ContentType: contentType,
 		Agent:       agent,
+		KeyID:       keyID,
 	}
 
 	if PushConf.Log.Format == "json" {
@@ -167,6 +169,10 @@ func LogRequest(uri string, method string, ip string, contentType string, agent
 			log.ContentType,
 			log.Agent,
 		)
+
+		if log.KeyID != "" {
+			output += " key:" + log.KeyID
+		}
 	}
 
 	LogAccess.Info(output)
@@ -178,6 +184,8 @@ func colorForPlatForm(platform int) string {
 		return blue
 	case PlatFormAndroid:
 		return yellow
+	case PlatFormAndroidFcm:
+		return cyan
 	default:
 		return reset
 	}
@@ -189,6 +197,8 @@ func typeForPlatForm(platform int) string {
 		return "ios"
 	case PlatFormAndroid:
 		return "android"
+	case PlatFormAndroidFcm:
+		return "android_fcm"
 	default:
 		return ""
 	}
@@ -214,11 +224,12 @@ func hideToken(token string, markLen int) string {
 
 // LogPush record user push request and server response.
 func LogPush(status, token string, req PushNotification, errPush error) {
-	var plat, platColor, resetColor, output string
+	var platColor, resetColor, output string
+
+	plat := typeForPlatForm(req.Platform)
 
 	if isTerm {
 		platColor = colorForPlatForm(req.Platform)
-		plat = typeForPlatForm(req.Platform)
 		resetColor = reset
 	}
 
@@ -283,7 +294,12 @@ func LogPush(status, token string, req PushNotification, errPush error) {
 // LogMiddleware provide gin router handler.
 func LogMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		LogRequest(c.Request.URL.Path, c.Request.Method, c.ClientIP(), c.ContentType(), c.Request.Header.Get("User-Agent"))
+		var keyID string
+		if apiKey := requestAPIKey(c); apiKey != nil {
+			keyID = apiKey.ID
+		}
+
+		LogRequest(c.Request.URL.Path, c.Request.Method, c.ClientIP(), c.ContentType(), c.Request.Header.Get("User-Agent"), keyID)
 		c.Next()
 	}
 }
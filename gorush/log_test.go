@@ -81,12 +81,14 @@ func TestErrorLogPath(t *testing.T) {
 func TestPlatFormType(t *testing.T) {
 	assert.Equal(t, "ios", typeForPlatForm(PlatFormIos))
 	assert.Equal(t, "android", typeForPlatForm(PlatFormAndroid))
+	assert.Equal(t, "android_fcm", typeForPlatForm(PlatFormAndroidFcm))
 	assert.Equal(t, "", typeForPlatForm(10000))
 }
 
 func TestPlatFormColor(t *testing.T) {
 	assert.Equal(t, blue, colorForPlatForm(PlatFormIos))
 	assert.Equal(t, yellow, colorForPlatForm(PlatFormAndroid))
+	assert.Equal(t, cyan, colorForPlatForm(PlatFormAndroidFcm))
 	assert.Equal(t, reset, colorForPlatForm(1000000))
 }
 
@@ -1,11 +1,137 @@
 package gorush
 
 import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
 const namespace = "gorush_"
 
+// Outcome label of provider request.
+const (
+	// provider accepted all tokens
+	outcomeSuccess = "success"
+	// provider answered and rejected some tokens
+	outcomeFailed = "failed"
+	// provider gave no usable answer
+	outcomeError = "error"
+)
+
+// Reasons of errors and drops which are not reported by provider.
+const (
+	reasonRequestError  = "request_error"
+	reasonMissingResult = "missing_result"
+	reasonClientError   = "client_error"
+	reasonInvalid       = "invalid_message"
+	reasonRetryLimit    = "retry_limit"
+	reasonTemplateError = "template_error"
+)
+
+var (
+	// workerCount and busyWorkers count workers of the current queue and
+	// workers sending notification.
+	workerCount int64
+	busyWorkers int64
+
+	providerLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    namespace + "provider_request_duration_seconds",
+			Help:    "Latency of APNs, GCM and FCM requests",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"app", "platform", "outcome"},
+	)
+	queueWait = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    namespace + "queue_wait_seconds",
+			Help:    "Time of notification in queue before a worker takes it",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+		},
+		[]string{"app", "platform"},
+	)
+	pushRetries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: namespace + "push_retry_total",
+			Help: "Number of tokens scheduled to resend",
+		},
+		[]string{"app", "platform"},
+	)
+	pushDrops = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: namespace + "push_drop_total",
+			Help: "Number of tokens dropped without delivery",
+		},
+		[]string{"app", "platform", "reason"},
+	)
+	pushErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: namespace + "push_error_total",
+			Help: "Number of failed tokens by provider reason",
+		},
+		[]string{"app", "platform", "reason"},
+	)
+)
+
+// pipelineCollectors are collectors updated by workers, they are exposed
+// through Metrics.
+var pipelineCollectors = []prometheus.Collector{
+	providerLatency,
+	queueWait,
+	pushRetries,
+	pushDrops,
+	pushErrors,
+}
+
+// observeProviderRequest records latency of provider request started at start.
+func observeProviderRequest(req PushNotification, outcome string, start time.Time) {
+	providerLatency.WithLabelValues(req.AppID, typeForPlatForm(req.Platform), outcome).Observe(time.Since(start).Seconds())
+}
+
+// observeQueueWait records time of notification in queue.
+func observeQueueWait(req PushNotification) {
+	if req.queuedAt.IsZero() {
+		return
+	}
+
+	queueWait.WithLabelValues(req.AppID, typeForPlatForm(req.Platform)).Observe(time.Since(req.queuedAt).Seconds())
+}
+
+// countPushError records count of failed tokens with provider reason.
+func countPushError(req PushNotification, reason string, count int) {
+	if count <= 0 {
+		return
+	}
+
+	if reason == "" {
+		reason = "unknown"
+	}
+	pushErrors.WithLabelValues(req.AppID, typeForPlatForm(req.Platform), reason).Add(float64(count))
+}
+
+// countPushRetry records count of tokens scheduled to resend.
+func countPushRetry(req PushNotification, count int) {
+	pushRetries.WithLabelValues(req.AppID, typeForPlatForm(req.Platform)).Add(float64(count))
+}
+
+// countPushDrop records count of tokens dropped without delivery.
+func countPushDrop(req PushNotification, reason string, count int) {
+	if count <= 0 {
+		return
+	}
+
+	pushDrops.WithLabelValues(req.AppID, typeForPlatForm(req.Platform), reason).Add(float64(count))
+}
+
+// httpStatusReason is error reason of provider http status.
+func httpStatusReason(code int) string {
+	return "http_" + strconv.Itoa(code)
+}
+
 // Metrics implements the prometheus.Metrics interface and
 // exposes gorush metrics for prometheus
 type Metrics struct {
@@ -14,6 +140,19 @@ type Metrics struct {
 	IosError       *prometheus.Desc
 	AndroidSuccess *prometheus.Desc
 	AndroidError   *prometheus.Desc
+
+	AndroidFcmSuccess *prometheus.Desc
+	AndroidFcmError   *prometheus.Desc
+
+	AppSuccess *prometheus.Desc
+	AppError   *prometheus.Desc
+
+	IosCertificateExpiry *prometheus.Desc
+
+	QueueUsage    *prometheus.Desc
+	QueueCapacity *prometheus.Desc
+	WorkerBusy    *prometheus.Desc
+	WorkerIdle    *prometheus.Desc
 }
 
 // NewMetrics returns a new Metrics with all prometheus.Desc initialized
@@ -45,6 +184,51 @@ func NewMetrics() Metrics {
 			"Number of android fail count",
 			nil, nil,
 		),
+		AndroidFcmSuccess: prometheus.NewDesc(
+			namespace+"android_fcm_success",
+			"Number of android FCM success count",
+			nil, nil,
+		),
+		AndroidFcmError: prometheus.NewDesc(
+			namespace+"android_fcm_fail",
+			"Number of android FCM fail count",
+			nil, nil,
+		),
+		AppSuccess: prometheus.NewDesc(
+			namespace+"app_success",
+			"Number of success count of app and platform",
+			[]string{"app", "platform"}, nil,
+		),
+		AppError: prometheus.NewDesc(
+			namespace+"app_fail",
+			"Number of fail count of app and platform",
+			[]string{"app", "platform"}, nil,
+		),
+		IosCertificateExpiry: prometheus.NewDesc(
+			namespace+"ios_certificate_expiry_timestamp_seconds",
+			"Expiry time of iOS certificate in unix seconds",
+			[]string{"app"}, nil,
+		),
+		QueueUsage: prometheus.NewDesc(
+			namespace+"queue_usage",
+			"Number of notifications waiting in queue",
+			nil, nil,
+		),
+		QueueCapacity: prometheus.NewDesc(
+			namespace+"queue_capacity",
+			"Capacity of notification queue",
+			nil, nil,
+		),
+		WorkerBusy: prometheus.NewDesc(
+			namespace+"worker_busy",
+			"Number of workers sending notification",
+			nil, nil,
+		),
+		WorkerIdle: prometheus.NewDesc(
+			namespace+"worker_idle",
+			"Number of workers waiting for notification",
+			nil, nil,
+		),
 	}
 }
 
@@ -55,33 +239,153 @@ func (c Metrics) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.IosError
 	ch <- c.AndroidSuccess
 	ch <- c.AndroidError
+	ch <- c.AndroidFcmSuccess
+	ch <- c.AndroidFcmError
+	ch <- c.AppSuccess
+	ch <- c.AppError
+	ch <- c.IosCertificateExpiry
+	ch <- c.QueueUsage
+	ch <- c.QueueCapacity
+	ch <- c.WorkerBusy
+	ch <- c.WorkerIdle
+
+	for _, collector := range pipelineCollectors {
+		collector.Describe(ch)
+	}
 }
 
 // Collect returns the metrics with values
 func (c Metrics) Collect(ch chan<- prometheus.Metric) {
+	status := pushStatus()
+
 	ch <- prometheus.MustNewConstMetric(
 		c.TotalPushCount,
 		prometheus.GaugeValue,
-		float64(StatStorage.GetTotalCount()),
+		float64(status.TotalCount),
 	)
 	ch <- prometheus.MustNewConstMetric(
 		c.IosSuccess,
 		prometheus.GaugeValue,
-		float64(StatStorage.GetIosSuccess()),
+		float64(status.Ios.PushSuccess),
 	)
 	ch <- prometheus.MustNewConstMetric(
 		c.IosError,
 		prometheus.GaugeValue,
-		float64(StatStorage.GetIosError()),
+		float64(status.Ios.PushError),
 	)
 	ch <- prometheus.MustNewConstMetric(
 		c.AndroidSuccess,
 		prometheus.GaugeValue,
-		float64(StatStorage.GetAndroidSuccess()),
+		float64(status.Android.PushSuccess),
 	)
 	ch <- prometheus.MustNewConstMetric(
 		c.AndroidError,
 		prometheus.GaugeValue,
-		float64(StatStorage.GetAndroidError()),
+		float64(status.Android.PushError),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		c.AndroidFcmSuccess,
+		prometheus.GaugeValue,
+		float64(status.AndroidFcm.PushSuccess),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		c.AndroidFcmError,
+		prometheus.GaugeValue,
+		float64(status.AndroidFcm.PushError),
+	)
+	for appID, app := range status.Apps {
+		counts := []struct {
+			platform int
+			status   AndroidStatus
+		}{
+			{PlatFormIos, AndroidStatus(app.Ios)},
+			{PlatFormAndroid, app.Android},
+			{PlatFormAndroidFcm, app.AndroidFcm},
+		}
+
+		for _, count := range counts {
+			ch <- prometheus.MustNewConstMetric(
+				c.AppSuccess,
+				prometheus.GaugeValue,
+				float64(count.status.PushSuccess),
+				appID, typeForPlatForm(count.platform),
+			)
+			ch <- prometheus.MustNewConstMetric(
+				c.AppError,
+				prometheus.GaugeValue,
+				float64(count.status.PushError),
+				appID, typeForPlatForm(count.platform),
+			)
+		}
+	}
+	for _, cert := range certificateStatus() {
+		ch <- prometheus.MustNewConstMetric(
+			c.IosCertificateExpiry,
+			prometheus.GaugeValue,
+			float64(cert.ExpiresAt.Unix()),
+			cert.AppID,
+		)
+	}
+
+	busy := atomic.LoadInt64(&busyWorkers)
+	ch <- prometheus.MustNewConstMetric(
+		c.QueueUsage,
+		prometheus.GaugeValue,
+		float64(len(QueueNotification)),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		c.QueueCapacity,
+		prometheus.GaugeValue,
+		float64(cap(QueueNotification)),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		c.WorkerBusy,
+		prometheus.GaugeValue,
+		float64(busy),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		c.WorkerIdle,
+		prometheus.GaugeValue,
+		float64(atomic.LoadInt64(&workerCount)-busy),
 	)
+
+	for _, collector := range pipelineCollectors {
+		collector.Collect(ch)
+	}
+}
+
+// appGatherer gathers metrics for api key limited to apps, series labelled
+// with other apps are dropped. Gorush series without app label count pushes
+// of every app, so they are dropped too and only process metrics are kept.
+func appGatherer(apiKey *APIKey) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := prometheus.DefaultGatherer.Gather()
+
+		result := families[:0]
+		for _, family := range families {
+			metrics := family.Metric[:0]
+			for _, metric := range family.Metric {
+				if allowMetric(apiKey, family.GetName(), metric) {
+					metrics = append(metrics, metric)
+				}
+			}
+
+			if len(metrics) > 0 {
+				family.Metric = metrics
+				result = append(result, family)
+			}
+		}
+
+		return result, err
+	})
+}
+
+func allowMetric(apiKey *APIKey, name string, metric *dto.Metric) bool {
+	for _, label := range metric.GetLabel() {
+		if label.GetName() == "app" {
+			return apiKey.AllowApp(label.GetValue())
+		}
+	}
+
+	return !strings.HasPrefix(name, namespace)
 }
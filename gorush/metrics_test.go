@@ -0,0 +1,106 @@
+package gorush
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/NaySoftware/go-fcm"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/appleboy/gofight.v2"
+)
+
+// gaugeValue returns value of metric without labels in exposition body.
+func gaugeValue(t *testing.T, body, name string) float64 {
+	match := regexp.MustCompile(`(?m)^` + name + ` (\S+)$`).FindStringSubmatch(body)
+	if !assert.Len(t, match, 2, name) {
+		return 0
+	}
+
+	value, err := strconv.ParseFloat(match[1], 64)
+	assert.NoError(t, err)
+
+	return value
+}
+
+func TestPipelineMetrics(t *testing.T) {
+	done := initFcmTest(t, func(w http.ResponseWriter, r *http.Request) {
+		var msg fcm.FcmMsg
+		json.NewDecoder(r.Body).Decode(&msg)
+
+		results := make([]map[string]string, len(msg.RegistrationIds))
+		for i, token := range msg.RegistrationIds {
+			switch token {
+			case "bad":
+				results[i] = map[string]string{"error": "InvalidRegistration"}
+			case "busy":
+				results[i] = map[string]string{"error": "Unavailable"}
+			default:
+				results[i] = map[string]string{"message_id": "1"}
+			}
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"failure": 2,
+			"results": results,
+		})
+	})
+	defer done()
+
+	// separate app keeps counters of other tests out.
+	PushConf.Apps["metrics"] = PushConf.Apps[AppNameDefault]
+	InitWorkers(2, 10)
+
+	PushToAndroidFcm(PushNotification{
+		AppID:    "metrics",
+		Tokens:   []string{"bad", "busy", "good"},
+		Platform: PlatFormAndroidFcm,
+		Message:  "Welcome",
+	})
+
+	r := gofight.New()
+
+	r.GET("/metrics").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			body := r.Body.String()
+
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Contains(t, body, `gorush_provider_request_duration_seconds_count{app="metrics",outcome="failed",platform="android_fcm"} 1`)
+			assert.Contains(t, body, `gorush_push_error_total{app="metrics",platform="android_fcm",reason="InvalidRegistration"} 1`)
+			assert.Contains(t, body, `gorush_push_error_total{app="metrics",platform="android_fcm",reason="Unavailable"} 1`)
+			// retry is disabled, so retryable token is dropped.
+			assert.Contains(t, body, `gorush_push_drop_total{app="metrics",platform="android_fcm",reason="retry_limit"} 1`)
+			assert.Equal(t, float64(10), gaugeValue(t, body, "gorush_queue_capacity"))
+			assert.True(t, gaugeValue(t, body, "gorush_queue_usage") <= 10)
+			// workers of other tests may still be busy, which moves count
+			// from idle to busy, but workers of replaced queue are not counted.
+			busy := gaugeValue(t, body, "gorush_worker_busy")
+			idle := gaugeValue(t, body, "gorush_worker_idle")
+			assert.Equal(t, float64(2), busy+idle)
+		})
+}
+
+func TestQueueWaitMetrics(t *testing.T) {
+	initTest()
+	InitLog()
+
+	notification := PushNotification{
+		AppID:    "metrics",
+		Platform: PlatFormIos,
+	}
+	observeQueueWait(notification)
+
+	notification.queuedAt = time.Now().Add(-time.Second)
+	observeQueueWait(notification)
+
+	r := gofight.New()
+
+	r.GET("/metrics").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			// notification without queue time is not observed.
+			assert.Contains(t, r.Body.String(), `gorush_queue_wait_seconds_count{app="metrics",platform="ios"} 1`)
+		})
+}
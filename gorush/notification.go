@@ -5,16 +5,16 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
-	_"os"
+	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"strings"
 
 	"github.com/google/go-gcm"
 	apns "github.com/sideshow/apns2"
-	"github.com/sideshow/apns2/certificate"
 	"github.com/sideshow/apns2/payload"
 
 	"github.com/NaySoftware/go-fcm"
@@ -25,9 +25,20 @@ type D map[string]interface{}
 
 // Push response
 type PushResponse struct {
-	Status       string   `json:"status,omitempty"`
-	CanonicalId  string   `json:"canonical_id,omitempty"`
-	Error        string   `json:"error,omitempty"`
+	Status      string `json:"status,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+	ApnsID      string `json:"apns_id,omitempty"`
+	CanonicalId string `json:"canonical_id,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// NotificationResult is the delivery result of single notification request.
+type NotificationResult struct {
+	ID       string                   `json:"id,omitempty"`
+	AppID    string                   `json:"app_id,omitempty"`
+	Platform int                      `json:"platform"`
+	Tokens   map[string]*PushResponse `json:"tokens"`
+	Error    string                   `json:"error,omitempty"`
 }
 
 const (
@@ -61,6 +72,8 @@ type Alert struct {
 // RequestPush support multiple notification request.
 type RequestPush struct {
 	Notifications []PushNotification `json:"notifications" binding:"required"`
+	watcher       *resultWatcher
+	trace         spanContext
 }
 
 // PushNotification is single notification request
@@ -74,9 +87,25 @@ type PushNotification struct {
 	ContentAvailable bool     `json:"content_available,omitempty"`
 	Sound            string   `json:"sound,omitempty"`
 	Data             D        `json:"data,omitempty"`
-	AppID            string   `json:"data,omitempty"`
+	AppID            string   `json:"app_id,omitempty"`
 	Retry            int      `json:"retry,omitempty"`
+	CallbackURL      string   `json:"callback_url,omitempty"`
+	SendAt           int64    `json:"send_at,omitempty"`
+	Delay            int64    `json:"delay,omitempty"`
+	Template         string   `json:"template,omitempty"`
+	Locale           string   `json:"locale,omitempty"`
+	Variables        D        `json:"variables,omitempty"`
+	UserIDs          []string `json:"user_ids,omitempty"`
+	Tags             string   `json:"tags,omitempty"`
+	IdempotencyKey   string   `json:"idempotency_key,omitempty"`
 	wg               *sync.WaitGroup
+	result           *NotificationResult
+	watcher          *resultWatcher
+	id               string
+	queueID          string
+	attempt          int
+	queuedAt         time.Time
+	trace            spanContext
 
 	// Android
 	APIKey                string           `json:"api_key,omitempty"`
@@ -98,7 +127,7 @@ type PushNotification struct {
 	URLArgs        []string `json:"url-args,omitempty"`
 	Alert          Alert    `json:"alert,omitempty"`
 	MutableContent bool     `json:"mutable-content,omitempty"`
-	IosData    	   D        `json:"ios_data,omitempty"`
+	IosData        D        `json:"ios_data,omitempty"`
 }
 
 // Done decrements the WaitGroup counter.
@@ -108,22 +137,22 @@ func (p *PushNotification) Done() {
 	}
 }
 
-// ApnsClients is collection of apns client connections
-type ApnsClients struct {
-	lock    sync.RWMutex
-	clients map[string]*apns.Client
-}
-
-var apnsClients = &ApnsClients{}
-
-// FcmClients is collection of FCM client connections
-type FcmClients struct {
-	lock    sync.RWMutex
-	clients map[string]*fcm.FcmClient
+// complete stores the per-token response, sends final results to the
+// watcher and callback url, acknowledges the queued notification and marks
+// the notification as done.
+func (p *PushNotification) complete(resp map[string]*PushResponse) {
+	if p.result != nil {
+		p.result.Tokens = resp
+	}
+	finishNotificationStatus(*p, resp)
+	if p.watcher != nil {
+		p.watcher.done(*p, resp)
+	}
+	sendCallback(*p, resp)
+	ackNotification(*p)
+	p.Done()
 }
 
-var fcmClients = &FcmClients{}
-
 // CheckMessage for check request message
 func CheckMessage(req PushNotification) error {
 	var msg string
@@ -173,136 +202,62 @@ func SetProxy(proxy string) error {
 }
 
 // CheckPushConf provide check your yml config.
-// To be reimplemented later
 func CheckPushConf() error {
-	/*if !PushConf.Ios.Enabled && !PushConf.Android.Enabled {
-		return errors.New("Please enable iOS or Android config in yml config")
-	}
+	var enabled bool
 
-	if PushConf.Ios.Enabled {
-		if PushConf.Ios.KeyPath == "" {
-			return errors.New("Missing iOS certificate path")
-		}
-
-		// check certificate file exist
-		if _, err := os.Stat(PushConf.Ios.KeyPath); os.IsNotExist(err) {
-			return errors.New("certificate file does not exist")
-		}
-	}
-
-	if PushConf.Android.Enabled {
-		if PushConf.Android.APIKey == "" {
-			return errors.New("Missing Android API Key")
+	for _, app := range PushConf.Apps {
+		if !app.Ios.Enabled && !app.Android.Enabled && !app.AndroidFcm.Enabled {
+			continue
 		}
-	}*/
-
-	return nil
-}
-
-// initAPNSClient initializes an APNs Client for the given AppID.
-func initAPNSClient(AppID string) (*apns.Client, error) {
-	var err error
-	var apnsClient *apns.Client
 
-	if PushConf.Apps[AppID].Ios.Enabled {
+		enabled = true
 
-		ext := filepath.Ext(PushConf.Apps[AppID].Ios.KeyPath)
-
-		// Append the certificates dir for the path
-		IosKeyPath := PushConf.Apps[AppID].Ios.KeyPath
-		CertCommonDir := PushConf.Core.CertDir
-		if (len(strings.TrimSpace(CertCommonDir)) != 0) {
+		if app.Ios.Enabled {
+			if app.Ios.KeyPath == "" {
+				return errors.New("Missing iOS certificate path")
+			}
 
-			IosKeyPath = CertCommonDir + IosKeyPath
-		}
+			// check certificate file exist
+			if _, err := os.Stat(certificatePath(app.Ios.KeyPath)); os.IsNotExist(err) {
+				return errors.New("certificate file does not exist")
+			}
 
-		switch ext {
-		case ".p12":
-			CertificatePemIos, err = certificate.FromP12File(IosKeyPath, PushConf.Apps[AppID].Ios.Password)
-		case ".pem":
-			CertificatePemIos, err = certificate.FromPemFile(IosKeyPath, PushConf.Apps[AppID].Ios.Password)
-		default:
-			err = errors.New("wrong certificate key extension")
+			if filepath.Ext(app.Ios.KeyPath) == ".p8" && (app.Ios.KeyID == "" || app.Ios.TeamID == "") {
+				return errors.New("Missing iOS key_id or team_id")
+			}
 		}
 
-		if err != nil {
-			LogError.Error("Cert Error:", err.Error())
-
-			return nil, err
+		if app.Android.Enabled && app.Android.APIKey == "" {
+			return errors.New("Missing Android API Key")
 		}
 
-		if PushConf.Apps[AppID].Ios.Production {
-			apnsClient = apns.NewClient(CertificatePemIos).Production()
-		} else {
-			apnsClient = apns.NewClient(CertificatePemIos).Development()
+		if app.AndroidFcm.Enabled && app.AndroidFcm.APIKey == "" {
+			return errors.New("Missing Android FCM API Key")
 		}
 	}
 
-	return apnsClient, nil
-}
-
-// initFCMClient initializes an FCM Client for the given AppID.
-func initFCMClient(AppID string) (*fcm.FcmClient, error) {
-	var err error
-	var fcmClient *fcm.FcmClient
-
-	if PushConf.Apps[AppID].AndroidFcm.Enabled {
-
-		apiKey := PushConf.Apps[AppID].AndroidFcm.APIKey
-
-		fcmClient = fcm.NewFcmClient(apiKey)
-
-		return fcmClient, nil
+	if !enabled {
+		return errors.New("Please enable iOS or Android config in yml config")
 	}
 
-	err = errors.New("FCM not enabled")
-
-	return nil, err
-}
-
-// GetFCMClient returns an existing FCM client connection if available else
-// creates a new connection and returns
-func GetFcmClient(AppID string) (*fcm.FcmClient, error) {
-    client, err := initFCMClient(AppID)
-	return client, err
+	return nil
 }
 
-// GetAPNSClient returns an existing APNs client connection if available else
-// creates a new connection and returns
-//
-// For faster concurrency with locks, double checks have been used
-// (https://www.misfra.me/optimizing-concurrent-map-access-in-go/)
-func GetAPNSClient(AppID string) (*apns.Client, error) {
-	var client *apns.Client
-	var present bool
-	var err error
-
-	if len(apnsClients.clients) == 0 {
-		apnsClients.clients = make(map[string]*apns.Client, 0)
-	}
-
-	apnsClients.lock.RLock()
-	if client, present = apnsClients.clients[AppID]; !present {
-		// The connection wasn't found, so we'll create it.
-		apnsClients.lock.RUnlock()
-		apnsClients.lock.Lock()
-		if client, present = apnsClients.clients[AppID]; !present {
-			client, err = initAPNSClient(AppID)
-
-			apnsClients.clients[AppID] = client
-		}
-		apnsClients.lock.Unlock()
-	} else {
-		apnsClients.lock.RUnlock()
+// certificatePath prepends the common certificate folder to the key path.
+func certificatePath(keyPath string) string {
+	if len(strings.TrimSpace(PushConf.Core.CertDir)) != 0 {
+		return PushConf.Core.CertDir + keyPath
 	}
 
-	return client, err
+	return keyPath
 }
 
 // InitWorkers for initialize all workers.
 func InitWorkers(workerNum int64, queueNum int64) {
 	LogAccess.Debug("worker number is ", workerNum, ", queue number is ", queueNum)
 	QueueNotification = make(chan PushNotification, queueNum)
+	// workers of previous call wait on the replaced channel.
+	atomic.StoreInt64(&workerCount, workerNum)
 	for i := int64(0); i < workerNum; i++ {
 		go startWorker()
 	}
@@ -311,55 +266,196 @@ func InitWorkers(workerNum int64, queueNum int64) {
 func startWorker() {
 	for {
 		notification := <-QueueNotification
+		atomic.AddInt64(&busyWorkers, 1)
+		observeQueueWait(notification)
+		updateNotificationStatus(notification, StateSending)
+
+		// each attempt is a span, provider requests are its children.
+		span := startSpan(notification.trace, "gorush.worker", spanKindInternal)
+		span.setAttribute("gorush.app", notification.AppID)
+		span.setAttribute("gorush.platform", typeForPlatForm(notification.Platform))
+		span.setAttribute("gorush.attempt", notification.attempt)
+		span.setAttribute("gorush.tokens", len(notification.Tokens))
+		if span != nil {
+			notification.trace = span.spanContext()
+		}
+
+		var resp map[string]*PushResponse
 		switch notification.Platform {
 		case PlatFormIos:
-			PushToIOS(notification)
+			resp = PushToIOS(notification)
 		case PlatFormAndroid:
-			PushToAndroid(notification)
+			resp = PushToAndroid(notification)
+		case PlatFormAndroidFcm:
+			resp = PushToAndroidFcm(notification)
 		}
+		finishTokensSpan(span, notification.Tokens, resp)
+		notification.complete(resp)
+		atomic.AddInt64(&busyWorkers, -1)
 	}
 }
 
-// queueNotification add notification to queue list.
-func queueNotification(req RequestPush) int {
-	var count int
+// queueNotification add notification to queue list and returns the id of
+// each accepted notification in the same order as the request.
+// In sync mode it waits for all workers and returns the delivery result of
+// each notification in the same order as the request. Scheduled
+// notifications are stored for scheduler and not waited for.
+func queueNotification(req RequestPush) (int, []string, []NotificationResult) {
+	var count, queued int
+	var results []NotificationResult
+	ids := make([]string, len(req.Notifications))
 	wg := sync.WaitGroup{}
-	for _, notification := range req.Notifications {
+
+	if PushConf.Core.Sync {
+		results = make([]NotificationResult, len(req.Notifications))
+	}
+
+	for i, notification := range req.Notifications {
 
 		// send notification to `normal` app, if app not specified
 		if notification.AppID == "" {
 			notification.AppID = AppNameDefault
 		}
 
-		// skip notification if unkown app specified
-		if _, exists := PushConf.Apps[notification.AppID]; !exists {
-			LogError.Error("Unknown app: " + notification.AppID)
-			continue
+		var result *NotificationResult
+		if results != nil {
+			result = &results[i]
+			result.AppID = notification.AppID
+			result.Platform = notification.Platform
 		}
 
-		switch notification.Platform {
-		case PlatFormIos:
-			if !PushConf.Apps[notification.AppID].Ios.Enabled {
-				continue
-			}
-		case PlatFormAndroid:
-			if !PushConf.Apps[notification.AppID].Android.Enabled {
-				continue
+		notification.wg = &wg
+		notification.result = result
+		notification.watcher = req.watcher
+		notification.trace = req.trace
+
+		id, sent, err := queueSingle(notification)
+		if err != nil {
+			if result != nil {
+				result.Error = err.Error()
 			}
+			continue
 		}
-		wg.Add(1)
-		notification.wg = &wg
-		QueueNotification <- notification
+
+		ids[i] = id
 		count += len(notification.Tokens)
+		if sent {
+			queued += len(notification.Tokens)
+		}
 	}
 
 	if PushConf.Core.Sync {
 		wg.Wait()
 	}
 
-	StatStorage.AddTotalCount(int64(count))
+	if req.watcher != nil {
+		req.watcher.seal()
+	}
+
+	addTotalCount(int64(queued))
+
+	return count, ids, results
+}
+
+// queueSingle checks notification and sends it to workers, or stores it for
+// scheduler if it is sent later. It returns id of notification and whether
+// it is sent to workers now.
+func queueSingle(notification PushNotification) (string, bool, error) {
+	if notification.AppID == "" {
+		notification.AppID = AppNameDefault
+	}
+
+	// skip notification if unkown app specified
+	if _, exists := PushConf.Apps[notification.AppID]; !exists {
+		LogError.Error("Unknown app: " + notification.AppID)
+		return "", false, errors.New("unknown app: " + notification.AppID)
+	}
+
+	var enabled bool
+	switch notification.Platform {
+	case PlatFormIos:
+		enabled = PushConf.Apps[notification.AppID].Ios.Enabled
+	case PlatFormAndroid:
+		enabled = PushConf.Apps[notification.AppID].Android.Enabled
+	case PlatFormAndroidFcm:
+		enabled = PushConf.Apps[notification.AppID].AndroidFcm.Enabled
+	}
+
+	if !enabled {
+		return "", false, errors.New("platform not enabled")
+	}
+
+	if _, err := renderTemplate(notification); err != nil {
+		LogError.Error("template error: " + err.Error())
+		return "", false, errors.New("template error: " + err.Error())
+	}
+
+	sendAt, err := notificationSendAt(notification)
+	if err != nil {
+		LogError.Error(err.Error())
+		return "", false, err
+	}
+
+	// notification with used idempotency_key is not sent again.
+	idempotencyKey := notificationIdempotencyKey(notification)
+	if idempotencyKey != "" {
+		record, err := claimIdempotencyKey(idempotencyKey, "")
+		if err != nil {
+			LogError.Error("idempotency error: " + err.Error())
+			return "", false, errors.New("idempotency error: " + err.Error())
+		}
+
+		if record != nil {
+			if !record.Done {
+				return "", false, errors.New("notification with the same idempotency_key is in progress")
+			}
+
+			LogAccess.Debug("Skip duplicate notification: " + record.ID)
+			if notification.result != nil {
+				notification.result.ID = record.ID
+			}
+			return record.ID, false, nil
+		}
+	}
+
+	// scheduled notification is sent later by scheduler.
+	if !sendAt.IsZero() {
+		id, err := scheduleNotification(notification, sendAt)
+		if err != nil {
+			LogError.Error("schedule error: " + err.Error())
+			if idempotencyKey != "" {
+				releaseIdempotencyKey(idempotencyKey)
+			}
+			return "", false, errors.New("schedule error: " + err.Error())
+		}
 
-	return count
+		if idempotencyKey != "" {
+			finishIdempotencyKey(idempotencyKey, idempotencyRecord{ID: id})
+		}
+		if notification.result != nil {
+			notification.result.ID = id
+		}
+		return id, false, nil
+	}
+
+	notification.id = newSortableID()
+	if notification.result != nil {
+		notification.result.ID = notification.id
+	}
+	if idempotencyKey != "" {
+		finishIdempotencyKey(idempotencyKey, idempotencyRecord{ID: notification.id})
+	}
+
+	if notification.wg != nil {
+		notification.wg.Add(1)
+	}
+	if notification.watcher != nil {
+		notification.watcher.add(len(notification.Tokens))
+	}
+	saveNotificationStatus(notification)
+	enqueueNotification(notification)
+
+	return notification.id, true, nil
 }
 
 func iosAlertDictionary(payload *payload.Payload, req PushNotification) *payload.Payload {
@@ -423,11 +519,18 @@ func iosAlertDictionary(payload *payload.Payload, req PushNotification) *payload
 // The iOS Notification Payload
 // ref: https://developer.apple.com/library/content/documentation/NetworkingInternet/Conceptual/RemoteNotificationsPG/PayloadKeyReference.html#//apple_ref/doc/uid/TP40008194-CH17-SW1
 func GetIOSNotification(req PushNotification) *apns.Notification {
+	req = applyTemplate(req)
+
 	notification := &apns.Notification{
 		ApnsID: req.ApnsID,
 		Topic:  req.Topic,
 	}
 
+	// one .p8 key can serve several bundles, so fallback to topic of app.
+	if notification.Topic == "" {
+		notification.Topic = PushConf.Apps[req.AppID].Ios.Topic
+	}
+
 	if req.Expiration > 0 {
 		notification.Expiration = time.Unix(req.Expiration, 0)
 	}
@@ -484,52 +587,53 @@ func GetIOSNotification(req PushNotification) *apns.Notification {
 // PushToIOS provide send notification to APNs server.
 func PushToIOS(req PushNotification) map[string]*PushResponse {
 	LogAccess.Debug("Start push notification for iOS")
-	defer req.Done()
-	var retryCount = 0
-	var maxRetry = PushConf.Apps[req.AppID].Ios.MaxRetry
 
+	var retryTokens []string
 	pushResponse := make(map[string]*PushResponse, 0)
 
-	if req.Retry > 0 && req.Retry < maxRetry {
-		maxRetry = req.Retry
+	req, failed := pushTemplate(req)
+	if failed != nil {
+		return failed
 	}
 
-Retry:
-	var isError = false
-	var newTokens []string
-
 	notification := GetIOSNotification(req)
 
-	// get apns client
-	apnsClient, err := GetAPNSClient(req.AppID)
+	// get apns client, it is kept open until pushes are finished.
+	apnsApp, err := acquireApnsApp(req.AppID)
 	if err != nil {
 		LogPush(FailedPush, "", req, err)
-		isError = true
+		countPushDrop(req, reasonClientError, len(req.Tokens))
 		return pushResponse
 	}
+	defer apnsApp.release()
+	apnsClient := apnsApp.client
 
 	for _, token := range req.Tokens {
 		notification.DeviceToken = token
 
 		// send ios notification
+		span := startPushSpan(req, "apns.push", []string{token})
+		start := time.Now()
 		res, err := apnsClient.Push(notification)
 
 		pushResponse[token] = &PushResponse{
-			Status:                "success",
-			CanonicalId:           "",
-			Error:                 "",
+			Status:      "success",
+			CanonicalId: "",
+			Error:       "",
 		}
 
 		if err != nil {
 			// apns server error
 
 			pushResponse[token].Status = "apn_error"
-			pushResponse[token].Error  = err.Error()
+			pushResponse[token].Error = err.Error()
 
 			LogPush(FailedPush, token, req, err)
-			StatStorage.AddIosError(1)
-			newTokens = append(newTokens, token)
-			isError = true
+			addPushError(PlatFormIos, req.AppID, reasonRequestError, 1)
+			observeProviderRequest(req, outcomeError, start)
+			countPushError(req, reasonRequestError, 1)
+			finishPushSpan(span, outcomeError, 1, err)
+			retryTokens = append(retryTokens, token)
 			continue
 		}
 
@@ -538,98 +642,34 @@ Retry:
 			// ref: https://github.com/sideshow/apns2/blob/master/response.go#L14-L65
 
 			pushResponse[token].Status = "failed"
-			pushResponse[token].Error  = res.Reason
+			pushResponse[token].Reason = res.Reason
+			pushResponse[token].ApnsID = res.ApnsID
 
 			LogPush(FailedPush, token, req, errors.New(res.Reason))
-			StatStorage.AddIosError(1)
-			newTokens = append(newTokens, token)
-			isError = true
+			addPushError(PlatFormIos, req.AppID, res.Reason, 1)
+			observeProviderRequest(req, outcomeFailed, start)
+			countPushError(req, res.Reason, 1)
+			finishPushSpan(span, outcomeFailed, 1, errors.New(res.Reason))
+			recordFeedback(req, token, res.Reason, "")
+			if isRetryableStatus(res.StatusCode) || isRetryableReason(req.Platform, res.Reason) {
+				retryTokens = append(retryTokens, token)
+			}
 			continue
 		}
 
-		if res.Sent() {
-
-			LogPush(SucceededPush, token, req, nil)
-			StatStorage.AddIosSuccess(1)
-		}
-	}
-
-	if isError == true && retryCount < maxRetry {
-		retryCount++
-
-		// resend fail token
-		req.Tokens = newTokens
-		goto Retry
-	}
-
-	return pushResponse
-}
-
-// PushToAndroidFcm provide send notification through FCM.
-func PushToAndroidFcm(req PushNotification) map[string]*PushResponse {
-	LogAccess.Debug("Start push notification for FCM")
-	defer req.Done()
-	var retryCount = 0
-	var maxRetry = PushConf.Apps[req.AppID].AndroidFcm.MaxRetry
-
-	pushResponse := make(map[string]*PushResponse, 0)
-
-	if req.Retry > 0 && req.Retry < maxRetry {
-		maxRetry = req.Retry
-	}
-
-Retry:
-	var isError = false
-	var newTokens []string
+		pushResponse[token].ApnsID = res.ApnsID
+		observeProviderRequest(req, outcomeSuccess, start)
+		finishPushSpan(span, outcomeSuccess, 0, nil)
 
-	notification, data := GetFcmNotification(req)
-
-	// get fcm client
-	fcmClient, err := GetFcmClient(req.AppID)
-	if err != nil {
-		LogPush(FailedPush, "", req, err)
-		isError = true
-		return pushResponse
-	}
-
-	for _, token := range req.Tokens {
-
-		// new fcm msg
-		fcmClient.NewFcmMsgTo(token, data)
-		fcmClient.SetNotificationPayload(notification)
-
-		// Send fcm msg
-		res, err := fcmClient.Send()
-
-		pushResponse[token] = &PushResponse{
-			Status:                "success",
-			CanonicalId:           "",
-			Error:                 "",
-		}
-
-		if err != nil {
-			// fcm error
-			pushResponse[token].Status = "failed"
-			pushResponse[token].Error  = err.Error()
-
-			LogPush(FailedPush, token, req, err)
-			newTokens = append(newTokens, token)
-			isError = true
-			continue
-		}
+		if res.Sent() {
 
-		if res.Ok {
 			LogPush(SucceededPush, token, req, nil)
+			addPushSuccess(PlatFormIos, req.AppID, 1)
 		}
 	}
 
-	if isError == true && retryCount < maxRetry {
-		retryCount++
-
-		// resend fail token
-		req.Tokens = newTokens
-		goto Retry
-	}
+	// resend transient failed tokens
+	scheduleRetry(req, retryTokens, 0, pushResponse)
 
 	return pushResponse
 }
@@ -639,11 +679,13 @@ Retry:
 // https://github.com/NaySoftware/go-fcm/blob/master/fcm.go#L75
 // https://firebase.google.com/docs/cloud-messaging/http-server-ref
 func GetFcmNotification(req PushNotification) (*fcm.NotificationPayload, interface{}) {
+	req = applyTemplate(req)
+
 	notification := new(fcm.NotificationPayload)
 	data := make(map[string]interface{})
 
 	// Add another field
-	if (len(req.Data) > 0 || len(req.AndroidData) > 0) {
+	if len(req.Data) > 0 || len(req.AndroidData) > 0 {
 
 		// Get Common data fields
 		for k, v := range req.Data {
@@ -679,6 +721,8 @@ func GetFcmNotification(req PushNotification) (*fcm.NotificationPayload, interfa
 // HTTP Connection Server Reference for Android
 // https://developers.google.com/cloud-messaging/http-server-ref
 func GetAndroidNotification(req PushNotification) gcm.HttpMessage {
+	req = applyTemplate(req)
+
 	notification := gcm.HttpMessage{
 		To:                    req.To,
 		CollapseKey:           req.CollapseKey,
@@ -696,7 +740,7 @@ func GetAndroidNotification(req PushNotification) gcm.HttpMessage {
 	}
 
 	// Add another field
-	if (len(req.Data) > 0 || len(req.AndroidData) > 0) {
+	if len(req.Data) > 0 || len(req.AndroidData) > 0 {
 		notification.Data = make(map[string]interface{})
 
 		// Get Common data fields
@@ -732,17 +776,13 @@ func GetAndroidNotification(req PushNotification) gcm.HttpMessage {
 func PushToAndroid(req PushNotification) map[string]*PushResponse {
 	LogAccess.Debug("Start push notification for Android")
 
-	defer req.Done()
-
-	var retryCount = 0
-	var maxRetry = PushConf.Apps[req.AppID].Android.MaxRetry
+	pushResponse := make(map[string]*PushResponse, 0)
 
-	if req.Retry > 0 && req.Retry < maxRetry {
-		maxRetry = req.Retry
+	req, failed := pushTemplate(req)
+	if failed != nil {
+		return failed
 	}
 
-	pushResponse := make(map[string]*PushResponse, 0)
-
 	// Set api key if none provided in req
 	var apiKey = req.APIKey
 	if apiKey == "" {
@@ -754,32 +794,54 @@ func PushToAndroid(req PushNotification) map[string]*PushResponse {
 
 	if err != nil {
 		LogError.Error("request error: " + err.Error())
+		countPushDrop(req, reasonInvalid, len(req.Tokens))
 		return pushResponse
 	}
 
-Retry:
-	var isError = false
 	notification := GetAndroidNotification(req)
 
+	span := startPushSpan(req, "gcm.send", req.Tokens)
+	start := time.Now()
 	res, err := gcm.SendHttp(apiKey, notification)
 
 	if err != nil {
-		// GCM server error
+		// GCM server error, all tokens failed
 		LogError.Error("GCM server error: " + err.Error())
+		for _, token := range req.Tokens {
+			pushResponse[token] = &PushResponse{
+				Status: "failed",
+				Error:  err.Error(),
+			}
+
+			LogPush(FailedPush, token, req, err)
+		}
+
+		addPushError(PlatFormAndroid, req.AppID, reasonRequestError, int64(len(req.Tokens)))
+		observeProviderRequest(req, outcomeError, start)
+		countPushError(req, reasonRequestError, len(req.Tokens))
+		finishPushSpan(span, outcomeError, len(req.Tokens), err)
+		scheduleRetry(req, req.Tokens, 0, pushResponse)
 		return pushResponse
 	}
 
+	if res.Failure > 0 {
+		observeProviderRequest(req, outcomeFailed, start)
+		finishPushSpan(span, outcomeFailed, int(res.Failure), nil)
+	} else {
+		observeProviderRequest(req, outcomeSuccess, start)
+		finishPushSpan(span, outcomeSuccess, 0, nil)
+	}
+
 	LogAccess.Debug(fmt.Sprintf("Android Success count: %d, Failure count: %d", res.Success, res.Failure))
-	StatStorage.AddAndroidSuccess(int64(res.Success))
-	StatStorage.AddAndroidError(int64(res.Failure))
+	addPushSuccess(PlatFormAndroid, req.AppID, int64(res.Success))
 
-	var newTokens []string
+	var retryTokens []string
 	for k, result := range res.Results {
 
 		pushResponse[req.Tokens[k]] = &PushResponse{
-			Status:                "success",
-			CanonicalId:           "",
-			Error:                 "",
+			Status:      "success",
+			CanonicalId: "",
+			Error:       "",
 		}
 
 		if result.RegistrationId != "" {
@@ -787,12 +849,17 @@ Retry:
 			pushResponse[req.Tokens[k]].CanonicalId = result.RegistrationId
 		}
 
+		recordFeedback(req, req.Tokens[k], result.Error, result.RegistrationId)
+
 		if result.Error != "" {
-			isError = true
-			newTokens = append(newTokens, req.Tokens[k])
+			if isRetryableReason(req.Platform, result.Error) {
+				retryTokens = append(retryTokens, req.Tokens[k])
+			}
 
 			pushResponse[req.Tokens[k]].Status = "failed"
-			pushResponse[req.Tokens[k]].Error = result.Error
+			pushResponse[req.Tokens[k]].Reason = result.Error
+			addPushError(PlatFormAndroid, req.AppID, result.Error, 1)
+			countPushError(req, result.Error, 1)
 
 			LogPush(FailedPush, req.Tokens[k], req, errors.New(result.Error))
 			continue
@@ -801,13 +868,8 @@ Retry:
 		LogPush(SucceededPush, req.Tokens[k], req, nil)
 	}
 
-	if isError == true && retryCount < maxRetry {
-		retryCount++
-
-		// resend fail token
-		req.Tokens = newTokens
-		goto Retry
-	}
+	// resend transient failed tokens
+	scheduleRetry(req, retryTokens, 0, pushResponse)
 
 	return pushResponse
 }
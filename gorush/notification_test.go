@@ -3,13 +3,14 @@ package gorush
 import (
 	"encoding/json"
 	"log"
+	"net/http"
 	"os"
 	"testing"
 	"time"
 
-	"github.com/lalit-verma/gorush/config"
 	"github.com/buger/jsonparser"
 	"github.com/google/go-gcm"
+	"github.com/lalit-verma/gorush/config"
 	"github.com/sideshow/apns2"
 	"github.com/stretchr/testify/assert"
 )
@@ -25,15 +26,20 @@ func TestDisabledAndroidIosConf(t *testing.T) {
 
 func TestMissingIOSCertificate(t *testing.T) {
 	PushConf = config.BuildDefaultPushConf()
+	app := PushConf.Apps[AppNameDefault]
+
+	app.Ios.Enabled = true
+	app.Ios.KeyPath = ""
+	PushConf.Apps[AppNameDefault] = app
 
-	PushConf.Ios.Enabled = true
-	PushConf.Ios.KeyPath = ""
 	err := CheckPushConf()
 
 	assert.Error(t, err)
 	assert.Equal(t, "Missing iOS certificate path", err.Error())
 
-	PushConf.Ios.KeyPath = "test.pem"
+	app.Ios.KeyPath = "test.pem"
+	PushConf.Apps[AppNameDefault] = app
+
 	err = CheckPushConf()
 
 	assert.Error(t, err)
@@ -43,9 +49,11 @@ func TestMissingIOSCertificate(t *testing.T) {
 
 func TestMissingAndroidAPIKey(t *testing.T) {
 	PushConf = config.BuildDefaultPushConf()
+	app := PushConf.Apps[AppNameDefault]
 
-	PushConf.Android.Enabled = true
-	PushConf.Android.APIKey = ""
+	app.Android.Enabled = true
+	app.Android.APIKey = ""
+	PushConf.Apps[AppNameDefault] = app
 
 	err := CheckPushConf()
 
@@ -53,14 +61,30 @@ func TestMissingAndroidAPIKey(t *testing.T) {
 	assert.Equal(t, "Missing Android API Key", err.Error())
 }
 
+func TestMissingAndroidFcmAPIKey(t *testing.T) {
+	PushConf = config.BuildDefaultPushConf()
+	app := PushConf.Apps[AppNameDefault]
+
+	app.AndroidFcm.Enabled = true
+	app.AndroidFcm.APIKey = ""
+	PushConf.Apps[AppNameDefault] = app
+
+	err := CheckPushConf()
+
+	assert.Error(t, err)
+	assert.Equal(t, "Missing Android FCM API Key", err.Error())
+}
+
 func TestCorrectConf(t *testing.T) {
 	PushConf = config.BuildDefaultPushConf()
+	app := PushConf.Apps[AppNameDefault]
 
-	PushConf.Android.Enabled = true
-	PushConf.Android.APIKey = "xxxxx"
+	app.Android.Enabled = true
+	app.Android.APIKey = "xxxxx"
 
-	PushConf.Ios.Enabled = true
-	PushConf.Ios.KeyPath = "../certificate/certificate-valid.pem"
+	app.Ios.Enabled = true
+	app.Ios.KeyPath = "../certificate/certificate-valid.pem"
+	PushConf.Apps[AppNameDefault] = app
 
 	err := CheckPushConf()
 
@@ -228,18 +252,19 @@ func TestCheckSilentNotification(t *testing.T) {
 
 // URL: https://goo.gl/5xFo3C
 // Example 2
-// {
-//     "aps" : {
-//         "alert" : {
-//             "title" : "Game Request",
-//             "body" : "Bob wants to play poker",
-//             "action-loc-key" : "PLAY"
-//         },
-//         "badge" : 5
-//     },
-//     "acme1" : "bar",
-//     "acme2" : [ "bang",  "whiz" ]
-// }
+//
+//	{
+//	    "aps" : {
+//	        "alert" : {
+//	            "title" : "Game Request",
+//	            "body" : "Bob wants to play poker",
+//	            "action-loc-key" : "PLAY"
+//	        },
+//	        "badge" : 5
+//	    },
+//	    "acme1" : "bar",
+//	    "acme2" : [ "bang",  "whiz" ]
+//	}
 func TestAlertStringExample2ForIos(t *testing.T) {
 	var dat map[string]interface{}
 
@@ -275,15 +300,16 @@ func TestAlertStringExample2ForIos(t *testing.T) {
 
 // URL: https://goo.gl/5xFo3C
 // Example 3
-// {
-//     "aps" : {
-//         "alert" : "You got your emails.",
-//         "badge" : 9,
-//         "sound" : "bingbong.aiff"
-//     },
-//     "acme1" : "bar",
-//     "acme2" : 42
-// }
+//
+//	{
+//	    "aps" : {
+//	        "alert" : "You got your emails.",
+//	        "badge" : 9,
+//	        "sound" : "bingbong.aiff"
+//	    },
+//	    "acme1" : "bar",
+//	    "acme2" : 42
+//	}
 func TestAlertStringExample3ForIos(t *testing.T) {
 	var dat map[string]interface{}
 
@@ -428,61 +454,144 @@ func TestAndroidNotificationStructure(t *testing.T) {
 	assert.Equal(t, "", notification.Notification.Body)
 }
 
+func TestAndroidFcmNotificationStructure(t *testing.T) {
+	req := PushNotification{
+		Tokens:  []string{"a"},
+		Message: "Welcome",
+		Title:   "test",
+		Sound:   "default",
+		Data: D{
+			"a": "1",
+		},
+		AndroidData: D{
+			"b": 2,
+		},
+	}
+
+	notification, data := GetFcmNotification(req)
+	payload := data.(map[string]interface{})
+
+	assert.Equal(t, "Welcome", notification.Body)
+	assert.Equal(t, "test", notification.Title)
+	assert.Equal(t, "default", notification.Sound)
+	assert.Equal(t, "1", payload["a"])
+	assert.Equal(t, 2, payload["b"])
+	assert.Equal(t, "Welcome", payload["Body"])
+}
+
 func TestPushToIOS(t *testing.T) {
 	PushConf = config.BuildDefaultPushConf()
+	app := PushConf.Apps[AppNameDefault]
+
+	app.Ios.Enabled = true
+	app.Ios.KeyPath = "../certificate/certificate-valid.pem"
+	PushConf.Apps[AppNameDefault] = app
 
-	PushConf.Ios.Enabled = true
-	PushConf.Ios.KeyPath = "../certificate/certificate-valid.pem"
-	InitAPNSClient()
 	InitAppStatus()
 
 	req := PushNotification{
 		Tokens:   []string{"11aa01229f15f0f0c52029d8cf8cd0aeaf2365fe4cebc4af26cd6d76b7919ef7"},
 		Platform: 1,
+		AppID:    AppNameDefault,
 		Message:  "Welcome",
 	}
 
-	isError := PushToIOS(req)
-	assert.True(t, isError)
+	resp := PushToIOS(req)
+	if assert.NotNil(t, resp[req.Tokens[0]]) {
+		assert.NotEqual(t, "success", resp[req.Tokens[0]].Status)
+	}
 }
 
 func TestPushToAndroidWrongAPIKey(t *testing.T) {
 	PushConf = config.BuildDefaultPushConf()
+	app := PushConf.Apps[AppNameDefault]
 
-	PushConf.Android.Enabled = true
-	PushConf.Android.APIKey = os.Getenv("ANDROID_API_KEY") + "a"
+	app.Android.Enabled = true
+	app.Android.APIKey = os.Getenv("ANDROID_API_KEY") + "a"
+	PushConf.Apps[AppNameDefault] = app
 
 	req := PushNotification{
 		Tokens:   []string{"aaaaaa", "bbbbb"},
 		Platform: PlatFormAndroid,
+		AppID:    AppNameDefault,
 		Message:  "Welcome",
 	}
 
-	success := PushToAndroid(req)
-	assert.False(t, success)
+	// request error fails every token.
+	resp := PushToAndroid(req)
+	assert.Len(t, resp, 2)
+	if assert.NotNil(t, resp["aaaaaa"]) {
+		assert.Equal(t, "failed", resp["aaaaaa"].Status)
+	}
 }
 
 func TestPushToAndroidWrongToken(t *testing.T) {
 	PushConf = config.BuildDefaultPushConf()
+	app := PushConf.Apps[AppNameDefault]
 
-	PushConf.Android.Enabled = true
-	PushConf.Android.APIKey = os.Getenv("ANDROID_API_KEY")
+	app.Android.Enabled = true
+	app.Android.APIKey = os.Getenv("ANDROID_API_KEY")
+	PushConf.Apps[AppNameDefault] = app
 
 	req := PushNotification{
 		Tokens:   []string{"aaaaaa", "bbbbb"},
 		Platform: PlatFormAndroid,
+		AppID:    AppNameDefault,
+		Message:  "Welcome",
+	}
+
+	resp := PushToAndroid(req)
+	if assert.NotNil(t, resp["aaaaaa"]) {
+		assert.Equal(t, "failed", resp["aaaaaa"].Status)
+	}
+}
+
+func TestPushToAndroidServerError(t *testing.T) {
+	PushConf = config.BuildDefaultPushConf()
+	InitLog()
+	InitAppStatus()
+
+	app := PushConf.Apps[AppNameDefault]
+	app.Android.Enabled = true
+	app.Android.APIKey = "apiKey"
+	PushConf.Apps[AppNameDefault] = app
+
+	// nothing listens on the proxy port, so GCM request fails.
+	transport := http.DefaultTransport
+	defer func() {
+		http.DefaultTransport = transport
+	}()
+	assert.NoError(t, SetProxy("http://127.0.0.1:1"))
+
+	before := pushStatus().Apps[AppNameDefault].Android
+	resp := PushToAndroid(PushNotification{
+		Tokens:   []string{"aaaaaa", "bbbbb"},
+		Platform: PlatFormAndroid,
+		AppID:    AppNameDefault,
 		Message:  "Welcome",
+	})
+
+	assert.Len(t, resp, 2)
+	for _, token := range []string{"aaaaaa", "bbbbb"} {
+		if assert.NotNil(t, resp[token]) {
+			assert.Equal(t, "failed", resp[token].Status)
+			assert.NotEmpty(t, resp[token].Error)
+		}
 	}
 
-	success := PushToAndroid(req)
-	assert.True(t, success)
+	after := pushStatus().Apps[AppNameDefault].Android
+	assert.Equal(t, before.PushError+2, after.PushError)
+	assert.Equal(t, before.Errors[reasonRequestError]+2, after.Errors[reasonRequestError])
 }
 
 func TestPushToAndroidRightTokenForJSONLog(t *testing.T) {
 	PushConf = config.BuildDefaultPushConf()
+	app := PushConf.Apps[AppNameDefault]
+
+	app.Android.Enabled = true
+	app.Android.APIKey = os.Getenv("ANDROID_API_KEY")
+	PushConf.Apps[AppNameDefault] = app
 
-	PushConf.Android.Enabled = true
-	PushConf.Android.APIKey = os.Getenv("ANDROID_API_KEY")
 	// log for json
 	PushConf.Log.Format = "json"
 
@@ -491,62 +600,78 @@ func TestPushToAndroidRightTokenForJSONLog(t *testing.T) {
 	req := PushNotification{
 		Tokens:   []string{androidToken, "bbbbb"},
 		Platform: PlatFormAndroid,
+		AppID:    AppNameDefault,
 		Message:  "Welcome",
 	}
 
-	success := PushToAndroid(req)
-	assert.True(t, success)
+	resp := PushToAndroid(req)
+	if assert.NotNil(t, resp["bbbbb"]) {
+		assert.Equal(t, "failed", resp["bbbbb"].Status)
+	}
 }
 
 func TestPushToAndroidRightTokenForStringLog(t *testing.T) {
 	PushConf = config.BuildDefaultPushConf()
+	app := PushConf.Apps[AppNameDefault]
 
-	PushConf.Android.Enabled = true
-	PushConf.Android.APIKey = os.Getenv("ANDROID_API_KEY")
+	app.Android.Enabled = true
+	app.Android.APIKey = os.Getenv("ANDROID_API_KEY")
+	PushConf.Apps[AppNameDefault] = app
 
 	androidToken := os.Getenv("ANDROID_TEST_TOKEN")
 
 	req := PushNotification{
 		Tokens:   []string{androidToken, "bbbbb"},
 		Platform: PlatFormAndroid,
+		AppID:    AppNameDefault,
 		Message:  "Welcome",
 	}
 
-	success := PushToAndroid(req)
-	assert.True(t, success)
+	resp := PushToAndroid(req)
+	if assert.NotNil(t, resp["bbbbb"]) {
+		assert.Equal(t, "failed", resp["bbbbb"].Status)
+	}
 }
 
 func TestOverwriteAndroidAPIKey(t *testing.T) {
 	PushConf = config.BuildDefaultPushConf()
+	app := PushConf.Apps[AppNameDefault]
 
-	PushConf.Android.Enabled = true
-	PushConf.Android.APIKey = os.Getenv("ANDROID_API_KEY")
+	app.Android.Enabled = true
+	app.Android.APIKey = os.Getenv("ANDROID_API_KEY")
+	PushConf.Apps[AppNameDefault] = app
 
 	androidToken := os.Getenv("ANDROID_TEST_TOKEN")
 
 	req := PushNotification{
 		Tokens:   []string{androidToken, "bbbbb"},
 		Platform: PlatFormAndroid,
+		AppID:    AppNameDefault,
 		Message:  "Welcome",
 		// overwrite android api key
 		APIKey: "1234",
 	}
 
-	success := PushToAndroid(req)
-	assert.False(t, success)
+	// request error fails every token.
+	resp := PushToAndroid(req)
+	assert.Len(t, resp, 2)
+	if assert.NotNil(t, resp["bbbbb"]) {
+		assert.Equal(t, "failed", resp["bbbbb"].Status)
+	}
 }
 
 func TestSenMultipleNotifications(t *testing.T) {
 	PushConf = config.BuildDefaultPushConf()
+	app := PushConf.Apps[AppNameDefault]
 
 	InitWorkers(int64(2), 2)
 
-	PushConf.Ios.Enabled = true
-	PushConf.Ios.KeyPath = "../certificate/certificate-valid.pem"
-	InitAPNSClient()
+	app.Ios.Enabled = true
+	app.Ios.KeyPath = "../certificate/certificate-valid.pem"
 
-	PushConf.Android.Enabled = true
-	PushConf.Android.APIKey = os.Getenv("ANDROID_API_KEY")
+	app.Android.Enabled = true
+	app.Android.APIKey = os.Getenv("ANDROID_API_KEY")
+	PushConf.Apps[AppNameDefault] = app
 
 	androidToken := os.Getenv("ANDROID_TEST_TOKEN")
 
@@ -567,19 +692,20 @@ func TestSenMultipleNotifications(t *testing.T) {
 		},
 	}
 
-	count := queueNotification(req)
+	count, _, _ := queueNotification(req)
 	assert.Equal(t, 3, count)
 }
 
 func TestDisabledAndroidNotifications(t *testing.T) {
 	PushConf = config.BuildDefaultPushConf()
+	app := PushConf.Apps[AppNameDefault]
 
-	PushConf.Ios.Enabled = true
-	PushConf.Ios.KeyPath = "../certificate/certificate-valid.pem"
-	InitAPNSClient()
+	app.Ios.Enabled = true
+	app.Ios.KeyPath = "../certificate/certificate-valid.pem"
 
-	PushConf.Android.Enabled = false
-	PushConf.Android.APIKey = os.Getenv("ANDROID_API_KEY")
+	app.Android.Enabled = false
+	app.Android.APIKey = os.Getenv("ANDROID_API_KEY")
+	PushConf.Apps[AppNameDefault] = app
 
 	androidToken := os.Getenv("ANDROID_TEST_TOKEN")
 
@@ -600,19 +726,20 @@ func TestDisabledAndroidNotifications(t *testing.T) {
 		},
 	}
 
-	count := queueNotification(req)
+	count, _, _ := queueNotification(req)
 	assert.Equal(t, 1, count)
 }
 
 func TestSyncModeForNotifications(t *testing.T) {
 	PushConf = config.BuildDefaultPushConf()
+	app := PushConf.Apps[AppNameDefault]
 
-	PushConf.Ios.Enabled = true
-	PushConf.Ios.KeyPath = "../certificate/certificate-valid.pem"
-	InitAPNSClient()
+	app.Ios.Enabled = true
+	app.Ios.KeyPath = "../certificate/certificate-valid.pem"
 
-	PushConf.Android.Enabled = true
-	PushConf.Android.APIKey = os.Getenv("ANDROID_API_KEY")
+	app.Android.Enabled = true
+	app.Android.APIKey = os.Getenv("ANDROID_API_KEY")
+	PushConf.Apps[AppNameDefault] = app
 
 	// enable sync mode
 	PushConf.Core.Sync = true
@@ -636,19 +763,74 @@ func TestSyncModeForNotifications(t *testing.T) {
 		},
 	}
 
-	count := queueNotification(req)
+	count, _, results := queueNotification(req)
 	assert.Equal(t, 3, count)
+	assert.Len(t, results, 2)
+	assert.Equal(t, PlatFormIos, results[0].Platform)
+	assert.Equal(t, AppNameDefault, results[0].AppID)
+	assert.Equal(t, PlatFormAndroid, results[1].Platform)
+}
+
+func TestSyncModeForSkippedNotifications(t *testing.T) {
+	PushConf = config.BuildDefaultPushConf()
+	app := PushConf.Apps[AppNameDefault]
+
+	app.Android.Enabled = false
+	PushConf.Apps[AppNameDefault] = app
+
+	// enable sync mode
+	PushConf.Core.Sync = true
+
+	req := RequestPush{
+		Notifications: []PushNotification{
+			{
+				Tokens:   []string{"aaaaaa"},
+				Platform: PlatFormAndroid,
+				Message:  "Welcome",
+			},
+			{
+				Tokens:   []string{"bbbbb"},
+				Platform: PlatFormAndroid,
+				Message:  "Welcome",
+				AppID:    "unknown",
+			},
+		},
+	}
+
+	count, _, results := queueNotification(req)
+	assert.Equal(t, 0, count)
+	assert.Len(t, results, 2)
+	assert.Equal(t, "platform not enabled", results[0].Error)
+	assert.Equal(t, "unknown app: unknown", results[1].Error)
+}
+
+func TestAsyncModeHasNoResults(t *testing.T) {
+	PushConf = config.BuildDefaultPushConf()
+
+	req := RequestPush{
+		Notifications: []PushNotification{
+			{
+				Tokens:   []string{"aaaaaa"},
+				Platform: PlatFormAndroid,
+				Message:  "Welcome",
+			},
+		},
+	}
+
+	_, _, results := queueNotification(req)
+	assert.Nil(t, results)
 }
 
 func TestDisabledIosNotifications(t *testing.T) {
 	PushConf = config.BuildDefaultPushConf()
+	app := PushConf.Apps[AppNameDefault]
 
-	PushConf.Ios.Enabled = false
-	PushConf.Ios.KeyPath = "../certificate/certificate-valid.pem"
-	InitAPNSClient()
+	app.Ios.Enabled = false
+	app.Ios.KeyPath = "../certificate/certificate-valid.pem"
 
-	PushConf.Android.Enabled = true
-	PushConf.Android.APIKey = os.Getenv("ANDROID_API_KEY")
+	app.Android.Enabled = true
+	app.Android.APIKey = os.Getenv("ANDROID_API_KEY")
+	PushConf.Apps[AppNameDefault] = app
 
 	androidToken := os.Getenv("ANDROID_TEST_TOKEN")
 
@@ -669,16 +851,76 @@ func TestDisabledIosNotifications(t *testing.T) {
 		},
 	}
 
-	count := queueNotification(req)
+	count, _, _ := queueNotification(req)
+	assert.Equal(t, 2, count)
+}
+
+func TestDisabledAndroidFcmNotifications(t *testing.T) {
+	PushConf = config.BuildDefaultPushConf()
+	app := PushConf.Apps[AppNameDefault]
+
+	app.Android.Enabled = true
+	app.Android.APIKey = os.Getenv("ANDROID_API_KEY")
+
+	app.AndroidFcm.Enabled = false
+	app.AndroidFcm.APIKey = os.Getenv("ANDROID_API_KEY")
+	PushConf.Apps[AppNameDefault] = app
+
+	androidToken := os.Getenv("ANDROID_TEST_TOKEN")
+
+	req := RequestPush{
+		Notifications: []PushNotification{
+			// android
+			{
+				Tokens:   []string{androidToken, "bbbbb"},
+				Platform: PlatFormAndroid,
+				Message:  "Welcome",
+			},
+			// android fcm
+			{
+				Tokens:   []string{androidToken, "bbbbb"},
+				Platform: PlatFormAndroidFcm,
+				Message:  "Welcome",
+			},
+		},
+	}
+
+	count, _, _ := queueNotification(req)
 	assert.Equal(t, 2, count)
 }
 
+func TestUnknownAppNotifications(t *testing.T) {
+	PushConf = config.BuildDefaultPushConf()
+	app := PushConf.Apps[AppNameDefault]
+
+	app.AndroidFcm.Enabled = true
+	app.AndroidFcm.APIKey = os.Getenv("ANDROID_API_KEY")
+	PushConf.Apps[AppNameDefault] = app
+
+	req := RequestPush{
+		Notifications: []PushNotification{
+			{
+				Tokens:   []string{"aaaaaa", "bbbbb"},
+				Platform: PlatFormAndroidFcm,
+				Message:  "Welcome",
+				AppID:    "unknown",
+			},
+		},
+	}
+
+	count, _, _ := queueNotification(req)
+	assert.Equal(t, 0, count)
+}
+
 func TestWrongIosCertificateExt(t *testing.T) {
 	PushConf = config.BuildDefaultPushConf()
+	app := PushConf.Apps[AppNameDefault]
 
-	PushConf.Ios.Enabled = true
-	PushConf.Ios.KeyPath = "test"
-	err := InitAPNSClient()
+	app.Ios.Enabled = true
+	app.Ios.KeyPath = "test"
+	PushConf.Apps[AppNameDefault] = app
+
+	_, err := initAPNSClient(AppNameDefault)
 
 	assert.Error(t, err)
 	assert.Equal(t, "wrong certificate key extension", err.Error())
@@ -686,23 +928,31 @@ func TestWrongIosCertificateExt(t *testing.T) {
 
 func TestAPNSClientDevHost(t *testing.T) {
 	PushConf = config.BuildDefaultPushConf()
+	app := PushConf.Apps[AppNameDefault]
+
+	app.Ios.Enabled = true
+	app.Ios.KeyPath = "../certificate/certificate-valid.p12"
+	PushConf.Apps[AppNameDefault] = app
 
-	PushConf.Ios.Enabled = true
-	PushConf.Ios.KeyPath = "../certificate/certificate-valid.p12"
-	InitAPNSClient()
+	client, err := initAPNSClient(AppNameDefault)
 
-	assert.Equal(t, apns2.HostDevelopment, ApnsClient.Host)
+	assert.NoError(t, err)
+	assert.Equal(t, apns2.HostDevelopment, client.Host)
 }
 
 func TestAPNSClientProdHost(t *testing.T) {
 	PushConf = config.BuildDefaultPushConf()
+	app := PushConf.Apps[AppNameDefault]
+
+	app.Ios.Enabled = true
+	app.Ios.Production = true
+	app.Ios.KeyPath = "../certificate/certificate-valid.pem"
+	PushConf.Apps[AppNameDefault] = app
 
-	PushConf.Ios.Enabled = true
-	PushConf.Ios.Production = true
-	PushConf.Ios.KeyPath = "../certificate/certificate-valid.pem"
-	InitAPNSClient()
+	client, err := initAPNSClient(AppNameDefault)
 
-	assert.Equal(t, apns2.HostProduction, ApnsClient.Host)
+	assert.NoError(t, err)
+	assert.Equal(t, apns2.HostProduction, client.Host)
 }
 
 func TestGCMMessage(t *testing.T) {
@@ -765,9 +1015,11 @@ func TestGCMMessage(t *testing.T) {
 
 func TestCheckAndroidMessage(t *testing.T) {
 	PushConf = config.BuildDefaultPushConf()
+	app := PushConf.Apps[AppNameDefault]
 
-	PushConf.Android.Enabled = true
-	PushConf.Android.APIKey = os.Getenv("ANDROID_API_KEY")
+	app.Android.Enabled = true
+	app.Android.APIKey = os.Getenv("ANDROID_API_KEY")
+	PushConf.Apps[AppNameDefault] = app
 
 	timeToLive := uint(2419201)
 	req := PushNotification{
@@ -777,11 +1029,15 @@ func TestCheckAndroidMessage(t *testing.T) {
 		TimeToLive: &timeToLive,
 	}
 
-	success := PushToAndroid(req)
-	assert.False(t, success)
+	resp := PushToAndroid(req)
+	assert.Empty(t, resp)
 }
 
 func TestSetProxyURL(t *testing.T) {
+	transport := http.DefaultTransport
+	defer func() {
+		http.DefaultTransport = transport
+	}()
 
 	err := SetProxy("87.236.233.92:8080")
 	assert.Error(t, err)
@@ -0,0 +1,199 @@
+package gorush
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// RequestError is an error of push request with the HTTP status code,
+// other transports map the code to their own status.
+type RequestError struct {
+	Code    int
+	Message string
+}
+
+func (e *RequestError) Error() string {
+	return e.Message
+}
+
+// TokenResult is the final delivery result of one token.
+type TokenResult struct {
+	ID       string        `json:"id"`
+	AppID    string        `json:"app_id"`
+	Platform int           `json:"platform"`
+	Token    string        `json:"token"`
+	Response *PushResponse `json:"response"`
+}
+
+// PushResult is the result of accepted push request.
+type PushResult struct {
+	Counts int
+
+	// IDs are grouped by notification of request in request order, one
+	// notification of user_ids or tags may be expanded to several ids.
+	IDs [][]string
+
+	// Results is the delivery result of each notification in sync mode,
+	// grouped like IDs.
+	Results [][]NotificationResult
+
+	// Watch receives final result of each queued token and is closed after
+	// all tokens are finished, including retries.
+	Watch <-chan TokenResult
+}
+
+// resultWatcher sends final result of tokens to watch channel.
+type resultWatcher struct {
+	sync.Mutex
+	pending int
+	sealed  bool
+	results chan TokenResult
+}
+
+// newResultWatcher returns watcher of at most size tokens, so sending to
+// the channel never blocks workers.
+func newResultWatcher(size int) *resultWatcher {
+	return &resultWatcher{
+		results: make(chan TokenResult, size),
+	}
+}
+
+func (w *resultWatcher) add(n int) {
+	w.Lock()
+	w.pending += n
+	w.Unlock()
+}
+
+// seal marks that no more token is added, the channel is closed once
+// pending tokens are finished.
+func (w *resultWatcher) seal() {
+	w.Lock()
+	defer w.Unlock()
+
+	w.sealed = true
+	if w.pending == 0 {
+		close(w.results)
+	}
+}
+
+// done sends result of finished tokens, tokens scheduled to resend are sent
+// after their last attempt.
+func (w *resultWatcher) done(req PushNotification, resp map[string]*PushResponse) {
+	w.Lock()
+	defer w.Unlock()
+
+	for _, token := range req.Tokens {
+		r, ok := resp[token]
+		if !ok {
+			// notification is not sent to provider at all.
+			r = &PushResponse{Status: StateFailed}
+		}
+
+		if r.Status == StatusRetrying {
+			continue
+		}
+
+		w.results <- TokenResult{
+			ID:       req.id,
+			AppID:    req.AppID,
+			Platform: req.Platform,
+			Token:    token,
+			Response: r,
+		}
+		w.pending--
+	}
+
+	if w.sealed && w.pending == 0 {
+		close(w.results)
+	}
+}
+
+// checkMaxNotification checks number of notifications against core.max_notification.
+func checkMaxNotification(notifications []PushNotification) *RequestError {
+	if int64(len(notifications)) > PushConf.Core.MaxNotification {
+		msg := fmt.Sprintf("Number of notifications(%d) over limit(%d)", len(notifications), PushConf.Core.MaxNotification)
+		return &RequestError{http.StatusBadRequest, msg}
+	}
+
+	return nil
+}
+
+// SendNotifications checks, expands and queues notifications of request.
+// It is shared by all transports, apiKey is nil if auth is disabled.
+func SendNotifications(apiKey *APIKey, req RequestPush, watch bool) (*PushResult, *RequestError) {
+	if len(req.Notifications) == 0 {
+		return nil, &RequestError{http.StatusBadRequest, "Notifications field is empty."}
+	}
+
+	if err := checkMaxNotification(req.Notifications); err != nil {
+		return nil, err
+	}
+
+	if apiKey != nil {
+		for _, notification := range req.Notifications {
+			appID := notification.AppID
+			if appID == "" {
+				appID = AppNameDefault
+			}
+
+			if !apiKey.AllowApp(appID) {
+				return nil, &RequestError{http.StatusForbidden, "API key is not allowed app: " + appID}
+			}
+		}
+	}
+
+	// send to registered devices of user_ids or tags, each notification is
+	// expanded separately so ids can be grouped by notification of request.
+	var notifications []PushNotification
+	sizes := make([]int, len(req.Notifications))
+	for i, notification := range req.Notifications {
+		expanded, err := expandNotifications([]PushNotification{notification})
+		if err != nil {
+			return nil, &RequestError{http.StatusBadRequest, err.Error()}
+		}
+
+		sizes[i] = len(expanded)
+		notifications = append(notifications, expanded...)
+	}
+	req.Notifications = notifications
+
+	// user_ids and tags may be expanded to more notifications.
+	if err := checkMaxNotification(req.Notifications); err != nil {
+		return nil, err
+	}
+
+	if watch {
+		size := 0
+		for _, notification := range req.Notifications {
+			size += len(notification.Tokens)
+		}
+		req.watcher = newResultWatcher(size)
+	}
+
+	counts, ids, results := queueNotification(req)
+
+	result := &PushResult{
+		Counts: counts,
+		IDs:    make([][]string, len(sizes)),
+	}
+
+	if results != nil {
+		result.Results = make([][]NotificationResult, len(sizes))
+	}
+
+	var offset int
+	for i, size := range sizes {
+		result.IDs[i] = ids[offset : offset+size]
+		if results != nil {
+			result.Results[i] = results[offset : offset+size]
+		}
+		offset += size
+	}
+
+	if req.watcher != nil {
+		result.Watch = req.watcher.results
+	}
+
+	return result, nil
+}
@@ -0,0 +1,373 @@
+package gorush
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Notification states of status api.
+const (
+	StateScheduled = "scheduled"
+	StateCanceled  = "canceled"
+	StateQueued    = "queued"
+	StateSending   = "sending"
+	StateRetrying  = "retrying"
+	StateDone      = "done"
+	StatePartial   = "partial"
+	StateFailed    = "failed"
+)
+
+// statusBucket is the storage bucket of notification status.
+const statusBucket = "notification"
+
+// statusTokenBucket keeps response of each token under "<id>/<token>", so
+// an update writes only the tokens which are changed.
+const statusTokenBucket = "notification-token"
+
+func statusTokenKey(id, token string) string {
+	return id + "/" + token
+}
+
+// statusPurgeInterval is how often expired notification status is removed.
+var statusPurgeInterval = 10 * time.Minute
+
+// statusLock serializes read-modify-write of status of one notification.
+type statusLock struct {
+	sync.Mutex
+	refs int
+}
+
+// statusLocks keeps locks of notifications which are being updated, so
+// workers updating different notifications don't wait for each other.
+var statusLocks = struct {
+	sync.Mutex
+	locks map[string]*statusLock
+}{locks: make(map[string]*statusLock)}
+
+// lockStatus locks status of notification id and returns the unlock func,
+// the lock is removed when no one waits for it.
+func lockStatus(id string) func() {
+	statusLocks.Lock()
+	l, ok := statusLocks.locks[id]
+	if !ok {
+		l = &statusLock{}
+		statusLocks.locks[id] = l
+	}
+	l.refs++
+	statusLocks.Unlock()
+
+	l.Lock()
+
+	return func() {
+		l.Unlock()
+
+		statusLocks.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(statusLocks.locks, id)
+		}
+		statusLocks.Unlock()
+	}
+}
+
+// NotificationStatus is the delivery state of accepted notification.
+type NotificationStatus struct {
+	ID        string                   `json:"id"`
+	AppID     string                   `json:"app_id"`
+	Platform  int                      `json:"platform"`
+	State     string                   `json:"state"`
+	Attempt   int                      `json:"attempt"`
+	Progress  map[string]int           `json:"progress"`
+	Tokens    map[string]*PushResponse `json:"tokens,omitempty"`
+	SendAt    int64                    `json:"send_at,omitempty"`
+	CreatedAt int64                    `json:"created_at"`
+	UpdatedAt int64                    `json:"updated_at"`
+	ExpiresAt int64                    `json:"expires_at"`
+}
+
+func statusEnabled(id string) bool {
+	return id != "" && PushConf.Core.StatusTTL > 0 && StatStorage != nil
+}
+
+// loadStatusRecord returns status without tokens, nil if status not exist
+// or expired.
+func loadStatusRecord(id string) (*NotificationStatus, error) {
+	data, err := StatStorage.GetRecord(context.Background(), statusBucket, id)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var status NotificationStatus
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, err
+	}
+
+	if status.ExpiresAt <= time.Now().Unix() {
+		return nil, deleteNotificationStatus(id)
+	}
+
+	return &status, nil
+}
+
+// loadNotificationStatus returns status with response of every token, nil
+// if status not exist or expired.
+func loadNotificationStatus(id string) (*NotificationStatus, error) {
+	status, err := loadStatusRecord(id)
+	if err != nil || status == nil {
+		return nil, err
+	}
+
+	status.Tokens = make(map[string]*PushResponse)
+	prefix := statusTokenKey(id, "")
+	err = StatStorage.RangeRecords(context.Background(), statusTokenBucket, prefix, "", func(key string, value []byte) bool {
+		var resp PushResponse
+		if json.Unmarshal(value, &resp) == nil {
+			status.Tokens[strings.TrimPrefix(key, prefix)] = &resp
+		}
+
+		return true
+	})
+
+	return status, err
+}
+
+// deleteNotificationStatus removes status and responses of its tokens.
+func deleteNotificationStatus(id string) error {
+	var keys []string
+	err := StatStorage.RangeRecords(context.Background(), statusTokenBucket, statusTokenKey(id, ""), "", func(key string, value []byte) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err := StatStorage.DeleteRecord(context.Background(), statusTokenBucket, key); err != nil {
+			return err
+		}
+	}
+
+	return StatStorage.DeleteRecord(context.Background(), statusBucket, id)
+}
+
+// storeNotificationStatus stores status without tokens, Progress is kept
+// by storeTokenStatus.
+func storeNotificationStatus(status *NotificationStatus) {
+	now := time.Now().Unix()
+	status.UpdatedAt = now
+	status.ExpiresAt = now + PushConf.Core.StatusTTL
+
+	// keep status of scheduled notification until it is sent.
+	if status.SendAt > now {
+		status.ExpiresAt = status.SendAt + PushConf.Core.StatusTTL
+	}
+
+	record := *status
+	record.Tokens = nil
+
+	data, err := json.Marshal(record)
+	if err == nil {
+		err = StatStorage.SetRecord(context.Background(), statusBucket, status.ID, data)
+	}
+
+	if err != nil {
+		LogError.Error("notification status error: " + err.Error())
+	}
+}
+
+// storeTokenStatus stores response of token if it is changed and moves the
+// token in Progress of status. Previous response is read only if known is
+// false.
+func storeTokenStatus(status *NotificationStatus, token string, resp *PushResponse, known bool) {
+	key := statusTokenKey(status.ID, token)
+
+	if !known {
+		data, err := StatStorage.GetRecord(context.Background(), statusTokenBucket, key)
+		if err != nil {
+			LogError.Error("notification status error: " + err.Error())
+			return
+		}
+
+		if data != nil {
+			var old PushResponse
+			if json.Unmarshal(data, &old) == nil {
+				if old == *resp {
+					return
+				}
+
+				status.Progress[old.Status]--
+				if status.Progress[old.Status] <= 0 {
+					delete(status.Progress, old.Status)
+				}
+			}
+		}
+	}
+
+	status.Progress[resp.Status]++
+
+	data, err := json.Marshal(resp)
+	if err == nil {
+		err = StatStorage.SetRecord(context.Background(), statusTokenBucket, key, data)
+	}
+
+	if err != nil {
+		LogError.Error("notification status error: " + err.Error())
+	}
+}
+
+// saveNotificationStatus stores the queued or scheduled state of accepted
+// notification.
+func saveNotificationStatus(req PushNotification) {
+	if !statusEnabled(req.id) {
+		return
+	}
+
+	status := &NotificationStatus{
+		ID:        req.id,
+		AppID:     req.AppID,
+		Platform:  req.Platform,
+		State:     StateQueued,
+		Progress:  make(map[string]int),
+		SendAt:    req.SendAt,
+		CreatedAt: time.Now().Unix(),
+	}
+
+	if req.SendAt > status.CreatedAt {
+		status.State = StateScheduled
+	}
+
+	unlock := lockStatus(req.id)
+	defer unlock()
+
+	// status is new, so tokens are written without reading them first.
+	seen := make(map[string]bool, len(req.Tokens))
+	for _, token := range req.Tokens {
+		if seen[token] {
+			continue
+		}
+		seen[token] = true
+
+		storeTokenStatus(status, token, &PushResponse{Status: status.State}, true)
+	}
+	storeNotificationStatus(status)
+}
+
+// updateNotificationStatus sets state of notification and its tokens.
+func updateNotificationStatus(req PushNotification, state string) {
+	if !statusEnabled(req.id) {
+		return
+	}
+
+	defer lockStatus(req.id)()
+
+	status, err := loadStatusRecord(req.id)
+	if err != nil || status == nil {
+		return
+	}
+
+	if status.Progress == nil {
+		status.Progress = make(map[string]int)
+	}
+
+	status.State = state
+	status.Attempt = req.attempt
+	for _, token := range req.Tokens {
+		storeTokenStatus(status, token, &PushResponse{Status: state}, false)
+	}
+
+	storeNotificationStatus(status)
+}
+
+// finishNotificationStatus stores the response of tokens after an attempt.
+// Notification is retrying while some tokens are scheduled to resend, then
+// done if all tokens succeeded, partial if some succeeded and failed if
+// none succeeded.
+func finishNotificationStatus(req PushNotification, resp map[string]*PushResponse) {
+	if !statusEnabled(req.id) {
+		return
+	}
+
+	defer lockStatus(req.id)()
+
+	status, err := loadStatusRecord(req.id)
+	if err != nil || status == nil {
+		return
+	}
+
+	if status.Progress == nil {
+		status.Progress = make(map[string]int)
+	}
+
+	status.Attempt = req.attempt
+	for _, token := range req.Tokens {
+		r, ok := resp[token]
+		if !ok {
+			// notification is not sent to provider at all.
+			r = &PushResponse{Status: StateFailed}
+		}
+
+		storeTokenStatus(status, token, r, false)
+	}
+
+	var total int
+	for _, count := range status.Progress {
+		total += count
+	}
+
+	switch success := status.Progress["success"]; {
+	case status.Progress[StatusRetrying] > 0:
+		status.State = StateRetrying
+	case success == 0:
+		status.State = StateFailed
+	case success == total:
+		status.State = StateDone
+	default:
+		status.State = StatePartial
+	}
+
+	storeNotificationStatus(status)
+}
+
+// purgeNotificationStatus removes expired notification status.
+func purgeNotificationStatus() int {
+	var expired []string
+	now := time.Now().Unix()
+
+	err := StatStorage.RangeRecords(context.Background(), statusBucket, "", "", func(key string, value []byte) bool {
+		var status NotificationStatus
+		if json.Unmarshal(value, &status) != nil || status.ExpiresAt <= now {
+			expired = append(expired, key)
+		}
+
+		return true
+	})
+
+	if err != nil {
+		LogError.Error("notification status error: " + err.Error())
+	}
+
+	for _, id := range expired {
+		if err := deleteNotificationStatus(id); err != nil {
+			LogError.Error("notification status error: " + err.Error())
+		}
+	}
+
+	return len(expired)
+}
+
+// StartStatusPurge removes expired notification status periodically.
+func StartStatusPurge() {
+	if PushConf.Core.StatusTTL <= 0 {
+		return
+	}
+
+	go func() {
+		for range time.Tick(statusPurgeInterval) {
+			purgeNotificationStatus()
+		}
+	}()
+}
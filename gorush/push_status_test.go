@@ -0,0 +1,218 @@
+package gorush
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/buger/jsonparser"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/appleboy/gofight.v2"
+)
+
+func TestNotificationStatus(t *testing.T) {
+	initTest()
+	InitLog()
+	InitAppStatus()
+
+	req := PushNotification{
+		AppID:    AppNameDefault,
+		Platform: PlatFormIos,
+		Tokens:   []string{"a", "b", "c"},
+		id:       newSortableID(),
+	}
+
+	saveNotificationStatus(req)
+	status, err := loadNotificationStatus(req.id)
+	assert.NoError(t, err)
+	if assert.NotNil(t, status) {
+		assert.Equal(t, StateQueued, status.State)
+		assert.Equal(t, 3, status.Progress[StateQueued])
+	}
+
+	updateNotificationStatus(req, StateSending)
+	status, _ = loadNotificationStatus(req.id)
+	assert.Equal(t, StateSending, status.State)
+
+	finishNotificationStatus(req, map[string]*PushResponse{
+		"a": {Status: "success"},
+		"b": {Status: StatusRetrying},
+		"c": {Status: "failed", Reason: "BadDeviceToken"},
+	})
+	status, _ = loadNotificationStatus(req.id)
+	assert.Equal(t, StateRetrying, status.State)
+	assert.Equal(t, 1, status.Progress["success"])
+	assert.Equal(t, 1, status.Progress[StatusRetrying])
+
+	// retry of token b
+	retry := req
+	retry.Tokens = []string{"b"}
+	retry.attempt = 1
+	updateNotificationStatus(retry, StateSending)
+	finishNotificationStatus(retry, map[string]*PushResponse{
+		"b": {Status: "success"},
+	})
+	status, _ = loadNotificationStatus(req.id)
+	assert.Equal(t, StatePartial, status.State)
+	assert.Equal(t, 1, status.Attempt)
+	assert.Equal(t, 2, status.Progress["success"])
+	assert.Equal(t, 1, status.Progress["failed"])
+	assert.Equal(t, 0, status.Progress[StatusRetrying])
+	assert.Equal(t, "success", status.Tokens["a"].Status)
+	assert.Equal(t, "BadDeviceToken", status.Tokens["c"].Reason)
+
+	// all tokens succeeded
+	req.id = newSortableID()
+	saveNotificationStatus(req)
+	finishNotificationStatus(req, map[string]*PushResponse{
+		"a": {Status: "success"},
+		"b": {Status: "success"},
+		"c": {Status: "success"},
+	})
+	status, _ = loadNotificationStatus(req.id)
+	assert.Equal(t, StateDone, status.State)
+	assert.Len(t, status.Tokens, 3)
+
+	// no token is sent
+	req.id = newSortableID()
+	saveNotificationStatus(req)
+	finishNotificationStatus(req, map[string]*PushResponse{})
+	status, _ = loadNotificationStatus(req.id)
+	assert.Equal(t, StateFailed, status.State)
+	assert.Equal(t, 3, status.Progress[StateFailed])
+}
+
+func TestNotificationStatusDisabled(t *testing.T) {
+	initTest()
+	InitLog()
+	InitAppStatus()
+	PushConf.Core.StatusTTL = 0
+
+	req := PushNotification{
+		AppID:    AppNameDefault,
+		Platform: PlatFormIos,
+		Tokens:   []string{"a"},
+		id:       newSortableID(),
+	}
+
+	saveNotificationStatus(req)
+	status, err := loadNotificationStatus(req.id)
+	assert.NoError(t, err)
+	assert.Nil(t, status)
+}
+
+func TestLockStatus(t *testing.T) {
+	unlock := lockStatus("0001")
+
+	// other notification is not blocked.
+	done := make(chan struct{})
+	go func() {
+		lockStatus("0002")()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		assert.Fail(t, "status of other notification is locked")
+	}
+
+	unlock()
+
+	statusLocks.Lock()
+	assert.NotContains(t, statusLocks.locks, "0001")
+	assert.NotContains(t, statusLocks.locks, "0002")
+	statusLocks.Unlock()
+}
+
+func TestPurgeNotificationStatus(t *testing.T) {
+	initTest()
+	InitLog()
+	InitAppStatus()
+
+	saveNotificationStatus(PushNotification{
+		AppID:  AppNameDefault,
+		Tokens: []string{"a"},
+		id:     "active",
+	})
+
+	data, _ := json.Marshal(NotificationStatus{
+		ID:        "expired",
+		ExpiresAt: time.Now().Unix() - 1,
+	})
+	StatStorage.SetRecord(context.Background(), statusBucket, "expired", data)
+
+	assert.Equal(t, 1, purgeNotificationStatus())
+
+	status, _ := loadNotificationStatus("active")
+	assert.NotNil(t, status)
+	data, _ = StatStorage.GetRecord(context.Background(), statusBucket, "expired")
+	assert.Nil(t, data)
+
+	// tokens are removed with status.
+	assert.NoError(t, deleteNotificationStatus("active"))
+	data, _ = StatStorage.GetRecord(context.Background(), statusTokenBucket, statusTokenKey("active", "a"))
+	assert.Nil(t, data)
+}
+
+func TestPushStatusHandler(t *testing.T) {
+	done := initFcmTest(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"results": []map[string]string{
+				{"message_id": "1"},
+			},
+		})
+	})
+	defer done()
+
+	PushConf.Core.Mode = "test"
+	PushConf.Core.Sync = true
+	InitWorkers(int64(2), 2)
+
+	r := gofight.New()
+
+	var id string
+	r.POST("/api/push").
+		SetJSON(gofight.D{
+			"notifications": []gofight.D{
+				{
+					"tokens":   []string{"aaaaa"},
+					"platform": PlatFormAndroidFcm,
+					"message":  "Welcome",
+				},
+			},
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			var resp struct {
+				IDs     [][]string             `json:"ids"`
+				Results [][]NotificationResult `json:"results"`
+			}
+			json.Unmarshal([]byte(r.Body.String()), &resp)
+
+			assert.Equal(t, http.StatusOK, r.Code)
+			if assert.Len(t, resp.IDs, 1) && assert.Len(t, resp.Results, 1) &&
+				assert.Len(t, resp.IDs[0], 1) && assert.Len(t, resp.Results[0], 1) {
+				id = resp.IDs[0][0]
+				assert.NotEmpty(t, id)
+				assert.Equal(t, id, resp.Results[0][0].ID)
+			}
+		})
+
+	r.GET("/api/push/"+id).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			data := []byte(r.Body.String())
+			state, _ := jsonparser.GetString(data, "state")
+			token, _ := jsonparser.GetString(data, "tokens", "aaaaa", "status")
+
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Equal(t, StateDone, state)
+			assert.Equal(t, "success", token)
+		})
+
+	r.GET("/api/push/unknown").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusNotFound, r.Code)
+		})
+}
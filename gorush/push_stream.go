@@ -0,0 +1,124 @@
+package gorush
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+const (
+	// maxStreamLineSize is the max size of one line of notification stream.
+	maxStreamLineSize = 1024 * 1024
+
+	// maxStreamErrors is the max number of rejected lines in stream result,
+	// rejected lines after it are only counted.
+	maxStreamErrors = 1000
+)
+
+// LineError is a rejected line of notification stream.
+type LineError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// StreamResult is the summary of notification stream.
+type StreamResult struct {
+	Accepted int         `json:"accepted"`
+	Rejected int         `json:"rejected"`
+	Counts   int         `json:"counts"`
+	Errors   []LineError `json:"errors"`
+}
+
+func (r *StreamResult) reject(line int, msg string) {
+	r.Rejected++
+	if len(r.Errors) < maxStreamErrors {
+		r.Errors = append(r.Errors, LineError{Line: line, Error: msg})
+	}
+}
+
+// streamNotification queues notification of stream line and returns number
+// of its tokens. Notification to user_ids or tags may be expanded to several
+// platforms, the line is rejected if one of them fails but others are sent.
+func streamNotification(apiKey *APIKey, notification PushNotification) (int, error) {
+	if notification.AppID == "" {
+		notification.AppID = AppNameDefault
+	}
+
+	if apiKey != nil && !apiKey.AllowApp(notification.AppID) {
+		return 0, errors.New("API key is not allowed app: " + notification.AppID)
+	}
+
+	if len(notification.Tokens) == 0 && len(notification.UserIDs) == 0 && notification.Tags == "" {
+		return 0, errors.New("missing tokens")
+	}
+
+	notifications, err := expandNotifications([]PushNotification{notification})
+	if err != nil {
+		return 0, err
+	}
+
+	var count, queued int
+	for _, n := range notifications {
+		_, sent, queueErr := queueSingle(n)
+		if queueErr != nil {
+			err = queueErr
+			continue
+		}
+
+		count += len(n.Tokens)
+		if sent {
+			queued += len(n.Tokens)
+		}
+	}
+
+	addTotalCount(int64(queued))
+
+	return count, err
+}
+
+// StreamNotifications reads newline-delimited notifications from r and
+// queues them one by one. It doesn't wait for delivery, and reading blocks
+// while the worker queue is full. The error is only returned if stream can't
+// be read, result still contains the lines before it.
+func StreamNotifications(apiKey *APIKey, r io.Reader) (*StreamResult, error) {
+	result := &StreamResult{Errors: []LineError{}}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxStreamLineSize)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		var notification PushNotification
+		if err := json.Unmarshal(data, &notification); err != nil {
+			result.reject(line, "invalid json: "+err.Error())
+			continue
+		}
+
+		count, err := streamNotification(apiKey, notification)
+		if err != nil {
+			result.reject(line, err.Error())
+			continue
+		}
+
+		result.Accepted++
+		result.Counts += count
+	}
+
+	if err := scanner.Err(); err != nil {
+		if err == bufio.ErrTooLong {
+			result.reject(line+1, "line is too long")
+		}
+		return result, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,98 @@
+package gorush
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/NaySoftware/go-fcm"
+	"github.com/buger/jsonparser"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/appleboy/gofight.v2"
+)
+
+func initPushStreamTest(t *testing.T) func() {
+	done := initFcmTest(t, func(w http.ResponseWriter, r *http.Request) {
+		var msg fcm.FcmMsg
+		json.NewDecoder(r.Body).Decode(&msg)
+
+		results := make([]map[string]string, len(msg.RegistrationIds))
+		for i := range msg.RegistrationIds {
+			results[i] = map[string]string{"message_id": "1"}
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"results": results,
+		})
+	})
+
+	// queue is smaller than stream to test blocking enqueue.
+	InitWorkers(int64(1), 1)
+
+	return done
+}
+
+func TestStreamNotifications(t *testing.T) {
+	done := initPushStreamTest(t)
+	defer done()
+
+	body := strings.Join([]string{
+		`{"tokens":["a","b"],"platform":3,"message":"Welcome"}`,
+		``,
+		`{"tokens":["c"],"platform":3,"message":"Welcome"`,
+		`{"tokens":["d"],"platform":3,"message":"Welcome","app_id":"unknown"}`,
+		`{"platform":3,"message":"Welcome"}`,
+		`{"tokens":["e"],"platform":3,"message":"Welcome"}`,
+		`{"tokens":["f"],"platform":3,"message":"Welcome"}`,
+	}, "\n")
+
+	result, err := StreamNotifications(nil, strings.NewReader(body))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.Accepted)
+	assert.Equal(t, 3, result.Rejected)
+	assert.Equal(t, 4, result.Counts)
+
+	if assert.Len(t, result.Errors, 3) {
+		assert.Equal(t, 3, result.Errors[0].Line)
+		assert.Contains(t, result.Errors[0].Error, "invalid json")
+		assert.Equal(t, LineError{Line: 4, Error: "unknown app: unknown"}, result.Errors[1])
+		assert.Equal(t, LineError{Line: 5, Error: "missing tokens"}, result.Errors[2])
+	}
+
+	assert.Equal(t, int64(4), pushStatus().TotalCount)
+}
+
+func TestStreamNotificationsTooLong(t *testing.T) {
+	done := initPushStreamTest(t)
+	defer done()
+
+	body := `{"tokens":["a"],"platform":3,"message":"Welcome"}` + "\n" +
+		`{"tokens":["` + strings.Repeat("a", maxStreamLineSize) + `"],"platform":3}`
+
+	result, err := StreamNotifications(nil, strings.NewReader(body))
+	assert.Error(t, err)
+	assert.Equal(t, 1, result.Accepted)
+	assert.Equal(t, []LineError{{Line: 2, Error: "line is too long"}}, result.Errors)
+}
+
+func TestPushStreamHandler(t *testing.T) {
+	done := initPushStreamTest(t)
+	defer done()
+
+	r := gofight.New()
+
+	r.POST("/api/push/stream").
+		SetBody(`{"tokens":["a"],"platform":3,"message":"Welcome"}`+"\n"+`{"tokens":["b"],"platform":1,"message":"Welcome"}`+"\n").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			data := []byte(r.Body.String())
+			accepted, _ := jsonparser.GetInt(data, "result", "accepted")
+			line, _ := jsonparser.GetInt(data, "result", "errors", "[0]", "line")
+			msg, _ := jsonparser.GetString(data, "result", "errors", "[0]", "error")
+
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Equal(t, int64(1), accepted)
+			assert.Equal(t, int64(2), line)
+			assert.Equal(t, "platform not enabled", msg)
+		})
+}
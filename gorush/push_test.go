@@ -0,0 +1,167 @@
+package gorush
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/NaySoftware/go-fcm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResultWatcher(t *testing.T) {
+	w := newResultWatcher(3)
+	w.add(3)
+
+	req := PushNotification{AppID: AppNameDefault, Platform: PlatFormAndroidFcm, Tokens: []string{"a", "b", "c"}}
+	w.done(req, map[string]*PushResponse{
+		"a": {Status: "success"},
+		"b": {Status: StatusRetrying},
+	})
+	w.seal()
+
+	r := <-w.results
+	assert.Equal(t, "a", r.Token)
+	assert.Equal(t, "success", r.Response.Status)
+
+	// token is not sent to provider at all
+	r = <-w.results
+	assert.Equal(t, "c", r.Token)
+	assert.Equal(t, "failed", r.Response.Status)
+
+	// channel is closed after last attempt of retried token
+	w.done(PushNotification{Tokens: []string{"b"}}, map[string]*PushResponse{
+		"b": {Status: "success"},
+	})
+
+	r = <-w.results
+	assert.Equal(t, "b", r.Token)
+	_, ok := <-w.results
+	assert.False(t, ok)
+}
+
+func TestSendNotificationsError(t *testing.T) {
+	initAuthTest()
+	PushConf.Core.MaxNotification = 1
+
+	_, err := SendNotifications(nil, RequestPush{}, false)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, http.StatusBadRequest, err.Code)
+		assert.Equal(t, "Notifications field is empty.", err.Message)
+	}
+
+	_, err = SendNotifications(nil, RequestPush{Notifications: make([]PushNotification, 2)}, false)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, http.StatusBadRequest, err.Code)
+	}
+
+	apiKey, _ := AuthenticateKey("backend-key", ScopePush)
+	_, err = SendNotifications(apiKey, RequestPush{Notifications: []PushNotification{{AppID: "other"}}}, false)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, http.StatusForbidden, err.Code)
+		assert.Equal(t, "API key is not allowed app: other", err.Message)
+	}
+
+	_, err = SendNotifications(apiKey, RequestPush{Notifications: []PushNotification{{Tags: "news ||"}}}, false)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, http.StatusBadRequest, err.Code)
+	}
+}
+
+func TestSendNotificationsExpandedLimit(t *testing.T) {
+	initDeviceTest()
+	PushConf.Core.MaxNotification = 1
+
+	// devices of tag are on two platforms.
+	_, err := SendNotifications(nil, RequestPush{Notifications: []PushNotification{{Tags: "news", Message: "Welcome"}}}, false)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, http.StatusBadRequest, err.Code)
+		assert.Equal(t, "Number of notifications(2) over limit(1)", err.Message)
+	}
+}
+
+func TestSendNotificationsExpandedIDs(t *testing.T) {
+	initDeviceTest()
+	QueueNotification = make(chan PushNotification, 10)
+
+	notifications := []PushNotification{
+		{Tokens: []string{"raw"}, Platform: PlatFormAndroidFcm, Message: "raw"},
+		{Tags: "news", Message: "Welcome"},
+		{Tags: "unknown", Message: "Welcome"},
+		{Tokens: []string{"other"}, Platform: PlatFormAndroidFcm, Message: "other"},
+	}
+
+	result, err := SendNotifications(nil, RequestPush{Notifications: notifications}, false)
+	assert.Nil(t, err)
+
+	// ids are grouped by notification of request.
+	if assert.Len(t, result.IDs, len(notifications)) {
+		assert.Len(t, result.IDs[0], 1)
+		assert.Len(t, result.IDs[1], 2)
+		assert.Len(t, result.IDs[2], 0)
+		assert.Len(t, result.IDs[3], 1)
+	}
+}
+
+func TestSendNotificationsWatch(t *testing.T) {
+	done := initFcmTest(t, func(w http.ResponseWriter, r *http.Request) {
+		var msg fcm.FcmMsg
+		json.NewDecoder(r.Body).Decode(&msg)
+
+		results := make([]map[string]string, len(msg.RegistrationIds))
+		for i, token := range msg.RegistrationIds {
+			if token == "bad" {
+				results[i] = map[string]string{"error": "NotRegistered"}
+			} else {
+				results[i] = map[string]string{"message_id": "1"}
+			}
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"results": results,
+		})
+	})
+	defer done()
+
+	InitWorkers(int64(2), 2)
+
+	result, err := SendNotifications(nil, RequestPush{
+		Notifications: []PushNotification{
+			{
+				Tokens:   []string{"good", "bad"},
+				Platform: PlatFormAndroidFcm,
+				Message:  "Welcome",
+			},
+			{
+				Tokens:   []string{"other"},
+				Platform: PlatFormAndroidFcm,
+				Message:  "Welcome",
+			},
+		},
+	}, true)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, result.Counts)
+	assert.Len(t, result.IDs, 2)
+
+	status := make(map[string]string)
+	timeout := time.After(5 * time.Second)
+
+	for {
+		select {
+		case r, ok := <-result.Watch:
+			if !ok {
+				assert.Equal(t, map[string]string{
+					"good":  "success",
+					"bad":   "failed",
+					"other": "success",
+				}, status)
+				return
+			}
+			assert.NotEmpty(t, r.ID)
+			status[r.Token] = r.Response.Status
+		case <-timeout:
+			t.Fatal("watch is not finished")
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package gorush
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/lalit-verma/gorush/queue/boltdb"
+	"github.com/lalit-verma/gorush/queue/buntdb"
+	"github.com/lalit-verma/gorush/queue/leveldb"
+	"github.com/lalit-verma/gorush/queue/redis"
+)
+
+// Queue interface keeps queued notifications until workers acknowledge them.
+type Queue interface {
+	Init() error
+	Enqueue(id string, data []byte) error
+	Ack(id string) error
+	Range(fn func(id string, data []byte) error) error
+	Close() error
+}
+
+var (
+	queueSequence uint32
+
+	// pendingNotifications counts notifications sent to workers but not finished.
+	pendingNotifications int64
+)
+
+// newSortableID returns an id which sorts in creation order.
+func newSortableID() string {
+	return fmt.Sprintf("%016x%08x", time.Now().UnixNano(), atomic.AddUint32(&queueSequence, 1))
+}
+
+// InitQueue for initialize the notification queue engine.
+func InitQueue() error {
+	switch PushConf.Core.Queue.Engine {
+	case "", "memory":
+		// nothing survives restart, so notifications are not stored.
+		NotificationQueue = nil
+		return nil
+	case "redis":
+		NotificationQueue = redis.New(PushConf)
+	case "boltdb":
+		NotificationQueue = boltdb.New(PushConf)
+	case "buntdb":
+		NotificationQueue = buntdb.New(PushConf)
+	case "leveldb":
+		NotificationQueue = leveldb.New(PushConf)
+	default:
+		err := errors.New("can't find queue driver")
+		LogError.Error("queue error: " + err.Error())
+		return err
+	}
+
+	if err := NotificationQueue.Init(); err != nil {
+		LogError.Error("queue error: " + err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// queueItem is the stored form of queued notification.
+type queueItem struct {
+	Notification PushNotification `json:"notification"`
+	ID           string           `json:"id,omitempty"`
+	Attempt      int              `json:"attempt,omitempty"`
+	TraceParent  string           `json:"trace_parent,omitempty"`
+}
+
+// persistNotification store notification in queue engine.
+func persistNotification(notification *PushNotification) {
+	notification.queueID = ""
+
+	if NotificationQueue == nil {
+		return
+	}
+
+	id := newSortableID()
+	data, err := json.Marshal(queueItem{
+		Notification: *notification,
+		ID:           notification.id,
+		Attempt:      notification.attempt,
+		TraceParent:  notification.trace.traceParent(),
+	})
+
+	if err == nil {
+		err = NotificationQueue.Enqueue(id, data)
+	}
+
+	if err != nil {
+		LogError.Error("queue error: " + err.Error())
+		return
+	}
+
+	notification.queueID = id
+}
+
+// enqueueNotification store notification in queue engine and send it to workers.
+func enqueueNotification(notification PushNotification) {
+	persistNotification(&notification)
+
+	atomic.AddInt64(&pendingNotifications, 1)
+	notification.queuedAt = time.Now()
+	QueueNotification <- notification
+}
+
+// ackNotification remove finished notification from queue engine.
+func ackNotification(notification PushNotification) {
+	atomic.AddInt64(&pendingNotifications, -1)
+
+	if NotificationQueue == nil || notification.queueID == "" {
+		return
+	}
+
+	if err := NotificationQueue.Ack(notification.queueID); err != nil {
+		LogError.Error("queue error: " + err.Error())
+	}
+}
+
+// ReplayQueue send unacknowledged notifications of previous run to workers.
+// Workers must be started before calling it.
+func ReplayQueue() (int, error) {
+	var count int
+
+	if NotificationQueue == nil {
+		return 0, nil
+	}
+
+	err := NotificationQueue.Range(func(id string, data []byte) error {
+		var item queueItem
+
+		if err := json.Unmarshal(data, &item); err != nil {
+			LogError.Error("queue error: drop broken notification " + id + ": " + err.Error())
+			return NotificationQueue.Ack(id)
+		}
+
+		notification := item.Notification
+		notification.queueID = id
+		notification.id = item.ID
+		notification.attempt = item.Attempt
+		notification.trace = parseTraceParent(item.TraceParent)
+		notification.queuedAt = time.Now()
+		atomic.AddInt64(&pendingNotifications, 1)
+		QueueNotification <- notification
+		count++
+
+		return nil
+	})
+
+	if err != nil {
+		LogError.Error("queue error: " + err.Error())
+		return count, err
+	}
+
+	if count > 0 {
+		LogAccess.Info(fmt.Sprintf("Replay %d notifications from queue", count))
+	}
+
+	return count, nil
+}
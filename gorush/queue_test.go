@@ -0,0 +1,127 @@
+package gorush
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lalit-verma/gorush/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// initTestQueue stores notifications in boltdb file of a temporary folder,
+// the returned func closes the queue and removes the folder.
+func initTestQueue(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "gorush-queue")
+	assert.NoError(t, err)
+
+	PushConf.Core.Queue.Engine = "boltdb"
+	PushConf.Core.Queue.BoltDB.Path = filepath.Join(dir, "queue.bolt.db")
+	assert.NoError(t, InitQueue())
+
+	return func() {
+		if NotificationQueue != nil {
+			NotificationQueue.Close()
+		}
+		NotificationQueue = nil
+		os.RemoveAll(dir)
+	}
+}
+
+func pendingQueueIDs(t *testing.T) []string {
+	var ids []string
+
+	err := NotificationQueue.Range(func(id string, data []byte) error {
+		ids = append(ids, id)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	return ids
+}
+
+func TestInitQueueEngine(t *testing.T) {
+	PushConf = config.BuildDefaultPushConf()
+
+	PushConf.Core.Queue.Engine = "unknown"
+	assert.Error(t, InitQueue())
+
+	// memory engine doesn't store notifications.
+	PushConf.Core.Queue.Engine = "memory"
+	assert.NoError(t, InitQueue())
+	assert.Nil(t, NotificationQueue)
+
+	notification := PushNotification{Tokens: []string{"aaaaa"}}
+	persistNotification(&notification)
+	assert.Empty(t, notification.queueID)
+}
+
+func TestQueueIDOrder(t *testing.T) {
+	first := newSortableID()
+	second := newSortableID()
+
+	assert.Len(t, first, 24)
+	assert.True(t, first < second)
+}
+
+func TestAckNotificationAfterPush(t *testing.T) {
+	PushConf = config.BuildDefaultPushConf()
+	app := PushConf.Apps[AppNameDefault]
+	app.Android.Enabled = true
+	PushConf.Apps[AppNameDefault] = app
+
+	PushConf.Core.Sync = true
+
+	InitWorkers(int64(2), 2)
+	defer initTestQueue(t)()
+
+	// empty token fails before calling the GCM server.
+	req := RequestPush{
+		Notifications: []PushNotification{
+			{
+				Tokens:   []string{""},
+				Platform: PlatFormAndroid,
+				Message:  "Welcome",
+			},
+		},
+	}
+
+	count, _, _ := queueNotification(req)
+	assert.Equal(t, 1, count)
+	assert.Empty(t, pendingQueueIDs(t))
+}
+
+func TestReplayQueue(t *testing.T) {
+	PushConf = config.BuildDefaultPushConf()
+	app := PushConf.Apps[AppNameDefault]
+	app.Android.Enabled = true
+	PushConf.Apps[AppNameDefault] = app
+
+	InitWorkers(int64(2), 2)
+	defer initTestQueue(t)()
+
+	data, _ := json.Marshal(queueItem{
+		Notification: PushNotification{
+			Tokens:   []string{""},
+			Platform: PlatFormAndroid,
+			Message:  "Welcome",
+			AppID:    AppNameDefault,
+		},
+	})
+
+	NotificationQueue.Enqueue(newSortableID(), data)
+	NotificationQueue.Enqueue(newSortableID(), []byte("broken"))
+
+	count, err := ReplayQueue()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	for i := 0; i < 50 && len(pendingQueueIDs(t)) > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.Empty(t, pendingQueueIDs(t))
+}
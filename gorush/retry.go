@@ -0,0 +1,186 @@
+package gorush
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jpillora/backoff"
+)
+
+// StatusRetrying is the push status of token which is scheduled to resend.
+const StatusRetrying = "retrying"
+
+// retryTimers keeps retries which wait for backoff delay, so shutdown can
+// stop them.
+var retryTimers = struct {
+	sync.Mutex
+	timers map[*time.Timer]PushNotification
+}{timers: make(map[*time.Timer]PushNotification)}
+
+// APNs reasons which are worth to retry.
+// ref: https://github.com/sideshow/apns2/blob/master/response.go
+var apnsRetryableReasons = map[string]bool{
+	"TooManyRequests":     true,
+	"IdleTimeout":         true,
+	"Shutdown":            true,
+	"InternalServerError": true,
+	"ServiceUnavailable":  true,
+}
+
+// GCM and FCM errors which are worth to retry.
+// ref: https://firebase.google.com/docs/cloud-messaging/http-server-ref#error-codes
+var gcmRetryableErrors = map[string]bool{
+	"Unavailable":               true,
+	"InternalServerError":       true,
+	"DeviceMessageRateExceeded": true,
+	"TopicsMessageRateExceeded": true,
+}
+
+// isRetryableReason check whether the provider error reason is transient.
+// Permanent errors like BadDeviceToken or NotRegistered are never resent.
+func isRetryableReason(platform int, reason string) bool {
+	switch platform {
+	case PlatFormIos:
+		return apnsRetryableReasons[reason]
+	case PlatFormAndroid, PlatFormAndroidFcm:
+		return gcmRetryableErrors[reason]
+	}
+
+	return false
+}
+
+// isRetryableStatus check whether the provider http status code is transient.
+func isRetryableStatus(code int) bool {
+	return code == 429 || code >= 500
+}
+
+// maxRetry returns the retry limit of notification. Platform max_retry
+// overrides the app retry policy and request retry can only lower it.
+func maxRetry(req PushNotification) int {
+	app := PushConf.Apps[req.AppID]
+	max := app.Retry.MaxRetry
+
+	var platformMax int
+	switch req.Platform {
+	case PlatFormIos:
+		platformMax = app.Ios.MaxRetry
+	case PlatFormAndroid:
+		platformMax = app.Android.MaxRetry
+	case PlatFormAndroidFcm:
+		platformMax = app.AndroidFcm.MaxRetry
+	}
+
+	if platformMax > 0 {
+		max = platformMax
+	}
+
+	if req.Retry > 0 && req.Retry < max {
+		max = req.Retry
+	}
+
+	return max
+}
+
+// retryDelay returns the backoff delay before given retry attempt.
+func retryDelay(req PushNotification, attempt int, retryAfter time.Duration) time.Duration {
+	policy := PushConf.Apps[req.AppID].Retry
+
+	b := &backoff.Backoff{
+		Min:    policy.BaseDelay,
+		Max:    policy.MaxDelay,
+		Factor: 2,
+		Jitter: policy.Jitter,
+	}
+
+	delay := b.ForAttempt(float64(attempt))
+
+	// honor provider Retry-After
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+
+	return delay
+}
+
+// scheduleRetry store failed tokens of notification in queue and send them
+// to workers again after backoff delay, so no worker is blocked meanwhile.
+// It returns false if retry limit is reached.
+func scheduleRetry(req PushNotification, tokens []string, retryAfter time.Duration, resp map[string]*PushResponse) bool {
+	if len(tokens) == 0 {
+		return false
+	}
+
+	if req.attempt >= maxRetry(req) {
+		countPushDrop(req, reasonRetryLimit, len(tokens))
+		return false
+	}
+
+	retry := req
+	retry.Tokens = tokens
+	retry.attempt = req.attempt + 1
+
+	// sync request doesn't wait for retry, it returns retrying tokens and
+	// their final result is in push status and callback.
+	retry.wg = nil
+	retry.result = nil
+
+	// persist retry now, the original notification is acknowledged after return.
+	persistNotification(&retry)
+	atomic.AddInt64(&pendingNotifications, 1)
+
+	delay := retryDelay(req, req.attempt, retryAfter)
+	LogAccess.Debug("Retry notification ", retry.attempt, " of ", maxRetry(req), " after ", delay)
+
+	// lock is held until timer is stored, so fired timer always finds itself.
+	retryTimers.Lock()
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		retryTimers.Lock()
+		delete(retryTimers.timers, timer)
+		retryTimers.Unlock()
+
+		retry.queuedAt = time.Now()
+		QueueNotification <- retry
+	})
+	retryTimers.timers[timer] = retry
+	retryTimers.Unlock()
+	countPushRetry(req, len(tokens))
+
+	for _, token := range tokens {
+		if r, ok := resp[token]; ok {
+			r.Status = StatusRetrying
+		}
+	}
+
+	return true
+}
+
+// stopRetryTimers stops retries which are still waiting for backoff delay.
+// Stopped retries stay in durable queue and are resent on next start.
+func stopRetryTimers() int {
+	retryTimers.Lock()
+	defer retryTimers.Unlock()
+
+	var count int
+	err := errors.New("retry is not sent before shutdown")
+
+	for timer, retry := range retryTimers.timers {
+		delete(retryTimers.timers, timer)
+		if !timer.Stop() {
+			continue
+		}
+
+		if !isDurableQueue() {
+			for _, token := range retry.Tokens {
+				LogPush(FailedPush, token, retry, err)
+			}
+		}
+
+		atomic.AddInt64(&pendingNotifications, -1)
+		count++
+	}
+
+	return count
+}
@@ -0,0 +1,113 @@
+package gorush
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lalit-verma/gorush/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsRetryableReason(t *testing.T) {
+	assert.True(t, isRetryableReason(PlatFormIos, "TooManyRequests"))
+	assert.True(t, isRetryableReason(PlatFormIos, "ServiceUnavailable"))
+	assert.False(t, isRetryableReason(PlatFormIos, "BadDeviceToken"))
+	assert.False(t, isRetryableReason(PlatFormIos, "Unregistered"))
+
+	assert.True(t, isRetryableReason(PlatFormAndroid, "Unavailable"))
+	assert.False(t, isRetryableReason(PlatFormAndroid, "NotRegistered"))
+	assert.True(t, isRetryableReason(PlatFormAndroidFcm, "InternalServerError"))
+	assert.False(t, isRetryableReason(PlatFormAndroidFcm, "InvalidRegistration"))
+
+	assert.True(t, isRetryableStatus(503))
+	assert.True(t, isRetryableStatus(429))
+	assert.False(t, isRetryableStatus(400))
+}
+
+func TestMaxRetry(t *testing.T) {
+	PushConf = config.BuildDefaultPushConf()
+	app := PushConf.Apps[AppNameDefault]
+	app.Retry.MaxRetry = 3
+	app.Ios.MaxRetry = 5
+	PushConf.Apps[AppNameDefault] = app
+
+	req := PushNotification{
+		AppID:    AppNameDefault,
+		Platform: PlatFormAndroid,
+	}
+	assert.Equal(t, 3, maxRetry(req))
+
+	// platform setting overrides app retry policy
+	req.Platform = PlatFormIos
+	assert.Equal(t, 5, maxRetry(req))
+
+	// request can only lower the limit
+	req.Retry = 2
+	assert.Equal(t, 2, maxRetry(req))
+	req.Retry = 10
+	assert.Equal(t, 5, maxRetry(req))
+}
+
+func TestRetryDelay(t *testing.T) {
+	PushConf = config.BuildDefaultPushConf()
+	app := PushConf.Apps[AppNameDefault]
+	app.Retry.BaseDelay = time.Second
+	app.Retry.MaxDelay = 4 * time.Second
+	app.Retry.Jitter = false
+	PushConf.Apps[AppNameDefault] = app
+
+	req := PushNotification{AppID: AppNameDefault}
+
+	assert.Equal(t, time.Second, retryDelay(req, 0, 0))
+	assert.Equal(t, 2*time.Second, retryDelay(req, 1, 0))
+	assert.Equal(t, 4*time.Second, retryDelay(req, 5, 0))
+	assert.Equal(t, 10*time.Second, retryDelay(req, 0, 10*time.Second))
+}
+
+func TestScheduleRetry(t *testing.T) {
+	PushConf = config.BuildDefaultPushConf()
+	app := PushConf.Apps[AppNameDefault]
+	app.Retry.MaxRetry = 1
+	app.Retry.BaseDelay = time.Millisecond
+	app.Retry.MaxDelay = time.Millisecond
+	PushConf.Apps[AppNameDefault] = app
+
+	// no worker reads from this channel.
+	QueueNotification = make(chan PushNotification, 2)
+	defer initTestQueue(t)()
+
+	req := PushNotification{
+		Tokens:   []string{"aaaaaa", "bbbbb"},
+		Platform: PlatFormAndroid,
+		Message:  "Welcome",
+		AppID:    AppNameDefault,
+	}
+	resp := map[string]*PushResponse{
+		"aaaaaa": {Status: "failed"},
+		"bbbbb":  {Status: "failed"},
+	}
+
+	assert.True(t, scheduleRetry(req, []string{"bbbbb"}, 0, resp))
+	assert.Equal(t, "failed", resp["aaaaaa"].Status)
+	assert.Equal(t, StatusRetrying, resp["bbbbb"].Status)
+
+	// retry is stored before it is sent to workers.
+	assert.Len(t, pendingQueueIDs(t), 1)
+
+	select {
+	case retry := <-QueueNotification:
+		assert.Equal(t, []string{"bbbbb"}, retry.Tokens)
+		assert.Equal(t, 1, retry.attempt)
+		assert.NotEmpty(t, retry.queueID)
+
+		// retry limit reached
+		assert.False(t, scheduleRetry(retry, retry.Tokens, 0, resp))
+	case <-time.After(time.Second):
+		assert.Fail(t, "retry is not sent to workers")
+	}
+
+	assert.False(t, scheduleRetry(req, nil, 0, resp))
+
+	atomic.StoreInt64(&pendingNotifications, 0)
+}
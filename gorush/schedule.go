@@ -0,0 +1,330 @@
+package gorush
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// scheduleBucket is the storage bucket of scheduled notifications.
+const scheduleBucket = "schedule"
+
+// scheduleClaimBucket keeps claims of scheduled notifications which are
+// being sent or canceled, so only one instance handles each of them.
+const scheduleClaimBucket = "schedule-claim"
+
+// scheduleInterval is how often due scheduled notifications are sent.
+var scheduleInterval = time.Second
+
+// scheduleClaimTTL is how long a claim is kept before other instance takes
+// it over, in case the claiming instance stopped before finishing.
+var scheduleClaimTTL = 10 * time.Minute
+
+// ScheduledNotification is a notification waiting for its send time.
+type ScheduledNotification struct {
+	ID           string           `json:"id"`
+	AppID        string           `json:"app_id"`
+	Platform     int              `json:"platform"`
+	SendAt       int64            `json:"send_at"`
+	CreatedAt    int64            `json:"created_at"`
+	Notification PushNotification `json:"notification"`
+}
+
+// newScheduleID returns an id which sorts in send time order, so scheduler
+// can stop at the first notification which is not due.
+func newScheduleID(sendAt time.Time) string {
+	return fmt.Sprintf("%016x%08x", sendAt.UnixNano(), atomic.AddUint32(&queueSequence, 1))
+}
+
+// notificationSendAt returns the send time of notification from send_at or
+// delay field. Zero time means the notification should be sent now.
+func notificationSendAt(req PushNotification) (time.Time, error) {
+	var sendAt time.Time
+
+	switch {
+	case req.SendAt != 0 && req.Delay != 0:
+		return sendAt, errors.New("send_at and delay can't be used together")
+	case req.Delay < 0:
+		return sendAt, errors.New("delay can't be negative")
+	case req.Delay > 0:
+		sendAt = time.Now().Add(time.Duration(req.Delay) * time.Second)
+	case req.SendAt > 0:
+		sendAt = time.Unix(req.SendAt, 0)
+	}
+
+	// send time in the past is sent now.
+	if !sendAt.After(time.Now()) {
+		return time.Time{}, nil
+	}
+
+	return sendAt, nil
+}
+
+// scheduleNotification stores notification in stat storage until sendAt
+// and returns its id.
+func scheduleNotification(req PushNotification, sendAt time.Time) (string, error) {
+	req.id = newScheduleID(sendAt)
+	req.SendAt = sendAt.Unix()
+	req.Delay = 0
+
+	data, err := json.Marshal(ScheduledNotification{
+		ID:           req.id,
+		AppID:        req.AppID,
+		Platform:     req.Platform,
+		SendAt:       req.SendAt,
+		CreatedAt:    time.Now().Unix(),
+		Notification: req,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := StatStorage.SetRecord(context.Background(), scheduleBucket, req.id, data); err != nil {
+		return "", err
+	}
+
+	saveNotificationStatus(req)
+
+	return req.id, nil
+}
+
+// loadSchedule returns nil if scheduled notification not exist.
+func loadSchedule(id string) (*ScheduledNotification, error) {
+	data, err := StatStorage.GetRecord(context.Background(), scheduleBucket, id)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var schedule ScheduledNotification
+	if err := json.Unmarshal(data, &schedule); err != nil {
+		return nil, err
+	}
+
+	return &schedule, nil
+}
+
+// listSchedule returns at most limit scheduled notifications after cursor in
+// send time order. The returned cursor is empty if there is no more.
+func listSchedule(appID string, cursor string, limit int) ([]ScheduledNotification, string, error) {
+	schedules := []ScheduledNotification{}
+	more := false
+
+	err := StatStorage.RangeRecords(context.Background(), scheduleBucket, "", cursor, func(key string, value []byte) bool {
+		var schedule ScheduledNotification
+		if err := json.Unmarshal(value, &schedule); err != nil {
+			LogError.Error("schedule decode error: " + err.Error())
+			return true
+		}
+
+		if appID != "" && schedule.AppID != appID {
+			return true
+		}
+
+		if len(schedules) == limit {
+			more = true
+			return false
+		}
+
+		schedules = append(schedules, schedule)
+		return true
+	})
+
+	if err != nil || !more {
+		return schedules, "", err
+	}
+
+	return schedules, schedules[len(schedules)-1].ID, nil
+}
+
+// claimSchedule claims scheduled notification with CreateRecord, which is
+// atomic in every storage engine. It returns false if the notification is
+// claimed by other sender or canceler.
+func claimSchedule(id string) (bool, error) {
+	now := []byte(strconv.FormatInt(time.Now().UnixNano(), 10))
+	key := id
+
+	for {
+		ok, err := StatStorage.CreateRecord(context.Background(), scheduleClaimBucket, key, now)
+		if err != nil || ok {
+			return ok, err
+		}
+
+		data, err := StatStorage.GetRecord(context.Background(), scheduleClaimBucket, key)
+		if err != nil || data == nil {
+			// released in the meantime, try again on next dispatch.
+			return false, err
+		}
+
+		claimedAt, _ := strconv.ParseInt(string(data), 10, 64)
+		if time.Since(time.Unix(0, claimedAt)) < scheduleClaimTTL {
+			return false, nil
+		}
+
+		// take over stale claim, the key is unique for the stale claim so
+		// only one instance gets it.
+		key = id + "/" + string(data)
+	}
+}
+
+// releaseSchedule removes the claim and its takeovers.
+func releaseSchedule(id string) {
+	var keys []string
+
+	err := StatStorage.RangeRecords(context.Background(), scheduleClaimBucket, id, "", func(key string, value []byte) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if err != nil {
+		LogError.Error("schedule error: " + err.Error())
+	}
+
+	for _, key := range keys {
+		if err := StatStorage.DeleteRecord(context.Background(), scheduleClaimBucket, key); err != nil {
+			LogError.Error("schedule error: " + err.Error())
+		}
+	}
+}
+
+// cancelSchedule removes scheduled notification, it returns false if the
+// notification is already sent, canceled or being sent.
+func cancelSchedule(id string) (bool, error) {
+	ok, err := claimSchedule(id)
+	if err != nil || !ok {
+		return false, err
+	}
+	defer releaseSchedule(id)
+
+	schedule, err := loadSchedule(id)
+	if err != nil || schedule == nil {
+		return false, err
+	}
+
+	if err := StatStorage.DeleteRecord(context.Background(), scheduleBucket, id); err != nil {
+		return false, err
+	}
+
+	notification := schedule.Notification
+	notification.id = schedule.ID
+	updateNotificationStatus(notification, StateCanceled)
+
+	return true, nil
+}
+
+// sendSchedule sends scheduled notification to workers. The record is
+// removed after the notification is persisted in queue engine, so it is
+// not lost if server stops in between. Instances sharing stat storage
+// send each notification once, the claim is kept until the record is gone.
+func sendSchedule(id string) bool {
+	ok, err := claimSchedule(id)
+	if err != nil {
+		LogError.Error("schedule error: " + err.Error())
+		return false
+	}
+
+	if !ok {
+		return false
+	}
+	defer releaseSchedule(id)
+
+	data, err := StatStorage.GetRecord(context.Background(), scheduleBucket, id)
+	if err != nil {
+		LogError.Error("schedule error: " + err.Error())
+		return false
+	}
+
+	// canceled in the meantime.
+	if data == nil {
+		return false
+	}
+
+	var schedule ScheduledNotification
+	if err := json.Unmarshal(data, &schedule); err != nil {
+		LogError.Error("schedule error: drop broken notification " + id + ": " + err.Error())
+		StatStorage.DeleteRecord(context.Background(), scheduleBucket, id)
+		return false
+	}
+
+	notification := schedule.Notification
+	notification.id = schedule.ID
+	notification.SendAt = 0
+
+	if _, exists := PushConf.Apps[notification.AppID]; exists {
+		updateNotificationStatus(notification, StateQueued)
+		enqueueNotification(notification)
+		addTotalCount(int64(len(notification.Tokens)))
+	} else {
+		LogError.Error("Unknown app of scheduled notification: " + notification.AppID)
+		finishNotificationStatus(notification, map[string]*PushResponse{})
+	}
+
+	if err := StatStorage.DeleteRecord(context.Background(), scheduleBucket, id); err != nil {
+		LogError.Error("schedule error: " + err.Error())
+	}
+
+	return true
+}
+
+// dispatchSchedule sends all scheduled notifications which are due at now.
+func dispatchSchedule(now time.Time) int {
+	var due []string
+	cutoff := fmt.Sprintf("%016x", now.UnixNano())
+
+	err := StatStorage.RangeRecords(context.Background(), scheduleBucket, "", "", func(key string, value []byte) bool {
+		if len(key) >= len(cutoff) && key[:len(cutoff)] > cutoff {
+			return false
+		}
+
+		due = append(due, key)
+		return true
+	})
+
+	if err != nil {
+		LogError.Error("schedule error: " + err.Error())
+	}
+
+	count := 0
+	for _, id := range due {
+		if sendSchedule(id) {
+			count++
+		}
+	}
+
+	if count > 0 {
+		LogAccess.Debug(fmt.Sprintf("Send %d scheduled notifications", count))
+	}
+
+	return count
+}
+
+// StartScheduler sends scheduled notifications when they are due. Pending
+// notifications are kept in stat storage, so they survive restart.
+// Workers must be started before calling it. The scheduler is stopped when
+// shutdown starts, so due notifications are sent after next start.
+func StartScheduler() {
+	ticker := time.NewTicker(scheduleInterval)
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		for {
+			select {
+			case <-ticker.C:
+				dispatchSchedule(time.Now())
+			case <-stop:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	OnShutdown(func() {
+		close(stop)
+		<-stopped
+	})
+}
@@ -0,0 +1,196 @@
+package gorush
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/buger/jsonparser"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/appleboy/gofight.v2"
+)
+
+func TestNotificationSendAt(t *testing.T) {
+	sendAt, err := notificationSendAt(PushNotification{})
+	assert.NoError(t, err)
+	assert.True(t, sendAt.IsZero())
+
+	sendAt, err = notificationSendAt(PushNotification{SendAt: time.Now().Unix() - 10})
+	assert.NoError(t, err)
+	assert.True(t, sendAt.IsZero())
+
+	sendAt, err = notificationSendAt(PushNotification{SendAt: time.Now().Unix() + 60})
+	assert.NoError(t, err)
+	assert.False(t, sendAt.IsZero())
+
+	sendAt, err = notificationSendAt(PushNotification{Delay: 60})
+	assert.NoError(t, err)
+	assert.True(t, sendAt.After(time.Now().Add(59*time.Second)))
+
+	_, err = notificationSendAt(PushNotification{SendAt: time.Now().Unix() + 60, Delay: 60})
+	assert.Error(t, err)
+
+	_, err = notificationSendAt(PushNotification{Delay: -1})
+	assert.Error(t, err)
+}
+
+func TestScheduleNotification(t *testing.T) {
+	initTest()
+	InitLog()
+	InitAppStatus()
+	QueueNotification = make(chan PushNotification, 10)
+
+	now := time.Now()
+	req := PushNotification{
+		AppID:    AppNameDefault,
+		Platform: PlatFormIos,
+		Tokens:   []string{"aaaaa"},
+		Message:  "Welcome",
+	}
+
+	later, err := scheduleNotification(req, now.Add(time.Hour))
+	assert.NoError(t, err)
+	soon, err := scheduleNotification(req, now.Add(time.Minute))
+	assert.NoError(t, err)
+	canceled, err := scheduleNotification(req, now.Add(2*time.Minute))
+	assert.NoError(t, err)
+
+	status, _ := loadNotificationStatus(soon)
+	assert.Equal(t, StateScheduled, status.State)
+
+	// listed in send time order
+	schedules, cursor, err := listSchedule(AppNameDefault, "", 2)
+	assert.NoError(t, err)
+	assert.Len(t, schedules, 2)
+	assert.Equal(t, soon, schedules[0].ID)
+	assert.Equal(t, canceled, schedules[1].ID)
+	assert.Equal(t, canceled, cursor)
+
+	schedules, cursor, _ = listSchedule(AppNameDefault, cursor, 2)
+	assert.Len(t, schedules, 1)
+	assert.Equal(t, later, schedules[0].ID)
+	assert.Equal(t, "", cursor)
+
+	schedules, _, _ = listSchedule("other", "", 2)
+	assert.Len(t, schedules, 0)
+
+	ok, err := cancelSchedule(canceled)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, _ = cancelSchedule(canceled)
+	assert.False(t, ok)
+	status, _ = loadNotificationStatus(canceled)
+	assert.Equal(t, StateCanceled, status.State)
+
+	// nothing is due yet
+	assert.Equal(t, 0, dispatchSchedule(now))
+
+	assert.Equal(t, 1, dispatchSchedule(now.Add(5*time.Minute)))
+	notification := <-QueueNotification
+	ackNotification(notification)
+	assert.Equal(t, soon, notification.id)
+	assert.Equal(t, int64(0), notification.SendAt)
+	assert.Equal(t, "Welcome", notification.Message)
+
+	status, _ = loadNotificationStatus(soon)
+	assert.Equal(t, StateQueued, status.State)
+
+	schedules, _, _ = listSchedule("", "", 10)
+	assert.Len(t, schedules, 1)
+	assert.Equal(t, later, schedules[0].ID)
+	assert.Equal(t, int64(1), pushStatus().TotalCount)
+}
+
+func TestScheduleClaim(t *testing.T) {
+	initTest()
+	InitLog()
+	InitAppStatus()
+	QueueNotification = make(chan PushNotification, 10)
+
+	id, err := scheduleNotification(PushNotification{
+		AppID:    AppNameDefault,
+		Platform: PlatFormIos,
+		Tokens:   []string{"aaaaa"},
+		Message:  "Welcome",
+	}, time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+
+	// claimed by other instance.
+	ok, err := claimSchedule(id)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	assert.False(t, sendSchedule(id))
+	ok, _ = cancelSchedule(id)
+	assert.False(t, ok)
+	assert.Equal(t, 0, len(QueueNotification))
+
+	// stale claim is taken over once.
+	scheduleClaimTTL = 0
+	defer func() {
+		scheduleClaimTTL = 10 * time.Minute
+	}()
+	ok, _ = claimSchedule(id)
+	assert.True(t, ok)
+	releaseSchedule(id)
+
+	assert.True(t, sendSchedule(id))
+	notification := <-QueueNotification
+	ackNotification(notification)
+	assert.Equal(t, id, notification.id)
+
+	// sent notification is not sent again.
+	assert.False(t, sendSchedule(id))
+	assert.Equal(t, 0, len(QueueNotification))
+}
+
+func TestScheduleHandler(t *testing.T) {
+	initTest()
+	InitLog()
+	InitAppStatus()
+	app := PushConf.Apps[AppNameDefault]
+	app.Ios.Enabled = true
+	PushConf.Apps[AppNameDefault] = app
+
+	r := gofight.New()
+
+	var id string
+	r.POST("/api/push").
+		SetJSON(gofight.D{
+			"notifications": []gofight.D{
+				{
+					"tokens":   []string{"aaaaa"},
+					"platform": PlatFormIos,
+					"message":  "Welcome",
+					"delay":    3600,
+				},
+			},
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			counts, _ := jsonparser.GetInt([]byte(r.Body.String()), "counts")
+
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Equal(t, int64(1), counts)
+		})
+
+	r.GET("/api/schedule").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			data := []byte(r.Body.String())
+			id, _ = jsonparser.GetString(data, "schedule", "[0]", "id")
+			message, _ := jsonparser.GetString(data, "schedule", "[0]", "notification", "message")
+
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.NotEmpty(t, id)
+			assert.Equal(t, "Welcome", message)
+		})
+
+	r.DELETE("/api/schedule/"+id).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+
+	r.DELETE("/api/schedule/"+id).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusNotFound, r.Code)
+		})
+}
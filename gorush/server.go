@@ -1,11 +1,15 @@
 package gorush
 
 import (
+	"context"
 	"crypto/tls"
-	"fmt"
+	"encoding/json"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lalit-verma/gorush/config"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"golang.org/x/crypto/acme/autocert"
@@ -42,34 +46,606 @@ func pushHandler(c *gin.Context) {
 		return
 	}
 
-	if len(form.Notifications) == 0 {
-		msg = "Notifications field is empty."
+	// replay response of request retried with the same Idempotency-Key.
+	var fingerprint string
+	idempotencyKey := requestIdempotencyKey(c)
+	if idempotencyKey != "" {
+		fingerprint = requestFingerprint(form)
+		record, err := claimIdempotencyKey(idempotencyKey, fingerprint)
+		if err != nil {
+			LogError.Error("idempotency error: " + err.Error())
+			abortWithError(c, http.StatusInternalServerError, "Can't check Idempotency-Key.")
+			return
+		}
+
+		if record != nil {
+			replayIdempotentResponse(c, record, fingerprint)
+			return
+		}
+	}
+
+	// notifications carry the request span to workers.
+	span := startSpan(parseTraceParent(c.Request.Header.Get(TraceParentHeader)), "POST "+c.Request.URL.Path, spanKindServer)
+	span.setAttribute("gorush.notifications", len(form.Notifications))
+	form.trace = span.spanContext()
+
+	result, err := SendNotifications(requestAPIKey(c), form, false)
+	if err != nil {
+		if idempotencyKey != "" {
+			releaseIdempotencyKey(idempotencyKey)
+		}
+		span.setAttribute("http.status_code", err.Code)
+		span.finish(err)
+		LogAccess.Debug(err.Message)
+		abortWithError(c, err.Code, err.Message)
+		return
+	}
+	span.setAttribute("http.status_code", http.StatusOK)
+	span.setAttribute("gorush.tokens", result.Counts)
+	span.finish(nil)
+
+	resp := gin.H{
+		"success": "ok",
+		"counts":  result.Counts,
+		"ids":     result.IDs,
+	}
+
+	// per-token delivery results are only known in sync mode.
+	if PushConf.Core.Sync {
+		resp["results"] = result.Results
+	}
+
+	if idempotencyKey != "" {
+		data, _ := json.Marshal(resp)
+		finishIdempotencyKey(idempotencyKey, idempotencyRecord{
+			Fingerprint: fingerprint,
+			Code:        http.StatusOK,
+			Response:    data,
+		})
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func pushStreamHandler(c *gin.Context) {
+	result, err := StreamNotifications(requestAPIKey(c), c.Request.Body)
+	if err != nil {
+		LogError.Error("push stream error: " + err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": err.Error(),
+			"result":  result,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": "ok",
+		"result":  result,
+	})
+}
+
+func pushStatusHandler(c *gin.Context) {
+	id := c.Param("id")
+
+	if PushConf.Core.StatusTTL <= 0 {
+		abortWithError(c, http.StatusNotFound, "Notification status is disabled.")
+		return
+	}
+
+	status, err := loadNotificationStatus(id)
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if status == nil {
+		abortWithError(c, http.StatusNotFound, "Unknown notification: "+id)
+		return
+	}
+
+	if !authorizeApp(c, status.AppID) {
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+func certReloadHandler(c *gin.Context) {
+	var err error
+
+	if !authorizeApp(c, c.Query("app_id")) {
+		return
+	}
+
+	if appID := c.Query("app_id"); appID != "" {
+		if _, exists := PushConf.Apps[appID]; !exists {
+			abortWithError(c, http.StatusBadRequest, "Unknown app: "+appID)
+			return
+		}
+
+		err = ReloadAPNSClient(appID)
+	} else {
+		err = InitAPNSClients()
+	}
+
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":      "ok",
+		"certificates": certificateStatus(),
+	})
+}
+
+func feedbackHandler(c *gin.Context) {
+	var err error
+	platform := 0
+	limit := 100
+
+	if value := c.Query("platform"); value != "" {
+		if platform, err = strconv.Atoi(value); err != nil {
+			abortWithError(c, http.StatusBadRequest, "Invalid platform: "+value)
+			return
+		}
+	}
+
+	if value := c.Query("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 || limit > 1000 {
+			abortWithError(c, http.StatusBadRequest, "Limit should be between 1 and 1000.")
+			return
+		}
+	}
+
+	if !authorizeApp(c, c.Query("app_id")) {
+		return
+	}
+
+	feedbacks, cursor, err := listFeedback(c.Query("app_id"), platform, c.Query("cursor"), limit)
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"feedback": feedbacks,
+		"cursor":   cursor,
+	})
+}
+
+func feedbackAckHandler(c *gin.Context) {
+	var form RequestFeedbackAck
+
+	if err := c.BindJSON(&form); err != nil {
+		msg := "Missing ids field."
+		LogAccess.Debug(msg)
+		abortWithError(c, http.StatusBadRequest, msg)
+		return
+	}
+
+	// feedback id starts with its app id.
+	for _, id := range form.IDs {
+		if !authorizeApp(c, strings.SplitN(strings.TrimSpace(id), "/", 2)[0]) {
+			return
+		}
+	}
+
+	count, err := ackFeedback(form.IDs)
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": "ok",
+		"acked":   count,
+	})
+}
+
+func scheduleHandler(c *gin.Context) {
+	limit := 100
+
+	if value := c.Query("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 || limit > 1000 {
+			abortWithError(c, http.StatusBadRequest, "Limit should be between 1 and 1000.")
+			return
+		}
+	}
+
+	if !authorizeApp(c, c.Query("app_id")) {
+		return
+	}
+
+	schedules, cursor, err := listSchedule(c.Query("app_id"), c.Query("cursor"), limit)
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"schedule": schedules,
+		"cursor":   cursor,
+	})
+}
+
+func cancelScheduleHandler(c *gin.Context) {
+	id := c.Param("id")
+
+	schedule, err := loadSchedule(id)
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if schedule == nil {
+		abortWithError(c, http.StatusNotFound, "Unknown scheduled notification: "+id)
+		return
+	}
+
+	if !authorizeApp(c, schedule.AppID) {
+		return
+	}
+
+	canceled, err := cancelSchedule(id)
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// sent by scheduler in the meantime.
+	if !canceled {
+		abortWithError(c, http.StatusNotFound, "Unknown scheduled notification: "+id)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": "ok",
+	})
+}
+
+func templateHandler(c *gin.Context) {
+	appID := c.Query("app_id")
+	if appID == "" {
+		appID = AppNameDefault
+	}
+
+	if !authorizeApp(c, appID) {
+		return
+	}
+
+	templates, err := listTemplates(appID)
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"templates": templates,
+	})
+}
+
+func createTemplateHandler(c *gin.Context) {
+	var form RequestTemplate
+
+	if err := c.BindJSON(&form); err != nil {
+		msg := "Missing name or template field."
+		LogAccess.Debug(msg)
+		abortWithError(c, http.StatusBadRequest, msg)
+		return
+	}
+
+	if form.AppID == "" {
+		form.AppID = AppNameDefault
+	}
+
+	if !authorizeApp(c, form.AppID) {
+		return
+	}
+
+	if _, exists := PushConf.Apps[form.AppID]; !exists {
+		abortWithError(c, http.StatusBadRequest, "Unknown app: "+form.AppID)
+		return
+	}
+
+	if err := saveTemplate(form); err != nil {
+		abortWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": "ok",
+	})
+}
+
+func deleteTemplateHandler(c *gin.Context) {
+	appID := c.Query("app_id")
+	if appID == "" {
+		appID = AppNameDefault
+	}
+
+	if !authorizeApp(c, appID) {
+		return
+	}
+
+	deleted, err := deleteTemplate(appID, c.Query("name"))
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !deleted {
+		abortWithError(c, http.StatusNotFound, "Unknown template: "+c.Query("name"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": "ok",
+	})
+}
+
+func deviceHandler(c *gin.Context) {
+	var err error
+	var devices []Device
+	var cursor string
+	platform := 0
+	limit := 100
+
+	appID := c.Query("app_id")
+	if appID == "" {
+		appID = AppNameDefault
+	}
+
+	if value := c.Query("platform"); value != "" {
+		if platform, err = strconv.Atoi(value); err != nil {
+			abortWithError(c, http.StatusBadRequest, "Invalid platform: "+value)
+			return
+		}
+	}
+
+	if value := c.Query("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 || limit > 1000 {
+			abortWithError(c, http.StatusBadRequest, "Limit should be between 1 and 1000.")
+			return
+		}
+	}
+
+	if !authorizeApp(c, appID) {
+		return
+	}
+
+	if c.Query("user_id") != "" || c.Query("tags") != "" {
+		var expr tagExpr
+		if value := c.Query("tags"); value != "" {
+			if expr, err = parseTagExpr(value); err != nil {
+				abortWithError(c, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+
+		var userIDs []string
+		if value := c.Query("user_id"); value != "" {
+			userIDs = []string{value}
+		}
+
+		devices, err = findDevices(appID, platform, userIDs, expr)
+	} else {
+		devices, cursor, err = listDevices(appID, platform, c.Query("cursor"), limit)
+	}
+
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if devices == nil {
+		devices = []Device{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"devices": devices,
+		"cursor":  cursor,
+	})
+}
+
+func registerDeviceHandler(c *gin.Context) {
+	var form Device
+
+	if err := c.BindJSON(&form); err != nil {
+		msg := "Missing token or platform field."
 		LogAccess.Debug(msg)
 		abortWithError(c, http.StatusBadRequest, msg)
 		return
 	}
 
-	if int64(len(form.Notifications)) > PushConf.Core.MaxNotification {
-		msg = fmt.Sprintf("Number of notifications(%d) over limit(%d)", len(form.Notifications), PushConf.Core.MaxNotification)
+	if form.AppID == "" {
+		form.AppID = AppNameDefault
+	}
+
+	if !authorizeApp(c, form.AppID) {
+		return
+	}
+
+	if _, exists := PushConf.Apps[form.AppID]; !exists {
+		abortWithError(c, http.StatusBadRequest, "Unknown app: "+form.AppID)
+		return
+	}
+
+	if err := registerDevice(form); err != nil {
+		abortWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": "ok",
+	})
+}
+
+func unregisterDeviceHandler(c *gin.Context) {
+	appID := c.Query("app_id")
+	if appID == "" {
+		appID = AppNameDefault
+	}
+
+	platform, err := strconv.Atoi(c.Query("platform"))
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, "Invalid platform: "+c.Query("platform"))
+		return
+	}
+
+	if !authorizeApp(c, appID) {
+		return
+	}
+
+	deleted, err := unregisterDevice(appID, platform, c.Query("token"))
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !deleted {
+		abortWithError(c, http.StatusNotFound, "Unknown device.")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": "ok",
+	})
+}
+
+func createAPIKeyHandler(c *gin.Context) {
+	var form RequestAPIKey
+
+	if !PushConf.Auth.Storage {
+		abortWithError(c, http.StatusBadRequest, "API key storage is disabled.")
+		return
+	}
+
+	if err := c.BindJSON(&form); err != nil {
+		msg := "Missing id or scopes field."
 		LogAccess.Debug(msg)
 		abortWithError(c, http.StatusBadRequest, msg)
 		return
 	}
 
-	counts := queueNotification(form)
+	// key limited to apps can't create key beyond its apps.
+	if !authorizeApps(c, form.Apps) {
+		return
+	}
+
+	key, err := createAPIKey(form)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": "ok",
+		"id":      form.ID,
+		"key":     key,
+	})
+}
+
+func deleteAPIKeyHandler(c *gin.Context) {
+	if !PushConf.Auth.Storage {
+		abortWithError(c, http.StatusBadRequest, "API key storage is disabled.")
+		return
+	}
+
+	hash, stored, err := findStoredAPIKey(c.Query("id"))
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if hash == "" {
+		abortWithError(c, http.StatusNotFound, "Unknown API key: "+c.Query("id"))
+		return
+	}
+
+	// key limited to apps can't delete key beyond its apps.
+	if !authorizeApps(c, stored.Apps) {
+		return
+	}
+
+	if err := StatStorage.DeleteRecord(context.Background(), apiKeyBucket, hash); err != nil {
+		abortWithError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": "ok",
-		"counts":  counts,
 	})
 }
 
 func configHandler(c *gin.Context) {
-	c.YAML(http.StatusCreated, PushConf)
+	full := c.Query("full") == "true"
+
+	// secrets are only shown to admin api key.
+	if full {
+		apiKey := requestAPIKey(c)
+		if apiKey == nil || !apiKey.HasScope(ScopeAdmin) {
+			abortWithError(c, http.StatusForbidden, "Full config requires admin API key.")
+			return
+		}
+	}
+
+	conf := limitConfApps(PushConf, requestAPIKey(c))
+
+	if c.Query("format") == "json" {
+		c.JSON(http.StatusOK, gin.H{
+			"config": config.Effective(conf, ConfSources, full),
+		})
+		return
+	}
+
+	if full {
+		c.YAML(http.StatusCreated, conf)
+		return
+	}
+
+	c.YAML(http.StatusCreated, config.Redact(conf))
+}
+
+// limitConfApps returns config with only apps and api keys of apps which
+// api key can access.
+func limitConfApps(conf config.ConfYaml, apiKey *APIKey) config.ConfYaml {
+	if apiKey == nil || len(apiKey.Apps) == 0 {
+		return conf
+	}
+
+	apps := make(map[string]config.SectionApp)
+	for appID, app := range conf.Apps {
+		if apiKey.AllowApp(appID) {
+			apps[appID] = app
+		}
+	}
+	conf.Apps = apps
+
+	var keys []config.SectionAPIKey
+	for _, key := range conf.Auth.Keys {
+		allowed := len(key.Apps) > 0
+		for _, app := range key.Apps {
+			allowed = allowed && apiKey.AllowApp(app)
+		}
+		if allowed {
+			keys = append(keys, key)
+		}
+	}
+	conf.Auth.Keys = keys
+
+	return conf
 }
 
 func metricsHandler(c *gin.Context) {
-	promhttp.Handler().ServeHTTP(c.Writer, c.Request)
+	apiKey := requestAPIKey(c)
+	if apiKey == nil || len(apiKey.Apps) == 0 {
+		promhttp.Handler().ServeHTTP(c.Writer, c.Request)
+		return
+	}
+
+	promhttp.HandlerFor(appGatherer(apiKey), promhttp.HandlerOpts{}).ServeHTTP(c.Writer, c.Request)
 }
 
 func autoTLSServer() *http.Server {
@@ -96,15 +672,31 @@ func routerEngine() *gin.Engine {
 	r.Use(gin.Logger())
 	r.Use(gin.Recovery())
 	r.Use(VersionMiddleware())
+	r.Use(AuthMiddleware())
 	r.Use(LogMiddleware())
 	r.Use(StatMiddleware())
 
-	r.GET(PushConf.API.StatGoURI, api.StatusHandler)
-	r.GET(PushConf.API.StatAppURI, appStatusHandler)
-	r.GET(PushConf.API.ConfigURI, configHandler)
-	r.GET(PushConf.API.SysStatURI, sysStatsHandler)
-	r.POST(PushConf.API.PushURI, pushHandler)
-	r.GET(PushConf.API.MetricURI, metricsHandler)
+	r.GET(PushConf.API.StatGoURI, RequireScope(ScopeStats), api.StatusHandler)
+	r.GET(PushConf.API.StatAppURI, RequireScope(ScopeStats), appStatusHandler)
+	r.GET(PushConf.API.ConfigURI, RequireScope(ScopeStats), configHandler)
+	r.GET(PushConf.API.SysStatURI, RequireScope(ScopeStats), sysStatsHandler)
+	r.POST(PushConf.API.PushURI, RequireScope(ScopePush), pushHandler)
+	r.POST(PushConf.API.PushURI+"/stream", RequireScope(ScopePush), pushStreamHandler)
+	r.GET(PushConf.API.PushURI+"/:id", RequireScope(ScopePush), pushStatusHandler)
+	r.POST(PushConf.API.CertReloadURI, RequireScope(ScopeAdmin), certReloadHandler)
+	r.GET(PushConf.API.FeedbackURI, RequireScope(ScopePush), feedbackHandler)
+	r.POST(PushConf.API.FeedbackAckURI, RequireScope(ScopePush), feedbackAckHandler)
+	r.GET(PushConf.API.ScheduleURI, RequireScope(ScopePush), scheduleHandler)
+	r.DELETE(PushConf.API.ScheduleURI+"/:id", RequireScope(ScopePush), cancelScheduleHandler)
+	r.GET(PushConf.API.TemplateURI, RequireScope(ScopePush), templateHandler)
+	r.POST(PushConf.API.TemplateURI, RequireScope(ScopeAdmin), createTemplateHandler)
+	r.DELETE(PushConf.API.TemplateURI, RequireScope(ScopeAdmin), deleteTemplateHandler)
+	r.GET(PushConf.API.DeviceURI, RequireScope(ScopePush), deviceHandler)
+	r.POST(PushConf.API.DeviceURI, RequireScope(ScopePush), registerDeviceHandler)
+	r.DELETE(PushConf.API.DeviceURI, RequireScope(ScopePush), unregisterDeviceHandler)
+	r.POST(PushConf.API.KeyURI, RequireScope(ScopeAdmin), createAPIKeyHandler)
+	r.DELETE(PushConf.API.KeyURI, RequireScope(ScopeAdmin), deleteAPIKeyHandler)
+	r.GET(PushConf.API.MetricURI, RequireScope(ScopeStats), metricsHandler)
 	r.GET("/", rootHandler)
 
 	return r
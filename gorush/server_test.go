@@ -1,15 +1,16 @@
 package gorush
 
 import (
+	"io/ioutil"
 	"net/http"
 	"os"
 	"runtime"
 	"testing"
 	"time"
 
-	"github.com/lalit-verma/gorush/config"
 	"github.com/buger/jsonparser"
 	"github.com/gin-gonic/gin"
+	"github.com/lalit-verma/gorush/config"
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/appleboy/gofight.v2"
 )
@@ -104,6 +105,61 @@ func TestRootHandler(t *testing.T) {
 		})
 }
 
+func TestOlderConfigRouter(t *testing.T) {
+	// api section of config before feedback endpoints.
+	content := []byte(`api:
+  push_uri: "/api/push"
+  stat_go_uri: "/api/stat/go"
+  stat_app_uri: "/api/stat/app"
+  config_uri: "/api/config"
+  sys_stat_uri: "/sys/stats"
+  metric_uri: "/metrics"
+`)
+
+	filename := "tempfile"
+	assert.NoError(t, ioutil.WriteFile(filename, content, 0644))
+	defer os.Remove(filename)
+
+	conf, err := config.LoadConfYaml(filename)
+	assert.NoError(t, err)
+
+	initTest()
+	PushConf.API = conf.API
+	InitLog()
+	InitAppStatus()
+
+	r := gofight.New()
+
+	var engine *gin.Engine
+	assert.NotPanics(t, func() {
+		engine = routerEngine()
+	})
+
+	r.GET("/").
+		Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			value, _ := jsonparser.GetString([]byte(r.Body.String()), "text")
+
+			assert.Equal(t, "Welcome to notification server.", value)
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+
+	r.GET("/api/feedback").
+		Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+
+	// admin cert reload is not mounted on root.
+	r.POST("/").
+		Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusNotFound, r.Code)
+		})
+
+	r.POST("/api/cert/reload?app_id=unknown").
+		Run(engine, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusBadRequest, r.Code)
+		})
+}
+
 func TestAPIStatusGoHandler(t *testing.T) {
 	initTest()
 
@@ -150,6 +206,63 @@ func TestAPIConfigHandler(t *testing.T) {
 		})
 }
 
+func TestAPIConfigRedactHandler(t *testing.T) {
+	initTest()
+
+	app := PushConf.Apps[AppNameDefault]
+	app.Android.APIKey = "android-key"
+	PushConf.Apps[AppNameDefault] = app
+
+	r := gofight.New()
+
+	r.GET("/api/config").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusCreated, r.Code)
+			assert.NotContains(t, r.Body.String(), "android-key")
+			assert.Contains(t, r.Body.String(), config.RedactedValue)
+		})
+
+	r.GET("/api/config?format=json").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			data := []byte(r.Body.String())
+			value, _ := jsonparser.GetString(data, "config", "apps.normal.android.apikey", "value")
+			source, _ := jsonparser.GetString(data, "config", "core.port", "source")
+
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Equal(t, config.RedactedValue, value)
+			assert.Equal(t, config.SourceDefault, source)
+		})
+
+	// full config requires admin api key
+	r.GET("/api/config?full=true").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusForbidden, r.Code)
+		})
+
+	PushConf.Auth.Enabled = true
+	PushConf.Auth.Keys = []config.SectionAPIKey{
+		{ID: "admin", Key: "admin-key", Scopes: []string{ScopeAdmin, ScopeStats}},
+		{ID: "stats", Key: "stats-key", Scopes: []string{ScopeStats}},
+	}
+
+	r.GET("/api/config?full=true").
+		SetHeader(gofight.H{
+			"Authorization": "Bearer stats-key",
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusForbidden, r.Code)
+		})
+
+	r.GET("/api/config?full=true").
+		SetHeader(gofight.H{
+			"Authorization": "Bearer admin-key",
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusCreated, r.Code)
+			assert.Contains(t, r.Body.String(), "android-key")
+		})
+}
+
 func TestMissingNotificationsParameter(t *testing.T) {
 	initTest()
 
@@ -211,8 +324,10 @@ func TestOutOfRangeMaxNotifications(t *testing.T) {
 func TestSuccessPushHandler(t *testing.T) {
 	initTest()
 
-	PushConf.Android.Enabled = true
-	PushConf.Android.APIKey = os.Getenv("ANDROID_API_KEY")
+	app := PushConf.Apps[AppNameDefault]
+	app.Android.Enabled = true
+	app.Android.APIKey = os.Getenv("ANDROID_API_KEY")
+	PushConf.Apps[AppNameDefault] = app
 
 	androidToken := os.Getenv("ANDROID_TEST_TOKEN")
 
@@ -234,6 +349,80 @@ func TestSuccessPushHandler(t *testing.T) {
 		})
 }
 
+func TestSyncModePushHandlerResults(t *testing.T) {
+	initTest()
+
+	PushConf.Core.Sync = true
+
+	r := gofight.New()
+
+	r.POST("/api/push").
+		SetJSON(gofight.D{
+			"notifications": []gofight.D{
+				{
+					"tokens":   []string{"aaaaa"},
+					"platform": PlatFormAndroid,
+					"message":  "Welcome",
+				},
+			},
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			data := []byte(r.Body.String())
+
+			platform, _ := jsonparser.GetInt(data, "results", "[0]", "[0]", "platform")
+			reason, _ := jsonparser.GetString(data, "results", "[0]", "[0]", "error")
+
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Equal(t, int64(PlatFormAndroid), platform)
+			assert.Equal(t, "platform not enabled", reason)
+		})
+}
+
+func TestSyncModePushHandlerRequestError(t *testing.T) {
+	initTest()
+	InitLog()
+	InitAppStatus()
+
+	PushConf.Core.Sync = true
+	app := PushConf.Apps[AppNameDefault]
+	app.Android.Enabled = true
+	app.Android.APIKey = "apiKey"
+	PushConf.Apps[AppNameDefault] = app
+	InitWorkers(2, 10)
+
+	// nothing listens on the proxy port, so GCM request fails.
+	transport := http.DefaultTransport
+	defer func() {
+		http.DefaultTransport = transport
+	}()
+	assert.NoError(t, SetProxy("http://127.0.0.1:1"))
+
+	r := gofight.New()
+
+	r.POST("/api/push").
+		SetJSON(gofight.D{
+			"notifications": []gofight.D{
+				{
+					"tokens":   []string{"aaaaa", "bbbbb"},
+					"platform": PlatFormAndroid,
+					"message":  "Welcome",
+				},
+			},
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			data := []byte(r.Body.String())
+
+			assert.Equal(t, http.StatusOK, r.Code)
+			for _, token := range []string{"aaaaa", "bbbbb"} {
+				status, _ := jsonparser.GetString(data, "results", "[0]", "[0]", "tokens", token, "status")
+				reason, _ := jsonparser.GetString(data, "results", "[0]", "[0]", "tokens", token, "error")
+
+				assert.Equal(t, "failed", status)
+				assert.NotEmpty(t, reason)
+			}
+		})
+}
+
 func TestSysStatsHandler(t *testing.T) {
 	initTest()
 
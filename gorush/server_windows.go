@@ -3,18 +3,51 @@
 package gorush
 
 import (
+	"context"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 // RunHTTPServer provide run http or https protocol.
 func RunHTTPServer() (err error) {
+	var server *http.Server
+
+	if PushConf.Core.AutoTLS.Enabled {
+		server = autoTLSServer()
+	} else {
+		server = &http.Server{
+			Addr:    ":" + PushConf.Core.Port,
+			Handler: routerEngine(),
+		}
+	}
+
+	// stop accepting new connections on SIGINT/SIGTERM.
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+		<-quit
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(PushConf.Core.ShutdownTimeout)*time.Second)
+		defer cancel()
+
+		if err := server.Shutdown(ctx); err != nil {
+			LogError.Error("Server shutdown error: ", err)
+		}
+	}()
+
 	if PushConf.Core.AutoTLS.Enabled {
-		s := autoTLSServer()
-		err = s.ListenAndServeTLS("", "")
+		err = server.ListenAndServeTLS("", "")
 	} else if PushConf.Core.SSL && PushConf.Core.CertPath != "" && PushConf.Core.KeyPath != "" {
-		err = http.ListenAndServeTLS(":"+PushConf.Core.Port, PushConf.Core.CertPath, PushConf.Core.KeyPath, routerEngine())
+		err = server.ListenAndServeTLS(PushConf.Core.CertPath, PushConf.Core.KeyPath)
 	} else {
-		err = http.ListenAndServe(":"+PushConf.Core.Port, routerEngine())
+		err = server.ListenAndServe()
+	}
+
+	if err == http.ErrServerClosed {
+		err = nil
 	}
 
 	return
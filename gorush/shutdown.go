@@ -0,0 +1,132 @@
+package gorush
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	shutdownHooks []func()
+	shutdownLock  sync.Mutex
+)
+
+// OnShutdown registers fn to stop accepting new notifications, hooks are
+// called when Shutdown starts, before queued notifications are drained.
+func OnShutdown(fn func()) {
+	shutdownLock.Lock()
+	defer shutdownLock.Unlock()
+
+	shutdownHooks = append(shutdownHooks, fn)
+}
+
+func runShutdownHooks() {
+	shutdownLock.Lock()
+	hooks := shutdownHooks
+	shutdownHooks = nil
+	shutdownLock.Unlock()
+
+	for _, fn := range hooks {
+		fn()
+	}
+}
+
+// Shutdown wait for workers to finish queued notifications and callbacks
+// up to core.shutdown_timeout, report what could not be sent and close
+// the queue and stat storage. All steps share one deadline.
+func Shutdown() {
+	deadline := time.Now().Add(time.Duration(PushConf.Core.ShutdownTimeout) * time.Second)
+
+	runShutdownHooks()
+
+	LogAccess.Info("Shutdown: waiting for queued notifications")
+
+	if !drainWorkers(time.Until(deadline)) {
+		dropped := dropQueuedNotifications()
+		inflight := atomic.LoadInt64(&pendingNotifications) - int64(dropped)
+
+		msg := fmt.Sprintf("Shutdown: %d queued and %d in-flight notifications are not finished", dropped, inflight)
+		if isDurableQueue() {
+			msg += ", they will be resent on next start"
+		}
+		LogError.Error(msg)
+	}
+
+	if !waitCallbacks(time.Until(deadline)) {
+		LogError.Error("Shutdown: delivery result callbacks are not finished")
+	}
+
+	if spanTracer != nil && !spanTracer.close(time.Until(deadline)) {
+		LogError.Error("Shutdown: trace spans are not exported")
+	}
+
+	if NotificationQueue != nil {
+		if err := NotificationQueue.Close(); err != nil {
+			LogError.Error("queue error: " + err.Error())
+		}
+	}
+
+	if StatStorage != nil {
+		if err := StatStorage.Close(); err != nil {
+			LogError.Error("storage error: " + err.Error())
+		}
+	}
+}
+
+// drainWorkers returns true if all notifications are finished before timeout.
+// Retries waiting for backoff are stopped instead of waited for, including
+// the ones scheduled by workers meanwhile.
+func drainWorkers(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+
+	var stopped int
+	for {
+		stopped += stopRetryTimers()
+		if atomic.LoadInt64(&pendingNotifications) <= 0 || time.Now().After(deadline) {
+			break
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if stopped > 0 {
+		msg := fmt.Sprintf("Shutdown: %d scheduled retries are stopped", stopped)
+		if isDurableQueue() {
+			msg += ", they will be resent on next start"
+		}
+		LogError.Error(msg)
+	}
+
+	return atomic.LoadInt64(&pendingNotifications) <= 0
+}
+
+// dropQueuedNotifications takes the notifications which no worker picked up yet
+// out of the channel and logs them as failed.
+func dropQueuedNotifications() int {
+	var count int
+	err := errors.New("notification is not sent before shutdown")
+
+	for {
+		select {
+		case notification := <-QueueNotification:
+			for _, token := range notification.Tokens {
+				LogPush(FailedPush, token, notification, err)
+			}
+			notification.Done()
+			count++
+		default:
+			return count
+		}
+	}
+}
+
+func isDurableQueue() bool {
+	switch PushConf.Core.Queue.Engine {
+	case "", "memory":
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,131 @@
+package gorush
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lalit-verma/gorush/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDrainWorkers(t *testing.T) {
+	atomic.StoreInt64(&pendingNotifications, 0)
+	assert.True(t, drainWorkers(0))
+
+	// workers of other tests may still finish notifications meanwhile.
+	atomic.StoreInt64(&pendingNotifications, 1000)
+	assert.False(t, drainWorkers(10*time.Millisecond))
+
+	atomic.StoreInt64(&pendingNotifications, 0)
+}
+
+func TestShutdownKeepsUnsentNotifications(t *testing.T) {
+	PushConf = config.BuildDefaultPushConf()
+	PushConf.Core.ShutdownTimeout = 0
+	InitLog()
+
+	atomic.StoreInt64(&pendingNotifications, 0)
+
+	// no worker reads from this channel.
+	QueueNotification = make(chan PushNotification, 2)
+	defer initTestQueue(t)()
+
+	enqueueNotification(PushNotification{
+		Tokens:   []string{"aaaaaa"},
+		Platform: PlatFormAndroid,
+		Message:  "Welcome",
+		AppID:    AppNameDefault,
+	})
+
+	Shutdown()
+	assert.Equal(t, 0, len(QueueNotification))
+
+	// notification is resent on restart.
+	assert.NoError(t, InitQueue())
+	assert.Len(t, pendingQueueIDs(t), 1)
+
+	atomic.StoreInt64(&pendingNotifications, 0)
+}
+
+func TestShutdownHooks(t *testing.T) {
+	var calls int
+	OnShutdown(func() {
+		// called before queued notifications are drained.
+		assert.Equal(t, int64(1), atomic.LoadInt64(&pendingNotifications))
+		calls++
+	})
+
+	atomic.StoreInt64(&pendingNotifications, 1)
+	runShutdownHooks()
+	atomic.StoreInt64(&pendingNotifications, 0)
+
+	// hooks are called once.
+	runShutdownHooks()
+	assert.Equal(t, 1, calls)
+}
+
+func TestStopSchedulerOnShutdown(t *testing.T) {
+	initTest()
+	InitLog()
+	InitAppStatus()
+	QueueNotification = make(chan PushNotification, 10)
+
+	interval := scheduleInterval
+	scheduleInterval = 10 * time.Millisecond
+	defer func() { scheduleInterval = interval }()
+
+	StartScheduler()
+	runShutdownHooks()
+
+	id, err := scheduleNotification(PushNotification{
+		AppID:    AppNameDefault,
+		Platform: PlatFormIos,
+		Tokens:   []string{"aaaaa"},
+		Message:  "Welcome",
+	}, time.Now())
+	assert.NoError(t, err)
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 0, len(QueueNotification))
+
+	// due notification is kept for next start.
+	ok, _ := cancelSchedule(id)
+	assert.True(t, ok)
+}
+
+func TestShutdownStopsRetryTimers(t *testing.T) {
+	PushConf = config.BuildDefaultPushConf()
+	PushConf.Core.ShutdownTimeout = 5
+	app := PushConf.Apps[AppNameDefault]
+	app.Retry.MaxRetry = 1
+	app.Retry.BaseDelay = time.Minute
+	app.Retry.MaxDelay = time.Minute
+	PushConf.Apps[AppNameDefault] = app
+	InitLog()
+
+	atomic.StoreInt64(&pendingNotifications, 0)
+
+	// no worker reads from this channel.
+	QueueNotification = make(chan PushNotification, 2)
+	defer initTestQueue(t)()
+
+	req := PushNotification{
+		Tokens:   []string{"aaaaaa"},
+		Platform: PlatFormAndroid,
+		Message:  "Welcome",
+		AppID:    AppNameDefault,
+	}
+	assert.True(t, scheduleRetry(req, req.Tokens, 0, nil))
+
+	// shutdown does not wait for retry delay.
+	start := time.Now()
+	Shutdown()
+	assert.True(t, time.Since(start) < time.Second)
+	assert.Equal(t, int64(0), atomic.LoadInt64(&pendingNotifications))
+	assert.Equal(t, 0, len(QueueNotification))
+
+	// retry is resent on restart.
+	assert.NoError(t, InitQueue())
+	assert.Len(t, pendingQueueIDs(t), 1)
+}
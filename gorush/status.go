@@ -1,15 +1,18 @@
 package gorush
 
 import (
+	"context"
 	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/lalit-verma/gorush/storage/boltdb"
 	"github.com/lalit-verma/gorush/storage/buntdb"
 	"github.com/lalit-verma/gorush/storage/leveldb"
 	"github.com/lalit-verma/gorush/storage/memory"
 	"github.com/lalit-verma/gorush/storage/redis"
-	"github.com/gin-gonic/gin"
 	"github.com/thoas/stats"
 )
 
@@ -24,33 +27,157 @@ type StatusApp struct {
 	TotalCount int64         `json:"total_count"`
 	Ios        IosStatus     `json:"ios"`
 	Android    AndroidStatus `json:"android"`
+	AndroidFcm AndroidStatus `json:"android_fcm"`
+
+	Apps         map[string]AppStatus `json:"apps"`
+	Certificates []CertificateStatus  `json:"certificates"`
+	History      *StatHistory         `json:"history,omitempty"`
+}
+
+// AppStatus is push counts of single app
+type AppStatus struct {
+	Ios        IosStatus     `json:"ios"`
+	Android    AndroidStatus `json:"android"`
+	AndroidFcm AndroidStatus `json:"android_fcm"`
 }
 
-// AndroidStatus is android structure
+// AndroidStatus is android structure, Errors is push error count of each
+// provider reason.
 type AndroidStatus struct {
-	PushSuccess int64 `json:"push_success"`
-	PushError   int64 `json:"push_error"`
+	PushSuccess int64            `json:"push_success"`
+	PushError   int64            `json:"push_error"`
+	Errors      map[string]int64 `json:"errors,omitempty"`
 }
 
-// IosStatus is iOS structure
+// IosStatus is iOS structure, Errors is push error count of each provider
+// reason.
 type IosStatus struct {
-	PushSuccess int64 `json:"push_success"`
-	PushError   int64 `json:"push_error"`
+	PushSuccess int64            `json:"push_success"`
+	PushError   int64            `json:"push_error"`
+	Errors      map[string]int64 `json:"errors,omitempty"`
+}
+
+// Counter keys of stat storage.
+const (
+	statTotalCount = "total"
+	statSuccess    = "success"
+	statError      = "error"
+)
+
+// statReasonOther counts errors of reasons not listed in errorReasons.
+const statReasonOther = "other"
+
+// APNs reasons counted in stat.
+// ref: https://github.com/sideshow/apns2/blob/master/response.go
+var apnsErrorReasons = []string{
+	"BadCollapseId",
+	"BadDeviceToken",
+	"BadExpirationDate",
+	"BadMessageId",
+	"BadPriority",
+	"BadTopic",
+	"DeviceTokenNotForTopic",
+	"DuplicateHeaders",
+	"IdleTimeout",
+	"MissingDeviceToken",
+	"MissingTopic",
+	"PayloadEmpty",
+	"TopicDisallowed",
+	"BadCertificate",
+	"BadCertificateEnvironment",
+	"ExpiredProviderToken",
+	"Forbidden",
+	"InvalidProviderToken",
+	"MissingProviderToken",
+	"BadPath",
+	"MethodNotAllowed",
+	"Unregistered",
+	"PayloadTooLarge",
+	"TooManyProviderTokenUpdates",
+	"TooManyRequests",
+	"InternalServerError",
+	"ServiceUnavailable",
+	"Shutdown",
+}
+
+// GCM and FCM errors counted in stat.
+// ref: https://firebase.google.com/docs/cloud-messaging/http-server-ref#error-codes
+var gcmErrorReasons = []string{
+	"MissingRegistration",
+	"InvalidRegistration",
+	"NotRegistered",
+	"InvalidPackageName",
+	"MismatchSenderId",
+	"MessageTooBig",
+	"InvalidDataKey",
+	"InvalidTtl",
+	"Unavailable",
+	"InternalServerError",
+	"DeviceMessageRateExceeded",
+	"TopicsMessageRateExceeded",
+	"InvalidApnsCredential",
+}
+
+// errorReasons returns error reasons of platform counted in stat.
+func errorReasons(platform int) []string {
+	reasons := []string{reasonRequestError, reasonMissingResult, statReasonOther}
+
+	switch platform {
+	case PlatFormIos:
+		return append(reasons, apnsErrorReasons...)
+	case PlatFormAndroid, PlatFormAndroidFcm:
+		return append(reasons, gcmErrorReasons...)
+	}
+
+	return reasons
+}
+
+// errorReason returns reason as counted in stat, unknown reason is
+// statReasonOther.
+func errorReason(platform int, reason string) string {
+	for _, r := range errorReasons(platform) {
+		if r == reason {
+			return reason
+		}
+	}
+
+	return statReasonOther
+}
+
+// platformStatKey is counter key prefix of each platform.
+var platformStatKey = map[int]string{
+	PlatFormIos:        "ios",
+	PlatFormAndroid:    "android",
+	PlatFormAndroidFcm: "android-fcm",
+}
+
+func platformCounterKey(platform int, kind string) string {
+	return platformStatKey[platform] + "-" + kind
+}
+
+func appCounterKey(appID string, platform int, kind string) string {
+	return "app-" + appID + "-" + typeForPlatForm(platform) + "-" + kind
+}
+
+func appReasonCounterKey(appID string, platform int, reason string) string {
+	return appCounterKey(appID, platform, statError) + "-" + reason
 }
 
 // InitAppStatus for initialize app status
 func InitAppStatus() error {
+	var statStorage Storage
+
 	switch PushConf.Stat.Engine {
 	case "memory":
-		StatStorage = memory.New()
+		statStorage = memory.New()
 	case "redis":
-		StatStorage = redis.New(PushConf)
+		statStorage = redis.New(PushConf)
 	case "boltdb":
-		StatStorage = boltdb.New(PushConf)
+		statStorage = boltdb.New(PushConf)
 	case "buntdb":
-		StatStorage = buntdb.New(PushConf)
+		statStorage = buntdb.New(PushConf)
 	case "leveldb":
-		StatStorage = leveldb.New(PushConf)
+		statStorage = leveldb.New(PushConf)
 	default:
 		err := errors.New("can't find storage driver")
 		if err != nil {
@@ -59,6 +186,14 @@ func InitAppStatus() error {
 		}
 	}
 
+	// engines keep their handle open, release the previous one first.
+	if StatStorage != nil {
+		if err := StatStorage.Close(); err != nil {
+			LogError.Error("storage error: " + err.Error())
+		}
+	}
+	StatStorage = statStorage
+
 	if err := StatStorage.Init(); err != nil {
 		LogError.Error("storage error: " + err.Error())
 
@@ -68,21 +203,255 @@ func InitAppStatus() error {
 	return nil
 }
 
-func appStatusHandler(c *gin.Context) {
+// incrStat adds counts to stat storage in one batch.
+func incrStat(counts map[string]int64) {
+	if err := StatStorage.Incr(context.Background(), counts); err != nil {
+		LogError.Error("storage error: " + err.Error())
+	}
+}
+
+// getStat returns counters of keys, missing or unreadable counter is zero.
+func getStat(keys ...string) map[string]int64 {
+	counts, err := StatStorage.Counters(context.Background(), keys...)
+	if err != nil {
+		LogError.Error("storage error: " + err.Error())
+	}
+
+	return counts
+}
+
+// addTotalCount records count of queued notifications.
+func addTotalCount(count int64) {
+	incrStat(map[string]int64{statTotalCount: count})
+}
+
+func addPushCount(platform int, appID, kind, reason string, count int64) {
+	if appID == "" {
+		appID = AppNameDefault
+	}
+
+	counts := map[string]int64{
+		appCounterKey(appID, platform, kind): count,
+	}
+	if reason != "" {
+		counts[appReasonCounterKey(appID, platform, reason)] = count
+	}
+	if _, ok := platformStatKey[platform]; ok {
+		counts[platformCounterKey(platform, kind)] = count
+	}
+	addHistoryCounts(counts, appID, platform, kind, count, time.Now())
+
+	incrStat(counts)
+}
+
+// addPushSuccess records success count of platform and app.
+func addPushSuccess(platform int, appID string, count int64) {
+	addPushCount(platform, appID, statSuccess, "", count)
+}
+
+// addPushError records error count of platform and app, and of the provider
+// reason in app.
+func addPushError(platform int, appID, reason string, count int64) {
+	addPushCount(platform, appID, statError, errorReason(platform, reason), count)
+}
+
+// appErrorCounts returns non-zero error counts of each reason of app, nil
+// if none.
+func appErrorCounts(counts map[string]int64, appID string, platform int) map[string]int64 {
+	var reasons map[string]int64
+	for _, reason := range errorReasons(platform) {
+		if count := counts[appReasonCounterKey(appID, platform, reason)]; count > 0 {
+			if reasons == nil {
+				reasons = make(map[string]int64)
+			}
+			reasons[reason] = count
+		}
+	}
+
+	return reasons
+}
+
+// sumErrorCounts adds counts of each reason to total.
+func sumErrorCounts(total map[string]int64, counts map[string]int64) map[string]int64 {
+	for reason, count := range counts {
+		if total == nil {
+			total = make(map[string]int64)
+		}
+		total[reason] += count
+	}
+
+	return total
+}
+
+// pushStatus returns push counts of all platforms and of each app in config,
+// all counters are read in one call.
+func pushStatus() StatusApp {
+	platforms := []int{PlatFormIos, PlatFormAndroid, PlatFormAndroidFcm}
+
+	keys := []string{statTotalCount}
+	for _, platform := range platforms {
+		keys = append(keys, platformCounterKey(platform, statSuccess), platformCounterKey(platform, statError))
+		for appID := range PushConf.Apps {
+			keys = append(keys, appCounterKey(appID, platform, statSuccess), appCounterKey(appID, platform, statError))
+			for _, reason := range errorReasons(platform) {
+				keys = append(keys, appReasonCounterKey(appID, platform, reason))
+			}
+		}
+	}
+
+	counts := getStat(keys...)
+
 	result := StatusApp{}
+	result.TotalCount = counts[statTotalCount]
+	result.Ios.PushSuccess = counts[platformCounterKey(PlatFormIos, statSuccess)]
+	result.Ios.PushError = counts[platformCounterKey(PlatFormIos, statError)]
+	result.Android.PushSuccess = counts[platformCounterKey(PlatFormAndroid, statSuccess)]
+	result.Android.PushError = counts[platformCounterKey(PlatFormAndroid, statError)]
+	result.AndroidFcm.PushSuccess = counts[platformCounterKey(PlatFormAndroidFcm, statSuccess)]
+	result.AndroidFcm.PushError = counts[platformCounterKey(PlatFormAndroidFcm, statError)]
+
+	result.Apps = make(map[string]AppStatus, len(PushConf.Apps))
+	for appID := range PushConf.Apps {
+		var status AppStatus
+		status.Ios.PushSuccess = counts[appCounterKey(appID, PlatFormIos, statSuccess)]
+		status.Ios.PushError = counts[appCounterKey(appID, PlatFormIos, statError)]
+		status.Android.PushSuccess = counts[appCounterKey(appID, PlatFormAndroid, statSuccess)]
+		status.Android.PushError = counts[appCounterKey(appID, PlatFormAndroid, statError)]
+		status.AndroidFcm.PushSuccess = counts[appCounterKey(appID, PlatFormAndroidFcm, statSuccess)]
+		status.AndroidFcm.PushError = counts[appCounterKey(appID, PlatFormAndroidFcm, statError)]
+		status.Ios.Errors = appErrorCounts(counts, appID, PlatFormIos)
+		status.Android.Errors = appErrorCounts(counts, appID, PlatFormAndroid)
+		status.AndroidFcm.Errors = appErrorCounts(counts, appID, PlatFormAndroidFcm)
+		result.Apps[appID] = status
+
+		result.Ios.Errors = sumErrorCounts(result.Ios.Errors, status.Ios.Errors)
+		result.Android.Errors = sumErrorCounts(result.Android.Errors, status.Android.Errors)
+		result.AndroidFcm.Errors = sumErrorCounts(result.AndroidFcm.Errors, status.AndroidFcm.Errors)
+	}
+
+	return result
+}
+
+// statHistoryQuery returns history of from, to and granularity query, nil
+// if none of them is set.
+func statHistoryQuery(c *gin.Context) (*StatHistory, error) {
+	if c.Query("from") == "" && c.Query("to") == "" && c.Query("granularity") == "" {
+		return nil, nil
+	}
+
+	granularity := c.DefaultQuery("granularity", GranularityHour)
+	seconds := historySeconds(granularity)
+	if seconds == 0 {
+		return nil, errors.New("granularity must be minute, hour or day")
+	}
+
+	to := time.Now().Unix()
+	if value := c.Query("to"); value != "" {
+		var err error
+		if to, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return nil, errors.New("to must be unix time")
+		}
+	}
+
+	// last 24 buckets by default
+	from := to - 23*seconds
+	if value := c.Query("from"); value != "" {
+		var err error
+		if from, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return nil, errors.New("from must be unix time")
+		}
+	}
+
+	return pushHistory(granularity, from, to)
+}
+
+func appStatusHandler(c *gin.Context) {
+	history, err := statHistoryQuery(c)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result := pushStatus()
+	result.History = history
 
 	result.Version = GetVersion()
 	result.QueueMax = cap(QueueNotification)
 	result.QueueUsage = len(QueueNotification)
-	result.TotalCount = StatStorage.GetTotalCount()
-	result.Ios.PushSuccess = StatStorage.GetIosSuccess()
-	result.Ios.PushError = StatStorage.GetIosError()
-	result.Android.PushSuccess = StatStorage.GetAndroidSuccess()
-	result.Android.PushError = StatStorage.GetAndroidError()
+	result.Certificates = certificateStatus()
+
+	if apiKey := requestAPIKey(c); apiKey != nil && len(apiKey.Apps) > 0 {
+		limitStatusApps(&result, apiKey)
+	}
 
 	c.JSON(http.StatusOK, result)
 }
 
+func addIosStatus(total, status IosStatus) IosStatus {
+	total.PushSuccess += status.PushSuccess
+	total.PushError += status.PushError
+	total.Errors = sumErrorCounts(total.Errors, status.Errors)
+
+	return total
+}
+
+func addAndroidStatus(total, status AndroidStatus) AndroidStatus {
+	total.PushSuccess += status.PushSuccess
+	total.PushError += status.PushError
+	total.Errors = sumErrorCounts(total.Errors, status.Errors)
+
+	return total
+}
+
+// limitAppStatus returns counts of apps which api key can access and their
+// sum.
+func limitAppStatus(apps map[string]AppStatus, apiKey *APIKey) (map[string]AppStatus, AppStatus) {
+	var total AppStatus
+	limited := make(map[string]AppStatus)
+
+	for appID, status := range apps {
+		if !apiKey.AllowApp(appID) {
+			continue
+		}
+
+		limited[appID] = status
+		total.Ios = addIosStatus(total.Ios, status.Ios)
+		total.Android = addAndroidStatus(total.Android, status.Android)
+		total.AndroidFcm = addAndroidStatus(total.AndroidFcm, status.AndroidFcm)
+	}
+
+	return limited, total
+}
+
+// limitStatusApps removes apps which api key can't access from status,
+// platform totals and total count are counted from the remaining apps.
+func limitStatusApps(status *StatusApp, apiKey *APIKey) {
+	var total AppStatus
+	status.Apps, total = limitAppStatus(status.Apps, apiKey)
+	status.Ios, status.Android, status.AndroidFcm = total.Ios, total.Android, total.AndroidFcm
+	status.TotalCount = total.Ios.PushSuccess + total.Ios.PushError +
+		total.Android.PushSuccess + total.Android.PushError +
+		total.AndroidFcm.PushSuccess + total.AndroidFcm.PushError
+
+	certificates := []CertificateStatus{}
+	for _, certificate := range status.Certificates {
+		if apiKey.AllowApp(certificate.AppID) {
+			certificates = append(certificates, certificate)
+		}
+	}
+	status.Certificates = certificates
+
+	if status.History == nil {
+		return
+	}
+
+	for i, point := range status.History.Points {
+		point.Apps, total = limitAppStatus(point.Apps, apiKey)
+		point.Ios, point.Android, point.AndroidFcm = total.Ios, total.Android, total.AndroidFcm
+		status.History.Points[i] = point
+	}
+}
+
 func sysStatsHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, Stats.Data())
 }
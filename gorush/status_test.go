@@ -1,10 +1,14 @@
 package gorush
 
 import (
+	"context"
+	"net/http"
 	"testing"
 	"time"
 
+	"github.com/buger/jsonparser"
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/appleboy/gofight.v2"
 )
 
 func TestStorageDriverExist(t *testing.T) {
@@ -21,22 +25,28 @@ func TestStatForMemoryEngine(t *testing.T) {
 	PushConf.Stat.Engine = "memory"
 	InitAppStatus()
 
-	StatStorage.AddTotalCount(100)
-	StatStorage.AddIosSuccess(200)
-	StatStorage.AddIosError(300)
-	StatStorage.AddAndroidSuccess(400)
-	StatStorage.AddAndroidError(500)
+	addTotalCount(100)
+	addPushSuccess(PlatFormIos, "", 200)
+	addPushError(PlatFormIos, "", "", 300)
+	addPushSuccess(PlatFormAndroid, "", 400)
+	addPushError(PlatFormAndroid, "", "", 500)
+	addPushSuccess(PlatFormAndroidFcm, "", 600)
+	addPushError(PlatFormAndroidFcm, "", "", 700)
 
-	val = StatStorage.GetTotalCount()
+	val = pushStatus().TotalCount
 	assert.Equal(t, int64(100), val)
-	val = StatStorage.GetIosSuccess()
+	val = pushStatus().Ios.PushSuccess
 	assert.Equal(t, int64(200), val)
-	val = StatStorage.GetIosError()
+	val = pushStatus().Ios.PushError
 	assert.Equal(t, int64(300), val)
-	val = StatStorage.GetAndroidSuccess()
+	val = pushStatus().Android.PushSuccess
 	assert.Equal(t, int64(400), val)
-	val = StatStorage.GetAndroidError()
+	val = pushStatus().Android.PushError
 	assert.Equal(t, int64(500), val)
+	val = pushStatus().AndroidFcm.PushSuccess
+	assert.Equal(t, int64(600), val)
+	val = pushStatus().AndroidFcm.PushError
+	assert.Equal(t, int64(700), val)
 }
 
 func TestRedisServerSuccess(t *testing.T) {
@@ -63,25 +73,30 @@ func TestStatForRedisEngine(t *testing.T) {
 	PushConf.Stat.Redis.Addr = "localhost:6379"
 	InitAppStatus()
 
-	StatStorage.Init()
-	StatStorage.Reset()
+	StatStorage.Reset(context.Background())
 
-	StatStorage.AddTotalCount(100)
-	StatStorage.AddIosSuccess(200)
-	StatStorage.AddIosError(300)
-	StatStorage.AddAndroidSuccess(400)
-	StatStorage.AddAndroidError(500)
+	addTotalCount(100)
+	addPushSuccess(PlatFormIos, "", 200)
+	addPushError(PlatFormIos, "", "", 300)
+	addPushSuccess(PlatFormAndroid, "", 400)
+	addPushError(PlatFormAndroid, "", "", 500)
+	addPushSuccess(PlatFormAndroidFcm, "", 600)
+	addPushError(PlatFormAndroidFcm, "", "", 700)
 
-	val = StatStorage.GetTotalCount()
+	val = pushStatus().TotalCount
 	assert.Equal(t, int64(100), val)
-	val = StatStorage.GetIosSuccess()
+	val = pushStatus().Ios.PushSuccess
 	assert.Equal(t, int64(200), val)
-	val = StatStorage.GetIosError()
+	val = pushStatus().Ios.PushError
 	assert.Equal(t, int64(300), val)
-	val = StatStorage.GetAndroidSuccess()
+	val = pushStatus().Android.PushSuccess
 	assert.Equal(t, int64(400), val)
-	val = StatStorage.GetAndroidError()
+	val = pushStatus().Android.PushError
 	assert.Equal(t, int64(500), val)
+	val = pushStatus().AndroidFcm.PushSuccess
+	assert.Equal(t, int64(600), val)
+	val = pushStatus().AndroidFcm.PushError
+	assert.Equal(t, int64(700), val)
 }
 
 func TestDefaultEngine(t *testing.T) {
@@ -89,24 +104,30 @@ func TestDefaultEngine(t *testing.T) {
 	// defaul engine as memory
 	InitAppStatus()
 
-	StatStorage.Reset()
+	StatStorage.Reset(context.Background())
 
-	StatStorage.AddTotalCount(100)
-	StatStorage.AddIosSuccess(200)
-	StatStorage.AddIosError(300)
-	StatStorage.AddAndroidSuccess(400)
-	StatStorage.AddAndroidError(500)
+	addTotalCount(100)
+	addPushSuccess(PlatFormIos, "", 200)
+	addPushError(PlatFormIos, "", "", 300)
+	addPushSuccess(PlatFormAndroid, "", 400)
+	addPushError(PlatFormAndroid, "", "", 500)
+	addPushSuccess(PlatFormAndroidFcm, "", 600)
+	addPushError(PlatFormAndroidFcm, "", "", 700)
 
-	val = StatStorage.GetTotalCount()
+	val = pushStatus().TotalCount
 	assert.Equal(t, int64(100), val)
-	val = StatStorage.GetIosSuccess()
+	val = pushStatus().Ios.PushSuccess
 	assert.Equal(t, int64(200), val)
-	val = StatStorage.GetIosError()
+	val = pushStatus().Ios.PushError
 	assert.Equal(t, int64(300), val)
-	val = StatStorage.GetAndroidSuccess()
+	val = pushStatus().Android.PushSuccess
 	assert.Equal(t, int64(400), val)
-	val = StatStorage.GetAndroidError()
+	val = pushStatus().Android.PushError
 	assert.Equal(t, int64(500), val)
+	val = pushStatus().AndroidFcm.PushSuccess
+	assert.Equal(t, int64(600), val)
+	val = pushStatus().AndroidFcm.PushError
+	assert.Equal(t, int64(700), val)
 }
 
 func TestStatForBoltDBEngine(t *testing.T) {
@@ -114,24 +135,30 @@ func TestStatForBoltDBEngine(t *testing.T) {
 	PushConf.Stat.Engine = "boltdb"
 	InitAppStatus()
 
-	StatStorage.Reset()
+	StatStorage.Reset(context.Background())
 
-	StatStorage.AddTotalCount(100)
-	StatStorage.AddIosSuccess(200)
-	StatStorage.AddIosError(300)
-	StatStorage.AddAndroidSuccess(400)
-	StatStorage.AddAndroidError(500)
+	addTotalCount(100)
+	addPushSuccess(PlatFormIos, "", 200)
+	addPushError(PlatFormIos, "", "", 300)
+	addPushSuccess(PlatFormAndroid, "", 400)
+	addPushError(PlatFormAndroid, "", "", 500)
+	addPushSuccess(PlatFormAndroidFcm, "", 600)
+	addPushError(PlatFormAndroidFcm, "", "", 700)
 
-	val = StatStorage.GetTotalCount()
+	val = pushStatus().TotalCount
 	assert.Equal(t, int64(100), val)
-	val = StatStorage.GetIosSuccess()
+	val = pushStatus().Ios.PushSuccess
 	assert.Equal(t, int64(200), val)
-	val = StatStorage.GetIosError()
+	val = pushStatus().Ios.PushError
 	assert.Equal(t, int64(300), val)
-	val = StatStorage.GetAndroidSuccess()
+	val = pushStatus().Android.PushSuccess
 	assert.Equal(t, int64(400), val)
-	val = StatStorage.GetAndroidError()
+	val = pushStatus().Android.PushError
 	assert.Equal(t, int64(500), val)
+	val = pushStatus().AndroidFcm.PushSuccess
+	assert.Equal(t, int64(600), val)
+	val = pushStatus().AndroidFcm.PushError
+	assert.Equal(t, int64(700), val)
 }
 
 func TestStatForBuntDBEngine(t *testing.T) {
@@ -139,47 +166,125 @@ func TestStatForBuntDBEngine(t *testing.T) {
 	PushConf.Stat.Engine = "buntdb"
 	InitAppStatus()
 
-	StatStorage.Reset()
+	StatStorage.Reset(context.Background())
 
-	StatStorage.AddTotalCount(100)
-	StatStorage.AddIosSuccess(200)
-	StatStorage.AddIosError(300)
-	StatStorage.AddAndroidSuccess(400)
-	StatStorage.AddAndroidError(500)
+	addTotalCount(100)
+	addPushSuccess(PlatFormIos, "", 200)
+	addPushError(PlatFormIos, "", "", 300)
+	addPushSuccess(PlatFormAndroid, "", 400)
+	addPushError(PlatFormAndroid, "", "", 500)
+	addPushSuccess(PlatFormAndroidFcm, "", 600)
+	addPushError(PlatFormAndroidFcm, "", "", 700)
 
-	val = StatStorage.GetTotalCount()
+	val = pushStatus().TotalCount
 	assert.Equal(t, int64(100), val)
-	val = StatStorage.GetIosSuccess()
+	val = pushStatus().Ios.PushSuccess
 	assert.Equal(t, int64(200), val)
-	val = StatStorage.GetIosError()
+	val = pushStatus().Ios.PushError
 	assert.Equal(t, int64(300), val)
-	val = StatStorage.GetAndroidSuccess()
+	val = pushStatus().Android.PushSuccess
 	assert.Equal(t, int64(400), val)
-	val = StatStorage.GetAndroidError()
+	val = pushStatus().Android.PushError
 	assert.Equal(t, int64(500), val)
+	val = pushStatus().AndroidFcm.PushSuccess
+	assert.Equal(t, int64(600), val)
+	val = pushStatus().AndroidFcm.PushError
+	assert.Equal(t, int64(700), val)
 }
 
-// func TestStatForLevelDBEngine(t *testing.T) {
-// 	var val int64
-// 	PushConf.Stat.Engine = "leveldb"
-// 	InitAppStatus()
-
-// 	StatStorage.Reset()
-
-// 	StatStorage.AddTotalCount(100)
-// 	StatStorage.AddIosSuccess(200)
-// 	StatStorage.AddIosError(300)
-// 	StatStorage.AddAndroidSuccess(400)
-// 	StatStorage.AddAndroidError(500)
-
-// 	val = StatStorage.GetTotalCount()
-// 	assert.Equal(t, int64(100), val)
-// 	val = StatStorage.GetIosSuccess()
-// 	assert.Equal(t, int64(200), val)
-// 	val = StatStorage.GetIosError()
-// 	assert.Equal(t, int64(300), val)
-// 	val = StatStorage.GetAndroidSuccess()
-// 	assert.Equal(t, int64(400), val)
-// 	val = StatStorage.GetAndroidError()
-// 	assert.Equal(t, int64(500), val)
-// }
+func TestStatForLevelDBEngine(t *testing.T) {
+	var val int64
+	PushConf.Stat.Engine = "leveldb"
+	InitAppStatus()
+
+	StatStorage.Reset(context.Background())
+
+	addTotalCount(100)
+	addPushSuccess(PlatFormIos, "", 200)
+	addPushError(PlatFormIos, "", "", 300)
+	addPushSuccess(PlatFormAndroid, "", 400)
+	addPushError(PlatFormAndroid, "", "", 500)
+	addPushSuccess(PlatFormAndroidFcm, "", 600)
+	addPushError(PlatFormAndroidFcm, "", "", 700)
+
+	val = pushStatus().TotalCount
+	assert.Equal(t, int64(100), val)
+	val = pushStatus().Ios.PushSuccess
+	assert.Equal(t, int64(200), val)
+	val = pushStatus().Ios.PushError
+	assert.Equal(t, int64(300), val)
+	val = pushStatus().Android.PushSuccess
+	assert.Equal(t, int64(400), val)
+	val = pushStatus().Android.PushError
+	assert.Equal(t, int64(500), val)
+	val = pushStatus().AndroidFcm.PushSuccess
+	assert.Equal(t, int64(600), val)
+	val = pushStatus().AndroidFcm.PushError
+	assert.Equal(t, int64(700), val)
+}
+
+func TestAppStatus(t *testing.T) {
+	initTest()
+	InitLog()
+	InitAppStatus()
+
+	addPushSuccess(PlatFormAndroidFcm, "", 2)
+	addPushError(PlatFormIos, AppNameDefault, "BadDeviceToken", 1)
+
+	assert.Equal(t, int64(2), pushStatus().AndroidFcm.PushSuccess)
+	assert.Equal(t, int64(1), pushStatus().Ios.PushError)
+
+	apps := pushStatus().Apps
+	assert.Len(t, apps, len(PushConf.Apps))
+	assert.Equal(t, int64(2), apps[AppNameDefault].AndroidFcm.PushSuccess)
+	assert.Equal(t, int64(1), apps[AppNameDefault].Ios.PushError)
+	assert.Equal(t, int64(0), apps[AppNameDefault].Android.PushSuccess)
+
+	r := gofight.New()
+
+	r.GET("/api/stat/app").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			data := []byte(r.Body.String())
+			value, _ := jsonparser.GetInt(data, "apps", AppNameDefault, "android_fcm", "push_success")
+
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Equal(t, int64(2), value)
+		})
+
+	r.GET("/metrics").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Contains(t, r.Body.String(), `gorush_app_success{app="normal",platform="android_fcm"} 2`)
+			assert.Contains(t, r.Body.String(), `gorush_app_fail{app="normal",platform="ios"} 1`)
+		})
+}
+
+func TestErrorReasonStatus(t *testing.T) {
+	initTest()
+	InitLog()
+	InitAppStatus()
+
+	addPushError(PlatFormIos, AppNameDefault, "TooManyRequests", 2)
+	addPushError(PlatFormIos, AppNameDefault, "UnknownReason", 1)
+	addPushError(PlatFormAndroid, AppNameDefault, "MismatchSenderId", 3)
+
+	status := pushStatus()
+	app := status.Apps[AppNameDefault]
+	assert.Equal(t, int64(2), app.Ios.Errors["TooManyRequests"])
+	assert.Equal(t, int64(1), app.Ios.Errors[statReasonOther])
+	assert.Equal(t, int64(3), app.Android.Errors["MismatchSenderId"])
+	assert.Nil(t, app.AndroidFcm.Errors)
+	assert.Equal(t, int64(2), status.Ios.Errors["TooManyRequests"])
+	assert.Equal(t, int64(3), status.Android.Errors["MismatchSenderId"])
+
+	r := gofight.New()
+
+	r.GET("/api/stat/app").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			data := []byte(r.Body.String())
+			value, _ := jsonparser.GetInt(data, "apps", AppNameDefault, "ios", "errors", "TooManyRequests")
+
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Equal(t, int64(2), value)
+		})
+}
@@ -0,0 +1,181 @@
+package gorush
+
+import (
+	"errors"
+	"strings"
+)
+
+// tagExpr is parsed tag expression like "news && (en || fr) && !beta".
+type tagExpr interface {
+	match(tags map[string]bool) bool
+}
+
+type tagName string
+
+func (t tagName) match(tags map[string]bool) bool {
+	return tags[string(t)]
+}
+
+type tagNot struct {
+	expr tagExpr
+}
+
+func (t tagNot) match(tags map[string]bool) bool {
+	return !t.expr.match(tags)
+}
+
+type tagAnd struct {
+	left, right tagExpr
+}
+
+func (t tagAnd) match(tags map[string]bool) bool {
+	return t.left.match(tags) && t.right.match(tags)
+}
+
+type tagOr struct {
+	left, right tagExpr
+}
+
+func (t tagOr) match(tags map[string]bool) bool {
+	return t.left.match(tags) || t.right.match(tags)
+}
+
+// tagParser is recursive descent parser of tag expression:
+//
+//	or    = and { "||" and }
+//	and   = unary { "&&" unary }
+//	unary = "!" unary | "(" or ")" | name
+type tagParser struct {
+	tokens []string
+	pos    int
+}
+
+func isTagChar(r rune) bool {
+	return r == '_' || r == '-' || r == '.' || r == ':' ||
+		(r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
+
+func splitTagExpr(s string) ([]string, error) {
+	var tokens []string
+
+	for i := 0; i < len(s); {
+		switch {
+		case s[i] == ' ' || s[i] == '\t':
+			i++
+		case strings.HasPrefix(s[i:], "&&"), strings.HasPrefix(s[i:], "||"):
+			tokens = append(tokens, s[i:i+2])
+			i += 2
+		case s[i] == '!' || s[i] == '(' || s[i] == ')':
+			tokens = append(tokens, s[i:i+1])
+			i++
+		case isTagChar(rune(s[i])):
+			start := i
+			for i < len(s) && isTagChar(rune(s[i])) {
+				i++
+			}
+			tokens = append(tokens, s[start:i])
+		default:
+			return nil, errors.New("invalid character in tag expression: " + s[i:i+1])
+		}
+	}
+
+	return tokens, nil
+}
+
+// parseTagExpr parses tag expression with &&, ||, ! and parentheses.
+func parseTagExpr(s string) (tagExpr, error) {
+	tokens, err := splitTagExpr(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 {
+		return nil, errors.New("empty tag expression")
+	}
+
+	p := &tagParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, errors.New("unexpected " + p.tokens[p.pos] + " in tag expression")
+	}
+
+	return expr, nil
+}
+
+func (p *tagParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+
+	return ""
+}
+
+func (p *tagParser) parseOr() (tagExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "||" {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = tagOr{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *tagParser) parseAnd() (tagExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "&&" {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = tagAnd{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *tagParser) parseUnary() (tagExpr, error) {
+	token := p.peek()
+	p.pos++
+
+	switch token {
+	case "":
+		return nil, errors.New("unexpected end of tag expression")
+	case "!":
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return tagNot{expr}, nil
+	case "(":
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, errors.New("missing ) in tag expression")
+		}
+		p.pos++
+		return expr, nil
+	case ")", "&&", "||":
+		return nil, errors.New("unexpected " + token + " in tag expression")
+	}
+
+	return tagName(token), nil
+}
@@ -0,0 +1,37 @@
+package gorush
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTagExpr(t *testing.T) {
+	tags := map[string]bool{"news": true, "en": true, "beta": true}
+
+	tests := map[string]bool{
+		"news":                      true,
+		"sport":                     false,
+		"!sport":                    true,
+		"news && en":                true,
+		"news && !beta":             false,
+		"sport || en":               true,
+		"news && (fr || en)":        true,
+		"news && !(beta || sport)":  false,
+		"sport || news && en":       true,
+		"(sport || news) && !en":    false,
+		"lang:en || region.tw-east": false,
+	}
+
+	for s, expected := range tests {
+		expr, err := parseTagExpr(s)
+		if assert.NoError(t, err, s) {
+			assert.Equal(t, expected, expr.match(tags), s)
+		}
+	}
+
+	for _, s := range []string{"", "news &&", "(news", "news)", "news || || en", "news & en", "news en"} {
+		_, err := parseTagExpr(s)
+		assert.Error(t, err, s)
+	}
+}
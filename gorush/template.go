@@ -0,0 +1,403 @@
+package gorush
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/lalit-verma/gorush/config"
+)
+
+// templateBucket is the storage bucket of templates registered by api.
+const templateBucket = "template"
+
+// Source of notification template.
+const (
+	TemplateSourceConfig = "config"
+	TemplateSourceAPI    = "api"
+)
+
+// parsedTemplates caches parsed texts of each template by app and template
+// name, entry is replaced when the template is changed.
+var parsedTemplates = struct {
+	sync.RWMutex
+	templates map[string]map[string]*template.Template
+}{templates: make(map[string]map[string]*template.Template)}
+
+// RequestTemplate is the body of template register request.
+type RequestTemplate struct {
+	AppID    string                 `json:"app_id"`
+	Name     string                 `json:"name" binding:"required"`
+	Template config.SectionTemplate `json:"template"`
+}
+
+// NotificationTemplate is named template of app with its source.
+type NotificationTemplate struct {
+	AppID    string                 `json:"app_id"`
+	Name     string                 `json:"name"`
+	Source   string                 `json:"source"`
+	Template config.SectionTemplate `json:"template"`
+}
+
+func templateKey(appID, name string) string {
+	return appID + "/" + name
+}
+
+// findTemplate returns template of app from config, then from templates
+// registered by api. It returns nil if template not exist.
+func findTemplate(appID, name string) (*config.SectionTemplate, error) {
+	if tmpl, ok := PushConf.Apps[appID].Templates[name]; ok {
+		return &tmpl, nil
+	}
+
+	data, err := StatStorage.GetRecord(context.Background(), templateBucket, templateKey(appID, name))
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var tmpl config.SectionTemplate
+	if err := json.Unmarshal(data, &tmpl); err != nil {
+		return nil, err
+	}
+
+	return &tmpl, nil
+}
+
+// listTemplates returns templates of app sorted by name.
+func listTemplates(appID string) ([]NotificationTemplate, error) {
+	templates := []NotificationTemplate{}
+
+	for name, tmpl := range PushConf.Apps[appID].Templates {
+		templates = append(templates, NotificationTemplate{
+			AppID:    appID,
+			Name:     name,
+			Source:   TemplateSourceConfig,
+			Template: tmpl,
+		})
+	}
+
+	err := StatStorage.RangeRecords(context.Background(), templateBucket, appID+"/", "", func(key string, value []byte) bool {
+		var tmpl config.SectionTemplate
+		if err := json.Unmarshal(value, &tmpl); err != nil {
+			LogError.Error("template decode error: " + err.Error())
+			return true
+		}
+
+		templates = append(templates, NotificationTemplate{
+			AppID:    appID,
+			Name:     strings.TrimPrefix(key, appID+"/"),
+			Source:   TemplateSourceAPI,
+			Template: tmpl,
+		})
+		return true
+	})
+
+	sort.Sort(templatesByName(templates))
+
+	return templates, err
+}
+
+type templatesByName []NotificationTemplate
+
+func (t templatesByName) Len() int           { return len(t) }
+func (t templatesByName) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t templatesByName) Less(i, j int) bool { return t[i].Name < t[j].Name }
+
+// saveTemplate validates and stores template registered by api.
+func saveTemplate(form RequestTemplate) error {
+	if strings.Contains(form.Name, "/") {
+		return errors.New("template name can't contain /")
+	}
+
+	if _, ok := PushConf.Apps[form.AppID].Templates[form.Name]; ok {
+		return errors.New("template is defined in config: " + form.Name)
+	}
+
+	if len(form.Template.Locales) == 0 {
+		return errors.New("template has no locale")
+	}
+
+	if form.Template.DefaultLocale != "" {
+		if _, ok := form.Template.Locales[form.Template.DefaultLocale]; !ok {
+			return errors.New("default locale is not defined: " + form.Template.DefaultLocale)
+		}
+	}
+
+	texts, err := parseTemplateTexts(&form.Template)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(form.Template)
+	if err != nil {
+		return err
+	}
+
+	key := templateKey(form.AppID, form.Name)
+	if err := StatStorage.SetRecord(context.Background(), templateBucket, key, data); err != nil {
+		return err
+	}
+
+	parsedTemplates.Lock()
+	parsedTemplates.templates[key] = texts
+	parsedTemplates.Unlock()
+
+	return nil
+}
+
+// deleteTemplate removes template registered by api, it returns false if
+// template not exist.
+func deleteTemplate(appID, name string) (bool, error) {
+	data, err := StatStorage.GetRecord(context.Background(), templateBucket, templateKey(appID, name))
+	if err != nil || data == nil {
+		return false, err
+	}
+
+	parsedTemplates.Lock()
+	delete(parsedTemplates.templates, templateKey(appID, name))
+	parsedTemplates.Unlock()
+
+	return true, StatStorage.DeleteRecord(context.Background(), templateBucket, templateKey(appID, name))
+}
+
+func templateTexts(content config.SectionTemplateLocale) []string {
+	texts := []string{
+		content.Title,
+		content.Message,
+		content.Sound,
+		content.Alert.Title,
+		content.Alert.Subtitle,
+		content.Alert.Body,
+		content.Alert.Action,
+		content.Alert.LaunchImage,
+	}
+
+	for _, value := range content.Data {
+		texts = append(texts, value)
+	}
+
+	return texts
+}
+
+// localeChain returns the fallback chain of locale, e.g. zh-Hant-TW falls
+// back to zh-Hant, zh and then default locale of template.
+func localeChain(locale, defaultLocale string) []string {
+	var chain []string
+
+	locale = strings.Replace(locale, "_", "-", -1)
+	for locale != "" {
+		chain = append(chain, locale)
+
+		i := strings.LastIndex(locale, "-")
+		if i < 0 {
+			break
+		}
+		locale = locale[:i]
+	}
+
+	if defaultLocale != "" {
+		chain = append(chain, defaultLocale)
+	}
+
+	return chain
+}
+
+// templateLocale returns the first locale variant in fallback chain, locale
+// is matched case-insensitively.
+func templateLocale(tmpl *config.SectionTemplate, locale string) (config.SectionTemplateLocale, bool) {
+	for _, name := range localeChain(locale, tmpl.DefaultLocale) {
+		if content, ok := tmpl.Locales[name]; ok {
+			return content, true
+		}
+
+		for key, content := range tmpl.Locales {
+			if strings.EqualFold(key, name) {
+				return content, true
+			}
+		}
+	}
+
+	return config.SectionTemplateLocale{}, false
+}
+
+// parseTemplateTexts parses texts of all locales of template.
+func parseTemplateTexts(tmpl *config.SectionTemplate) (map[string]*template.Template, error) {
+	texts := make(map[string]*template.Template)
+
+	for locale, content := range tmpl.Locales {
+		for _, text := range templateTexts(content) {
+			if !strings.Contains(text, "{{") {
+				continue
+			}
+
+			// missing variable is an error instead of printing <no value>.
+			t, err := template.New("").Option("missingkey=error").Parse(text)
+			if err != nil {
+				return nil, errors.New(locale + ": " + err.Error())
+			}
+			texts[text] = t
+		}
+	}
+
+	return texts, nil
+}
+
+// parseTemplate returns parsed text of template stored under key. Texts
+// of template are parsed again if text is not cached, so texts of changed
+// template don't stay in cache.
+func parseTemplate(key string, tmpl *config.SectionTemplate, text string) (*template.Template, error) {
+	parsedTemplates.RLock()
+	t, ok := parsedTemplates.templates[key][text]
+	parsedTemplates.RUnlock()
+
+	if ok {
+		return t, nil
+	}
+
+	texts, err := parseTemplateTexts(tmpl)
+	if err != nil {
+		return nil, err
+	}
+
+	t, ok = texts[text]
+	if !ok {
+		return nil, errors.New("text is not in template: " + key)
+	}
+
+	parsedTemplates.Lock()
+	parsedTemplates.templates[key] = texts
+	parsedTemplates.Unlock()
+
+	return t, nil
+}
+
+func renderText(key string, tmpl *config.SectionTemplate, text string, variables D) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	t, err := parseTemplate(key, tmpl, text)
+	if err != nil {
+		return "", err
+	}
+
+	if variables == nil {
+		variables = D{}
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, map[string]interface{}(variables)); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// renderTemplate returns notification with fields rendered from template of
+// request. Fields set in request are kept, data of template is merged with
+// data of request.
+func renderTemplate(req PushNotification) (PushNotification, error) {
+	if req.Template == "" {
+		return req, nil
+	}
+
+	tmpl, err := findTemplate(req.AppID, req.Template)
+	if err != nil {
+		return req, err
+	}
+
+	if tmpl == nil {
+		return req, errors.New("unknown template: " + req.Template)
+	}
+
+	key := templateKey(req.AppID, req.Template)
+	content, ok := templateLocale(tmpl, req.Locale)
+	if !ok {
+		return req, errors.New("template " + req.Template + " has no locale for: " + req.Locale)
+	}
+
+	fields := []struct {
+		text  string
+		value *string
+	}{
+		{content.Title, &req.Title},
+		{content.Message, &req.Message},
+		{content.Sound, &req.Sound},
+		{content.Alert.Title, &req.Alert.Title},
+		{content.Alert.Subtitle, &req.Alert.Subtitle},
+		{content.Alert.Body, &req.Alert.Body},
+		{content.Alert.Action, &req.Alert.Action},
+		{content.Alert.LaunchImage, &req.Alert.LaunchImage},
+	}
+
+	for _, field := range fields {
+		if field.text == "" || *field.value != "" {
+			continue
+		}
+
+		if *field.value, err = renderText(key, tmpl, field.text, req.Variables); err != nil {
+			return req, err
+		}
+	}
+
+	if len(content.Data) > 0 {
+		data := D{}
+		for k, text := range content.Data {
+			if data[k], err = renderText(key, tmpl, text, req.Variables); err != nil {
+				return req, err
+			}
+		}
+
+		for k, v := range req.Data {
+			data[k] = v
+		}
+		req.Data = data
+	}
+
+	return req, nil
+}
+
+// applyTemplate renders template of notification before building payload.
+// Payload is built as is if template can't be rendered, push functions
+// render template first by pushTemplate and fail the tokens instead.
+func applyTemplate(req PushNotification) PushNotification {
+	rendered, err := renderTemplate(req)
+	if err != nil {
+		LogError.Error("template error: " + err.Error())
+		return req
+	}
+
+	return rendered
+}
+
+// pushTemplate renders template of notification at send time. If template
+// can't be rendered, e.g. it is deleted after notification is queued, all
+// tokens are failed with template_error reason and not sent.
+func pushTemplate(req PushNotification) (PushNotification, map[string]*PushResponse) {
+	rendered, err := renderTemplate(req)
+	if err == nil {
+		// payload builders don't render it again.
+		rendered.Template = ""
+		return rendered, nil
+	}
+
+	LogError.Error("template error: " + err.Error())
+	countPushDrop(req, reasonTemplateError, len(req.Tokens))
+
+	pushResponse := make(map[string]*PushResponse, len(req.Tokens))
+	for _, token := range req.Tokens {
+		pushResponse[token] = &PushResponse{
+			Status: "failed",
+			Reason: reasonTemplateError,
+			Error:  err.Error(),
+		}
+		LogPush(FailedPush, token, req, err)
+	}
+
+	return req, pushResponse
+}
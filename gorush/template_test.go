@@ -0,0 +1,313 @@
+package gorush
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/buger/jsonparser"
+	"github.com/lalit-verma/gorush/config"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/appleboy/gofight.v2"
+)
+
+func initTemplateTest() {
+	initTest()
+	InitLog()
+	InitAppStatus()
+
+	app := PushConf.Apps[AppNameDefault]
+	app.Ios.Enabled = true
+	app.Templates = map[string]config.SectionTemplate{
+		"welcome": {
+			DefaultLocale: "en",
+			Locales: map[string]config.SectionTemplateLocale{
+				"en": {
+					Title:   "Welcome",
+					Message: "Hello {{.name}}",
+					Sound:   "default",
+					Alert: config.SectionTemplateAlert{
+						Subtitle: "{{.count}} new messages",
+					},
+					Data: map[string]string{
+						"user": "{{.name}}",
+					},
+				},
+				"zh": {
+					Title:   "歡迎",
+					Message: "{{.name}} 你好",
+				},
+			},
+		},
+	}
+	PushConf.Apps[AppNameDefault] = app
+}
+
+func TestLocaleChain(t *testing.T) {
+	assert.Equal(t, []string{"zh-Hant-TW", "zh-Hant", "zh", "en"}, localeChain("zh-Hant-TW", "en"))
+	assert.Equal(t, []string{"pt-BR", "pt"}, localeChain("pt_BR", ""))
+	assert.Equal(t, []string{"en"}, localeChain("", "en"))
+	assert.Empty(t, localeChain("", ""))
+}
+
+func TestRenderTemplate(t *testing.T) {
+	initTemplateTest()
+
+	req := PushNotification{
+		AppID:     AppNameDefault,
+		Platform:  PlatFormIos,
+		Template:  "welcome",
+		Locale:    "zh-Hant-TW",
+		Variables: D{"name": "Bo"},
+	}
+
+	rendered, err := renderTemplate(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "歡迎", rendered.Title)
+	assert.Equal(t, "Bo 你好", rendered.Message)
+
+	// fallback to default locale and keep fields of request
+	req.Locale = "fr-FR"
+	req.Title = "Hi"
+	req.Data = D{"user": "override", "extra": 1}
+	req.Variables = D{"name": "Bo", "count": 3}
+	rendered, err = renderTemplate(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "Hi", rendered.Title)
+	assert.Equal(t, "Hello Bo", rendered.Message)
+	assert.Equal(t, "default", rendered.Sound)
+	assert.Equal(t, "3 new messages", rendered.Alert.Subtitle)
+	assert.Equal(t, "override", rendered.Data["user"])
+	assert.Equal(t, 1, rendered.Data["extra"])
+
+	// missing variable
+	req.Variables = D{"name": "Bo"}
+	_, err = renderTemplate(req)
+	assert.Error(t, err)
+
+	req.Template = "unknown"
+	_, err = renderTemplate(req)
+	assert.Error(t, err)
+
+	// no template
+	req.Template = ""
+	rendered, err = renderTemplate(req)
+	assert.NoError(t, err)
+	assert.Equal(t, req, rendered)
+}
+
+func TestTemplateNotification(t *testing.T) {
+	initTemplateTest()
+
+	req := PushNotification{
+		AppID:     AppNameDefault,
+		Tokens:    []string{"aaaaa"},
+		Template:  "welcome",
+		Locale:    "zh-TW",
+		Variables: D{"name": "Bo"},
+	}
+
+	notification := GetIOSNotification(req)
+	dump, _ := json.Marshal(notification.Payload)
+	title, _ := jsonparser.GetString(dump, "aps", "alert", "title")
+	assert.Equal(t, "歡迎", title)
+
+	android := GetAndroidNotification(req)
+	assert.Equal(t, "Bo 你好", android.Notification.Body)
+	assert.Equal(t, "歡迎", android.Notification.Title)
+
+	fcmNotification, _ := GetFcmNotification(req)
+	assert.Equal(t, "Bo 你好", fcmNotification.Body)
+	assert.Equal(t, "歡迎", fcmNotification.Title)
+}
+
+func TestPushTemplateError(t *testing.T) {
+	initTemplateTest()
+
+	req := PushNotification{
+		AppID:    AppNameDefault,
+		Platform: PlatFormIos,
+		Tokens:   []string{"aaaaa", "bbbbb"},
+		Template: "unknown",
+	}
+
+	// tokens are failed instead of sending raw notification.
+	resp := PushToIOS(req)
+	if assert.Len(t, resp, 2) {
+		assert.Equal(t, "failed", resp["aaaaa"].Status)
+		assert.Equal(t, reasonTemplateError, resp["bbbbb"].Reason)
+		assert.Equal(t, "unknown template: unknown", resp["bbbbb"].Error)
+	}
+
+	req.Template = "welcome"
+	req.Variables = D{"name": "Bo", "count": 2}
+	rendered, failed := pushTemplate(req)
+	assert.Nil(t, failed)
+	assert.Equal(t, "Welcome", rendered.Title)
+	assert.Equal(t, "", rendered.Template)
+}
+
+func TestParsedTemplatesReplaced(t *testing.T) {
+	initTemplateTest()
+
+	form := RequestTemplate{
+		AppID: AppNameDefault,
+		Name:  "sale",
+		Template: config.SectionTemplate{
+			Locales: map[string]config.SectionTemplateLocale{
+				"en": {Message: "{{.discount}}% off"},
+			},
+		},
+	}
+	assert.NoError(t, saveTemplate(form))
+
+	req := PushNotification{AppID: AppNameDefault, Template: "sale", Locale: "en", Variables: D{"discount": 10}}
+	rendered, err := renderTemplate(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "10% off", rendered.Message)
+
+	// updated template replaces the cached texts.
+	form.Template.Locales["en"] = config.SectionTemplateLocale{Message: "save {{.discount}}%"}
+	assert.NoError(t, saveTemplate(form))
+
+	rendered, err = renderTemplate(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "save 10%", rendered.Message)
+
+	parsedTemplates.RLock()
+	texts := parsedTemplates.templates[templateKey(AppNameDefault, "sale")]
+	parsedTemplates.RUnlock()
+	assert.Len(t, texts, 1)
+
+	deleted, err := deleteTemplate(AppNameDefault, "sale")
+	assert.True(t, deleted)
+	assert.NoError(t, err)
+
+	parsedTemplates.RLock()
+	_, ok := parsedTemplates.templates[templateKey(AppNameDefault, "sale")]
+	parsedTemplates.RUnlock()
+	assert.False(t, ok)
+}
+
+func TestRedactWhileFindTemplate(t *testing.T) {
+	initTemplateTest()
+
+	// run with -race, redact must not write into maps of live config.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			config.Redact(PushConf)
+			config.Effective(PushConf, ConfSources, false)
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		tmpl, err := findTemplate(AppNameDefault, "welcome")
+		if assert.NoError(t, err) && assert.NotNil(t, tmpl) {
+			assert.Equal(t, "Welcome", tmpl.Locales["en"].Title)
+		}
+	}
+
+	<-done
+}
+
+func TestTemplateHandler(t *testing.T) {
+	initTemplateTest()
+
+	r := gofight.New()
+
+	r.POST("/api/templates").
+		SetJSON(gofight.D{
+			"name": "welcome",
+			"template": gofight.D{
+				"locales": gofight.D{
+					"en": gofight.D{"message": "Hi"},
+				},
+			},
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			msg, _ := jsonparser.GetString([]byte(r.Body.String()), "message")
+
+			assert.Equal(t, http.StatusBadRequest, r.Code)
+			assert.Equal(t, "template is defined in config: welcome", msg)
+		})
+
+	r.POST("/api/templates").
+		SetJSON(gofight.D{
+			"name": "broken",
+			"template": gofight.D{
+				"locales": gofight.D{
+					"en": gofight.D{"message": "Hi {{.name"},
+				},
+			},
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusBadRequest, r.Code)
+		})
+
+	r.POST("/api/templates").
+		SetJSON(gofight.D{
+			"name": "sale",
+			"template": gofight.D{
+				"default_locale": "en",
+				"locales": gofight.D{
+					"en": gofight.D{"message": "{{.discount}}% off"},
+				},
+			},
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+
+	r.GET("/api/templates").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			data := []byte(r.Body.String())
+			first, _ := jsonparser.GetString(data, "templates", "[0]", "name")
+			second, _ := jsonparser.GetString(data, "templates", "[1]", "name")
+			source, _ := jsonparser.GetString(data, "templates", "[0]", "source")
+
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Equal(t, "sale", first)
+			assert.Equal(t, TemplateSourceAPI, source)
+			assert.Equal(t, "welcome", second)
+		})
+
+	rendered, err := renderTemplate(PushNotification{
+		AppID:     AppNameDefault,
+		Template:  "sale",
+		Locale:    "de",
+		Variables: D{"discount": 20},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "20% off", rendered.Message)
+
+	// unknown template is rejected at request time
+	PushConf.Core.Sync = true
+	r.POST("/api/push").
+		SetJSON(gofight.D{
+			"notifications": []gofight.D{
+				{
+					"tokens":   []string{"aaaaa"},
+					"platform": PlatFormIos,
+					"template": "unknown",
+				},
+			},
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			msg, _ := jsonparser.GetString([]byte(r.Body.String()), "results", "[0]", "[0]", "error")
+
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Equal(t, "template error: unknown template: unknown", msg)
+		})
+
+	r.DELETE("/api/templates?name=sale").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+
+	r.DELETE("/api/templates?name=sale").
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusNotFound, r.Code)
+		})
+}
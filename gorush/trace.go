@@ -0,0 +1,525 @@
+package gorush
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// TraceParentHeader carries W3C trace context of incoming request.
+// ref: https://www.w3.org/TR/trace-context/
+const TraceParentHeader = "traceparent"
+
+// Span kinds of OTLP.
+const (
+	spanKindInternal = 1
+	spanKindServer   = 2
+	spanKindClient   = 3
+)
+
+const (
+	traceBatchSize     = 512
+	traceBufferSize    = 4096
+	traceFlushInterval = time.Second
+)
+
+var (
+	// spanTracer exports finished spans, nil if trace is disabled.
+	spanTracer *tracer
+
+	// droppedSpans counts spans dropped because the buffer is full.
+	droppedSpans int64
+
+	traceClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+// spanContext identifies span of a trace, it is carried with notification
+// from request to workers.
+type spanContext struct {
+	TraceID string
+	SpanID  string
+	Sampled bool
+}
+
+func (sc spanContext) valid() bool {
+	return sc.TraceID != "" && sc.SpanID != ""
+}
+
+// traceParent returns traceparent header value of context, empty if invalid.
+func (sc spanContext) traceParent() string {
+	if !sc.valid() {
+		return ""
+	}
+
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+
+	return "00-" + sc.TraceID + "-" + sc.SpanID + "-" + flags
+}
+
+func isLowerHex(value string) bool {
+	for _, c := range value {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseTraceParent returns context of traceparent header, empty if the
+// header is missing or invalid.
+func parseTraceParent(value string) spanContext {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 {
+		return spanContext{}
+	}
+
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+	if len(version) != 2 || !isLowerHex(version) || version == "ff" || (version == "00" && len(parts) != 4) {
+		return spanContext{}
+	}
+
+	if len(traceID) != 32 || !isLowerHex(traceID) || traceID == strings.Repeat("0", 32) {
+		return spanContext{}
+	}
+
+	if len(spanID) != 16 || !isLowerHex(spanID) || spanID == strings.Repeat("0", 16) {
+		return spanContext{}
+	}
+
+	if len(flags) != 2 || !isLowerHex(flags) {
+		return spanContext{}
+	}
+	f, _ := strconv.ParseUint(flags, 16, 8)
+
+	return spanContext{
+		TraceID: traceID,
+		SpanID:  spanID,
+		Sampled: f&1 == 1,
+	}
+}
+
+func newTraceID(size int) string {
+	id := make([]byte, size)
+	rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
+
+// tokenHash returns short sha256 of token, so spans can be matched to a
+// device without exporting the token.
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:8])
+}
+
+// span is a timed operation of trace. All methods are no-op on nil span,
+// which is returned when trace is disabled.
+type span struct {
+	name       string
+	kind       int
+	context    spanContext
+	parentID   string
+	startTime  time.Time
+	endTime    time.Time
+	attributes map[string]interface{}
+	err        string
+}
+
+// startSpan starts child span of parent, or a new trace if parent is empty.
+// Child of unsampled parent is not exported.
+func startSpan(parent spanContext, name string, kind int) *span {
+	if spanTracer == nil {
+		return nil
+	}
+
+	s := &span{
+		name:       name,
+		kind:       kind,
+		startTime:  time.Now(),
+		attributes: make(map[string]interface{}),
+	}
+
+	if parent.valid() {
+		s.context = spanContext{TraceID: parent.TraceID, Sampled: parent.Sampled}
+		s.parentID = parent.SpanID
+	} else {
+		s.context = spanContext{TraceID: newTraceID(16), Sampled: true}
+	}
+	s.context.SpanID = newTraceID(8)
+
+	return s
+}
+
+// spanContext returns context of span, parent of child spans.
+func (s *span) spanContext() spanContext {
+	if s == nil {
+		return spanContext{}
+	}
+
+	return s.context
+}
+
+// setAttribute sets string, int or bool attribute of span.
+func (s *span) setAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+
+	s.attributes[key] = value
+}
+
+// finish ends span with err and sends it to exporter if sampled.
+func (s *span) finish(err error) {
+	if s == nil {
+		return
+	}
+
+	s.endTime = time.Now()
+	if err != nil {
+		s.err = err.Error()
+	}
+
+	if s.context.Sampled {
+		spanTracer.send(s)
+	}
+}
+
+// startPushSpan starts span of provider request of tokens of notification.
+func startPushSpan(req PushNotification, name string, tokens []string) *span {
+	s := startSpan(req.trace, name, spanKindClient)
+	s.setAttribute("gorush.app", req.AppID)
+	s.setAttribute("gorush.platform", typeForPlatForm(req.Platform))
+	s.setAttribute("gorush.tokens", len(tokens))
+	if len(tokens) == 1 {
+		s.setAttribute("gorush.token_hash", tokenHash(tokens[0]))
+	}
+
+	return s
+}
+
+// finishPushSpan ends span of provider request with result and number of
+// failed tokens.
+func finishPushSpan(s *span, result string, failed int, err error) {
+	s.setAttribute("gorush.result", result)
+	s.setAttribute("gorush.failed_tokens", failed)
+	s.finish(err)
+}
+
+// finishTokensSpan ends span with result of tokens in resp.
+func finishTokensSpan(s *span, tokens []string, resp map[string]*PushResponse) {
+	var failed int
+	for _, token := range tokens {
+		if r, ok := resp[token]; !ok || r.Status != "success" {
+			failed++
+		}
+	}
+
+	result := outcomeSuccess
+	if failed > 0 {
+		result = outcomeFailed
+	}
+
+	finishPushSpan(s, result, failed, nil)
+}
+
+// spanExporter sends finished spans to trace backend.
+type spanExporter interface {
+	export(spans []*span) error
+}
+
+// tracer batches finished spans and exports them in background.
+type tracer struct {
+	exporter spanExporter
+	spans    chan *span
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func newTracer(exporter spanExporter) *tracer {
+	t := &tracer{
+		exporter: exporter,
+		spans:    make(chan *span, traceBufferSize),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go t.run()
+
+	return t
+}
+
+// send queues span for export, span is dropped if the buffer is full.
+func (t *tracer) send(s *span) {
+	select {
+	case t.spans <- s:
+	default:
+		atomic.AddInt64(&droppedSpans, 1)
+	}
+}
+
+func (t *tracer) flush(batch []*span) {
+	if len(batch) == 0 {
+		return
+	}
+
+	if err := t.exporter.export(batch); err != nil {
+		LogError.Error("trace error: " + err.Error())
+	}
+}
+
+func (t *tracer) run() {
+	defer close(t.done)
+
+	ticker := time.NewTicker(traceFlushInterval)
+	defer ticker.Stop()
+
+	var batch []*span
+	for {
+		select {
+		case s := <-t.spans:
+			batch = append(batch, s)
+			if len(batch) >= traceBatchSize {
+				t.flush(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			t.flush(batch)
+			batch = nil
+		case <-t.stop:
+			for {
+				select {
+				case s := <-t.spans:
+					batch = append(batch, s)
+				default:
+					t.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// close exports buffered spans, it returns false if they are not exported
+// before timeout.
+func (t *tracer) close(timeout time.Duration) bool {
+	close(t.stop)
+
+	select {
+	case <-t.done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// stdoutSpan is the exported form of span in stdout exporter.
+type stdoutSpan struct {
+	Name       string                 `json:"name"`
+	Kind       int                    `json:"kind"`
+	TraceID    string                 `json:"trace_id"`
+	SpanID     string                 `json:"span_id"`
+	ParentID   string                 `json:"parent_id,omitempty"`
+	Start      time.Time              `json:"start"`
+	End        time.Time              `json:"end"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+// stdoutExporter writes one JSON line of each span.
+type stdoutExporter struct {
+	writer io.Writer
+}
+
+func (e *stdoutExporter) export(spans []*span) error {
+	encoder := json.NewEncoder(e.writer)
+	for _, s := range spans {
+		err := encoder.Encode(stdoutSpan{
+			Name:       s.name,
+			Kind:       s.kind,
+			TraceID:    s.context.TraceID,
+			SpanID:     s.context.SpanID,
+			ParentID:   s.parentID,
+			Start:      s.startTime,
+			End:        s.endTime,
+			Attributes: s.attributes,
+			Error:      s.err,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// OTLP/HTTP JSON request of spans.
+// ref: https://opentelemetry.io/docs/specs/otlp/#otlphttp
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+func otlpValue(value interface{}) map[string]interface{} {
+	switch v := value.(type) {
+	case bool:
+		return map[string]interface{}{"boolValue": v}
+	case int:
+		return map[string]interface{}{"intValue": strconv.Itoa(v)}
+	case int64:
+		return map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+	}
+
+	return map[string]interface{}{"stringValue": fmt.Sprint(value)}
+}
+
+func otlpAttributes(attributes map[string]interface{}) []otlpAttribute {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make([]otlpAttribute, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, otlpAttribute{Key: key, Value: otlpValue(attributes[key])})
+	}
+
+	return result
+}
+
+// otlpExporter posts spans to OTLP/HTTP traces endpoint in JSON encoding.
+type otlpExporter struct {
+	endpoint    string
+	serviceName string
+}
+
+func (e *otlpExporter) export(spans []*span) error {
+	scope := otlpScopeSpans{
+		Scope: otlpScope{Name: "gorush", Version: GetVersion()},
+	}
+
+	for _, s := range spans {
+		otlp := otlpSpan{
+			TraceID:           s.context.TraceID,
+			SpanID:            s.context.SpanID,
+			ParentSpanID:      s.parentID,
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.startTime.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.endTime.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.attributes),
+		}
+		if s.err != "" {
+			// STATUS_CODE_ERROR
+			otlp.Status = otlpStatus{Code: 2, Message: s.err}
+		}
+		scope.Spans = append(scope.Spans, otlp)
+	}
+
+	data, err := json.Marshal(otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: otlpAttributes(map[string]interface{}{"service.name": e.serviceName}),
+			},
+			ScopeSpans: []otlpScopeSpans{scope},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	res, err := traceClient.Post(e.endpoint, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("OTLP endpoint returns status %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+// InitTrace starts span exporter of config, nothing is traced if trace is
+// disabled.
+func InitTrace() error {
+	if !PushConf.Trace.Enabled {
+		return nil
+	}
+
+	var exporter spanExporter
+	switch PushConf.Trace.Exporter {
+	case "", "stdout":
+		exporter = &stdoutExporter{writer: os.Stdout}
+	case "otlp":
+		exporter = &otlpExporter{
+			endpoint:    PushConf.Trace.Endpoint,
+			serviceName: PushConf.Trace.ServiceName,
+		}
+	default:
+		err := errors.New("can't find trace exporter")
+		LogError.Error("trace error: " + err.Error())
+		return err
+	}
+
+	spanTracer = newTracer(exporter)
+
+	return nil
+}
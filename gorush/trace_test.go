@@ -0,0 +1,211 @@
+package gorush
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NaySoftware/go-fcm"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/appleboy/gofight.v2"
+)
+
+type testExporter struct {
+	sync.Mutex
+	spans map[string]*span
+}
+
+func (e *testExporter) export(spans []*span) error {
+	e.Lock()
+	defer e.Unlock()
+
+	for _, s := range spans {
+		e.spans[s.name] = s
+	}
+
+	return nil
+}
+
+func TestParseTraceParent(t *testing.T) {
+	sc := parseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID)
+	assert.True(t, sc.Sampled)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", sc.traceParent())
+
+	sc = parseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	assert.True(t, sc.valid())
+	assert.False(t, sc.Sampled)
+
+	// future version may append fields.
+	assert.True(t, parseTraceParent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra").valid())
+
+	for _, value := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		assert.False(t, parseTraceParent(value).valid(), value)
+	}
+
+	assert.Equal(t, "", spanContext{}.traceParent())
+}
+
+func TestTraceDisabled(t *testing.T) {
+	spanTracer = nil
+
+	s := startSpan(spanContext{}, "test", spanKindInternal)
+	assert.Nil(t, s)
+
+	// methods of nil span are no-op.
+	s.setAttribute("key", "value")
+	s.finish(errors.New("error"))
+	assert.False(t, s.spanContext().valid())
+}
+
+func TestPushTrace(t *testing.T) {
+	done := initFcmTest(t, func(w http.ResponseWriter, r *http.Request) {
+		var msg fcm.FcmMsg
+		json.NewDecoder(r.Body).Decode(&msg)
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"failure": 1,
+			"results": []map[string]string{{"error": "NotRegistered"}},
+		})
+	})
+	defer done()
+
+	exporter := &testExporter{spans: make(map[string]*span)}
+	spanTracer = newTracer(exporter)
+	defer func() {
+		spanTracer = nil
+	}()
+
+	PushConf.Core.Sync = true
+	InitWorkers(2, 10)
+
+	r := gofight.New()
+
+	r.POST("/api/push").
+		SetHeader(gofight.H{
+			TraceParentHeader: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		}).
+		SetJSON(gofight.D{
+			"notifications": []gofight.D{
+				{
+					"tokens":   []string{"bad"},
+					"platform": PlatFormAndroidFcm,
+					"message":  "Welcome",
+				},
+			},
+		}).
+		Run(routerEngine(), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+
+	assert.True(t, spanTracer.close(time.Second))
+
+	server := exporter.spans["POST /api/push"]
+	worker := exporter.spans["gorush.worker"]
+	provider := exporter.spans["fcm.send"]
+	if !assert.NotNil(t, server) || !assert.NotNil(t, worker) || !assert.NotNil(t, provider) {
+		return
+	}
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.context.TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", server.parentID)
+	assert.Equal(t, spanKindServer, server.kind)
+	assert.Equal(t, server.context.TraceID, worker.context.TraceID)
+	assert.Equal(t, server.context.SpanID, worker.parentID)
+	assert.Equal(t, worker.context.SpanID, provider.parentID)
+
+	assert.Equal(t, AppNameDefault, provider.attributes["gorush.app"])
+	assert.Equal(t, "android_fcm", provider.attributes["gorush.platform"])
+	assert.Equal(t, tokenHash("bad"), provider.attributes["gorush.token_hash"])
+	assert.Equal(t, outcomeFailed, provider.attributes["gorush.result"])
+	assert.Equal(t, 1, provider.attributes["gorush.failed_tokens"])
+	assert.Equal(t, outcomeFailed, worker.attributes["gorush.result"])
+}
+
+func TestUnsampledTrace(t *testing.T) {
+	exporter := &testExporter{spans: make(map[string]*span)}
+	spanTracer = newTracer(exporter)
+	defer func() {
+		spanTracer = nil
+	}()
+
+	parent := startSpan(parseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"), "parent", spanKindServer)
+	child := startSpan(parent.spanContext(), "child", spanKindInternal)
+	child.finish(nil)
+	parent.finish(nil)
+
+	assert.True(t, spanTracer.close(time.Second))
+	assert.Empty(t, exporter.spans)
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var body otlpRequest
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		json.NewDecoder(r.Body).Decode(&body)
+	}))
+	defer ts.Close()
+
+	exporter := &otlpExporter{endpoint: ts.URL, serviceName: "gorush"}
+	s := &span{
+		name:       "apns.push",
+		kind:       spanKindClient,
+		context:    spanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Sampled: true},
+		parentID:   "00f067aa0ba902b8",
+		startTime:  time.Unix(1, 0),
+		endTime:    time.Unix(2, 0),
+		attributes: map[string]interface{}{"gorush.app": "normal", "gorush.tokens": 1},
+		err:        "BadDeviceToken",
+	}
+	assert.NoError(t, exporter.export([]*span{s}))
+
+	if assert.Len(t, body.ResourceSpans, 1) && assert.Len(t, body.ResourceSpans[0].ScopeSpans, 1) {
+		assert.Equal(t, "service.name", body.ResourceSpans[0].Resource.Attributes[0].Key)
+		assert.Equal(t, "gorush", body.ResourceSpans[0].Resource.Attributes[0].Value["stringValue"])
+
+		spans := body.ResourceSpans[0].ScopeSpans[0].Spans
+		if assert.Len(t, spans, 1) {
+			assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].TraceID)
+			assert.Equal(t, "00f067aa0ba902b8", spans[0].ParentSpanID)
+			assert.Equal(t, "1000000000", spans[0].StartTimeUnixNano)
+			assert.Equal(t, 2, spans[0].Status.Code)
+			assert.Equal(t, "gorush.app", spans[0].Attributes[0].Key)
+			assert.Equal(t, "1", spans[0].Attributes[1].Value["intValue"])
+		}
+	}
+
+	ts.Close()
+	assert.Error(t, exporter.export([]*span{s}))
+}
+
+func TestQueueTraceParent(t *testing.T) {
+	initTest()
+	InitLog()
+	defer initTestQueue(t)()
+
+	notification := PushNotification{
+		Tokens:   []string{"aaaaa"},
+		Platform: PlatFormIos,
+		trace:    parseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"),
+	}
+	persistNotification(&notification)
+
+	var item queueItem
+	NotificationQueue.Range(func(id string, data []byte) error {
+		return json.Unmarshal(data, &item)
+	})
+	assert.Equal(t, notification.trace, parseTraceParent(item.TraceParent))
+}
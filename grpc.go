@@ -0,0 +1,9 @@
+// +build grpc
+
+package main
+
+import "github.com/lalit-verma/gorush/rpc"
+
+func init() {
+	runGRPCServer = rpc.RunGRPCServer
+}
@@ -25,6 +25,9 @@ func checkInput(token, message string) {
 // Version control for gorush.
 var Version = "No Version Provided"
 
+// runGRPCServer is set if binary is built with "grpc" tag.
+var runGRPCServer func() error
+
 var usageStr = `
 
 Usage: gorush [options]
@@ -46,6 +49,7 @@ iOS Options:
 Android Options:
     -k, --apikey <api_key>           Android API Key
     --android                        enabled android (default: false)
+    --fcm                            enabled android FCM (default: false)
 Common Options:
     -h, --help                       Show this message
     -v, --version                    Show version
@@ -102,6 +106,7 @@ func main() {
 	var iosProduction bool
 	var androidAPIKey string
 	var androidEnabled bool
+	var androidFcmEnabled bool
 
 	flag.BoolVar(&showVersion, "version", false, "Print version information.")
 	flag.BoolVar(&showVersion, "v", false, "Print version information.")
@@ -131,7 +136,7 @@ func main() {
 	flag.StringVar(&androidAPIKey, "k", "", "Android api key configuration for gorush")
 	flag.StringVar(&androidAPIKey, "apikey", "", "Android api key configuration for gorush")
 	flag.BoolVar(&androidEnabled, "android", false, "send android notification")
-
+	flag.BoolVar(&androidFcmEnabled, "fcm", false, "send android notification through FCM")
 
 	flag.Usage = usage
 	flag.Parse()
@@ -164,14 +169,30 @@ func main() {
 		}
 	}
 
+	// record where config values come from.
+	gorush.ConfSources, err = config.LoadSources(configFile)
+
+	if err != nil {
+		log.Printf("Load yaml config file error: '%v'", err)
+
+		return
+	}
+
+	// overwrite config by GORUSH_* environment variables.
+	if err = config.LoadEnv(&gorush.PushConf, gorush.ConfSources); err != nil {
+		log.Printf("Load environment config error: '%v'", err)
+
+		return
+	}
+
 	// overwrite server port
 	if port != "" {
 		gorush.PushConf.Core.Port = port
+		gorush.ConfSources.Set("core.port", config.SourceFlag)
 	}
 
 	// create a dynamic app from command line flags
-	gorush.PushConf.Apps[gorush.AppNameDynamic] = config.SectionApp{}
-	dynamicAppConfig := gorush.PushConf.Apps[gorush.AppNameDynamic]
+	dynamicAppConfig := config.SectionApp{}
 
 	if iosKeyPath != "" {
 		dynamicAppConfig.Ios.KeyPath = iosKeyPath
@@ -197,6 +218,13 @@ func main() {
 		dynamicAppConfig.Android.Enabled = androidEnabled
 	}
 
+	if androidFcmEnabled {
+		dynamicAppConfig.AndroidFcm.Enabled = androidFcmEnabled
+		dynamicAppConfig.AndroidFcm.APIKey = androidAPIKey
+	}
+
+	gorush.PushConf.Apps[gorush.AppNameDynamic] = dynamicAppConfig
+	gorush.ConfSources.Set("apps."+gorush.AppNameDynamic, config.SourceFlag)
 
 	if err = gorush.InitLog(); err != nil {
 		log.Println(err)
@@ -242,6 +270,29 @@ func main() {
 		return
 	}
 
+	// send android notification through FCM
+	if dynamicAppConfig.AndroidFcm.Enabled {
+
+		req := gorush.PushNotification{
+			Tokens:   []string{token},
+			Platform: gorush.PlatFormAndroidFcm,
+			Message:  message,
+			Title:    title,
+			AppID:    gorush.AppNameDynamic,
+		}
+
+		err := gorush.CheckMessage(req)
+
+		if err != nil {
+			gorush.LogError.Fatal(err)
+		}
+
+		gorush.InitAppStatus()
+		gorush.PushToAndroidFcm(req)
+
+		return
+	}
+
 	// send ios notification
 	if dynamicAppConfig.Ios.Enabled {
 
@@ -273,17 +324,58 @@ func main() {
 		gorush.LogError.Fatal(err)
 	}
 
+	if err = gorush.InitAPNSClients(); err != nil {
+		gorush.LogError.Fatal(err)
+	}
+
 	if opts.Core.PID.Path != "" {
 		gorush.PushConf.Core.PID.Path = opts.Core.PID.Path
 		gorush.PushConf.Core.PID.Enabled = true
 		gorush.PushConf.Core.PID.Override = true
+		gorush.ConfSources.Set("core.pid", config.SourceFlag)
 	}
 
 	if err = createPIDFile(); err != nil {
 		gorush.LogError.Fatal(err)
 	}
 
+	if err = gorush.InitTrace(); err != nil {
+		gorush.LogError.Fatal(err)
+	}
+
 	gorush.InitAppStatus()
+	gorush.StartStatusPurge()
+	gorush.StartIdempotencyPurge()
+	gorush.StartHistoryPurge()
+
+	if err = gorush.InitQueue(); err != nil {
+		gorush.LogError.Fatal(err)
+	}
+
 	gorush.InitWorkers(gorush.PushConf.Core.WorkerNum, gorush.PushConf.Core.QueueNum)
-	gorush.RunHTTPServer()
+
+	// resend notifications which were not finished before last shutdown.
+	go gorush.ReplayQueue()
+
+	// send scheduled notifications when they are due.
+	gorush.StartScheduler()
+
+	if gorush.PushConf.GRPC.Enabled {
+		if runGRPCServer == nil {
+			gorush.LogError.Error("gRPC server is enabled but gorush is built without grpc tag")
+		} else {
+			go func() {
+				if err := runGRPCServer(); err != nil {
+					gorush.LogError.Error(err)
+				}
+			}()
+		}
+	}
+
+	if err = gorush.RunHTTPServer(); err != nil {
+		gorush.LogError.Error(err)
+	}
+
+	// server is stopped, finish queued notifications before exit.
+	gorush.Shutdown()
 }
@@ -0,0 +1,101 @@
+package boltdb
+
+import (
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/lalit-verma/gorush/config"
+)
+
+// New func implements the queue interface for gorush (https://github.com/appleboy/gorush)
+func New(config config.ConfYaml) *Queue {
+	return &Queue{
+		config: config,
+	}
+}
+
+// Queue is interface structure
+type Queue struct {
+	config config.ConfYaml
+	db     *bolt.DB
+}
+
+type item struct {
+	id   string
+	data []byte
+}
+
+// Init open the queue database.
+func (q *Queue) Init() error {
+	db, err := bolt.Open(q.config.Core.Queue.BoltDB.Path, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(q.bucket())
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return err
+	}
+
+	q.db = db
+
+	return nil
+}
+
+func (q *Queue) bucket() []byte {
+	return []byte(q.config.Core.Queue.BoltDB.Bucket)
+}
+
+// Enqueue store the notification until it is acknowledged.
+func (q *Queue) Enqueue(id string, data []byte) error {
+	return q.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(q.bucket()).Put([]byte(id), data)
+	})
+}
+
+// Ack remove the notification from queue.
+func (q *Queue) Ack(id string) error {
+	return q.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(q.bucket()).Delete([]byte(id))
+	})
+}
+
+// Range calls fn for each unacknowledged notification ordered by id.
+func (q *Queue) Range(fn func(id string, data []byte) error) error {
+	var items []item
+
+	// bolt values are only valid inside the transaction, so copy them out
+	// before calling fn which may write to the queue.
+	err := q.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(q.bucket()).ForEach(func(k, v []byte) error {
+			data := make([]byte, len(v))
+			copy(data, v)
+			items = append(items, item{id: string(k), data: data})
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, i := range items {
+		if err := fn(i.id, i.data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close the queue database.
+func (q *Queue) Close() error {
+	if q.db == nil {
+		return nil
+	}
+
+	return q.db.Close()
+}
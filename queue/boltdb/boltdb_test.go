@@ -0,0 +1,53 @@
+package boltdb
+
+import (
+	"os"
+	"testing"
+
+	c "github.com/lalit-verma/gorush/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func collect(t *testing.T, queue *Queue) ([]string, []string) {
+	var ids, data []string
+
+	err := queue.Range(func(id string, d []byte) error {
+		ids = append(ids, id)
+		data = append(data, string(d))
+		return nil
+	})
+	assert.NoError(t, err)
+
+	return ids, data
+}
+
+func TestBoltDBQueue(t *testing.T) {
+	config := c.BuildDefaultPushConf()
+	os.RemoveAll(config.Core.Queue.BoltDB.Path)
+	defer os.RemoveAll(config.Core.Queue.BoltDB.Path)
+
+	queue := New(config)
+	assert.NoError(t, queue.Init())
+
+	assert.NoError(t, queue.Enqueue("0002", []byte("b")))
+	assert.NoError(t, queue.Enqueue("0001", []byte("a")))
+	assert.NoError(t, queue.Enqueue("0003", []byte("c")))
+
+	ids, data := collect(t, queue)
+	assert.Equal(t, []string{"0001", "0002", "0003"}, ids)
+	assert.Equal(t, []string{"a", "b", "c"}, data)
+
+	assert.NoError(t, queue.Ack("0002"))
+	assert.NoError(t, queue.Ack("0004"))
+	assert.NoError(t, queue.Close())
+
+	// unacknowledged notifications survive restart
+	queue = New(config)
+	assert.NoError(t, queue.Init())
+
+	ids, data = collect(t, queue)
+	assert.Equal(t, []string{"0001", "0003"}, ids)
+	assert.Equal(t, []string{"a", "c"}, data)
+
+	assert.NoError(t, queue.Close())
+}
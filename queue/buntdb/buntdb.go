@@ -0,0 +1,87 @@
+package buntdb
+
+import (
+	"github.com/lalit-verma/gorush/config"
+	"github.com/tidwall/buntdb"
+)
+
+// New func implements the queue interface for gorush (https://github.com/appleboy/gorush)
+func New(config config.ConfYaml) *Queue {
+	return &Queue{
+		config: config,
+	}
+}
+
+// Queue is interface structure
+type Queue struct {
+	config config.ConfYaml
+	db     *buntdb.DB
+}
+
+type item struct {
+	id   string
+	data []byte
+}
+
+// Init open the queue database.
+func (q *Queue) Init() error {
+	db, err := buntdb.Open(q.config.Core.Queue.BuntDB.Path)
+	if err != nil {
+		return err
+	}
+
+	q.db = db
+
+	return nil
+}
+
+// Enqueue store the notification until it is acknowledged.
+func (q *Queue) Enqueue(id string, data []byte) error {
+	return q.db.Update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set(id, string(data), nil)
+		return err
+	})
+}
+
+// Ack remove the notification from queue.
+func (q *Queue) Ack(id string) error {
+	return q.db.Update(func(tx *buntdb.Tx) error {
+		_, err := tx.Delete(id)
+		if err == buntdb.ErrNotFound {
+			return nil
+		}
+		return err
+	})
+}
+
+// Range calls fn for each unacknowledged notification ordered by id.
+func (q *Queue) Range(fn func(id string, data []byte) error) error {
+	var items []item
+
+	err := q.db.View(func(tx *buntdb.Tx) error {
+		return tx.Ascend("", func(key, value string) bool {
+			items = append(items, item{id: key, data: []byte(value)})
+			return true
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, i := range items {
+		if err := fn(i.id, i.data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close the queue database.
+func (q *Queue) Close() error {
+	if q.db == nil {
+		return nil
+	}
+
+	return q.db.Close()
+}
@@ -0,0 +1,80 @@
+package leveldb
+
+import (
+	"github.com/lalit-verma/gorush/config"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// New func implements the queue interface for gorush (https://github.com/appleboy/gorush)
+func New(config config.ConfYaml) *Queue {
+	return &Queue{
+		config: config,
+	}
+}
+
+// Queue is interface structure
+type Queue struct {
+	config config.ConfYaml
+	db     *leveldb.DB
+}
+
+type item struct {
+	id   string
+	data []byte
+}
+
+// Init open the queue database.
+func (q *Queue) Init() error {
+	db, err := leveldb.OpenFile(q.config.Core.Queue.LevelDB.Path, nil)
+	if err != nil {
+		return err
+	}
+
+	q.db = db
+
+	return nil
+}
+
+// Enqueue store the notification until it is acknowledged.
+func (q *Queue) Enqueue(id string, data []byte) error {
+	return q.db.Put([]byte(id), data, nil)
+}
+
+// Ack remove the notification from queue.
+func (q *Queue) Ack(id string) error {
+	return q.db.Delete([]byte(id), nil)
+}
+
+// Range calls fn for each unacknowledged notification ordered by id.
+func (q *Queue) Range(fn func(id string, data []byte) error) error {
+	var items []item
+
+	iter := q.db.NewIterator(nil, nil)
+	for iter.Next() {
+		data := make([]byte, len(iter.Value()))
+		copy(data, iter.Value())
+		items = append(items, item{id: string(iter.Key()), data: data})
+	}
+	iter.Release()
+
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	for _, i := range items {
+		if err := fn(i.id, i.data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close the queue database.
+func (q *Queue) Close() error {
+	if q.db == nil {
+		return nil
+	}
+
+	return q.db.Close()
+}
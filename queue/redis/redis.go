@@ -0,0 +1,216 @@
+package redis
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/lalit-verma/gorush/config"
+	"gopkg.in/redis.v5"
+)
+
+// Queue keys for redis
+const (
+	QueueListKey     = "gorush-queue-list"
+	QueueDataKey     = "gorush-queue-data"
+	QueueLeaseKey    = "gorush-queue-lease"
+	QueueInstanceKey = "gorush-queue-instance"
+)
+
+// LeaseTTL is how long an instance owns its list without refreshing the lease.
+const LeaseTTL = 30 * time.Second
+
+// New func implements the queue interface for gorush (https://github.com/appleboy/gorush)
+func New(config config.ConfYaml) *Queue {
+	instance := config.Core.Queue.Instance
+	if instance == "" {
+		instance, _ = os.Hostname()
+	}
+
+	return &Queue{
+		config:   config,
+		instance: instance,
+	}
+}
+
+// Queue is interface structure
+// Each instance keeps ids in its own list, so it never resends notifications
+// which other running instances are sending.
+type Queue struct {
+	config   config.ConfYaml
+	client   *redis.Client
+	instance string
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+func listKey(instance string) string {
+	return QueueListKey + ":" + instance
+}
+
+func leaseKey(instance string) string {
+	return QueueLeaseKey + ":" + instance
+}
+
+// Init connect to redis server and take the lease of instance list.
+func (q *Queue) Init() error {
+	q.client = redis.NewClient(&redis.Options{
+		Addr:     q.config.Core.Queue.Redis.Addr,
+		Password: q.config.Core.Queue.Redis.Password,
+		DB:       q.config.Core.Queue.Redis.DB,
+	})
+
+	if _, err := q.client.Ping().Result(); err != nil {
+		q.client.Close()
+		return err
+	}
+
+	if err := q.client.SAdd(QueueInstanceKey, q.instance).Err(); err != nil {
+		q.client.Close()
+		return err
+	}
+
+	if err := q.refreshLease(); err != nil {
+		q.client.Close()
+		return err
+	}
+
+	q.stop = make(chan struct{})
+	q.wg.Add(1)
+	go q.keepLease()
+
+	return nil
+}
+
+func (q *Queue) refreshLease() error {
+	return q.client.Set(leaseKey(q.instance), time.Now().Unix(), LeaseTTL).Err()
+}
+
+// keepLease refreshes the lease until queue is closed.
+func (q *Queue) keepLease() {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(LeaseTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// failed refresh is retried on next tick, the lease expires
+			// only if redis is unreachable for the whole TTL.
+			q.refreshLease()
+		case <-q.stop:
+			return
+		}
+	}
+}
+
+// Enqueue store the notification until it is acknowledged.
+// The list keeps the order and the hash keeps the payload.
+func (q *Queue) Enqueue(id string, data []byte) error {
+	_, err := q.client.TxPipelined(func(pipe *redis.Pipeline) error {
+		pipe.HSet(QueueDataKey, id, string(data))
+		pipe.RPush(listKey(q.instance), id)
+		return nil
+	})
+
+	return err
+}
+
+// Ack remove the notification from queue.
+func (q *Queue) Ack(id string) error {
+	_, err := q.client.TxPipelined(func(pipe *redis.Pipeline) error {
+		pipe.LRem(listKey(q.instance), 1, id)
+		pipe.HDel(QueueDataKey, id)
+		return nil
+	})
+
+	return err
+}
+
+// claim moves ids of instances whose lease is expired to own list.
+// RPOPLPUSH moves one id atomically, so an id is claimed by one instance.
+func (q *Queue) claim() error {
+	instances, err := q.client.SMembers(QueueInstanceKey).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, instance := range instances {
+		if instance == q.instance {
+			continue
+		}
+
+		alive, err := q.client.Exists(leaseKey(instance)).Result()
+		if err != nil {
+			return err
+		}
+
+		if alive {
+			continue
+		}
+
+		for {
+			err := q.client.RPopLPush(listKey(instance), listKey(q.instance)).Err()
+			if err == redis.Nil {
+				break
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+
+		q.client.SRem(QueueInstanceKey, instance)
+	}
+
+	return nil
+}
+
+// Range calls fn for each unacknowledged notification of this instance in
+// enqueue order, after claiming lists of stopped instances.
+func (q *Queue) Range(fn func(id string, data []byte) error) error {
+	if err := q.claim(); err != nil {
+		return err
+	}
+
+	ids, err := q.client.LRange(listKey(q.instance), 0, -1).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		data, err := q.client.HGet(QueueDataKey, id).Result()
+		if err == redis.Nil {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := fn(id, []byte(data)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close redis connection and release the lease, other instances may claim
+// notifications which are not finished.
+func (q *Queue) Close() error {
+	if q.client == nil {
+		return nil
+	}
+
+	if q.stop != nil {
+		close(q.stop)
+		q.wg.Wait()
+		q.stop = nil
+	}
+
+	q.client.Del(leaseKey(q.instance))
+
+	return q.client.Close()
+}
@@ -0,0 +1,99 @@
+package redis
+
+import (
+	"testing"
+
+	c "github.com/lalit-verma/gorush/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisQueueServerError(t *testing.T) {
+	config := c.BuildDefaultPushConf()
+	config.Core.Queue.Redis.Addr = "localhost:6370"
+
+	queue := New(config)
+	err := queue.Init()
+
+	assert.Error(t, err)
+}
+
+func TestRedisQueue(t *testing.T) {
+	var ids, data []string
+
+	config := c.BuildDefaultPushConf()
+	config.Core.Queue.Redis.Addr = "localhost:6379"
+
+	queue := New(config)
+	if !assert.NoError(t, queue.Init()) {
+		return
+	}
+	queue.client.Del(listKey(queue.instance), QueueDataKey)
+
+	assert.NoError(t, queue.Enqueue("0002", []byte("b")))
+	assert.NoError(t, queue.Enqueue("0001", []byte("a")))
+	assert.NoError(t, queue.Enqueue("0003", []byte("c")))
+	assert.NoError(t, queue.Ack("0001"))
+
+	// redis keeps the enqueue order
+	err := queue.Range(func(id string, d []byte) error {
+		ids = append(ids, id)
+		data = append(data, string(d))
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"0002", "0003"}, ids)
+	assert.Equal(t, []string{"b", "c"}, data)
+	assert.NoError(t, queue.Close())
+}
+
+func collect(t *testing.T, queue *Queue) []string {
+	var ids []string
+
+	err := queue.Range(func(id string, d []byte) error {
+		ids = append(ids, id)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	return ids
+}
+
+func TestRedisQueueOwnership(t *testing.T) {
+	config := c.BuildDefaultPushConf()
+	config.Core.Queue.Redis.Addr = "localhost:6379"
+
+	config.Core.Queue.Instance = "first"
+	first := New(config)
+	if !assert.NoError(t, first.Init()) {
+		return
+	}
+	// forget instances of other tests.
+	first.client.Del(QueueInstanceKey, listKey("first"), listKey("second"), listKey("third"), QueueDataKey)
+
+	config.Core.Queue.Instance = "second"
+	second := New(config)
+	assert.NoError(t, second.Init())
+
+	assert.NoError(t, first.Enqueue("0001", []byte("a")))
+	assert.NoError(t, second.Enqueue("0002", []byte("b")))
+
+	// running instance doesn't resend notifications of other instance.
+	assert.Equal(t, []string{"0001"}, collect(t, first))
+	assert.Equal(t, []string{"0002"}, collect(t, second))
+
+	// notifications of stopped instance are claimed once.
+	assert.NoError(t, second.Close())
+	assert.Equal(t, []string{"0002", "0001"}, collect(t, first))
+
+	config.Core.Queue.Instance = "third"
+	third := New(config)
+	assert.NoError(t, third.Init())
+	assert.Empty(t, collect(t, third))
+
+	assert.NoError(t, first.Ack("0002"))
+	assert.Equal(t, []string{"0001"}, collect(t, first))
+
+	assert.NoError(t, first.Close())
+	assert.NoError(t, third.Close())
+}
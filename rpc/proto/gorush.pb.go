@@ -0,0 +1,930 @@
+// Code generated by protoc-gen-go.
+// source: rpc/proto/gorush.proto
+// DO NOT EDIT!
+
+/*
+Package proto is a generated protocol buffer package.
+
+It is generated from these files:
+
+	rpc/proto/gorush.proto
+
+It has these top-level messages:
+
+	Alert
+	AndroidNotification
+	Notification
+	NotificationRequest
+	NotificationIds
+	NotificationReply
+	PushResponse
+	TokenResult
+*/
+package proto
+
+import proto1 "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+import google_protobuf "github.com/golang/protobuf/ptypes/struct"
+import google_protobuf1 "github.com/golang/protobuf/ptypes/wrappers"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto1.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto1.ProtoPackageIsVersion2 // please upgrade the proto package
+
+type Alert struct {
+	Title        string   `protobuf:"bytes,1,opt,name=title" json:"title,omitempty"`
+	Subtitle     string   `protobuf:"bytes,2,opt,name=subtitle" json:"subtitle,omitempty"`
+	Body         string   `protobuf:"bytes,3,opt,name=body" json:"body,omitempty"`
+	Action       string   `protobuf:"bytes,4,opt,name=action" json:"action,omitempty"`
+	LaunchImage  string   `protobuf:"bytes,5,opt,name=launch_image,json=launchImage" json:"launch_image,omitempty"`
+	LocKey       string   `protobuf:"bytes,6,opt,name=loc_key,json=locKey" json:"loc_key,omitempty"`
+	LocArgs      []string `protobuf:"bytes,7,rep,name=loc_args,json=locArgs" json:"loc_args,omitempty"`
+	TitleLocKey  string   `protobuf:"bytes,8,opt,name=title_loc_key,json=titleLocKey" json:"title_loc_key,omitempty"`
+	TitleLocArgs []string `protobuf:"bytes,9,rep,name=title_loc_args,json=titleLocArgs" json:"title_loc_args,omitempty"`
+}
+
+func (m *Alert) Reset()                    { *m = Alert{} }
+func (m *Alert) String() string            { return proto1.CompactTextString(m) }
+func (*Alert) ProtoMessage()               {}
+func (*Alert) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+func (m *Alert) GetTitle() string {
+	if m != nil {
+		return m.Title
+	}
+	return ""
+}
+
+func (m *Alert) GetSubtitle() string {
+	if m != nil {
+		return m.Subtitle
+	}
+	return ""
+}
+
+func (m *Alert) GetBody() string {
+	if m != nil {
+		return m.Body
+	}
+	return ""
+}
+
+func (m *Alert) GetAction() string {
+	if m != nil {
+		return m.Action
+	}
+	return ""
+}
+
+func (m *Alert) GetLaunchImage() string {
+	if m != nil {
+		return m.LaunchImage
+	}
+	return ""
+}
+
+func (m *Alert) GetLocKey() string {
+	if m != nil {
+		return m.LocKey
+	}
+	return ""
+}
+
+func (m *Alert) GetLocArgs() []string {
+	if m != nil {
+		return m.LocArgs
+	}
+	return nil
+}
+
+func (m *Alert) GetTitleLocKey() string {
+	if m != nil {
+		return m.TitleLocKey
+	}
+	return ""
+}
+
+func (m *Alert) GetTitleLocArgs() []string {
+	if m != nil {
+		return m.TitleLocArgs
+	}
+	return nil
+}
+
+type AndroidNotification struct {
+	Title        string `protobuf:"bytes,1,opt,name=title" json:"title,omitempty"`
+	Body         string `protobuf:"bytes,2,opt,name=body" json:"body,omitempty"`
+	Icon         string `protobuf:"bytes,3,opt,name=icon" json:"icon,omitempty"`
+	Sound        string `protobuf:"bytes,4,opt,name=sound" json:"sound,omitempty"`
+	Badge        string `protobuf:"bytes,5,opt,name=badge" json:"badge,omitempty"`
+	Tag          string `protobuf:"bytes,6,opt,name=tag" json:"tag,omitempty"`
+	Color        string `protobuf:"bytes,7,opt,name=color" json:"color,omitempty"`
+	ClickAction  string `protobuf:"bytes,8,opt,name=click_action,json=clickAction" json:"click_action,omitempty"`
+	BodyLocKey   string `protobuf:"bytes,9,opt,name=body_loc_key,json=bodyLocKey" json:"body_loc_key,omitempty"`
+	BodyLocArgs  string `protobuf:"bytes,10,opt,name=body_loc_args,json=bodyLocArgs" json:"body_loc_args,omitempty"`
+	TitleLocArgs string `protobuf:"bytes,11,opt,name=title_loc_args,json=titleLocArgs" json:"title_loc_args,omitempty"`
+	TitleLocKey  string `protobuf:"bytes,12,opt,name=title_loc_key,json=titleLocKey" json:"title_loc_key,omitempty"`
+}
+
+func (m *AndroidNotification) Reset()                    { *m = AndroidNotification{} }
+func (m *AndroidNotification) String() string            { return proto1.CompactTextString(m) }
+func (*AndroidNotification) ProtoMessage()               {}
+func (*AndroidNotification) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *AndroidNotification) GetTitle() string {
+	if m != nil {
+		return m.Title
+	}
+	return ""
+}
+
+func (m *AndroidNotification) GetBody() string {
+	if m != nil {
+		return m.Body
+	}
+	return ""
+}
+
+func (m *AndroidNotification) GetIcon() string {
+	if m != nil {
+		return m.Icon
+	}
+	return ""
+}
+
+func (m *AndroidNotification) GetSound() string {
+	if m != nil {
+		return m.Sound
+	}
+	return ""
+}
+
+func (m *AndroidNotification) GetBadge() string {
+	if m != nil {
+		return m.Badge
+	}
+	return ""
+}
+
+func (m *AndroidNotification) GetTag() string {
+	if m != nil {
+		return m.Tag
+	}
+	return ""
+}
+
+func (m *AndroidNotification) GetColor() string {
+	if m != nil {
+		return m.Color
+	}
+	return ""
+}
+
+func (m *AndroidNotification) GetClickAction() string {
+	if m != nil {
+		return m.ClickAction
+	}
+	return ""
+}
+
+func (m *AndroidNotification) GetBodyLocKey() string {
+	if m != nil {
+		return m.BodyLocKey
+	}
+	return ""
+}
+
+func (m *AndroidNotification) GetBodyLocArgs() string {
+	if m != nil {
+		return m.BodyLocArgs
+	}
+	return ""
+}
+
+func (m *AndroidNotification) GetTitleLocArgs() string {
+	if m != nil {
+		return m.TitleLocArgs
+	}
+	return ""
+}
+
+func (m *AndroidNotification) GetTitleLocKey() string {
+	if m != nil {
+		return m.TitleLocKey
+	}
+	return ""
+}
+
+type Notification struct {
+	// Common
+	Tokens           []string                `protobuf:"bytes,1,rep,name=tokens" json:"tokens,omitempty"`
+	Platform         int32                   `protobuf:"varint,2,opt,name=platform" json:"platform,omitempty"`
+	Message          string                  `protobuf:"bytes,3,opt,name=message" json:"message,omitempty"`
+	Title            string                  `protobuf:"bytes,4,opt,name=title" json:"title,omitempty"`
+	Priority         string                  `protobuf:"bytes,5,opt,name=priority" json:"priority,omitempty"`
+	ContentAvailable bool                    `protobuf:"varint,6,opt,name=content_available,json=contentAvailable" json:"content_available,omitempty"`
+	Sound            string                  `protobuf:"bytes,7,opt,name=sound" json:"sound,omitempty"`
+	Data             *google_protobuf.Struct `protobuf:"bytes,8,opt,name=data" json:"data,omitempty"`
+	AppId            string                  `protobuf:"bytes,9,opt,name=app_id,json=appId" json:"app_id,omitempty"`
+	Retry            int32                   `protobuf:"varint,10,opt,name=retry" json:"retry,omitempty"`
+	CallbackUrl      string                  `protobuf:"bytes,11,opt,name=callback_url,json=callbackUrl" json:"callback_url,omitempty"`
+	SendAt           int64                   `protobuf:"varint,12,opt,name=send_at,json=sendAt" json:"send_at,omitempty"`
+	Delay            int64                   `protobuf:"varint,13,opt,name=delay" json:"delay,omitempty"`
+	Template         string                  `protobuf:"bytes,14,opt,name=template" json:"template,omitempty"`
+	Locale           string                  `protobuf:"bytes,15,opt,name=locale" json:"locale,omitempty"`
+	Variables        *google_protobuf.Struct `protobuf:"bytes,16,opt,name=variables" json:"variables,omitempty"`
+	UserIds          []string                `protobuf:"bytes,17,rep,name=user_ids,json=userIds" json:"user_ids,omitempty"`
+	Tags             string                  `protobuf:"bytes,18,opt,name=tags" json:"tags,omitempty"`
+	IdempotencyKey   string                  `protobuf:"bytes,19,opt,name=idempotency_key,json=idempotencyKey" json:"idempotency_key,omitempty"`
+	// Android
+	To                    string                  `protobuf:"bytes,30,opt,name=to" json:"to,omitempty"`
+	CollapseKey           string                  `protobuf:"bytes,31,opt,name=collapse_key,json=collapseKey" json:"collapse_key,omitempty"`
+	DelayWhileIdle        bool                    `protobuf:"varint,32,opt,name=delay_while_idle,json=delayWhileIdle" json:"delay_while_idle,omitempty"`
+	TimeToLive            uint32                  `protobuf:"varint,33,opt,name=time_to_live,json=timeToLive" json:"time_to_live,omitempty"`
+	RestrictedPackageName string                  `protobuf:"bytes,34,opt,name=restricted_package_name,json=restrictedPackageName" json:"restricted_package_name,omitempty"`
+	DryRun                bool                    `protobuf:"varint,35,opt,name=dry_run,json=dryRun" json:"dry_run,omitempty"`
+	ApiKey                string                  `protobuf:"bytes,36,opt,name=api_key,json=apiKey" json:"api_key,omitempty"`
+	Notification          *AndroidNotification    `protobuf:"bytes,37,opt,name=notification" json:"notification,omitempty"`
+	AndroidData           *google_protobuf.Struct `protobuf:"bytes,38,opt,name=android_data,json=androidData" json:"android_data,omitempty"`
+	// iOS
+	Expiration     int64                        `protobuf:"varint,50,opt,name=expiration" json:"expiration,omitempty"`
+	ApnsId         string                       `protobuf:"bytes,51,opt,name=apns_id,json=apnsId" json:"apns_id,omitempty"`
+	Topic          string                       `protobuf:"bytes,52,opt,name=topic" json:"topic,omitempty"`
+	Badge          *google_protobuf1.Int32Value `protobuf:"bytes,53,opt,name=badge" json:"badge,omitempty"`
+	Category       string                       `protobuf:"bytes,54,opt,name=category" json:"category,omitempty"`
+	Alert          *Alert                       `protobuf:"bytes,55,opt,name=alert" json:"alert,omitempty"`
+	MutableContent bool                         `protobuf:"varint,56,opt,name=mutable_content,json=mutableContent" json:"mutable_content,omitempty"`
+	UrlArgs        []string                     `protobuf:"bytes,57,rep,name=url_args,json=urlArgs" json:"url_args,omitempty"`
+	IosData        *google_protobuf.Struct      `protobuf:"bytes,58,opt,name=ios_data,json=iosData" json:"ios_data,omitempty"`
+}
+
+func (m *Notification) Reset()                    { *m = Notification{} }
+func (m *Notification) String() string            { return proto1.CompactTextString(m) }
+func (*Notification) ProtoMessage()               {}
+func (*Notification) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+func (m *Notification) GetTokens() []string {
+	if m != nil {
+		return m.Tokens
+	}
+	return nil
+}
+
+func (m *Notification) GetPlatform() int32 {
+	if m != nil {
+		return m.Platform
+	}
+	return 0
+}
+
+func (m *Notification) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
+func (m *Notification) GetTitle() string {
+	if m != nil {
+		return m.Title
+	}
+	return ""
+}
+
+func (m *Notification) GetPriority() string {
+	if m != nil {
+		return m.Priority
+	}
+	return ""
+}
+
+func (m *Notification) GetContentAvailable() bool {
+	if m != nil {
+		return m.ContentAvailable
+	}
+	return false
+}
+
+func (m *Notification) GetSound() string {
+	if m != nil {
+		return m.Sound
+	}
+	return ""
+}
+
+func (m *Notification) GetData() *google_protobuf.Struct {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func (m *Notification) GetAppId() string {
+	if m != nil {
+		return m.AppId
+	}
+	return ""
+}
+
+func (m *Notification) GetRetry() int32 {
+	if m != nil {
+		return m.Retry
+	}
+	return 0
+}
+
+func (m *Notification) GetCallbackUrl() string {
+	if m != nil {
+		return m.CallbackUrl
+	}
+	return ""
+}
+
+func (m *Notification) GetSendAt() int64 {
+	if m != nil {
+		return m.SendAt
+	}
+	return 0
+}
+
+func (m *Notification) GetDelay() int64 {
+	if m != nil {
+		return m.Delay
+	}
+	return 0
+}
+
+func (m *Notification) GetTemplate() string {
+	if m != nil {
+		return m.Template
+	}
+	return ""
+}
+
+func (m *Notification) GetLocale() string {
+	if m != nil {
+		return m.Locale
+	}
+	return ""
+}
+
+func (m *Notification) GetVariables() *google_protobuf.Struct {
+	if m != nil {
+		return m.Variables
+	}
+	return nil
+}
+
+func (m *Notification) GetUserIds() []string {
+	if m != nil {
+		return m.UserIds
+	}
+	return nil
+}
+
+func (m *Notification) GetTags() string {
+	if m != nil {
+		return m.Tags
+	}
+	return ""
+}
+
+func (m *Notification) GetIdempotencyKey() string {
+	if m != nil {
+		return m.IdempotencyKey
+	}
+	return ""
+}
+
+func (m *Notification) GetTo() string {
+	if m != nil {
+		return m.To
+	}
+	return ""
+}
+
+func (m *Notification) GetCollapseKey() string {
+	if m != nil {
+		return m.CollapseKey
+	}
+	return ""
+}
+
+func (m *Notification) GetDelayWhileIdle() bool {
+	if m != nil {
+		return m.DelayWhileIdle
+	}
+	return false
+}
+
+func (m *Notification) GetTimeToLive() uint32 {
+	if m != nil {
+		return m.TimeToLive
+	}
+	return 0
+}
+
+func (m *Notification) GetRestrictedPackageName() string {
+	if m != nil {
+		return m.RestrictedPackageName
+	}
+	return ""
+}
+
+func (m *Notification) GetDryRun() bool {
+	if m != nil {
+		return m.DryRun
+	}
+	return false
+}
+
+func (m *Notification) GetApiKey() string {
+	if m != nil {
+		return m.ApiKey
+	}
+	return ""
+}
+
+func (m *Notification) GetNotification() *AndroidNotification {
+	if m != nil {
+		return m.Notification
+	}
+	return nil
+}
+
+func (m *Notification) GetAndroidData() *google_protobuf.Struct {
+	if m != nil {
+		return m.AndroidData
+	}
+	return nil
+}
+
+func (m *Notification) GetExpiration() int64 {
+	if m != nil {
+		return m.Expiration
+	}
+	return 0
+}
+
+func (m *Notification) GetApnsId() string {
+	if m != nil {
+		return m.ApnsId
+	}
+	return ""
+}
+
+func (m *Notification) GetTopic() string {
+	if m != nil {
+		return m.Topic
+	}
+	return ""
+}
+
+func (m *Notification) GetBadge() *google_protobuf1.Int32Value {
+	if m != nil {
+		return m.Badge
+	}
+	return nil
+}
+
+func (m *Notification) GetCategory() string {
+	if m != nil {
+		return m.Category
+	}
+	return ""
+}
+
+func (m *Notification) GetAlert() *Alert {
+	if m != nil {
+		return m.Alert
+	}
+	return nil
+}
+
+func (m *Notification) GetMutableContent() bool {
+	if m != nil {
+		return m.MutableContent
+	}
+	return false
+}
+
+func (m *Notification) GetUrlArgs() []string {
+	if m != nil {
+		return m.UrlArgs
+	}
+	return nil
+}
+
+func (m *Notification) GetIosData() *google_protobuf.Struct {
+	if m != nil {
+		return m.IosData
+	}
+	return nil
+}
+
+type NotificationRequest struct {
+	Notifications []*Notification `protobuf:"bytes,1,rep,name=notifications" json:"notifications,omitempty"`
+}
+
+func (m *NotificationRequest) Reset()                    { *m = NotificationRequest{} }
+func (m *NotificationRequest) String() string            { return proto1.CompactTextString(m) }
+func (*NotificationRequest) ProtoMessage()               {}
+func (*NotificationRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+
+func (m *NotificationRequest) GetNotifications() []*Notification {
+	if m != nil {
+		return m.Notifications
+	}
+	return nil
+}
+
+// NotificationIds are ids of one notification of request, notification of
+// user_ids or tags may be expanded to several ids.
+type NotificationIds struct {
+	Ids []string `protobuf:"bytes,1,rep,name=ids" json:"ids,omitempty"`
+}
+
+func (m *NotificationIds) Reset()                    { *m = NotificationIds{} }
+func (m *NotificationIds) String() string            { return proto1.CompactTextString(m) }
+func (*NotificationIds) ProtoMessage()               {}
+func (*NotificationIds) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+func (m *NotificationIds) GetIds() []string {
+	if m != nil {
+		return m.Ids
+	}
+	return nil
+}
+
+type NotificationReply struct {
+	Success bool               `protobuf:"varint,1,opt,name=success" json:"success,omitempty"`
+	Counts  int32              `protobuf:"varint,2,opt,name=counts" json:"counts,omitempty"`
+	Ids     []*NotificationIds `protobuf:"bytes,4,rep,name=ids" json:"ids,omitempty"`
+}
+
+func (m *NotificationReply) Reset()                    { *m = NotificationReply{} }
+func (m *NotificationReply) String() string            { return proto1.CompactTextString(m) }
+func (*NotificationReply) ProtoMessage()               {}
+func (*NotificationReply) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+func (m *NotificationReply) GetSuccess() bool {
+	if m != nil {
+		return m.Success
+	}
+	return false
+}
+
+func (m *NotificationReply) GetCounts() int32 {
+	if m != nil {
+		return m.Counts
+	}
+	return 0
+}
+
+func (m *NotificationReply) GetIds() []*NotificationIds {
+	if m != nil {
+		return m.Ids
+	}
+	return nil
+}
+
+type PushResponse struct {
+	Status      string `protobuf:"bytes,1,opt,name=status" json:"status,omitempty"`
+	Reason      string `protobuf:"bytes,2,opt,name=reason" json:"reason,omitempty"`
+	ApnsId      string `protobuf:"bytes,3,opt,name=apns_id,json=apnsId" json:"apns_id,omitempty"`
+	CanonicalId string `protobuf:"bytes,4,opt,name=canonical_id,json=canonicalId" json:"canonical_id,omitempty"`
+	Error       string `protobuf:"bytes,5,opt,name=error" json:"error,omitempty"`
+}
+
+func (m *PushResponse) Reset()                    { *m = PushResponse{} }
+func (m *PushResponse) String() string            { return proto1.CompactTextString(m) }
+func (*PushResponse) ProtoMessage()               {}
+func (*PushResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+
+func (m *PushResponse) GetStatus() string {
+	if m != nil {
+		return m.Status
+	}
+	return ""
+}
+
+func (m *PushResponse) GetReason() string {
+	if m != nil {
+		return m.Reason
+	}
+	return ""
+}
+
+func (m *PushResponse) GetApnsId() string {
+	if m != nil {
+		return m.ApnsId
+	}
+	return ""
+}
+
+func (m *PushResponse) GetCanonicalId() string {
+	if m != nil {
+		return m.CanonicalId
+	}
+	return ""
+}
+
+func (m *PushResponse) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+type TokenResult struct {
+	Id       string        `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	AppId    string        `protobuf:"bytes,2,opt,name=app_id,json=appId" json:"app_id,omitempty"`
+	Platform int32         `protobuf:"varint,3,opt,name=platform" json:"platform,omitempty"`
+	Token    string        `protobuf:"bytes,4,opt,name=token" json:"token,omitempty"`
+	Response *PushResponse `protobuf:"bytes,5,opt,name=response" json:"response,omitempty"`
+}
+
+func (m *TokenResult) Reset()                    { *m = TokenResult{} }
+func (m *TokenResult) String() string            { return proto1.CompactTextString(m) }
+func (*TokenResult) ProtoMessage()               {}
+func (*TokenResult) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+func (m *TokenResult) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *TokenResult) GetAppId() string {
+	if m != nil {
+		return m.AppId
+	}
+	return ""
+}
+
+func (m *TokenResult) GetPlatform() int32 {
+	if m != nil {
+		return m.Platform
+	}
+	return 0
+}
+
+func (m *TokenResult) GetToken() string {
+	if m != nil {
+		return m.Token
+	}
+	return ""
+}
+
+func (m *TokenResult) GetResponse() *PushResponse {
+	if m != nil {
+		return m.Response
+	}
+	return nil
+}
+
+func init() {
+	proto1.RegisterType((*Alert)(nil), "proto.Alert")
+	proto1.RegisterType((*AndroidNotification)(nil), "proto.AndroidNotification")
+	proto1.RegisterType((*Notification)(nil), "proto.Notification")
+	proto1.RegisterType((*NotificationRequest)(nil), "proto.NotificationRequest")
+	proto1.RegisterType((*NotificationIds)(nil), "proto.NotificationIds")
+	proto1.RegisterType((*NotificationReply)(nil), "proto.NotificationReply")
+	proto1.RegisterType((*PushResponse)(nil), "proto.PushResponse")
+	proto1.RegisterType((*TokenResult)(nil), "proto.TokenResult")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// Client API for Gorush service
+
+type GorushClient interface {
+	// Send queues notifications like POST /api/push.
+	Send(ctx context.Context, in *NotificationRequest, opts ...grpc.CallOption) (*NotificationReply, error)
+	// SendAndWatch queues notifications and streams the final result of each
+	// token, the stream is finished after all tokens are sent.
+	SendAndWatch(ctx context.Context, in *NotificationRequest, opts ...grpc.CallOption) (Gorush_SendAndWatchClient, error)
+}
+
+type gorushClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewGorushClient(cc *grpc.ClientConn) GorushClient {
+	return &gorushClient{cc}
+}
+
+func (c *gorushClient) Send(ctx context.Context, in *NotificationRequest, opts ...grpc.CallOption) (*NotificationReply, error) {
+	out := new(NotificationReply)
+	err := grpc.Invoke(ctx, "/proto.Gorush/Send", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gorushClient) SendAndWatch(ctx context.Context, in *NotificationRequest, opts ...grpc.CallOption) (Gorush_SendAndWatchClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Gorush_serviceDesc.Streams[0], c.cc, "/proto.Gorush/SendAndWatch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &gorushSendAndWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Gorush_SendAndWatchClient interface {
+	Recv() (*TokenResult, error)
+	grpc.ClientStream
+}
+
+type gorushSendAndWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *gorushSendAndWatchClient) Recv() (*TokenResult, error) {
+	m := new(TokenResult)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Server API for Gorush service
+
+type GorushServer interface {
+	// Send queues notifications like POST /api/push.
+	Send(context.Context, *NotificationRequest) (*NotificationReply, error)
+	// SendAndWatch queues notifications and streams the final result of each
+	// token, the stream is finished after all tokens are sent.
+	SendAndWatch(*NotificationRequest, Gorush_SendAndWatchServer) error
+}
+
+func RegisterGorushServer(s *grpc.Server, srv GorushServer) {
+	s.RegisterService(&_Gorush_serviceDesc, srv)
+}
+
+func _Gorush_Send_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NotificationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GorushServer).Send(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Gorush/Send",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GorushServer).Send(ctx, req.(*NotificationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gorush_SendAndWatch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(NotificationRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GorushServer).SendAndWatch(m, &gorushSendAndWatchServer{stream})
+}
+
+type Gorush_SendAndWatchServer interface {
+	Send(*TokenResult) error
+	grpc.ServerStream
+}
+
+type gorushSendAndWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *gorushSendAndWatchServer) Send(m *TokenResult) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+var _Gorush_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "proto.Gorush",
+	HandlerType: (*GorushServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Send",
+			Handler:    _Gorush_Send_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SendAndWatch",
+			Handler:       _Gorush_SendAndWatch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "rpc/proto/gorush.proto",
+}
+
+func init() { proto1.RegisterFile("rpc/proto/gorush.proto", fileDescriptor0) }
+
+var fileDescriptor0 = []byte{
+	// 1202 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x7c, 0x56, 0xdd, 0x6e, 0x1c, 0x35,
+	0x14, 0xee, 0xfe, 0x66, 0xd7, 0xbb, 0x49, 0x53, 0x87, 0xa6, 0x66, 0x41, 0x25, 0x9d, 0x16, 0x88,
+	0x54, 0x29, 0x81, 0x94, 0x16, 0xda, 0x8b, 0x4a, 0x0b, 0x48, 0x28, 0x50, 0x55, 0xd5, 0xb4, 0xd0,
+	0xcb, 0x91, 0xd7, 0xe3, 0x6c, 0xac, 0xf5, 0xda, 0x83, 0xed, 0x49, 0x99, 0x17, 0xe0, 0x8a, 0x0b,
+	0xee, 0x78, 0x37, 0x6e, 0x78, 0x15, 0xe4, 0x63, 0xcf, 0xee, 0x6c, 0x12, 0xe5, 0x6a, 0xe7, 0xfb,
+	0xce, 0xb1, 0x7d, 0xfc, 0x9d, 0x1f, 0x2f, 0xda, 0x37, 0x05, 0x3b, 0x2e, 0x8c, 0x76, 0xfa, 0x78,
+	0xae, 0x4d, 0x69, 0xcf, 0x8f, 0x00, 0xe0, 0x1e, 0xfc, 0x4c, 0x3e, 0x9d, 0x6b, 0x3d, 0x97, 0x3c,
+	0x78, 0xcc, 0xca, 0xb3, 0x63, 0xeb, 0x4c, 0xc9, 0x5c, 0x70, 0x9a, 0xdc, 0xbf, 0x6c, 0xfd, 0x60,
+	0x68, 0x51, 0x70, 0x63, 0x83, 0x3d, 0xf9, 0xb3, 0x8d, 0x7a, 0x53, 0xc9, 0x8d, 0xc3, 0x1f, 0xa1,
+	0x9e, 0x13, 0x4e, 0x72, 0xd2, 0x3a, 0x68, 0x1d, 0x0e, 0xd3, 0x00, 0xf0, 0x04, 0x0d, 0x6c, 0x39,
+	0x0b, 0x86, 0x36, 0x18, 0x56, 0x18, 0x63, 0xd4, 0x9d, 0xe9, 0xbc, 0x22, 0x1d, 0xe0, 0xe1, 0x1b,
+	0xef, 0xa3, 0x3e, 0x65, 0x4e, 0x68, 0x45, 0xba, 0xc0, 0x46, 0x84, 0x1f, 0xa0, 0xb1, 0xa4, 0xa5,
+	0x62, 0xe7, 0x99, 0x58, 0xd2, 0x39, 0x27, 0x3d, 0xb0, 0x8e, 0x02, 0x77, 0xea, 0x29, 0x7c, 0x0f,
+	0x6d, 0x49, 0xcd, 0xb2, 0x05, 0xaf, 0x48, 0x3f, 0xac, 0x95, 0x9a, 0xfd, 0xc2, 0x2b, 0xfc, 0x31,
+	0x1a, 0x78, 0x03, 0x35, 0x73, 0x4b, 0xb6, 0x0e, 0x3a, 0x87, 0xc3, 0xd4, 0x3b, 0x4e, 0xcd, 0xdc,
+	0xe2, 0x04, 0x6d, 0x43, 0x2c, 0x59, 0xbd, 0x72, 0x10, 0xf6, 0x05, 0xf2, 0x55, 0x58, 0xfe, 0x08,
+	0xed, 0xac, 0x7d, 0x60, 0x93, 0x21, 0x6c, 0x32, 0xae, 0x9d, 0xfc, 0x4e, 0xc9, 0xbf, 0x6d, 0xb4,
+	0x37, 0x55, 0xb9, 0xd1, 0x22, 0x7f, 0xad, 0x9d, 0x38, 0x13, 0x8c, 0x42, 0xe0, 0xd7, 0xcb, 0x52,
+	0x5f, 0xbd, 0xdd, 0xb8, 0x3a, 0x46, 0x5d, 0xc1, 0xb4, 0xaa, 0xe5, 0x10, 0x2c, 0xac, 0xb6, 0xba,
+	0x54, 0x79, 0x54, 0x23, 0x00, 0xcf, 0xce, 0x68, 0xbe, 0x52, 0x21, 0x00, 0xbc, 0x8b, 0x3a, 0x8e,
+	0xce, 0xe3, 0xdd, 0xfd, 0xa7, 0xf7, 0x63, 0x5a, 0x6a, 0x43, 0xb6, 0x82, 0x1f, 0x00, 0x2f, 0x25,
+	0x93, 0x82, 0x2d, 0xb2, 0x28, 0x74, 0xbc, 0x32, 0x70, 0xd3, 0xa0, 0xf6, 0x01, 0x1a, 0xfb, 0x90,
+	0x56, 0xaa, 0x0c, 0xc1, 0x05, 0x79, 0x2e, 0x8a, 0x92, 0xa0, 0xed, 0x95, 0x07, 0x68, 0x82, 0xc2,
+	0x2e, 0xd1, 0x05, 0xc4, 0xbd, 0x2a, 0xdc, 0xe8, 0xa0, 0x75, 0x59, 0xb8, 0xab, 0x29, 0x18, 0x5f,
+	0x49, 0x41, 0xf2, 0xdf, 0x10, 0x8d, 0x37, 0x54, 0xdd, 0x47, 0x7d, 0xa7, 0x17, 0x5c, 0x59, 0xd2,
+	0x82, 0x5c, 0x44, 0xe4, 0xcb, 0xad, 0x90, 0xd4, 0x9d, 0x69, 0xb3, 0x04, 0x6d, 0x7b, 0xe9, 0x0a,
+	0x63, 0x82, 0xb6, 0x96, 0xdc, 0x5a, 0x5f, 0x3d, 0x41, 0xe2, 0x1a, 0xae, 0x73, 0xd4, 0xbd, 0x54,
+	0xba, 0x85, 0x11, 0xda, 0x08, 0x57, 0x45, 0xa1, 0x57, 0x18, 0x3f, 0x46, 0x77, 0x98, 0x56, 0x8e,
+	0x2b, 0x97, 0xd1, 0x0b, 0x2a, 0x24, 0x9d, 0x49, 0x0e, 0xca, 0x0f, 0xd2, 0xdd, 0x68, 0x98, 0xd6,
+	0xfc, 0x3a, 0x89, 0x5b, 0xcd, 0x24, 0x3e, 0x46, 0xdd, 0x9c, 0x3a, 0x0a, 0xf2, 0x8f, 0x4e, 0xee,
+	0x1d, 0x85, 0x46, 0x3b, 0xaa, 0x1b, 0xed, 0xe8, 0x2d, 0xb4, 0x61, 0x0a, 0x4e, 0xf8, 0x2e, 0xea,
+	0xd3, 0xa2, 0xc8, 0x44, 0x1e, 0x53, 0xd1, 0xa3, 0x45, 0x71, 0x0a, 0x85, 0x60, 0xb8, 0x33, 0x15,
+	0xa8, 0xdf, 0x4b, 0x03, 0x80, 0x04, 0x53, 0x29, 0x67, 0x94, 0x2d, 0xb2, 0xd2, 0xc8, 0xa8, 0xfa,
+	0xa8, 0xe6, 0x7e, 0x35, 0xd2, 0xf7, 0x8a, 0xe5, 0x2a, 0xcf, 0xa8, 0x03, 0xb9, 0x3b, 0x69, 0xdf,
+	0xc3, 0x29, 0x74, 0x71, 0xce, 0x25, 0xad, 0xc8, 0x36, 0xd0, 0x01, 0x78, 0x29, 0x1c, 0x5f, 0x7a,
+	0x25, 0x39, 0xd9, 0x09, 0x52, 0xd4, 0xd8, 0xa7, 0x42, 0x6a, 0x46, 0x25, 0x27, 0xb7, 0x57, 0x5d,
+	0x47, 0x25, 0xc7, 0x4f, 0xd1, 0xf0, 0x82, 0x1a, 0xe1, 0x15, 0xb0, 0x64, 0xf7, 0xe6, 0x4b, 0xae,
+	0x3d, 0x7d, 0xb3, 0x96, 0x96, 0x9b, 0x4c, 0xe4, 0x96, 0xdc, 0x09, 0xcd, 0xea, 0xf1, 0x69, 0x6e,
+	0x7d, 0x83, 0x38, 0x3a, 0xb7, 0x04, 0x87, 0x06, 0xf1, 0xdf, 0xf8, 0x4b, 0x74, 0x5b, 0xe4, 0x7c,
+	0x59, 0x68, 0xc7, 0x15, 0xab, 0xa0, 0x7e, 0xf6, 0xc0, 0xbc, 0xd3, 0xa0, 0x7d, 0xc1, 0xee, 0xa0,
+	0xb6, 0xd3, 0xe4, 0x3e, 0xd8, 0xda, 0x4e, 0x83, 0x48, 0x5a, 0x4a, 0x5a, 0x58, 0x0e, 0xab, 0x3e,
+	0x8b, 0x22, 0x45, 0xce, 0x2f, 0x39, 0x44, 0xbb, 0x70, 0xfd, 0xec, 0xc3, 0xb9, 0x90, 0x3c, 0x13,
+	0xb9, 0xe4, 0xe4, 0x00, 0x72, 0xbc, 0x03, 0xfc, 0x7b, 0x4f, 0x9f, 0xe6, 0x92, 0xfb, 0x7e, 0x71,
+	0x62, 0xc9, 0x33, 0xa7, 0x33, 0x29, 0x2e, 0x38, 0x79, 0x70, 0xd0, 0x3a, 0xdc, 0x4e, 0x91, 0xe7,
+	0xde, 0xe9, 0x57, 0xe2, 0x82, 0xe3, 0x67, 0xe8, 0x9e, 0xe1, 0xd6, 0x19, 0xc1, 0x1c, 0xcf, 0xb3,
+	0x82, 0xb2, 0x05, 0x9d, 0xf3, 0x4c, 0xd1, 0x25, 0x27, 0x09, 0x9c, 0x7c, 0x77, 0x6d, 0x7e, 0x13,
+	0xac, 0xaf, 0xe9, 0x12, 0x86, 0x5a, 0x6e, 0xaa, 0xcc, 0x94, 0x8a, 0x3c, 0x84, 0xa3, 0xfb, 0xb9,
+	0xa9, 0xd2, 0x52, 0x79, 0x03, 0x2d, 0x04, 0x84, 0xfe, 0x28, 0x4e, 0xca, 0x42, 0xf8, 0xa8, 0x5f,
+	0xa2, 0xb1, 0x6a, 0xb4, 0x0a, 0xf9, 0x1c, 0xa4, 0x9f, 0x04, 0xcd, 0x8f, 0xae, 0x19, 0x51, 0xe9,
+	0x86, 0x3f, 0x7e, 0x81, 0xc6, 0x34, 0x38, 0x65, 0x50, 0x9f, 0x5f, 0xdc, 0x9c, 0xba, 0x51, 0x74,
+	0xfe, 0xd1, 0x97, 0xe9, 0x7d, 0x84, 0xf8, 0x1f, 0x85, 0x30, 0xe1, 0xe4, 0x13, 0x28, 0xa1, 0x06,
+	0x13, 0x82, 0x56, 0xd6, 0xd7, 0xf1, 0x93, 0x3a, 0x68, 0x65, 0x43, 0x21, 0x3b, 0x5d, 0x08, 0x46,
+	0xbe, 0x89, 0x1d, 0xe8, 0x01, 0xfe, 0xba, 0x9e, 0x73, 0x4f, 0x21, 0x86, 0x4f, 0xae, 0xc4, 0x70,
+	0xaa, 0xdc, 0x93, 0x93, 0xdf, 0xa8, 0x2c, 0x79, 0x3d, 0x04, 0x27, 0x68, 0xc0, 0xa8, 0xe3, 0x73,
+	0x6d, 0x2a, 0xf2, 0x2c, 0x54, 0x6a, 0x8d, 0x71, 0x82, 0x7a, 0xd4, 0x3f, 0x55, 0xe4, 0x5b, 0xd8,
+	0x6e, 0x5c, 0x4b, 0xe2, 0xb9, 0x34, 0x98, 0x7c, 0x3d, 0x2d, 0x4b, 0xe7, 0x4b, 0x31, 0x8b, 0x7d,
+	0x4c, 0xbe, 0x0b, 0x29, 0x8f, 0xf4, 0x0f, 0x81, 0x85, 0x3a, 0x35, 0x32, 0x8c, 0xb5, 0xe7, 0xb1,
+	0x4e, 0x8d, 0x84, 0x89, 0x76, 0x82, 0x06, 0x42, 0xdb, 0xa0, 0xde, 0x8b, 0x9b, 0xd5, 0xdb, 0x12,
+	0xda, 0x7a, 0xe5, 0x92, 0x37, 0x68, 0x6f, 0x23, 0x27, 0xfc, 0xf7, 0x92, 0x5b, 0x87, 0x9f, 0xa3,
+	0xed, 0x66, 0x72, 0xc2, 0xb8, 0x1b, 0x9d, 0xec, 0xc5, 0xd0, 0x37, 0x96, 0x6c, 0x7a, 0x26, 0x0f,
+	0xd1, 0xed, 0xa6, 0xd9, 0x37, 0xd0, 0x2e, 0xea, 0x88, 0x3c, 0xec, 0x31, 0x4c, 0xfd, 0x67, 0x52,
+	0xa2, 0x3b, 0x9b, 0xc7, 0x16, 0xb2, 0xf2, 0x83, 0xd2, 0x96, 0x8c, 0x71, 0x6b, 0xe1, 0xd1, 0x1a,
+	0xa4, 0x35, 0xf4, 0xbd, 0xce, 0x74, 0xa9, 0x9c, 0x8d, 0xc3, 0x35, 0x22, 0x7c, 0x18, 0x36, 0xee,
+	0x42, 0x70, 0xfb, 0xd7, 0x04, 0x77, 0x9a, 0x5b, 0x38, 0xf0, 0xe7, 0xee, 0xa0, 0xb3, 0xdb, 0x4d,
+	0xfe, 0x6e, 0xa1, 0xf1, 0x9b, 0xd2, 0x9e, 0xa7, 0xdc, 0x16, 0x5a, 0x59, 0x18, 0x22, 0xd6, 0x51,
+	0x57, 0xda, 0xf8, 0x4c, 0x46, 0xe4, 0x79, 0xc3, 0xa9, 0xd5, 0x2a, 0xbe, 0x94, 0x11, 0x35, 0x0b,
+	0xa9, 0xb3, 0x51, 0x48, 0x30, 0xfb, 0x94, 0x56, 0x82, 0x51, 0xe9, 0xad, 0xdd, 0x7a, 0xf6, 0x45,
+	0x2e, 0xd4, 0x1a, 0x37, 0x46, 0x9b, 0xfa, 0xf5, 0x04, 0x90, 0xfc, 0xd3, 0x42, 0xa3, 0x77, 0xfe,
+	0x11, 0x49, 0xb9, 0x2d, 0xa5, 0xf3, 0xf3, 0x42, 0xe4, 0x31, 0x9a, 0xb6, 0xc8, 0x1b, 0x13, 0xb8,
+	0xdd, 0x9c, 0xc0, 0xcd, 0x07, 0xa7, 0x73, 0xe9, 0xc1, 0x81, 0xa2, 0x5e, 0x70, 0xb5, 0x7a, 0x56,
+	0x3c, 0xc0, 0xc7, 0x68, 0x60, 0xe2, 0xb5, 0x21, 0x82, 0x75, 0x36, 0x9b, 0x8a, 0xa4, 0x2b, 0xa7,
+	0x93, 0xbf, 0x5a, 0xa8, 0xff, 0x13, 0xfc, 0x71, 0xc3, 0x2f, 0x51, 0xf7, 0x2d, 0x57, 0x39, 0x9e,
+	0x5c, 0x97, 0xff, 0x50, 0x32, 0x13, 0x72, 0xad, 0xad, 0x90, 0x55, 0x72, 0x0b, 0x7f, 0x8f, 0xc6,
+	0x7e, 0xfd, 0x54, 0xe5, 0xef, 0xa9, 0x63, 0xe7, 0x37, 0xee, 0x83, 0xa3, 0xad, 0x21, 0x4a, 0x72,
+	0xeb, 0xab, 0xd6, 0xac, 0x0f, 0xf4, 0x93, 0xff, 0x07, 0x00, 0x3e, 0xde, 0x96, 0x55, 0x57, 0x0a,
+	0x00, 0x00,
+}
@@ -0,0 +1,302 @@
+// +build grpc
+
+package rpc
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lalit-verma/gorush/gorush"
+	"github.com/lalit-verma/gorush/rpc/proto"
+
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	"github.com/google/go-gcm"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Server is the gRPC push service.
+type Server struct{}
+
+// NewServer returns gRPC push service.
+func NewServer() *Server {
+	return &Server{}
+}
+
+// statusError maps HTTP status code of request error to gRPC status.
+func statusError(err *gorush.RequestError) error {
+	code := codes.Internal
+
+	switch err.Code {
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusNotFound:
+		code = codes.NotFound
+	}
+
+	return status.Error(code, err.Message)
+}
+
+// authenticate checks api key in "authorization: Bearer <key>" metadata.
+func authenticate(ctx context.Context) (*gorush.APIKey, *gorush.RequestError) {
+	var key string
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md["authorization"]; len(values) > 0 {
+			key = strings.TrimSpace(strings.TrimPrefix(values[0], "Bearer "))
+		}
+	}
+
+	return gorush.AuthenticateKey(key, gorush.ScopePush)
+}
+
+func convertValue(v *structpb.Value) interface{} {
+	switch k := v.GetKind().(type) {
+	case *structpb.Value_NumberValue:
+		return k.NumberValue
+	case *structpb.Value_StringValue:
+		return k.StringValue
+	case *structpb.Value_BoolValue:
+		return k.BoolValue
+	case *structpb.Value_StructValue:
+		return map[string]interface{}(convertData(k.StructValue))
+	case *structpb.Value_ListValue:
+		list := make([]interface{}, len(k.ListValue.GetValues()))
+		for i, item := range k.ListValue.GetValues() {
+			list[i] = convertValue(item)
+		}
+		return list
+	}
+
+	return nil
+}
+
+// convertData converts struct of JSON values to the data of notification.
+func convertData(data *structpb.Struct) gorush.D {
+	if len(data.GetFields()) == 0 {
+		return nil
+	}
+
+	d := make(gorush.D, len(data.Fields))
+	for k, v := range data.Fields {
+		d[k] = convertValue(v)
+	}
+
+	return d
+}
+
+func convertRequest(in *proto.NotificationRequest) gorush.RequestPush {
+	var req gorush.RequestPush
+
+	for _, n := range in.Notifications {
+		notification := gorush.PushNotification{
+			Tokens:                n.Tokens,
+			Platform:              int(n.Platform),
+			Message:               n.Message,
+			Title:                 n.Title,
+			Priority:              n.Priority,
+			ContentAvailable:      n.ContentAvailable,
+			Sound:                 n.Sound,
+			Data:                  convertData(n.Data),
+			AppID:                 n.AppId,
+			Retry:                 int(n.Retry),
+			CallbackURL:           n.CallbackUrl,
+			SendAt:                n.SendAt,
+			Delay:                 n.Delay,
+			Template:              n.Template,
+			Locale:                n.Locale,
+			Variables:             convertData(n.Variables),
+			UserIDs:               n.UserIds,
+			Tags:                  n.Tags,
+			IdempotencyKey:        n.IdempotencyKey,
+			To:                    n.To,
+			CollapseKey:           n.CollapseKey,
+			DelayWhileIdle:        n.DelayWhileIdle,
+			RestrictedPackageName: n.RestrictedPackageName,
+			DryRun:                n.DryRun,
+			APIKey:                n.ApiKey,
+			AndroidData:           convertData(n.AndroidData),
+			Expiration:            n.Expiration,
+			ApnsID:                n.ApnsId,
+			Topic:                 n.Topic,
+			Category:              n.Category,
+			MutableContent:        n.MutableContent,
+			URLArgs:               n.UrlArgs,
+			IosData:               convertData(n.IosData),
+		}
+
+		if n.TimeToLive > 0 {
+			ttl := uint(n.TimeToLive)
+			notification.TimeToLive = &ttl
+		}
+
+		if n.Badge != nil {
+			badge := int(n.Badge.Value)
+			notification.Badge = &badge
+		}
+
+		if n.Notification != nil {
+			notification.Notification = gcm.Notification{
+				Title:        n.Notification.Title,
+				Body:         n.Notification.Body,
+				Icon:         n.Notification.Icon,
+				Sound:        n.Notification.Sound,
+				Badge:        n.Notification.Badge,
+				Tag:          n.Notification.Tag,
+				Color:        n.Notification.Color,
+				ClickAction:  n.Notification.ClickAction,
+				BodyLocKey:   n.Notification.BodyLocKey,
+				BodyLocArgs:  n.Notification.BodyLocArgs,
+				TitleLocArgs: n.Notification.TitleLocArgs,
+				TitleLocKey:  n.Notification.TitleLocKey,
+			}
+		}
+
+		if n.Alert != nil {
+			notification.Alert = gorush.Alert{
+				Title:        n.Alert.Title,
+				Subtitle:     n.Alert.Subtitle,
+				Body:         n.Alert.Body,
+				Action:       n.Alert.Action,
+				LaunchImage:  n.Alert.LaunchImage,
+				LocKey:       n.Alert.LocKey,
+				LocArgs:      n.Alert.LocArgs,
+				TitleLocKey:  n.Alert.TitleLocKey,
+				TitleLocArgs: n.Alert.TitleLocArgs,
+			}
+		}
+
+		req.Notifications = append(req.Notifications, notification)
+	}
+
+	return req
+}
+
+func send(ctx context.Context, in *proto.NotificationRequest, watch bool) (*gorush.PushResult, error) {
+	apiKey, authErr := authenticate(ctx)
+	if authErr != nil {
+		return nil, statusError(authErr)
+	}
+
+	result, err := gorush.SendNotifications(apiKey, convertRequest(in), watch)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return result, nil
+}
+
+// Send queues notifications like POST /api/push.
+func (s *Server) Send(ctx context.Context, in *proto.NotificationRequest) (*proto.NotificationReply, error) {
+	result, err := send(ctx, in, false)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]*proto.NotificationIds, len(result.IDs))
+	for i, group := range result.IDs {
+		ids[i] = &proto.NotificationIds{Ids: group}
+	}
+
+	return &proto.NotificationReply{
+		Success: true,
+		Counts:  int32(result.Counts),
+		Ids:     ids,
+	}, nil
+}
+
+// SendAndWatch queues notifications and streams final result of each token.
+func (s *Server) SendAndWatch(in *proto.NotificationRequest, stream proto.Gorush_SendAndWatchServer) error {
+	result, err := send(stream.Context(), in, true)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case r, ok := <-result.Watch:
+			if !ok {
+				return nil
+			}
+
+			err := stream.Send(&proto.TokenResult{
+				Id:       r.ID,
+				AppId:    r.AppID,
+				Platform: int32(r.Platform),
+				Token:    r.Token,
+				Response: &proto.PushResponse{
+					Status:      r.Response.Status,
+					Reason:      r.Response.Reason,
+					ApnsId:      r.Response.ApnsID,
+					CanonicalId: r.Response.CanonicalId,
+					Error:       r.Response.Error,
+				},
+			})
+			if err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			// notifications are still sent, only the stream is closed.
+			return stream.Context().Err()
+		}
+	}
+}
+
+// stopServer stops gRPC server from taking new requests, running calls are
+// waited for up to core.shutdown_timeout.
+func stopServer(s *grpc.Server) {
+	done := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Duration(gorush.PushConf.Core.ShutdownTimeout) * time.Second):
+		s.Stop()
+	}
+}
+
+// serve runs gRPC server on listener until gorush is shut down.
+func serve(lis net.Listener) error {
+	s := grpc.NewServer()
+	proto.RegisterGorushServer(s, NewServer())
+
+	stopped := make(chan struct{})
+	gorush.OnShutdown(func() {
+		close(stopped)
+		stopServer(s)
+	})
+
+	err := s.Serve(lis)
+
+	select {
+	case <-stopped:
+		// listener is closed by shutdown.
+		return nil
+	default:
+		return err
+	}
+}
+
+// RunGRPCServer starts gRPC server on grpc.port of config.
+func RunGRPCServer() error {
+	lis, err := net.Listen("tcp", ":"+gorush.PushConf.GRPC.Port)
+	if err != nil {
+		return err
+	}
+
+	gorush.LogAccess.Info("gRPC server is running on " + gorush.PushConf.GRPC.Port + " port.")
+
+	return serve(lis)
+}
@@ -0,0 +1,140 @@
+// +build grpc
+
+package rpc
+
+import (
+	"net"
+	"testing"
+
+	"github.com/lalit-verma/gorush/config"
+	"github.com/lalit-verma/gorush/gorush"
+	"github.com/lalit-verma/gorush/rpc/proto"
+
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func initTest(t *testing.T) {
+	gorush.PushConf = config.BuildDefaultPushConf()
+	gorush.PushConf.Core.Mode = "test"
+	app := gorush.PushConf.Apps[gorush.AppNameDefault]
+	app.Android.Enabled = true
+	app.Android.APIKey = "apiKey"
+	gorush.PushConf.Apps[gorush.AppNameDefault] = app
+
+	assert.NoError(t, gorush.InitLog())
+	assert.NoError(t, gorush.InitAppStatus())
+	assert.NoError(t, gorush.InitQueue())
+	gorush.InitWorkers(2, 10)
+}
+
+// startServer runs gRPC server on a random local port and returns client.
+func startServer(t *testing.T) (proto.GorushClient, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	go serve(lis)
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	return proto.NewGorushClient(conn), func() {
+		conn.Close()
+		gorush.Shutdown()
+	}
+}
+
+func TestSendAndWatch(t *testing.T) {
+	initTest(t)
+
+	client, stop := startServer(t)
+	defer stop()
+
+	stream, err := client.SendAndWatch(context.Background(), &proto.NotificationRequest{
+		Notifications: []*proto.Notification{
+			{
+				// empty token is rejected before it is sent to GCM.
+				Tokens:   []string{""},
+				Platform: gorush.PlatFormAndroid,
+				Message:  "Welcome",
+			},
+		},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	result, err := stream.Recv()
+	if assert.NoError(t, err) {
+		assert.Equal(t, int32(gorush.PlatFormAndroid), result.Platform)
+		assert.Equal(t, "failed", result.Response.Status)
+	}
+
+	_, err = stream.Recv()
+	assert.Error(t, err)
+}
+
+func TestSendWithoutAPIKey(t *testing.T) {
+	initTest(t)
+	gorush.PushConf.Auth.Enabled = true
+
+	client, stop := startServer(t)
+	defer stop()
+
+	_, err := client.Send(context.Background(), &proto.NotificationRequest{
+		Notifications: []*proto.Notification{
+			{
+				Tokens:   []string{"aaaaaa"},
+				Platform: gorush.PlatFormAndroid,
+				Message:  "Welcome",
+			},
+		},
+	})
+	s, _ := status.FromError(err)
+	assert.Equal(t, codes.Unauthenticated, s.Code())
+}
+
+func TestConvertRequest(t *testing.T) {
+	req := convertRequest(&proto.NotificationRequest{
+		Notifications: []*proto.Notification{
+			{
+				Tokens:   []string{"aaaaaa"},
+				Platform: gorush.PlatFormIos,
+				Badge:    &wrappers.Int32Value{Value: 0},
+				UrlArgs:  []string{"a"},
+				Data: &structpb.Struct{
+					Fields: map[string]*structpb.Value{
+						"count": {Kind: &structpb.Value_NumberValue{NumberValue: 1}},
+						"nested": {Kind: &structpb.Value_StructValue{StructValue: &structpb.Struct{
+							Fields: map[string]*structpb.Value{
+								"ok": {Kind: &structpb.Value_BoolValue{BoolValue: true}},
+							},
+						}}},
+					},
+				},
+				Notification: &proto.AndroidNotification{Icon: "icon"},
+			},
+		},
+	})
+
+	if assert.Len(t, req.Notifications, 1) {
+		n := req.Notifications[0]
+		if assert.NotNil(t, n.Badge) {
+			assert.Equal(t, 0, *n.Badge)
+		}
+		assert.Equal(t, []string{"a"}, n.URLArgs)
+		assert.Equal(t, float64(1), n.Data["count"])
+		assert.Equal(t, map[string]interface{}{"ok": true}, n.Data["nested"])
+		assert.Equal(t, "icon", n.Notification.Icon)
+		assert.Nil(t, n.IosData)
+	}
+}
@@ -1,17 +1,13 @@
 package boltdb
 
 import (
-	"github.com/lalit-verma/gorush/config"
-	"github.com/asdine/storm"
-)
+	"bytes"
+	"context"
+	"strconv"
+	"time"
 
-// Stat variable for redis
-const (
-	TotalCountKey     = "gorush-total-count"
-	IosSuccessKey     = "gorush-ios-success-count"
-	IosErrorKey       = "gorush-ios-error-count"
-	AndroidSuccessKey = "gorush-android-success-count"
-	AndroidErrorKey   = "gorush-android-error-count"
+	"github.com/boltdb/bolt"
+	"github.com/lalit-verma/gorush/config"
 )
 
 // New func implements the storage interface for gorush (https://github.com/appleboy/gorush)
@@ -24,100 +20,252 @@ func New(config config.ConfYaml) *Storage {
 // Storage is interface structure
 type Storage struct {
 	config config.ConfYaml
+	db     *bolt.DB
 }
 
 // Init client storage.
 func (s *Storage) Init() error {
+	db, err := bolt.Open(s.config.Stat.BoltDB.Path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return err
+	}
+
+	s.db = db
+
 	return nil
 }
 
-// Reset Client storage.
-func (s *Storage) Reset() {
-	s.setBoltDB(TotalCountKey, 0)
-	s.setBoltDB(IosSuccessKey, 0)
-	s.setBoltDB(IosErrorKey, 0)
-	s.setBoltDB(AndroidSuccessKey, 0)
-	s.setBoltDB(AndroidErrorKey, 0)
+// Close client storage.
+func (s *Storage) Close() error {
+	if s.db == nil {
+		return nil
+	}
+
+	return s.db.Close()
 }
 
-func (s *Storage) setBoltDB(key string, count int64) {
-	db, _ := storm.Open(s.config.Stat.BoltDB.Path)
-	db.Set(s.config.Stat.BoltDB.Bucket, key, count)
-	defer db.Close()
+func (s *Storage) counterBucket() []byte {
+	return []byte(s.config.Stat.BoltDB.Bucket)
 }
 
-func (s *Storage) getBoltDB(key string, count *int64) {
-	db, _ := storm.Open(s.config.Stat.BoltDB.Path)
-	db.Get(s.config.Stat.BoltDB.Bucket, key, count)
-	defer db.Close()
+// counterKey keeps the key names written by earlier gorush versions.
+func counterKey(key string) []byte {
+	return []byte("gorush-" + key + "-count")
 }
 
-// AddTotalCount record push notification count.
-func (s *Storage) AddTotalCount(count int64) {
-	total := s.GetTotalCount() + count
-	s.setBoltDB(TotalCountKey, total)
+func parseCount(value []byte) (int64, error) {
+	if value == nil {
+		return 0, nil
+	}
+
+	return strconv.ParseInt(string(value), 10, 64)
 }
 
-// AddIosSuccess record counts of success iOS push notification.
-func (s *Storage) AddIosSuccess(count int64) {
-	total := s.GetIosSuccess() + count
-	s.setBoltDB(IosSuccessKey, total)
+// Incr add counts to counters in one transaction.
+func (s *Storage) Incr(ctx context.Context, counts map[string]int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(s.counterBucket())
+		if err != nil {
+			return err
+		}
+
+		for key, count := range counts {
+			total, err := parseCount(b.Get(counterKey(key)))
+			if err != nil {
+				return err
+			}
+
+			if err := b.Put(counterKey(key), []byte(strconv.FormatInt(total+count, 10))); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Counters return value of counters.
+func (s *Storage) Counters(ctx context.Context, keys ...string) (map[string]int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(keys))
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(s.counterBucket())
+		for _, key := range keys {
+			counts[key] = 0
+			if b == nil {
+				continue
+			}
+
+			count, err := parseCount(b.Get(counterKey(key)))
+			if err != nil {
+				return err
+			}
+			counts[key] = count
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return counts, nil
 }
 
-// AddIosError record counts of error iOS push notification.
-func (s *Storage) AddIosError(count int64) {
-	total := s.GetIosError() + count
-	s.setBoltDB(IosErrorKey, total)
+// DeleteCounters remove counters of keys.
+func (s *Storage) DeleteCounters(ctx context.Context, keys ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(s.counterBucket())
+		if b == nil {
+			return nil
+		}
+
+		for _, key := range keys {
+			if err := b.Delete(counterKey(key)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
 }
 
-// AddAndroidSuccess record counts of success Android push notification.
-func (s *Storage) AddAndroidSuccess(count int64) {
-	total := s.GetAndroidSuccess() + count
-	s.setBoltDB(AndroidSuccessKey, total)
+// Reset remove all counters.
+func (s *Storage) Reset(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		err := tx.DeleteBucket(s.counterBucket())
+		if err == bolt.ErrBucketNotFound {
+			return nil
+		}
+
+		return err
+	})
 }
 
-// AddAndroidError record counts of error Android push notification.
-func (s *Storage) AddAndroidError(count int64) {
-	total := s.GetAndroidError() + count
-	s.setBoltDB(AndroidErrorKey, total)
+func (s *Storage) recordBucket(bucket string) []byte {
+	return []byte(s.config.Stat.BoltDB.Bucket + "-" + bucket)
 }
 
-// GetTotalCount show counts of all notification.
-func (s *Storage) GetTotalCount() int64 {
-	var count int64
-	s.getBoltDB(TotalCountKey, &count)
+// SetRecord store value under key in bucket.
+func (s *Storage) SetRecord(ctx context.Context, bucket, key string, value []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(s.recordBucket(bucket))
+		if err != nil {
+			return err
+		}
 
-	return count
+		return b.Put([]byte(key), value)
+	})
 }
 
-// GetIosSuccess show success counts of iOS notification.
-func (s *Storage) GetIosSuccess() int64 {
-	var count int64
-	s.getBoltDB(IosSuccessKey, &count)
+// CreateRecord store value under key in bucket if key not exist.
+func (s *Storage) CreateRecord(ctx context.Context, bucket, key string, value []byte) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	created := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(s.recordBucket(bucket))
+		if err != nil {
+			return err
+		}
+
+		if b.Get([]byte(key)) != nil {
+			return nil
+		}
 
-	return count
+		created = true
+		return b.Put([]byte(key), value)
+	})
+
+	return created, err
 }
 
-// GetIosError show error counts of iOS notification.
-func (s *Storage) GetIosError() int64 {
-	var count int64
-	s.getBoltDB(IosErrorKey, &count)
+// GetRecord return value of key in bucket, nil if key not exist.
+func (s *Storage) GetRecord(ctx context.Context, bucket, key string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var value []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(s.recordBucket(bucket))
+		if b == nil {
+			return nil
+		}
 
-	return count
+		if v := b.Get([]byte(key)); v != nil {
+			value = append([]byte(nil), v...)
+		}
+
+		return nil
+	})
+
+	return value, err
 }
 
-// GetAndroidSuccess show success counts of Android notification.
-func (s *Storage) GetAndroidSuccess() int64 {
-	var count int64
-	s.getBoltDB(AndroidSuccessKey, &count)
+// DeleteRecord remove key from bucket.
+func (s *Storage) DeleteRecord(ctx context.Context, bucket, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-	return count
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(s.recordBucket(bucket))
+		if b == nil {
+			return nil
+		}
+
+		return b.Delete([]byte(key))
+	})
 }
 
-// GetAndroidError show error counts of Android notification.
-func (s *Storage) GetAndroidError() int64 {
-	var count int64
-	s.getBoltDB(AndroidErrorKey, &count)
+// RangeRecords call fn in key order for every key in bucket with prefix
+// and greater than after. Iteration stops when fn returns false, fn must
+// not call back into the storage.
+func (s *Storage) RangeRecords(ctx context.Context, bucket, prefix, after string, fn func(key string, value []byte) bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(s.recordBucket(bucket))
+		if b == nil {
+			return nil
+		}
+
+		c := b.Cursor()
+		k, v := c.Seek([]byte(prefix))
+		for ; k != nil && bytes.HasPrefix(k, []byte(prefix)); k, v = c.Next() {
+			if string(k) <= after {
+				continue
+			}
+
+			if !fn(string(k), append([]byte(nil), v...)) {
+				break
+			}
+		}
 
-	return count
+		return nil
+	})
 }
@@ -1,22 +1,14 @@
 package buntdb
 
 import (
-	"fmt"
+	"context"
 	"strconv"
+	"strings"
 
 	"github.com/lalit-verma/gorush/config"
 	"github.com/tidwall/buntdb"
 )
 
-// Stat variable for redis
-const (
-	TotalCountKey     = "gorush-total-count"
-	IosSuccessKey     = "gorush-ios-success-count"
-	IosErrorKey       = "gorush-ios-error-count"
-	AndroidSuccessKey = "gorush-android-success-count"
-	AndroidErrorKey   = "gorush-android-error-count"
-)
-
 // New func implements the storage interface for gorush (https://github.com/appleboy/gorush)
 func New(config config.ConfYaml) *Storage {
 	return &Storage{
@@ -27,109 +19,239 @@ func New(config config.ConfYaml) *Storage {
 // Storage is interface structure
 type Storage struct {
 	config config.ConfYaml
+	db     *buntdb.DB
 }
 
 // Init client storage.
 func (s *Storage) Init() error {
+	db, err := buntdb.Open(s.config.Stat.BuntDB.Path)
+	if err != nil {
+		return err
+	}
+
+	s.db = db
+
 	return nil
 }
 
-// Reset Client storage.
-func (s *Storage) Reset() {
-	s.setBuntDB(TotalCountKey, 0)
-	s.setBuntDB(IosSuccessKey, 0)
-	s.setBuntDB(IosErrorKey, 0)
-	s.setBuntDB(AndroidSuccessKey, 0)
-	s.setBuntDB(AndroidErrorKey, 0)
+// Close client storage.
+func (s *Storage) Close() error {
+	if s.db == nil {
+		return nil
+	}
+
+	return s.db.Close()
+}
+
+// counterKey keeps the key names written by earlier gorush versions.
+func counterKey(key string) string {
+	return "gorush-" + key + "-count"
+}
+
+func parseCount(value string, err error) (int64, error) {
+	if err == buntdb.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(value, 10, 64)
 }
 
-func (s *Storage) setBuntDB(key string, count int64) {
-	db, _ := buntdb.Open(s.config.Stat.BuntDB.Path)
+// Incr add counts to counters in one transaction.
+func (s *Storage) Incr(ctx context.Context, counts map[string]int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *buntdb.Tx) error {
+		for key, count := range counts {
+			total, err := parseCount(tx.Get(counterKey(key)))
+			if err != nil {
+				return err
+			}
+
+			if _, _, err := tx.Set(counterKey(key), strconv.FormatInt(total+count, 10), nil); err != nil {
+				return err
+			}
+		}
 
-	db.Update(func(tx *buntdb.Tx) error {
-		tx.Set(key, fmt.Sprintf("%d", count), nil)
 		return nil
 	})
-	defer db.Close()
 }
 
-func (s *Storage) getBuntDB(key string, count *int64) {
-	db, _ := buntdb.Open(s.config.Stat.BuntDB.Path)
+// Counters return value of counters.
+func (s *Storage) Counters(ctx context.Context, keys ...string) (map[string]int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(keys))
+	err := s.db.View(func(tx *buntdb.Tx) error {
+		for _, key := range keys {
+			count, err := parseCount(tx.Get(counterKey(key)))
+			if err != nil {
+				return err
+			}
+			counts[key] = count
+		}
 
-	db.View(func(tx *buntdb.Tx) error {
-		val, _ := tx.Get(key)
-		*count, _ = strconv.ParseInt(val, 10, 64)
 		return nil
 	})
-	defer db.Close()
-}
+	if err != nil {
+		return nil, err
+	}
 
-// AddTotalCount record push notification count.
-func (s *Storage) AddTotalCount(count int64) {
-	total := s.GetTotalCount() + count
-	s.setBuntDB(TotalCountKey, total)
+	return counts, nil
 }
 
-// AddIosSuccess record counts of success iOS push notification.
-func (s *Storage) AddIosSuccess(count int64) {
-	total := s.GetIosSuccess() + count
-	s.setBuntDB(IosSuccessKey, total)
-}
+// DeleteCounters remove counters of keys.
+func (s *Storage) DeleteCounters(ctx context.Context, keys ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *buntdb.Tx) error {
+		for _, key := range keys {
+			if _, err := tx.Delete(counterKey(key)); err != nil && err != buntdb.ErrNotFound {
+				return err
+			}
+		}
 
-// AddIosError record counts of error iOS push notification.
-func (s *Storage) AddIosError(count int64) {
-	total := s.GetIosError() + count
-	s.setBuntDB(IosErrorKey, total)
+		return nil
+	})
 }
 
-// AddAndroidSuccess record counts of success Android push notification.
-func (s *Storage) AddAndroidSuccess(count int64) {
-	total := s.GetAndroidSuccess() + count
-	s.setBuntDB(AndroidSuccessKey, total)
+// Reset remove all counters.
+func (s *Storage) Reset(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *buntdb.Tx) error {
+		var keys []string
+		err := tx.AscendKeys(counterKey("*"), func(k, v string) bool {
+			// record keys share the prefix but always contain a colon.
+			if !strings.Contains(k, ":") {
+				keys = append(keys, k)
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			if _, err := tx.Delete(key); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
 }
 
-// AddAndroidError record counts of error Android push notification.
-func (s *Storage) AddAndroidError(count int64) {
-	total := s.GetAndroidError() + count
-	s.setBuntDB(AndroidErrorKey, total)
+func recordKey(bucket, key string) string {
+	return "gorush-" + bucket + ":" + key
 }
 
-// GetTotalCount show counts of all notification.
-func (s *Storage) GetTotalCount() int64 {
-	var count int64
-	s.getBuntDB(TotalCountKey, &count)
+// SetRecord store value under key in bucket.
+func (s *Storage) SetRecord(ctx context.Context, bucket, key string, value []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-	return count
+	return s.db.Update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set(recordKey(bucket, key), string(value), nil)
+		return err
+	})
 }
 
-// GetIosSuccess show success counts of iOS notification.
-func (s *Storage) GetIosSuccess() int64 {
-	var count int64
-	s.getBuntDB(IosSuccessKey, &count)
+// CreateRecord store value under key in bucket if key not exist.
+func (s *Storage) CreateRecord(ctx context.Context, bucket, key string, value []byte) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	created := false
+	err := s.db.Update(func(tx *buntdb.Tx) error {
+		_, err := tx.Get(recordKey(bucket, key))
+		if err == nil {
+			return nil
+		}
+		if err != buntdb.ErrNotFound {
+			return err
+		}
+
+		created = true
+		_, _, err = tx.Set(recordKey(bucket, key), string(value), nil)
+		return err
+	})
 
-	return count
+	return created, err
 }
 
-// GetIosError show error counts of iOS notification.
-func (s *Storage) GetIosError() int64 {
-	var count int64
-	s.getBuntDB(IosErrorKey, &count)
+// GetRecord return value of key in bucket, nil if key not exist.
+func (s *Storage) GetRecord(ctx context.Context, bucket, key string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var value []byte
+	err := s.db.View(func(tx *buntdb.Tx) error {
+		val, err := tx.Get(recordKey(bucket, key))
+		if err == buntdb.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		value = []byte(val)
+		return nil
+	})
 
-	return count
+	return value, err
 }
 
-// GetAndroidSuccess show success counts of Android notification.
-func (s *Storage) GetAndroidSuccess() int64 {
-	var count int64
-	s.getBuntDB(AndroidSuccessKey, &count)
+// DeleteRecord remove key from bucket.
+func (s *Storage) DeleteRecord(ctx context.Context, bucket, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *buntdb.Tx) error {
+		_, err := tx.Delete(recordKey(bucket, key))
+		if err == buntdb.ErrNotFound {
+			return nil
+		}
 
-	return count
+		return err
+	})
 }
 
-// GetAndroidError show error counts of Android notification.
-func (s *Storage) GetAndroidError() int64 {
-	var count int64
-	s.getBuntDB(AndroidErrorKey, &count)
+// RangeRecords call fn in key order for every key in bucket with prefix
+// and greater than after. Iteration stops when fn returns false, fn must
+// not call back into the storage.
+func (s *Storage) RangeRecords(ctx context.Context, bucket, prefix, after string, fn func(key string, value []byte) bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	base := recordKey(bucket, "")
+	return s.db.View(func(tx *buntdb.Tx) error {
+		return tx.AscendGreaterOrEqual("", base+prefix, func(k, v string) bool {
+			if !strings.HasPrefix(k, base+prefix) {
+				return false
+			}
+
+			key := strings.TrimPrefix(k, base)
+			if key <= after {
+				return true
+			}
 
-	return count
+			return fn(key, []byte(v))
+		})
+	})
 }
@@ -1,42 +1,16 @@
 package leveldb
 
 import (
-	"fmt"
+	"context"
 	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/lalit-verma/gorush/config"
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
-// Stat variable for redis
-const (
-	TotalCountKey     = "gorush-total-count"
-	IosSuccessKey     = "gorush-ios-success-count"
-	IosErrorKey       = "gorush-ios-error-count"
-	AndroidSuccessKey = "gorush-android-success-count"
-	AndroidErrorKey   = "gorush-android-error-count"
-)
-
-var dbPath string
-
-func setLevelDB(key string, count int64) {
-	db, _ := leveldb.OpenFile(dbPath, nil)
-	value := fmt.Sprintf("%d", count)
-
-	_ = db.Put([]byte(key), []byte(value), nil)
-
-	defer db.Close()
-}
-
-func getLevelDB(key string, count *int64) {
-	db, _ := leveldb.OpenFile(dbPath, nil)
-
-	data, _ := db.Get([]byte(key), nil)
-	*count, _ = strconv.ParseInt(string(data), 10, 64)
-
-	defer db.Close()
-}
-
 // New func implements the storage interface for gorush (https://github.com/appleboy/gorush)
 func New(config config.ConfYaml) *Storage {
 	return &Storage{
@@ -47,89 +21,222 @@ func New(config config.ConfYaml) *Storage {
 // Storage is interface structure
 type Storage struct {
 	config config.ConfYaml
+	db     *leveldb.DB
+
+	// lock serializes read-modify-write updates, leveldb has no
+	// transactions.
+	lock sync.Mutex
 }
 
 // Init client storage.
 func (s *Storage) Init() error {
-	dbPath = s.config.Stat.LevelDB.Path
+	db, err := leveldb.OpenFile(s.config.Stat.LevelDB.Path, nil)
+	if err != nil {
+		return err
+	}
+
+	s.db = db
+
 	return nil
 }
 
-// Reset Client storage.
-func (s *Storage) Reset() {
-	setLevelDB(TotalCountKey, 0)
-	setLevelDB(IosSuccessKey, 0)
-	setLevelDB(IosErrorKey, 0)
-	setLevelDB(AndroidSuccessKey, 0)
-	setLevelDB(AndroidErrorKey, 0)
+// Close client storage.
+func (s *Storage) Close() error {
+	if s.db == nil {
+		return nil
+	}
+
+	return s.db.Close()
 }
 
-// AddTotalCount record push notification count.
-func (s *Storage) AddTotalCount(count int64) {
-	total := s.GetTotalCount() + count
-	setLevelDB(TotalCountKey, total)
+// counterKey keeps the key names written by earlier gorush versions.
+func counterKey(key string) []byte {
+	return []byte("gorush-" + key + "-count")
 }
 
-// AddIosSuccess record counts of success iOS push notification.
-func (s *Storage) AddIosSuccess(count int64) {
-	total := s.GetIosSuccess() + count
-	setLevelDB(IosSuccessKey, total)
+func (s *Storage) getCount(key []byte) (int64, error) {
+	value, err := s.db.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(string(value), 10, 64)
 }
 
-// AddIosError record counts of error iOS push notification.
-func (s *Storage) AddIosError(count int64) {
-	total := s.GetIosError() + count
-	setLevelDB(IosErrorKey, total)
+// Incr add counts to counters in one batch.
+func (s *Storage) Incr(ctx context.Context, counts map[string]int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	batch := new(leveldb.Batch)
+	for key, count := range counts {
+		total, err := s.getCount(counterKey(key))
+		if err != nil {
+			return err
+		}
+
+		batch.Put(counterKey(key), []byte(strconv.FormatInt(total+count, 10)))
+	}
+
+	return s.db.Write(batch, nil)
 }
 
-// AddAndroidSuccess record counts of success Android push notification.
-func (s *Storage) AddAndroidSuccess(count int64) {
-	total := s.GetAndroidSuccess() + count
-	setLevelDB(AndroidSuccessKey, total)
+// Counters return value of counters.
+func (s *Storage) Counters(ctx context.Context, keys ...string) (map[string]int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	snap, err := s.db.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Release()
+
+	counts := make(map[string]int64, len(keys))
+	for _, key := range keys {
+		value, err := snap.Get(counterKey(key), nil)
+		if err == leveldb.ErrNotFound {
+			counts[key] = 0
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if counts[key], err = strconv.ParseInt(string(value), 10, 64); err != nil {
+			return nil, err
+		}
+	}
+
+	return counts, nil
 }
 
-// AddAndroidError record counts of error Android push notification.
-func (s *Storage) AddAndroidError(count int64) {
-	total := s.GetAndroidError() + count
-	setLevelDB(AndroidErrorKey, total)
+// DeleteCounters remove counters of keys.
+func (s *Storage) DeleteCounters(ctx context.Context, keys ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	batch := new(leveldb.Batch)
+	for _, key := range keys {
+		batch.Delete(counterKey(key))
+	}
+
+	return s.db.Write(batch, nil)
 }
 
-// GetTotalCount show counts of all notification.
-func (s *Storage) GetTotalCount() int64 {
-	var count int64
-	getLevelDB(TotalCountKey, &count)
+// Reset remove all counters.
+func (s *Storage) Reset(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-	return count
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	batch := new(leveldb.Batch)
+	iter := s.db.NewIterator(util.BytesPrefix([]byte("gorush-")), nil)
+	for iter.Next() {
+		key := string(iter.Key())
+		// record keys share the prefix but always contain a colon.
+		if strings.HasSuffix(key, "-count") && !strings.Contains(key, ":") {
+			batch.Delete([]byte(key))
+		}
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	return s.db.Write(batch, nil)
 }
 
-// GetIosSuccess show success counts of iOS notification.
-func (s *Storage) GetIosSuccess() int64 {
-	var count int64
-	getLevelDB(IosSuccessKey, &count)
+func recordKey(bucket, key string) string {
+	return "gorush-" + bucket + ":" + key
+}
 
-	return count
+// SetRecord store value under key in bucket.
+func (s *Storage) SetRecord(ctx context.Context, bucket, key string, value []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.db.Put([]byte(recordKey(bucket, key)), value, nil)
 }
 
-// GetIosError show error counts of iOS notification.
-func (s *Storage) GetIosError() int64 {
-	var count int64
-	getLevelDB(IosErrorKey, &count)
+// CreateRecord store value under key in bucket if key not exist.
+func (s *Storage) CreateRecord(ctx context.Context, bucket, key string, value []byte) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
 
-	return count
+	exists, err := s.db.Has([]byte(recordKey(bucket, key)), nil)
+	if err != nil || exists {
+		return false, err
+	}
+
+	return true, s.db.Put([]byte(recordKey(bucket, key)), value, nil)
+}
+
+// GetRecord return value of key in bucket, nil if key not exist.
+func (s *Storage) GetRecord(ctx context.Context, bucket, key string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	value, err := s.db.Get([]byte(recordKey(bucket, key)), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, nil
+	}
+
+	return value, err
 }
 
-// GetAndroidSuccess show success counts of Android notification.
-func (s *Storage) GetAndroidSuccess() int64 {
-	var count int64
-	getLevelDB(AndroidSuccessKey, &count)
+// DeleteRecord remove key from bucket.
+func (s *Storage) DeleteRecord(ctx context.Context, bucket, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-	return count
+	return s.db.Delete([]byte(recordKey(bucket, key)), nil)
 }
 
-// GetAndroidError show error counts of Android notification.
-func (s *Storage) GetAndroidError() int64 {
-	var count int64
-	getLevelDB(AndroidErrorKey, &count)
+// RangeRecords call fn in key order for every key in bucket with prefix
+// and greater than after. Iteration stops when fn returns false, fn must
+// not call back into the storage.
+func (s *Storage) RangeRecords(ctx context.Context, bucket, prefix, after string, fn func(key string, value []byte) bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	base := recordKey(bucket, "")
+	iter := s.db.NewIterator(util.BytesPrefix([]byte(base+prefix)), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		key := strings.TrimPrefix(string(iter.Key()), base)
+		if key <= after {
+			continue
+		}
+
+		if !fn(key, append([]byte(nil), iter.Value()...)) {
+			break
+		}
+	}
 
-	return count
+	return iter.Error()
 }
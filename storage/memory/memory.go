@@ -1,38 +1,25 @@
 package memory
 
 import (
-	"sync/atomic"
+	"context"
+	"sort"
+	"strings"
+	"sync"
 )
 
-// StatusApp is app status structure
-type statApp struct {
-	TotalCount int64         `json:"total_count"`
-	Ios        IosStatus     `json:"ios"`
-	Android    AndroidStatus `json:"android"`
-}
-
-// AndroidStatus is android structure
-type AndroidStatus struct {
-	PushSuccess int64 `json:"push_success"`
-	PushError   int64 `json:"push_error"`
-}
-
-// IosStatus is iOS structure
-type IosStatus struct {
-	PushSuccess int64 `json:"push_success"`
-	PushError   int64 `json:"push_error"`
-}
-
 // New func implements the storage interface for gorush (https://github.com/appleboy/gorush)
 func New() *Storage {
 	return &Storage{
-		stat: &statApp{},
+		counts:  make(map[string]int64),
+		records: make(map[string]map[string][]byte),
 	}
 }
 
 // Storage is interface structure
 type Storage struct {
-	stat *statApp
+	sync.RWMutex
+	counts  map[string]int64
+	records map[string]map[string][]byte
 }
 
 // Init client storage.
@@ -40,71 +27,167 @@ func (s *Storage) Init() error {
 	return nil
 }
 
-// Reset Client storage.
-func (s *Storage) Reset() {
-	atomic.StoreInt64(&s.stat.TotalCount, 0)
-	atomic.StoreInt64(&s.stat.Ios.PushSuccess, 0)
-	atomic.StoreInt64(&s.stat.Ios.PushError, 0)
-	atomic.StoreInt64(&s.stat.Android.PushSuccess, 0)
-	atomic.StoreInt64(&s.stat.Android.PushError, 0)
+// Close client storage.
+func (s *Storage) Close() error {
+	return nil
 }
 
-// AddTotalCount record push notification count.
-func (s *Storage) AddTotalCount(count int64) {
-	atomic.AddInt64(&s.stat.TotalCount, count)
-}
+// Incr add counts to counters.
+func (s *Storage) Incr(ctx context.Context, counts map[string]int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-// AddIosSuccess record counts of success iOS push notification.
-func (s *Storage) AddIosSuccess(count int64) {
-	atomic.AddInt64(&s.stat.Ios.PushSuccess, count)
+	s.Lock()
+	defer s.Unlock()
+
+	for key, count := range counts {
+		s.counts[key] += count
+	}
+
+	return nil
 }
 
-// AddIosError record counts of error iOS push notification.
-func (s *Storage) AddIosError(count int64) {
-	atomic.AddInt64(&s.stat.Ios.PushError, count)
+// Counters return value of counters.
+func (s *Storage) Counters(ctx context.Context, keys ...string) (map[string]int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.RLock()
+	defer s.RUnlock()
+
+	counts := make(map[string]int64, len(keys))
+	for _, key := range keys {
+		counts[key] = s.counts[key]
+	}
+
+	return counts, nil
 }
 
-// AddAndroidSuccess record counts of success Android push notification.
-func (s *Storage) AddAndroidSuccess(count int64) {
-	atomic.AddInt64(&s.stat.Android.PushSuccess, count)
+// DeleteCounters remove counters of keys.
+func (s *Storage) DeleteCounters(ctx context.Context, keys ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	for _, key := range keys {
+		delete(s.counts, key)
+	}
+
+	return nil
 }
 
-// AddAndroidError record counts of error Android push notification.
-func (s *Storage) AddAndroidError(count int64) {
-	atomic.AddInt64(&s.stat.Android.PushError, count)
+// Reset remove all counters.
+func (s *Storage) Reset(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.Lock()
+	s.counts = make(map[string]int64)
+	s.Unlock()
+
+	return nil
 }
 
-// GetTotalCount show counts of all notification.
-func (s *Storage) GetTotalCount() int64 {
-	count := atomic.LoadInt64(&s.stat.TotalCount)
+// SetRecord store value under key in bucket.
+func (s *Storage) SetRecord(ctx context.Context, bucket, key string, value []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
 
-	return count
+	if s.records[bucket] == nil {
+		s.records[bucket] = make(map[string][]byte)
+	}
+	s.records[bucket][key] = append([]byte(nil), value...)
+
+	return nil
 }
 
-// GetIosSuccess show success counts of iOS notification.
-func (s *Storage) GetIosSuccess() int64 {
-	count := atomic.LoadInt64(&s.stat.Ios.PushSuccess)
+// CreateRecord store value under key in bucket if key not exist.
+func (s *Storage) CreateRecord(ctx context.Context, bucket, key string, value []byte) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
 
-	return count
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.records[bucket][key]; ok {
+		return false, nil
+	}
+
+	if s.records[bucket] == nil {
+		s.records[bucket] = make(map[string][]byte)
+	}
+	s.records[bucket][key] = append([]byte(nil), value...)
+
+	return true, nil
 }
 
-// GetIosError show error counts of iOS notification.
-func (s *Storage) GetIosError() int64 {
-	count := atomic.LoadInt64(&s.stat.Ios.PushError)
+// GetRecord return value of key in bucket, nil if key not exist.
+func (s *Storage) GetRecord(ctx context.Context, bucket, key string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.RLock()
+	defer s.RUnlock()
+
+	value, ok := s.records[bucket][key]
+	if !ok {
+		return nil, nil
+	}
 
-	return count
+	return append([]byte(nil), value...), nil
 }
 
-// GetAndroidSuccess show success counts of Android notification.
-func (s *Storage) GetAndroidSuccess() int64 {
-	count := atomic.LoadInt64(&s.stat.Android.PushSuccess)
+// DeleteRecord remove key from bucket.
+func (s *Storage) DeleteRecord(ctx context.Context, bucket, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-	return count
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.records[bucket], key)
+
+	return nil
 }
 
-// GetAndroidError show error counts of Android notification.
-func (s *Storage) GetAndroidError() int64 {
-	count := atomic.LoadInt64(&s.stat.Android.PushError)
+// RangeRecords call fn in key order for every key in bucket with prefix
+// and greater than after. Iteration stops when fn returns false, fn must
+// not call back into the storage.
+func (s *Storage) RangeRecords(ctx context.Context, bucket, prefix, after string, fn func(key string, value []byte) bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.RLock()
+	keys := []string{}
+	values := make(map[string][]byte)
+	for key, value := range s.records[bucket] {
+		if strings.HasPrefix(key, prefix) && key > after {
+			keys = append(keys, key)
+			values[key] = append([]byte(nil), value...)
+		}
+	}
+	s.RUnlock()
 
-	return count
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !fn(key, values[key]) {
+			break
+		}
+	}
+
+	return nil
 }
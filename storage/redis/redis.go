@@ -1,6 +1,7 @@
 package redis
 
 import (
+	"context"
 	"log"
 	"strconv"
 
@@ -8,17 +9,13 @@ import (
 	"gopkg.in/redis.v5"
 )
 
-// Stat variable for redis
-const (
-	TotalCountKey     = "gorush-total-count"
-	IosSuccessKey     = "gorush-ios-success-count"
-	IosErrorKey       = "gorush-ios-error-count"
-	AndroidSuccessKey = "gorush-android-success-count"
-	AndroidErrorKey   = "gorush-android-error-count"
-)
+// CountersKey is the set of all counter keys written by gorush, Reset
+// removes every member of it.
+const CountersKey = "gorush-counters"
 
-//
-var redisClient *redis.Client
+func counterKey(key string) string {
+	return "gorush-" + key + "-count"
+}
 
 // New func implements the storage interface for gorush (https://github.com/appleboy/gorush)
 func New(config config.ConfYaml) *Storage {
@@ -27,25 +24,21 @@ func New(config config.ConfYaml) *Storage {
 	}
 }
 
-func getInt64(key string, count *int64) {
-	val, _ := redisClient.Get(key).Result()
-	*count, _ = strconv.ParseInt(val, 10, 64)
-}
-
 // Storage is interface structure
 type Storage struct {
 	config config.ConfYaml
+	client *redis.Client
 }
 
 // Init client storage.
 func (s *Storage) Init() error {
-	redisClient = redis.NewClient(&redis.Options{
+	s.client = redis.NewClient(&redis.Options{
 		Addr:     s.config.Stat.Redis.Addr,
 		Password: s.config.Stat.Redis.Password,
 		DB:       s.config.Stat.Redis.DB,
 	})
 
-	_, err := redisClient.Ping().Result()
+	_, err := s.client.Ping().Result()
 
 	if err != nil {
 		// redis server error
@@ -57,81 +50,241 @@ func (s *Storage) Init() error {
 	return nil
 }
 
-// Reset Client storage.
-func (s *Storage) Reset() {
-	redisClient.Set(TotalCountKey, strconv.Itoa(0), 0)
-	redisClient.Set(IosSuccessKey, strconv.Itoa(0), 0)
-	redisClient.Set(IosErrorKey, strconv.Itoa(0), 0)
-	redisClient.Set(AndroidSuccessKey, strconv.Itoa(0), 0)
-	redisClient.Set(AndroidErrorKey, strconv.Itoa(0), 0)
+// Close client storage.
+func (s *Storage) Close() error {
+	if s.client == nil {
+		return nil
+	}
+
+	return s.client.Close()
 }
 
-// AddTotalCount record push notification count.
-func (s *Storage) AddTotalCount(count int64) {
-	total := s.GetTotalCount() + count
-	redisClient.Set(TotalCountKey, strconv.Itoa(int(total)), 0)
+// Incr add counts to counters with INCRBY in one transaction.
+func (s *Storage) Incr(ctx context.Context, counts map[string]int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if len(counts) == 0 {
+		return nil
+	}
+
+	pipe := s.client.TxPipeline()
+	for key, count := range counts {
+		pipe.IncrBy(counterKey(key), count)
+		pipe.SAdd(CountersKey, counterKey(key))
+	}
+	_, err := pipe.Exec()
+
+	return err
 }
 
-// AddIosSuccess record counts of success iOS push notification.
-func (s *Storage) AddIosSuccess(count int64) {
-	total := s.GetIosSuccess() + count
-	redisClient.Set(IosSuccessKey, strconv.Itoa(int(total)), 0)
+// Counters return value of counters.
+func (s *Storage) Counters(ctx context.Context, keys ...string) (map[string]int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(keys))
+	if len(keys) == 0 {
+		return counts, nil
+	}
+
+	redisKeys := make([]string, len(keys))
+	for i, key := range keys {
+		redisKeys[i] = counterKey(key)
+	}
+
+	values, err := s.client.MGet(redisKeys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, key := range keys {
+		counts[key] = 0
+		value, ok := values[i].(string)
+		if !ok {
+			continue
+		}
+
+		count, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		counts[key] = count
+	}
+
+	return counts, nil
 }
 
-// AddIosError record counts of error iOS push notification.
-func (s *Storage) AddIosError(count int64) {
-	total := s.GetIosError() + count
-	redisClient.Set(IosErrorKey, strconv.Itoa(int(total)), 0)
+// DeleteCounters remove counters of keys.
+func (s *Storage) DeleteCounters(ctx context.Context, keys ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	redisKeys := make([]string, len(keys))
+	members := make([]interface{}, len(keys))
+	for i, key := range keys {
+		redisKeys[i] = counterKey(key)
+		members[i] = counterKey(key)
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.Del(redisKeys...)
+	pipe.SRem(CountersKey, members...)
+	_, err := pipe.Exec()
+
+	return err
 }
 
-// AddAndroidSuccess record counts of success Android push notification.
-func (s *Storage) AddAndroidSuccess(count int64) {
-	total := s.GetAndroidSuccess() + count
-	redisClient.Set(AndroidSuccessKey, strconv.Itoa(int(total)), 0)
+// Reset remove all counters.
+func (s *Storage) Reset(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	keys, err := s.client.SMembers(CountersKey).Result()
+	if err != nil {
+		return err
+	}
+
+	return s.client.Del(append(keys, CountersKey)...).Err()
 }
 
-// AddAndroidError record counts of error Android push notification.
-func (s *Storage) AddAndroidError(count int64) {
-	total := s.GetAndroidError() + count
-	redisClient.Set(AndroidErrorKey, strconv.Itoa(int(total)), 0)
+func recordKeys(bucket string) (string, string) {
+	return "gorush-" + bucket + "-data", "gorush-" + bucket + "-index"
 }
 
-// GetTotalCount show counts of all notification.
-func (s *Storage) GetTotalCount() int64 {
-	var count int64
-	getInt64(TotalCountKey, &count)
+// SetRecord store value under key in bucket.
+func (s *Storage) SetRecord(ctx context.Context, bucket, key string, value []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	dataKey, indexKey := recordKeys(bucket)
 
-	return count
+	pipe := s.client.TxPipeline()
+	pipe.HSet(dataKey, key, string(value))
+	pipe.ZAdd(indexKey, redis.Z{Score: 0, Member: key})
+	_, err := pipe.Exec()
+
+	return err
 }
 
-// GetIosSuccess show success counts of iOS notification.
-func (s *Storage) GetIosSuccess() int64 {
-	var count int64
-	getInt64(IosSuccessKey, &count)
+// createRecordScript adds key to index only if HSETNX stored it, so record
+// is never left without index.
+var createRecordScript = redis.NewScript(`
+if redis.call("HSETNX", KEYS[1], ARGV[1], ARGV[2]) == 0 then
+	return 0
+end
+redis.call("ZADD", KEYS[2], 0, ARGV[1])
+return 1
+`)
+
+// CreateRecord store value under key in bucket if key not exist. The script
+// makes it atomic across gorush instances sharing the same redis.
+func (s *Storage) CreateRecord(ctx context.Context, bucket, key string, value []byte) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	dataKey, indexKey := recordKeys(bucket)
 
-	return count
+	created, err := createRecordScript.Run(s.client, []string{dataKey, indexKey}, key, string(value)).Result()
+	if err != nil {
+		return false, err
+	}
+
+	return created == int64(1), nil
 }
 
-// GetIosError show error counts of iOS notification.
-func (s *Storage) GetIosError() int64 {
-	var count int64
-	getInt64(IosErrorKey, &count)
+// GetRecord return value of key in bucket, nil if key not exist.
+func (s *Storage) GetRecord(ctx context.Context, bucket, key string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
-	return count
+	dataKey, _ := recordKeys(bucket)
+
+	value, err := s.client.HGet(dataKey, key).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+
+	return value, err
 }
 
-// GetAndroidSuccess show success counts of Android notification.
-func (s *Storage) GetAndroidSuccess() int64 {
-	var count int64
-	getInt64(AndroidSuccessKey, &count)
+// DeleteRecord remove key from bucket.
+func (s *Storage) DeleteRecord(ctx context.Context, bucket, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	dataKey, indexKey := recordKeys(bucket)
 
-	return count
+	pipe := s.client.TxPipeline()
+	pipe.HDel(dataKey, key)
+	pipe.ZRem(indexKey, key)
+	_, err := pipe.Exec()
+
+	return err
 }
 
-// GetAndroidError show error counts of Android notification.
-func (s *Storage) GetAndroidError() int64 {
-	var count int64
-	getInt64(AndroidErrorKey, &count)
+// RangeRecords call fn in key order for every key in bucket with prefix
+// and greater than after. Iteration stops when fn returns false, fn must
+// not call back into the storage.
+func (s *Storage) RangeRecords(ctx context.Context, bucket, prefix, after string, fn func(key string, value []byte) bool) error {
+	dataKey, indexKey := recordKeys(bucket)
+
+	min := "-"
+	if after != "" && after >= prefix {
+		min = "(" + after
+	} else if prefix != "" {
+		min = "[" + prefix
+	}
+	max := "+"
+	if prefix != "" {
+		max = "[" + prefix + "\xff"
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		keys, err := s.client.ZRangeByLex(indexKey, redis.ZRangeBy{
+			Min:   min,
+			Max:   max,
+			Count: 100,
+		}).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			return nil
+		}
 
-	return count
+		values, err := s.client.HMGet(dataKey, keys...).Result()
+		if err != nil {
+			return err
+		}
+
+		for i, key := range keys {
+			value, ok := values[i].(string)
+			if !ok {
+				continue
+			}
+
+			if !fn(key, []byte(value)) {
+				return nil
+			}
+		}
+
+		min = "(" + keys[len(keys)-1]
+	}
 }
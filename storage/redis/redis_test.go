@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	c "github.com/lalit-verma/gorush/config"
+	"github.com/lalit-verma/gorush/storage"
+	"github.com/lalit-verma/gorush/storage/storagetest"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -18,40 +20,10 @@ func TestRedisServerError(t *testing.T) {
 }
 
 func TestRedisEngine(t *testing.T) {
-	var val int64
-
 	config := c.BuildDefaultPushConf()
 	config.Stat.Redis.Addr = "localhost:6379"
 
-	redis := New(config)
-	redis.Init()
-	redis.Reset()
-
-	redis.AddTotalCount(10)
-	val = redis.GetTotalCount()
-	assert.Equal(t, int64(10), val)
-	redis.AddTotalCount(10)
-	val = redis.GetTotalCount()
-	assert.Equal(t, int64(20), val)
-
-	redis.AddIosSuccess(20)
-	val = redis.GetIosSuccess()
-	assert.Equal(t, int64(20), val)
-
-	redis.AddIosError(30)
-	val = redis.GetIosError()
-	assert.Equal(t, int64(30), val)
-
-	redis.AddAndroidSuccess(40)
-	val = redis.GetAndroidSuccess()
-	assert.Equal(t, int64(40), val)
-
-	redis.AddAndroidError(50)
-	val = redis.GetAndroidError()
-	assert.Equal(t, int64(50), val)
-
-	// test reset db
-	redis.Reset()
-	val = redis.GetAndroidError()
-	assert.Equal(t, int64(0), val)
+	storagetest.Run(t, func() storage.Storage {
+		return New(config)
+	})
 }
@@ -0,0 +1,35 @@
+// Package storage defines the stat storage interface implemented by the
+// engines under storage/.
+package storage
+
+import "context"
+
+// Storage keeps push counters and records of gorush. Engines open their
+// handle in Init and keep it until Close.
+type Storage interface {
+	Init() error
+	Close() error
+
+	// Incr adds every count to its counter atomically, all counts of one
+	// call are written in a single batch.
+	Incr(ctx context.Context, counts map[string]int64) error
+	// Counters returns value of each key, missing counter is zero.
+	Counters(ctx context.Context, keys ...string) (map[string]int64, error)
+	// DeleteCounters removes counters of keys, missing counter is ignored.
+	DeleteCounters(ctx context.Context, keys ...string) error
+	// Reset removes all counters, records are kept.
+	Reset(ctx context.Context) error
+
+	// SetRecord stores value under key in bucket.
+	SetRecord(ctx context.Context, bucket, key string, value []byte) error
+	// CreateRecord stores value only if the key does not exist and returns
+	// false otherwise.
+	CreateRecord(ctx context.Context, bucket, key string, value []byte) (bool, error)
+	// GetRecord returns nil value if the key does not exist.
+	GetRecord(ctx context.Context, bucket, key string) ([]byte, error)
+	DeleteRecord(ctx context.Context, bucket, key string) error
+	// RangeRecords calls fn in ascending key order for every key in bucket
+	// with prefix and greater than after. Iteration stops when fn returns
+	// false, fn must not call back into the storage.
+	RangeRecords(ctx context.Context, bucket, prefix, after string, fn func(key string, value []byte) bool) error
+}
@@ -0,0 +1,328 @@
+// Package storagetest provides the conformance tests every storage engine
+// of gorush must pass.
+package storagetest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/lalit-verma/gorush/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// Run runs the conformance suite against storages returned by newStorage.
+// Every call must return a storage, not yet initialized, backed by the same
+// data so what one writes is visible to the next after Close.
+func Run(t *testing.T, newStorage func() storage.Storage) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s storage.Storage)
+	}{
+		{"Counters", testCounters},
+		{"ConcurrentIncr", testConcurrentIncr},
+		{"Records", testRecords},
+		{"RangeRecords", testRangeRecords},
+		{"CreateRecord", testCreateRecord},
+		{"CanceledContext", testCanceledContext},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newStorage()
+			if err := s.Init(); err != nil {
+				t.Fatalf("Init: %v", err)
+			}
+			defer func() {
+				assert.NoError(t, s.Close())
+			}()
+
+			assert.NoError(t, s.Reset(context.Background()))
+			test.fn(t, s)
+		})
+	}
+
+	t.Run("Reopen", func(t *testing.T) {
+		testReopen(t, newStorage)
+	})
+}
+
+func counters(t *testing.T, s storage.Storage, keys ...string) map[string]int64 {
+	counts, err := s.Counters(context.Background(), keys...)
+	assert.NoError(t, err)
+
+	return counts
+}
+
+// clearBucket removes records left in bucket by a previous run.
+func clearBucket(t *testing.T, s storage.Storage, bucket string) {
+	ctx := context.Background()
+
+	keys := []string{}
+	assert.NoError(t, s.RangeRecords(ctx, bucket, "", "", func(key string, value []byte) bool {
+		keys = append(keys, key)
+		return true
+	}))
+
+	for _, key := range keys {
+		assert.NoError(t, s.DeleteRecord(ctx, bucket, key))
+	}
+}
+
+func testCounters(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+
+	assert.Equal(t, map[string]int64{"total": 0}, counters(t, s, "total"))
+	assert.Equal(t, map[string]int64{}, counters(t, s))
+
+	assert.NoError(t, s.Incr(ctx, map[string]int64{"total": 10}))
+	assert.NoError(t, s.Incr(ctx, map[string]int64{"total": 10}))
+	assert.NoError(t, s.Incr(ctx, map[string]int64{
+		"ios-success":                20,
+		"ios-error":                  30,
+		"app-normal-android_fcm-ok":  8,
+		"app-normal-android_fcm-err": -1,
+	}))
+	assert.NoError(t, s.Incr(ctx, map[string]int64{}))
+
+	assert.Equal(t, map[string]int64{
+		"total":                      20,
+		"ios-success":                20,
+		"ios-error":                  30,
+		"app-normal-android_fcm-ok":  8,
+		"app-normal-android_fcm-err": -1,
+		"android-error":              0,
+	}, counters(t, s,
+		"total",
+		"ios-success",
+		"ios-error",
+		"app-normal-android_fcm-ok",
+		"app-normal-android_fcm-err",
+		"android-error",
+	))
+
+	assert.NoError(t, s.DeleteCounters(ctx, "ios-error", "missing"))
+	assert.NoError(t, s.DeleteCounters(ctx))
+	assert.Equal(t, map[string]int64{
+		"ios-success": 20,
+		"ios-error":   0,
+	}, counters(t, s, "ios-success", "ios-error"))
+
+	assert.NoError(t, s.Incr(ctx, map[string]int64{"ios-error": 1}))
+	assert.Equal(t, map[string]int64{"ios-error": 1}, counters(t, s, "ios-error"))
+
+	assert.NoError(t, s.Reset(ctx))
+	assert.Equal(t, map[string]int64{
+		"total":                     0,
+		"ios-success":               0,
+		"app-normal-android_fcm-ok": 0,
+	}, counters(t, s, "total", "ios-success", "app-normal-android_fcm-ok"))
+}
+
+func testConcurrentIncr(t *testing.T, s storage.Storage) {
+	const workers, loops = 8, 25
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < loops; j++ {
+				assert.NoError(t, s.Incr(context.Background(), map[string]int64{
+					"total":       1,
+					"ios-success": 2,
+				}))
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, map[string]int64{
+		"total":       workers * loops,
+		"ios-success": 2 * workers * loops,
+	}, counters(t, s, "total", "ios-success"))
+}
+
+func testRecords(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	clearBucket(t, s, "test")
+	clearBucket(t, s, "other")
+
+	value, err := s.GetRecord(ctx, "test", "a/1")
+	assert.NoError(t, err)
+	assert.Nil(t, value)
+
+	assert.NoError(t, s.SetRecord(ctx, "test", "a/1", []byte("one")))
+	assert.NoError(t, s.SetRecord(ctx, "other", "a/1", []byte("other")))
+
+	value, err = s.GetRecord(ctx, "test", "a/1")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("one"), value)
+
+	value, err = s.GetRecord(ctx, "other", "a/1")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("other"), value)
+
+	assert.NoError(t, s.SetRecord(ctx, "test", "a/1", []byte("two")))
+	value, err = s.GetRecord(ctx, "test", "a/1")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("two"), value)
+
+	// records are kept by Reset and do not show up as counters.
+	assert.NoError(t, s.Reset(ctx))
+	value, err = s.GetRecord(ctx, "test", "a/1")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("two"), value)
+
+	assert.NoError(t, s.DeleteRecord(ctx, "test", "a/1"))
+	assert.NoError(t, s.DeleteRecord(ctx, "test", "a/1"))
+	assert.NoError(t, s.DeleteRecord(ctx, "missing", "a/1"))
+	value, err = s.GetRecord(ctx, "test", "a/1")
+	assert.NoError(t, err)
+	assert.Nil(t, value)
+
+	value, err = s.GetRecord(ctx, "missing", "a/1")
+	assert.NoError(t, err)
+	assert.Nil(t, value)
+
+	clearBucket(t, s, "other")
+}
+
+func testRangeRecords(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	clearBucket(t, s, "test")
+
+	assert.NoError(t, s.SetRecord(ctx, "test", "a/2", []byte("two")))
+	assert.NoError(t, s.SetRecord(ctx, "test", "a/1", []byte("one")))
+	assert.NoError(t, s.SetRecord(ctx, "test", "a/3", []byte("three")))
+	assert.NoError(t, s.SetRecord(ctx, "test", "b/1", []byte("four")))
+
+	walk := func(prefix, after string, limit int) ([]string, []string) {
+		keys, values := []string{}, []string{}
+		assert.NoError(t, s.RangeRecords(ctx, "test", prefix, after, func(key string, value []byte) bool {
+			keys = append(keys, key)
+			values = append(values, string(value))
+			return limit == 0 || len(keys) < limit
+		}))
+
+		return keys, values
+	}
+
+	keys, values := walk("", "", 0)
+	assert.Equal(t, []string{"a/1", "a/2", "a/3", "b/1"}, keys)
+	assert.Equal(t, []string{"one", "two", "three", "four"}, values)
+
+	keys, _ = walk("a/", "", 0)
+	assert.Equal(t, []string{"a/1", "a/2", "a/3"}, keys)
+
+	keys, _ = walk("a/", "a/1", 0)
+	assert.Equal(t, []string{"a/2", "a/3"}, keys)
+
+	keys, _ = walk("", "a/3", 0)
+	assert.Equal(t, []string{"b/1"}, keys)
+
+	keys, _ = walk("", "", 3)
+	assert.Equal(t, []string{"a/1", "a/2", "a/3"}, keys)
+
+	keys, _ = walk("c/", "", 0)
+	assert.Equal(t, []string{}, keys)
+
+	assert.NoError(t, s.RangeRecords(ctx, "missing", "", "", func(key string, value []byte) bool {
+		t.Errorf("unexpected key %s", key)
+		return true
+	}))
+
+	clearBucket(t, s, "test")
+}
+
+func testCreateRecord(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	clearBucket(t, s, "test")
+
+	created, err := s.CreateRecord(ctx, "test", "a/1", []byte("one"))
+	assert.NoError(t, err)
+	assert.True(t, created)
+
+	created, err = s.CreateRecord(ctx, "test", "a/1", []byte("two"))
+	assert.NoError(t, err)
+	assert.False(t, created)
+
+	value, err := s.GetRecord(ctx, "test", "a/1")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("one"), value)
+
+	// only one of concurrent creates wins.
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	wins := 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			created, err := s.CreateRecord(ctx, "test", "a/2", []byte(fmt.Sprintf("%d", i)))
+			assert.NoError(t, err)
+			if created {
+				lock.Lock()
+				wins++
+				lock.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 1, wins)
+
+	clearBucket(t, s, "test")
+}
+
+func testCanceledContext(t *testing.T, s storage.Storage) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.Error(t, s.Incr(ctx, map[string]int64{"total": 1}))
+	_, err := s.Counters(ctx, "total")
+	assert.Error(t, err)
+	assert.Error(t, s.DeleteCounters(ctx, "total"))
+	assert.Error(t, s.Reset(ctx))
+	assert.Error(t, s.SetRecord(ctx, "test", "a/1", []byte("one")))
+	_, err = s.CreateRecord(ctx, "test", "a/1", []byte("one"))
+	assert.Error(t, err)
+	_, err = s.GetRecord(ctx, "test", "a/1")
+	assert.Error(t, err)
+	assert.Error(t, s.DeleteRecord(ctx, "test", "a/1"))
+	assert.Error(t, s.RangeRecords(ctx, "test", "", "", func(key string, value []byte) bool {
+		return true
+	}))
+
+	// nothing was written with the canceled context.
+	assert.Equal(t, map[string]int64{"total": 0}, counters(t, s, "total"))
+}
+
+func testReopen(t *testing.T, newStorage func() storage.Storage) {
+	ctx := context.Background()
+
+	s := newStorage()
+	if err := s.Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	assert.NoError(t, s.Reset(ctx))
+	assert.NoError(t, s.Incr(ctx, map[string]int64{"total": 5}))
+	assert.NoError(t, s.SetRecord(ctx, "test", "a/1", []byte("one")))
+	assert.NoError(t, s.Close())
+
+	s = newStorage()
+	if err := s.Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	assert.Equal(t, map[string]int64{"total": 5}, counters(t, s, "total"))
+	value, err := s.GetRecord(ctx, "test", "a/1")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("one"), value)
+
+	assert.NoError(t, s.Reset(ctx))
+	clearBucket(t, s, "test")
+}